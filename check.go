@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/agent"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/rest"
+)
+
+// Exit codes of the check command
+const (
+	checkExitNotTerminating  = 0
+	checkExitTerminating     = 2
+	checkExitCannotDetermine = 3
+)
+
+// cannotDetermine returns an error exiting with checkExitCannotDetermine. Errors of the check
+// command exit with it rather than exitConfigError, which is the code of a terminating instance.
+func cannotDetermine(err error) error {
+	return &exitError{code: checkExitCannotDetermine, err: err}
+}
+
+// newCheckCommand constructs the command polling the termination notice endpoint once
+func newCheckCommand(opts *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Poll the termination notice endpoint once and report whether the instance is terminating",
+		Long: fmt.Sprintf(`Poll the termination notice endpoint once and report whether the instance is terminating.
+
+The exit code is %d if the instance is not marked for termination, %d if it is
+and %d if the termination notice endpoint could not be checked.`, checkExitNotTerminating, checkExitTerminating, checkExitCannotDetermine),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if err := cobra.NoArgs(cmd, args); err != nil {
+				return cannotDetermine(err)
+			}
+			return nil
+		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.complete(cmd); err != nil {
+				return cannotDetermine(err)
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			os.Exit(runCheck(opts))
+		},
+	}
+	cmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return cannotDetermine(err)
+	})
+	return cmd
+}
+
+// runCheck polls the termination notice endpoint once and returns the exit code
+func runCheck(opts *rootOptions) int {
+	logger := opts.logger
+
+	// The API server is only needed to read the configuration from a ConfigMap or a
+	// TerminationHandlerConfig
+	var cfg *rest.Config
+	if opts.configMap != "" || opts.handlerConfig != "" {
+		var err error
+		cfg, err = opts.restConfig()
+		if err != nil {
+			logger.Error(err, "Error getting configuration")
+			return checkExitCannotDetermine
+		}
+	}
+	if _, err := opts.loadConfig(cfg); err != nil {
+		logger.Error(err, "Error loading configuration")
+		return checkExitCannotDetermine
+	}
+	conf := opts.conf
+	registerExecProvider(conf)
+
+	httpClient, err := pollClient(conf)
+	if err != nil {
+		logger.Error(err, "Error constructing metadata client")
+		return checkExitCannotDetermine
+	}
+
+	notice, err := agent.CheckTermination(context.Background(), logger, httpClient, conf.CloudProvider, conf.Metadata.URL(conf.CloudProvider), conf.NodeName)
+	if err != nil {
+		logger.Error(err, "Error checking termination notice endpoint")
+		fmt.Println("unknown")
+		return checkExitCannotDetermine
+	}
+	if notice == nil {
+		fmt.Println("not terminating")
+		return checkExitNotTerminating
+	}
+
+	if notice.Deadline.IsZero() {
+		fmt.Printf("terminating (%s)\n", notice.EventType)
+	} else {
+		fmt.Printf("terminating (%s) at %s\n", notice.EventType, notice.Deadline.UTC().Format(time.RFC3339))
+	}
+	return checkExitTerminating
+}
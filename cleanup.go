@@ -0,0 +1,68 @@
+//go:build !lite
+// +build !lite
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/agent"
+	"github.com/spf13/cobra"
+)
+
+// newCleanupCommand constructs the command removing stale terminating conditions from the nodes of the cluster
+func newCleanupCommand(opts *rootOptions) *cobra.Command {
+	cleanupOpts := agent.CleanupOptions{
+		GracePeriod: 15 * time.Minute,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "Remove stale terminating conditions from the nodes of the cluster",
+		Long: `Remove stale terminating conditions from the nodes of the cluster.
+
+Terminating conditions are left behind when an interruption is cancelled, after a
+simulation or when the handler misbehaves, and keep the node marked for deletion.
+A condition is stale when the node is still reported ready by its kubelet longer than
+the grace period after the deadline of the termination notice, or after the condition
+was added if the deadline is unknown. The notice annotation is removed with the condition.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCleanup(opts, cleanupOpts)
+		},
+	}
+	cmd.Flags().DurationVar(&cleanupOpts.GracePeriod, "grace-period", cleanupOpts.GracePeriod, "time after the expected termination an instance has to keep running before its terminating condition is considered stale")
+	cmd.Flags().BoolVar(&cleanupOpts.DryRun, "dry-run", cleanupOpts.DryRun, "only report the stale conditions, without removing them")
+	return cmd
+}
+
+// runCleanup removes the stale terminating conditions and reports them
+func runCleanup(opts *rootOptions, cleanupOpts agent.CleanupOptions) error {
+	cfg, err := opts.restConfig()
+	if err != nil {
+		return configError("error getting configuration: %w", err)
+	}
+	if _, err := opts.loadConfig(cfg); err != nil {
+		return configError("error loading configuration: %w", err)
+	}
+	cleanupOpts.ConditionType = opts.conf.Condition.Type
+
+	stale, err := agent.CleanupStaleConditions(context.Background(), opts.logger, cfg, cleanupOpts)
+	verb := "removed"
+	if cleanupOpts.DryRun {
+		verb = "stale"
+	}
+	for _, condition := range stale {
+		fmt.Printf("%s: %s, expected termination at %s, ready at %s\n", condition.Node, verb,
+			condition.ExpectedTermination.UTC().Format(time.RFC3339), condition.LastHeartbeat.UTC().Format(time.RFC3339))
+	}
+	if err != nil {
+		return fmt.Errorf("error cleaning up stale conditions: %w", err)
+	}
+	if len(stale) == 0 {
+		fmt.Println("No stale terminating conditions found")
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// fake-metadata serves a fake instance metadata service emulating the termination notice
+// endpoints of AWS, Azure and GCP along a scripted timeline, for end-to-end runs and game
+// days. Point the handler at it with --aws-metadata-url, --azure-metadata-url or
+// --gcp-metadata-url.
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/testutil/fakeimds"
+	"github.com/alexander-demichev/termination-handler/pkg/version"
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCommand() *cobra.Command {
+	var (
+		address  string
+		timeline string
+		opts     fakeimds.Options
+	)
+
+	cmd := &cobra.Command{
+		Use:   "fake-metadata",
+		Short: "Serve a fake instance metadata service emulating termination notices",
+		Long: `Serve a fake instance metadata service emulating termination notices.
+
+The instance starts without advisory or termination notice and follows the timeline, a
+comma separated list of phase@offset steps. The phases are none, advisory, maintenance and
+terminating, e.g. "advisory@10s,terminating@30s" recommends a rebalance after 10s and
+interrupts the instance after 30s. Maintenance schedules an Azure reboot or a GCP host
+maintenance. The phase can also be switched while running:
+
+  curl -X POST "http://ADDRESS` + fakeimds.ControlPath + `?phase=terminating"
+
+For soak runs, --repeat restarts the timeline periodically and --failure-rate and
+--max-latency inject transient failures. The number of runs of the timeline, reported
+by the control endpoint, can be compared with the terminations_detected_total metric of
+the handler, and its go_goroutines and process_resident_memory_bytes metrics watched for
+growth.`,
+		Version:      version.String(),
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			steps, err := fakeimds.ParseTimeline(timeline)
+			if err != nil {
+				return fmt.Errorf("invalid timeline: %v", err)
+			}
+
+			log.Printf("Serving fake metadata service on %s", address)
+			return http.ListenAndServe(address, logRequests(fakeimds.New(steps, opts)))
+		},
+	}
+	cmd.SetVersionTemplate("{{.Version}}\n")
+	cmd.Flags().StringVar(&address, "address", "127.0.0.1:8090", "address the metadata service binds to")
+	cmd.Flags().StringVar(&timeline, "timeline", "", "comma separated phase@offset steps followed from the start, e.g. advisory@10s,terminating@30s")
+	cmd.Flags().DurationVar(&opts.NoticePeriod, "notice-period", 2*time.Minute, "time between the start of the terminating or maintenance phase and its deadline")
+	cmd.Flags().DurationVar(&opts.Repeat, "repeat", 0, "interval at which the timeline restarts, for soak runs going through many interruptions. If unspecified, the timeline runs once.")
+	cmd.Flags().Float64Var(&opts.FailureRate, "failure-rate", 0, "fraction of requests failed with a server error or a dropped connection, e.g. 0.05")
+	cmd.Flags().DurationVar(&opts.MaxLatency, "max-latency", 0, "maximum random delay added to every request")
+	return cmd
+}
+
+// logRequests logs every request with the phase it was served in
+func logRequests(server *fakeimds.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		phase, _ := server.Phase()
+		log.Printf("%s %s (%s)", r.Method, r.URL.Path, phase)
+		server.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,220 @@
+//go:build !lite
+// +build !lite
+
+// kubectl-termination is a kubectl plugin inspecting the termination handling of the nodes
+// of a cluster. Installed on the PATH, it is run as "kubectl termination". It is not built with
+// the lite tag, which leaves out the inspection of nodes.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/agent"
+	"github.com/alexander-demichev/termination-handler/pkg/version"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// pluginOptions holds the configuration shared by every subcommand
+type pluginOptions struct {
+	kubeconfig    string
+	kubeContext   string
+	conditionType string
+	all           bool
+}
+
+func main() {
+	if err := newRootCommand(&pluginOptions{}).Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// newRootCommand constructs the root command, which lists the terminating nodes
+func newRootCommand(opts *pluginOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "kubectl-termination",
+		Short:        "Inspect the termination handling of the nodes of the cluster",
+		Version:      version.String(),
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runList(opts)
+		},
+	}
+	cmd.SetVersionTemplate("{{.Version}}\n")
+	cmd.PersistentFlags().StringVar(&opts.kubeconfig, "kubeconfig", "", "path to the kubeconfig, the default loading rules apply if empty")
+	cmd.PersistentFlags().StringVar(&opts.kubeContext, "context", "", "name of the kubeconfig context to use, the current context if empty")
+	cmd.PersistentFlags().StringVar(&opts.conditionType, "condition-type", "", "type of the terminating condition, as set with the handler's --condition-type")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List the nodes marked for termination, paused or cordoned",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runList(opts)
+		},
+	}
+	list.Flags().BoolVarP(&opts.all, "all", "A", false, "list every node")
+
+	cmd.AddCommand(
+		list,
+		&cobra.Command{
+			Use:   "events NODE",
+			Short: "Show the events recorded by the handler for a node",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return runEvents(opts, args[0])
+			},
+		},
+		&cobra.Command{
+			Use:   "pause NODE",
+			Short: "Pause the actions of the handler on a node",
+			Long: `Pause the actions of the handler on a node.
+
+Termination notices are still detected on a paused node, but the node is not marked,
+cordoned or drained until the handling is resumed.`,
+			Args: cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return runSetPaused(opts, args[0], true)
+			},
+		},
+		&cobra.Command{
+			Use:   "resume NODE",
+			Short: "Resume the actions of the handler on a paused node",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return runSetPaused(opts, args[0], false)
+			},
+		},
+	)
+	return cmd
+}
+
+// clientset constructs a clientset from the kubeconfig
+func (o *pluginOptions) clientset() (kubernetes.Interface, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = o.kubeconfig
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: o.kubeContext}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubeconfig: %v", err)
+	}
+	return kubernetes.NewForConfig(cfg)
+}
+
+// runList prints the termination handling of the nodes
+func runList(opts *pluginOptions) error {
+	clientset, err := opts.clientset()
+	if err != nil {
+		return err
+	}
+	nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing nodes: %v", err)
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tTERMINATING\tEVENT\tDEADLINE\tPAUSED\tCORDONED\tTAINTS")
+	for i := range nodes.Items {
+		t := agent.InspectNode(&nodes.Items[i], opts.conditionType)
+		if !opts.all && !t.Terminating() && !t.Paused && !t.Cordoned {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%t\t%s\n", t.Node, conditionStatus(t.Condition), orNone(eventType(t)), deadline(t.Deadline, now), t.Paused, t.Cordoned, orNone(taints(t.Taints)))
+	}
+	return w.Flush()
+}
+
+// runEvents prints the events recorded by the handler for the node
+func runEvents(opts *pluginOptions, nodeName string) error {
+	clientset, err := opts.clientset()
+	if err != nil {
+		return err
+	}
+	events, err := agent.NodeEvents(context.TODO(), clientset, nodeName)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		fmt.Printf("No events recorded by the handler for node %s\n", nodeName)
+		return nil
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "LAST SEEN\tTYPE\tREASON\tCOUNT\tMESSAGE")
+	for _, event := range events {
+		lastSeen := event.LastTimestamp.Time
+		if lastSeen.IsZero() {
+			lastSeen = event.EventTime.Time
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", duration.HumanDuration(now.Sub(lastSeen)), event.Type, event.Reason, event.Count, event.Message)
+	}
+	return w.Flush()
+}
+
+// runSetPaused pauses or resumes the handler on the node
+func runSetPaused(opts *pluginOptions, nodeName string, paused bool) error {
+	clientset, err := opts.clientset()
+	if err != nil {
+		return err
+	}
+	if err := agent.SetNodePaused(context.TODO(), clientset, nodeName, paused); err != nil {
+		return err
+	}
+	if paused {
+		fmt.Printf("node/%s paused\n", nodeName)
+	} else {
+		fmt.Printf("node/%s resumed\n", nodeName)
+	}
+	return nil
+}
+
+func conditionStatus(condition *corev1.NodeCondition) string {
+	if condition == nil {
+		return "<none>"
+	}
+	return string(condition.Status)
+}
+
+func eventType(t agent.NodeTermination) string {
+	if t.Simulated {
+		return t.EventType + " (simulated)"
+	}
+	return t.EventType
+}
+
+// deadline formats the deadline relative to now
+func deadline(deadline *time.Time, now time.Time) string {
+	if deadline == nil {
+		return "<unknown>"
+	}
+	if deadline.Before(now) {
+		return fmt.Sprintf("%s ago", duration.HumanDuration(now.Sub(*deadline)))
+	}
+	return fmt.Sprintf("in %s", duration.HumanDuration(deadline.Sub(now)))
+}
+
+func taints(taints []corev1.Taint) string {
+	var keys []string
+	for _, taint := range taints {
+		keys = append(keys, taint.Key+":"+string(taint.Effect))
+	}
+	return strings.Join(keys, ",")
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
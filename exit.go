@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Exit codes of the termination handler, so the kubelet restarts the pod and
+// automation can tell configuration errors from errors while running
+const (
+	exitRuntimeError = 1
+	exitConfigError  = 2
+)
+
+// exitError is an error terminating the process with a specific exit code
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// configError returns an error exiting with exitConfigError
+func configError(format string, args ...interface{}) error {
+	return &exitError{code: exitConfigError, err: fmt.Errorf(format, args...)}
+}
+
+// exitCode returns the exit code for an error returned by a command
+func exitCode(err error) int {
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitRuntimeError
+}
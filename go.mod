@@ -3,14 +3,22 @@ module github.com/alexander-demichev/termination-handler
 go 1.13
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.2.0
+	github.com/evanphx/json-patch v4.9.0+incompatible
 	github.com/go-logr/logr v0.2.0
 	github.com/matttproud/golang_protobuf_extensions v1.0.2-0.20181231171920-c182affec369 // indirect
-	github.com/prometheus/client_golang v1.7.1 // indirect
+	github.com/nats-io/nats.go v1.10.0
+	github.com/prometheus/client_golang v1.7.1
+	github.com/robfig/cron/v3 v3.0.1
+	github.com/spf13/cobra v1.0.0
+	github.com/spf13/pflag v1.0.5
 	go.uber.org/atomic v1.4.0 // indirect
 	golang.org/x/oauth2 v0.0.0-20200902213428-5d25da1a8d43 // indirect
+	golang.org/x/time v0.0.0-20191024005414-555d28b269f0
 	k8s.io/api v0.19.0
 	k8s.io/apimachinery v0.19.0
 	k8s.io/client-go v0.19.0
 	k8s.io/klog v1.0.0
 	sigs.k8s.io/controller-runtime v0.5.10
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -0,0 +1,192 @@
+//go:build !lite
+// +build !lite
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/alexander-demichev/termination-handler/pkg/agent"
+	"github.com/alexander-demichev/termination-handler/pkg/apis/v1alpha1"
+	"github.com/alexander-demichev/termination-handler/pkg/config"
+	"github.com/alexander-demichev/termination-handler/pkg/providers"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// --kubeconfig is registered on the Go flag set by controller-runtime
+
+// loadRESTConfig loads the configuration to talk to the API server with the kubeconfig context
+func loadRESTConfig(context string) (*rest.Config, error) {
+	return clientconfig.GetConfigWithContext(context)
+}
+
+// newConfigMapLoader constructs a loader reading the configuration from a ConfigMap
+func newConfigMapLoader(cfg *rest.Config, namespace, name, key string) (*config.Loader, error) {
+	c, err := client.New(cfg, client.Options{Scheme: clientgoscheme.Scheme})
+	if err != nil {
+		return nil, fmt.Errorf("error creating client: %v", err)
+	}
+	return config.NewConfigMapLoader(c, namespace, name, key, flag.CommandLine), nil
+}
+
+// newHandlerConfigLoader constructs a loader reading the configuration from a
+// TerminationHandlerConfig with the overrides of the pools of the node named nodeName
+func newHandlerConfigLoader(cfg *rest.Config, name, nodeName string) (*config.Loader, error) {
+	c, err := client.New(cfg, client.Options{Scheme: managerScheme})
+	if err != nil {
+		return nil, fmt.Errorf("error creating client: %v", err)
+	}
+	return config.NewHandlerConfigLoader(c, name, nodeName, flag.CommandLine), nil
+}
+
+// runInterruptionStats runs the interruption statistics exporter until stopped
+func runInterruptionStats(logger logr.Logger, cfg *rest.Config, conf *config.Config, stop <-chan struct{}) error {
+	stats := conf.InterruptionStats
+	exporter, err := agent.NewInterruptionStatsExporter(logger, cfg, stats.Window.Duration, stats.Interval.Duration, stats.NodePoolLabel, conf.Condition.Type, stats.ReportNamespace, stats.ReportName)
+	if err != nil {
+		return fmt.Errorf("error constructing interruption statistics exporter: %w", err)
+	}
+
+	serveMetrics(logger, conf.Metrics.BindAddress, nil)
+
+	if err := exporter.Run(stop); err != nil {
+		return fmt.Errorf("error running interruption statistics exporter: %w", err)
+	}
+	return nil
+}
+
+// managerScheme is the scheme of the managers of the NodeTermination controller and the
+// binding webhook, it knows about the core types and the termination handler API types
+var managerScheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(managerScheme))
+	utilruntime.Must(v1alpha1.AddToScheme(managerScheme))
+}
+
+// runNodeTerminationController runs the NodeTermination controller until stopped
+func runNodeTerminationController(logger logr.Logger, cfg *rest.Config, conf *config.Config, stop <-chan struct{}) error {
+	mgr, err := manager.New(cfg, manager.Options{Scheme: managerScheme, MetricsBindAddress: "0"})
+	if err != nil {
+		return fmt.Errorf("error constructing manager: %w", err)
+	}
+	reconciler, err := agent.NewNodeTerminationReconciler(logger, mgr, conditionOptions(conf))
+	if err != nil {
+		return configError("error constructing NodeTermination controller: %w", err)
+	}
+	if err := reconciler.SetupWithManager(mgr, conf.NodeTerminations.Workers); err != nil {
+		return fmt.Errorf("error setting up NodeTermination controller: %w", err)
+	}
+
+	serveMetrics(logger, conf.Metrics.BindAddress, nil)
+
+	run := mgr.Start
+	if conf.LeaderElection.Enabled {
+		run = func(stop <-chan struct{}) error {
+			return runLeaderElected(logger, cfg, conf, stop, mgr.Start)
+		}
+	}
+	if err := run(stop); err != nil {
+		return fmt.Errorf("error running NodeTermination controller: %w", err)
+	}
+	return nil
+}
+
+// runConfigController runs the controller validating the TerminationHandlerConfigs until
+// stopped. Every replica validates them, the result only depends on the spec.
+func runConfigController(logger logr.Logger, cfg *rest.Config, conf *config.Config, stop <-chan struct{}) error {
+	mgr, err := manager.New(cfg, manager.Options{Scheme: managerScheme, MetricsBindAddress: "0"})
+	if err != nil {
+		return fmt.Errorf("error constructing manager: %w", err)
+	}
+	reconciler := agent.NewHandlerConfigReconciler(logger, mgr, config.ValidateHandlerConfig)
+	if err := reconciler.SetupWithManager(mgr); err != nil {
+		return fmt.Errorf("error setting up configuration controller: %w", err)
+	}
+
+	serveMetrics(logger, conf.Metrics.BindAddress, nil)
+
+	if err := mgr.Start(stop); err != nil {
+		return fmt.Errorf("error running configuration controller: %w", err)
+	}
+	return nil
+}
+
+// runBindingWebhook serves the binding webhook until stopped. Every replica serves it, the
+// webhook only reads.
+func runBindingWebhook(logger logr.Logger, cfg *rest.Config, conf *config.Config, stop <-chan struct{}) error {
+	webhook := conf.BindingWebhook
+	mgr, err := manager.New(cfg, manager.Options{
+		Scheme:             managerScheme,
+		MetricsBindAddress: "0",
+		Port:               webhook.Port,
+		CertDir:            webhook.CertDir,
+	})
+	if err != nil {
+		return fmt.Errorf("error constructing manager: %w", err)
+	}
+	validator, err := agent.NewBindingValidator(logger, mgr, conf.Condition.Type)
+	if err != nil {
+		return fmt.Errorf("error constructing binding webhook: %w", err)
+	}
+	validator.SetupWithManager(mgr)
+
+	serveMetrics(logger, conf.Metrics.BindAddress, nil)
+
+	if err := mgr.Start(stop); err != nil {
+		return fmt.Errorf("error running binding webhook: %w", err)
+	}
+	return nil
+}
+
+// newCentralHandler constructs the handler of every node of the cluster, polling the exec
+// provider plugin for the termination notices of their instances. Central handlers always use
+// the exec provider, validation rejects any other cloud provider.
+func newCentralHandler(logger logr.Logger, cfg *rest.Config, conf *config.Config, opts agent.Options) (fleetHandler, error) {
+	plugin := conf.ExecProvider
+	fleet, err := providers.NewExecFleet(plugin.Command, plugin.Args, plugin.EventType)
+	if err != nil {
+		return nil, configError("error constructing fleet provider: %w", err)
+	}
+	handler, err := agent.NewCentralHandler(logger, cfg, fleet, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error constructing central termination handler: %w", err)
+	}
+	return handler, nil
+}
+
+// newManagementHandler constructs the handler of the Machines of the workload clusters of a
+// Cluster API management cluster, polling the exec provider plugin for the termination
+// notices of their instances
+func newManagementHandler(logger logr.Logger, cfg *rest.Config, conf *config.Config, opts agent.Options) (fleetHandler, error) {
+	plugin := conf.ExecProvider
+	fleet, err := providers.NewExecFleet(plugin.Command, plugin.Args, plugin.EventType)
+	if err != nil {
+		return nil, configError("error constructing fleet provider: %w", err)
+	}
+	handler, err := agent.NewManagementHandler(logger, cfg, fleet, conf.Management.Target, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error constructing management cluster termination handler: %w", err)
+	}
+	return handler, nil
+}
+
+// runLeaderElected runs the handler with run once this replica is elected leader
+func runLeaderElected(logger logr.Logger, cfg *rest.Config, conf *config.Config, stop <-chan struct{}, run func(stop <-chan struct{}) error) error {
+	le := conf.LeaderElection
+	return agent.RunLeaderElected(logger, cfg, agent.LeaderElectionOptions{
+		Namespace:     le.Namespace,
+		Name:          le.Name,
+		LeaseDuration: le.LeaseDuration.Duration,
+		RenewDeadline: le.RenewDeadline.Duration,
+		RetryPeriod:   le.RetryPeriod.Duration,
+	}, stop, run)
+}
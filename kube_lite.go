@@ -0,0 +1,95 @@
+//go:build lite
+// +build lite
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/alexander-demichev/termination-handler/pkg/agent"
+	"github.com/alexander-demichev/termination-handler/pkg/config"
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// kubeconfig is the path of a kubeconfig, registered here as lite builds do not import
+// controller-runtime, which registers it in default builds
+var kubeconfig = flag.String("kubeconfig", "", "Paths to a kubeconfig. Only required if out-of-cluster.")
+
+// loadRESTConfig loads the configuration to talk to the API server with the kubeconfig context
+func loadRESTConfig(context string) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if *kubeconfig != "" {
+		rules.ExplicitPath = *kubeconfig
+	}
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: context}).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	// Match the defaults of default builds
+	if cfg.QPS == 0 {
+		cfg.QPS = 20
+		cfg.Burst = 30
+	}
+	return cfg, nil
+}
+
+// newConfigMapLoader is not supported in lite builds
+func newConfigMapLoader(cfg *rest.Config, namespace, name, key string) (*config.Loader, error) {
+	return nil, fmt.Errorf("--config-map is not supported in lite builds, use --config")
+}
+
+// runInterruptionStats is not supported in lite builds
+func runInterruptionStats(logger logr.Logger, cfg *rest.Config, conf *config.Config, stop <-chan struct{}) error {
+	return configError("interruption statistics are not supported in lite builds")
+}
+
+// runNodeTerminationController is not supported in lite builds
+func runNodeTerminationController(logger logr.Logger, cfg *rest.Config, conf *config.Config, stop <-chan struct{}) error {
+	return configError("the NodeTermination controller is not supported in lite builds")
+}
+
+// newHandlerConfigLoader is not supported in lite builds
+func newHandlerConfigLoader(cfg *rest.Config, name, nodeName string) (*config.Loader, error) {
+	return nil, fmt.Errorf("--handler-config is not supported in lite builds, use --config")
+}
+
+// runConfigController is not supported in lite builds
+func runConfigController(logger logr.Logger, cfg *rest.Config, conf *config.Config, stop <-chan struct{}) error {
+	return configError("the configuration controller is not supported in lite builds")
+}
+
+// runBindingWebhook is not supported in lite builds
+func runBindingWebhook(logger logr.Logger, cfg *rest.Config, conf *config.Config, stop <-chan struct{}) error {
+	return configError("the binding webhook is not supported in lite builds")
+}
+
+// newCentralHandler is not supported in lite builds
+func newCentralHandler(logger logr.Logger, cfg *rest.Config, conf *config.Config, opts agent.Options) (fleetHandler, error) {
+	return nil, configError("central handlers are not supported in lite builds")
+}
+
+// newManagementHandler is not supported in lite builds
+func newManagementHandler(logger logr.Logger, cfg *rest.Config, conf *config.Config, opts agent.Options) (fleetHandler, error) {
+	return nil, configError("management cluster handlers are not supported in lite builds")
+}
+
+// newCleanupCommand constructs the cleanup command, which is not supported in lite builds
+func newCleanupCommand(opts *rootOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "cleanup",
+		Short: "Remove stale terminating conditions from the nodes of the cluster (not supported in lite builds)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return configError("cleanup is not supported in lite builds")
+		},
+	}
+}
+
+// runLeaderElected is not supported in lite builds
+func runLeaderElected(logger logr.Logger, cfg *rest.Config, conf *config.Config, stop <-chan struct{}, run func(stop <-chan struct{}) error) error {
+	return configError("leader election is not supported in lite builds")
+}
@@ -1,47 +1,235 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/alexander-demichev/termination-handler/pkg/termination"
+	"github.com/alexander-demichev/termination-handler/pkg/config"
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/alexander-demichev/termination-handler/pkg/providers"
+	"github.com/alexander-demichev/termination-handler/pkg/version"
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/rest"
 	"k8s.io/klog"
 	"k8s.io/klog/klogr"
-	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/client/config"
 )
 
+// rootOptions holds the configuration shared by every subcommand
+type rootOptions struct {
+	logger logr.Logger
+	conf   *config.Config
+
+	configFile           string
+	configMap            string
+	configMapKey         string
+	handlerConfig        string
+	configReloadInterval time.Duration
+	kubeContext          string
+	kubeAPIQPS           float64
+	kubeAPIBurst         int
+	kubeAPITimeout       time.Duration
+}
+
 func main() {
 	klog.InitFlags(nil)
-	logger := klogr.New()
-
-	pollIntervalSeconds := flag.Int64("poll-interval-seconds", 5, "interval in seconds at which termination notice endpoint should be checked (Default: 5)")
-	nodeName := flag.String("node-name", "", "name of the node that the termination handler is running on")
-	namespace := flag.String("namespace", "", "namespace that the machine for the node should live in. If unspecified, the look for machines across all namespaces.")
-	cloudProvider := flag.String("cloud-provider", "", "name of the cloud provider that the termination handler is running on")
 	flag.Set("logtostderr", "true")
-	flag.Parse()
 
-	// Get a config to talk to the apiserver
-	cfg, err := config.GetConfig()
+	opts := &rootOptions{
+		logger: klogr.New(),
+		conf:   config.Default(),
+	}
+	if err := newRootCommand(opts).Execute(); err != nil {
+		os.Exit(exitCode(err))
+	}
+}
+
+// newRootCommand constructs the root command. Running it without a subcommand
+// runs the handler, so existing deployments keep working.
+func newRootCommand(opts *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "termination-handler",
+		Short:        "Marks nodes for deletion when the cloud provider is about to terminate their instance",
+		Version:      version.String(),
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return opts.complete(cmd)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runHandler(opts)
+		},
+	}
+	cmd.SetVersionTemplate("{{.Version}}\n")
+	cmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return configError("%v", err)
+	})
+
+	// The configuration is bound to the Go flag set as the configuration loader and the
+	// environment overrides rely on it to know which flags were set on the command line
+	opts.conf.BindFlags(flag.CommandLine)
+	flag.StringVar(&opts.configFile, "config", "", "path to a YAML configuration file. Flags take precedence over values in the file.")
+	flag.StringVar(&opts.configMap, "config-map", "", "namespace/name of a ConfigMap holding the YAML configuration. Flags take precedence over values in the ConfigMap.")
+	flag.StringVar(&opts.configMapKey, "config-map-key", "config.yaml", "key of the ConfigMap holding the YAML configuration")
+	flag.StringVar(&opts.handlerConfig, "handler-config", "", "name of a TerminationHandlerConfig holding the configuration, with the overrides of the pools selecting the node. Flags take precedence over values in the TerminationHandlerConfig.")
+	flag.DurationVar(&opts.configReloadInterval, "config-reload-interval", 10*time.Second, "interval at which the configuration file, ConfigMap or TerminationHandlerConfig is checked for changes. Poll interval, unreachable threshold and log verbosity changes are applied without a restart.")
+	flag.StringVar(&opts.kubeContext, "context", "", "name of the kubeconfig context to use when running outside of the cluster, the current context if empty")
+	flag.Float64Var(&opts.kubeAPIQPS, "kube-api-qps", 0, "maximum queries per second to the API server, 20 if zero")
+	flag.IntVar(&opts.kubeAPIBurst, "kube-api-burst", 0, "maximum burst of queries to the API server, 30 if zero")
+	flag.DurationVar(&opts.kubeAPITimeout, "kube-api-timeout", 0, "timeout of requests to the API server, no timeout if zero")
+	cmd.PersistentFlags().AddGoFlagSet(flag.CommandLine)
+	cmd.PersistentFlags().MarkDeprecated("poll-interval-seconds", "use --poll-interval instead")
+
+	cmd.AddCommand(
+		newRunCommand(opts),
+		newCheckCommand(opts),
+		newSimulateCommand(opts),
+		newCleanupCommand(opts),
+		newStatusCommand(opts),
+		newVersionCommand(),
+	)
+	return cmd
+}
+
+// complete marks the flags set on the command line as set on the Go flag set
+// and applies the environment overrides
+func (o *rootOptions) complete(cmd *cobra.Command) error {
+	var err error
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if err != nil || flag.CommandLine.Lookup(f.Name) == nil {
+			return
+		}
+		err = flag.CommandLine.Set(f.Name, f.Value.String())
+	})
 	if err != nil {
-		logger.Error(err, "Error getting configuration")
-		return
+		return configError("%v", err)
 	}
 
-	// Get the poll interval as a duration from the `poll-interval-seconds` flag
-	pollInterval := time.Duration(*pollIntervalSeconds) * time.Second
+	// Flags not set on the command line can be set with TERMINATION_HANDLER_<FLAG_NAME>
+	if err := config.ApplyEnv(flag.CommandLine); err != nil {
+		return configError("error applying configuration from the environment: %v", err)
+	}
+	return nil
+}
 
-	// Construct a termination handler
-	handler, err := termination.NewHandler(logger, cfg, pollInterval, *cloudProvider, *namespace, *nodeName)
+// restConfig returns the configuration to talk to the API server, from the in-cluster
+// configuration or the kubeconfig when running outside of the cluster
+func (o *rootOptions) restConfig() (*rest.Config, error) {
+	cfg, err := loadRESTConfig(o.kubeContext)
 	if err != nil {
-		logger.Error(err, "Error constructing termination handler")
-		return
+		return nil, fmt.Errorf("error getting API server configuration: %v", err)
+	}
+	if o.kubeAPIQPS > 0 {
+		cfg.QPS = float32(o.kubeAPIQPS)
+	}
+	if o.kubeAPIBurst > 0 {
+		cfg.Burst = o.kubeAPIBurst
+	}
+	if o.kubeAPITimeout > 0 {
+		cfg.Timeout = o.kubeAPITimeout
 	}
+	return cfg, nil
+}
+
+// loadConfig loads the configuration from the file, ConfigMap or TerminationHandlerConfig, if
+// configured, and returns the loader so it can be watched for changes. The loader is nil if
+// none is configured.
+func (o *rootOptions) loadConfig(cfg *rest.Config) (*config.Loader, error) {
+	var loader *config.Loader
+	switch {
+	case countSet(o.configFile, o.configMap, o.handlerConfig) > 1:
+		return nil, errors.New("--config, --config-map and --handler-config are mutually exclusive")
+	case o.configFile != "":
+		loader = config.NewLoader(o.configFile, flag.CommandLine)
+	case o.configMap != "":
+		parts := strings.Split(o.configMap, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid --config-map %q, expected namespace/name", o.configMap)
+		}
+		var err error
+		loader, err = newConfigMapLoader(cfg, parts[0], parts[1], o.configMapKey)
+		if err != nil {
+			return nil, err
+		}
+	case o.handlerConfig != "":
+		// The node name is read before the configuration, from the flags or the environment
+		var err error
+		loader, err = newHandlerConfigLoader(cfg, o.handlerConfig, flag.CommandLine.Lookup("node-name").Value.String())
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	conf, err := loader.Load()
+	if err != nil {
+		return nil, err
+	}
+	o.conf = conf
+	applyLogVerbosity(o.logger, loader, conf)
+	return loader, nil
+}
+
+// countSet returns the number of non-empty values
+func countSet(values ...string) int {
+	n := 0
+	for _, v := range values {
+		if v != "" {
+			n++
+		}
+	}
+	return n
+}
 
-	// Start the termination handler
-	if err := handler.Run(ctrl.SetupSignalHandler()); err != nil {
-		logger.Error(err, "Error starting termination handler")
+// registerExecProvider makes the exec cloud provider available if a plugin is configured
+func registerExecProvider(conf *config.Config) {
+	if plugin := conf.ExecProvider; plugin.Command != "" {
+		providers.Register(providers.ExecName, providers.NewExecFactory(plugin.Command, plugin.Args, plugin.EventType))
+	}
+}
+
+// pollClient constructs the HTTP client polling the metadata service
+func pollClient(conf *config.Config) (*http.Client, error) {
+	return providers.NewPollClient(providers.PollClientOptions{
+		ProxyURL:     conf.Metadata.ProxyURL,
+		Timeout:      conf.Metadata.Timeout.Duration,
+		DialTimeout:  conf.Metadata.DialTimeout.Duration,
+		MaxIdleConns: conf.Metadata.MaxIdleConns,
+		TLS: notify.TLSOptions{
+			CAFile:     conf.Metadata.CAFile,
+			CertFile:   conf.Metadata.CertFile,
+			KeyFile:    conf.Metadata.KeyFile,
+			MinVersion: conf.Metadata.MinTLSVersion,
+		},
+		InsecureSkipVerify: conf.Metadata.InsecureSkipVerify,
+	})
+}
+
+// tlsOptions converts the TLS configuration of an endpoint to notify.TLSOptions
+func tlsOptions(c config.TLSConfig) notify.TLSOptions {
+	return notify.TLSOptions{
+		CAFile:     c.CAFile,
+		CertFile:   c.CertFile,
+		KeyFile:    c.KeyFile,
+		MinVersion: c.MinVersion,
+	}
+}
+
+// applyLogVerbosity sets the klog verbosity from the configuration file,
+// unless it was set on the command line
+func applyLogVerbosity(logger logr.Logger, loader *config.Loader, conf *config.Config) {
+	if conf.LogVerbosity == nil || loader.FlagSet("v") {
 		return
 	}
+	if err := flag.Set("v", strconv.Itoa(*conf.LogVerbosity)); err != nil {
+		logger.Error(err, "Error setting log verbosity")
+	}
 }
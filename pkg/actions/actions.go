@@ -0,0 +1,67 @@
+// Package actions describes the actions taken on a node for a termination notice: the
+// operating modes, the terminating condition added to the node and the deferral of the drain
+// on notices of scheduled maintenance.
+package actions
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+)
+
+const (
+	// ModeMarkOnly only adds the terminating condition, leaving the drain to MachineHealthChecks
+	ModeMarkOnly = "mark-only"
+	// ModeCordonDrain cordons and drains the node without adding the terminating condition
+	ModeCordonDrain = "cordon-drain"
+	// ModeFull adds the terminating condition, then cordons and drains the node
+	ModeFull = "full"
+)
+
+// Actions are the actions taken on the node for a termination notice
+type Actions struct {
+	MarkNode bool
+	Cordon   bool
+	Drain    bool
+	// DrainTimeout bounds the time spent evicting pods
+	DrainTimeout time.Duration
+	// DrainDelay is the time waited after marking or cordoning the node before evicting
+	// pods, so external controllers can take over the drain
+	DrainDelay time.Duration
+}
+
+// ForMode returns the actions of an operating mode, mark-only if mode is empty
+func ForMode(mode string, drainTimeout, drainDelay time.Duration) (Actions, error) {
+	switch mode {
+	case "", ModeMarkOnly:
+		return Actions{MarkNode: true}, nil
+	case ModeCordonDrain, ModeFull:
+		if !DrainSupported {
+			return Actions{}, fmt.Errorf("mode %q is not supported in lite builds", mode)
+		}
+	}
+
+	switch mode {
+	case ModeCordonDrain:
+		return Actions{Cordon: true, Drain: true, DrainTimeout: drainTimeout, DrainDelay: drainDelay}, nil
+	case ModeFull:
+		return Actions{MarkNode: true, Cordon: true, Drain: true, DrainTimeout: drainTimeout, DrainDelay: drainDelay}, nil
+	}
+	return Actions{}, fmt.Errorf("unknown mode %q", mode)
+}
+
+// DrainDelayFor returns the time to wait before draining the node for the notice. The delay
+// is shortened so that the drain can still complete before the deadline of the notice, if known.
+func (a Actions) DrainDelayFor(notice notify.Notice, now time.Time) time.Duration {
+	delay := a.DrainDelay
+	if !notice.Deadline.IsZero() {
+		if latest := notice.Deadline.Sub(now) - a.DrainTimeout; latest < delay {
+			delay = latest
+		}
+	}
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
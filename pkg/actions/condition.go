@@ -0,0 +1,95 @@
+package actions
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// TerminatingConditionType is the type of the terminating condition if no type is configured
+	TerminatingConditionType corev1.NodeConditionType = "Terminating"
+	// TerminationRequestedReason is the reason of the terminating condition if no template is configured
+	TerminationRequestedReason = "TerminationRequested"
+
+	// defaultConditionMessage is the message of the terminating condition if no template is configured
+	defaultConditionMessage = "The cloud provider has marked this instance for termination"
+)
+
+// ConditionOptions configures the node condition added when a termination notice is detected.
+// The reason and message are Go templates rendered with the notify.Notice, e.g.
+// "{{.Provider}} {{.EventType}} event {{.EventID}}". Defaults are used for empty options.
+type ConditionOptions struct {
+	Type            string
+	ReasonTemplate  string
+	MessageTemplate string
+	// TTL is the time the notice must no longer be reported before the condition is set to false
+	TTL time.Duration
+}
+
+// Condition renders the condition added to the node for a termination notice
+type Condition struct {
+	conditionType corev1.NodeConditionType
+	reason        *template.Template
+	message       *template.Template
+	ttl           time.Duration
+}
+
+// NewCondition parses the templates of the options
+func NewCondition(opts ConditionOptions) (*Condition, error) {
+	c := &Condition{conditionType: TerminatingConditionType, ttl: opts.TTL}
+	if opts.Type != "" {
+		c.conditionType = corev1.NodeConditionType(opts.Type)
+	}
+
+	reason := opts.ReasonTemplate
+	if reason == "" {
+		reason = TerminationRequestedReason
+	}
+	var err error
+	if c.reason, err = template.New("reason").Option("missingkey=error").Parse(reason); err != nil {
+		return nil, fmt.Errorf("invalid condition reason template: %v", err)
+	}
+
+	message := opts.MessageTemplate
+	if message == "" {
+		message = defaultConditionMessage
+	}
+	if c.message, err = template.New("message").Option("missingkey=error").Parse(message); err != nil {
+		return nil, fmt.Errorf("invalid condition message template: %v", err)
+	}
+	return c, nil
+}
+
+// Type returns the type of the condition
+func (c *Condition) Type() corev1.NodeConditionType {
+	return c.conditionType
+}
+
+// TTL returns the time the notice must no longer be reported before the condition is set to false
+func (c *Condition) TTL() time.Duration {
+	return c.ttl
+}
+
+// Render returns the condition for the notice, its times are set once it is written with conditions.Update
+func (c *Condition) Render(notice notify.Notice) (corev1.NodeCondition, error) {
+	reason := &bytes.Buffer{}
+	if err := c.reason.Execute(reason, notice); err != nil {
+		return corev1.NodeCondition{}, fmt.Errorf("error rendering condition reason: %v", err)
+	}
+	message := &bytes.Buffer{}
+	if err := c.message.Execute(message, notice); err != nil {
+		return corev1.NodeCondition{}, fmt.Errorf("error rendering condition message: %v", err)
+	}
+
+	return corev1.NodeCondition{
+		Type:    c.conditionType,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason.String(),
+		Message: message.String(),
+	}, nil
+}
@@ -0,0 +1,63 @@
+package actions
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/robfig/cron/v3"
+)
+
+// DeferralOptions configures deferring the drain on notices of scheduled maintenance, e.g. a
+// reboot announced well ahead of its NotBefore time
+type DeferralOptions struct {
+	// Window is a cron expression matching the start of the maintenance windows,
+	// the drain is only deferred until the lead time before the deadline if empty
+	Window string
+	// LeadTime is the time before the deadline at which the node is drained at the
+	// latest, deferral is disabled if zero
+	LeadTime time.Duration
+}
+
+// Deferral decides when the node is drained on a notice of scheduled maintenance
+type Deferral struct {
+	window   cron.Schedule
+	leadTime time.Duration
+}
+
+// NewDeferral parses the maintenance window of the options, it returns nil if deferral is disabled
+func NewDeferral(opts DeferralOptions) (*Deferral, error) {
+	if opts.LeadTime <= 0 {
+		if opts.Window != "" {
+			return nil, fmt.Errorf("a lead time is required to defer the drain to a maintenance window")
+		}
+		return nil, nil
+	}
+
+	d := &Deferral{leadTime: opts.LeadTime}
+	if opts.Window != "" {
+		schedule, err := cron.ParseStandard(opts.Window)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window %q: %v", opts.Window, err)
+		}
+		d.window = schedule
+	}
+	return d, nil
+}
+
+// DrainTime returns the time at which the node is drained on the notice, the start of the
+// next maintenance window or the lead time before the deadline, whichever comes first. Notices
+// that are not deferrable, e.g. spot interruptions, are acted on at once.
+func (d *Deferral) DrainTime(notice notify.Notice, now time.Time) time.Time {
+	if d == nil || !notice.Deferrable || notice.Deadline.IsZero() {
+		return now
+	}
+
+	at := notice.Deadline.Add(-d.leadTime)
+	if d.window != nil {
+		if next := d.window.Next(now); next.Before(at) {
+			at = next
+		}
+	}
+	return at
+}
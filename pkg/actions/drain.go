@@ -0,0 +1,7 @@
+//go:build !lite
+// +build !lite
+
+package actions
+
+// DrainSupported is whether the cordon-drain and full modes can be used
+const DrainSupported = true
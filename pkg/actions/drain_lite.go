@@ -0,0 +1,8 @@
+//go:build lite
+// +build lite
+
+package actions
+
+// DrainSupported is whether the cordon-drain and full modes can be used, lite builds
+// only mark the node
+const DrainSupported = false
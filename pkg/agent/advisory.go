@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/metrics"
+	"github.com/go-logr/logr"
+)
+
+// watchAdvisories checks the advisory signal of the cloud provider at the poll interval until
+// ctx is done. While the signal is active, the termination notice endpoint is polled at the
+// advisory poll interval. Nothing is checked while the advisory poll interval is unset.
+func (h *handlerBase) watchAdvisories(ctx context.Context, logger logr.Logger) {
+	provider, err := h.newProvider()
+	if err != nil {
+		logger.Error(err, "Error constructing provider, advisory signals are not checked")
+		return
+	}
+
+	active := false
+	setActive := func(signalled bool) {
+		if signalled == active {
+			return
+		}
+		if signalled {
+			logger.Info("Cloud provider signals a termination is likely, polling more frequently", "interval", h.advisoryPollInterval())
+		} else {
+			logger.Info("Cloud provider no longer signals a termination is likely, polling at the regular interval")
+		}
+		active = signalled
+		h.hintDescheduler(logger, advisoryHint, active)
+		value := int32(0)
+		if active {
+			value = 1
+		}
+		atomic.StoreInt32(&h.advisoryActive, value)
+		metrics.SetAdvisoryActive(h.cloudProvider, active)
+	}
+
+	// Errors are ignored as the signal only tunes the poll interval
+	_ = pollImmediateUntil(ctx, h.pollInterval, func() (bool, error) {
+		if h.advisoryPollInterval() <= 0 {
+			setActive(false)
+			return false, nil
+		}
+
+		getCtx, cancel := context.WithTimeout(ctx, h.pollInterval())
+		defer cancel()
+		var signalled bool
+		err := catchPanic(logger, func() error {
+			var err error
+			signalled, err = provider.CheckAdvisory(getCtx)
+			return err
+		})
+		if err != nil {
+			logger.V(2).Info("Error checking advisory signal", "error", err.Error())
+			return false, nil
+		}
+		setActive(signalled)
+		return false, nil
+	})
+}
+
+// pollContext returns the context of a single poll of the termination notice endpoint, a
+// request must not outlive the interval until the next poll or the handler being stopped
+func (h *handlerBase) pollContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, h.nextPollInterval())
+}
+
+// nextPollInterval returns the time until the next poll of the termination notice endpoint,
+// the advisory poll interval while the cloud provider signals a termination is likely
+func (h *handlerBase) nextPollInterval() time.Duration {
+	if atomic.LoadInt32(&h.advisoryActive) == 1 {
+		if interval := h.advisoryPollInterval(); interval > 0 {
+			return interval
+		}
+	}
+	return h.pollInterval()
+}
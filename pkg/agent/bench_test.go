@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/actions"
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+)
+
+// benchmarkNotice returns a termination notice of the node
+func benchmarkNotice(nodeName string) notify.Notice {
+	now := time.Now()
+	return notify.Notice{
+		NodeName:   nodeName,
+		Provider:   "aws",
+		EventType:  "SpotInterruption",
+		DetectedAt: now,
+		Deadline:   now.Add(2 * time.Minute),
+		Raw:        now.Add(2 * time.Minute).UTC().Format(time.RFC3339),
+	}
+}
+
+func BenchmarkMarkNodeForDeletion(b *testing.B) {
+	condition, err := actions.NewCondition(actions.ConditionOptions{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	notice := benchmarkNotice("node")
+	ctx := context.Background()
+
+	// unmarked writes the condition and the annotation, the node is reset between iterations
+	b.Run("unmarked", func(b *testing.B) {
+		nodes := newFakeNodeClient(testNode("node"))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			nodes.setNode(testNode("node"))
+			b.StartTimer()
+			if err := markNodeForDeletion(ctx, nodes, condition, notice); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	// marked is the steady state of a notice reported on every poll, nothing is written
+	b.Run("marked", func(b *testing.B) {
+		nodes := newFakeNodeClient(testNode("node"))
+		if err := markNodeForDeletion(ctx, nodes, condition, notice); err != nil {
+			b.Fatal(err)
+		}
+		writes := nodes.writeCount()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := markNodeForDeletion(ctx, nodes, condition, notice); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StopTimer()
+		if nodes.writeCount() != writes {
+			b.Errorf("marked node written %d times", nodes.writeCount()-writes)
+		}
+	})
+}
+
+func BenchmarkCordonNode(b *testing.B) {
+	ctx := context.Background()
+	nodes := newFakeNodeClient(testNode("node"))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		nodes.setNode(testNode("node"))
+		b.StartTimer()
+		if err := cordonNode(ctx, nodes, "node"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
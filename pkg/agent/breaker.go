@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/apis/v1alpha1"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// writeRetryInitial is the delay before retrying the first failed write to the API server,
+	// it doubles with every consecutive failure up to writeRetryMax
+	writeRetryInitial = 500 * time.Millisecond
+	writeRetryMax     = 30 * time.Second
+	// writeRetryJitter is the maximum fraction of the delay randomly added to it, so the
+	// handlers of many nodes do not retry in lockstep
+	writeRetryJitter = 0.5
+	// breakerThreshold is the number of consecutive failed writes after which the breaker is
+	// reported open, every write then waits for the delay of the last failure
+	breakerThreshold = 3
+)
+
+// breakerNodeClient wraps the mutations of a nodeClient in a circuit breaker. Writes
+// failing because the API server is unavailable are retried until they succeed or their
+// context is done, so the terminating condition is eventually delivered. The consecutive
+// failures are shared by all writes, while the API server is browned out every write waits
+// for the backoff of the last failure instead of hammering it.
+type breakerNodeClient struct {
+	nodeClient
+	log logr.Logger
+
+	lock     sync.Mutex
+	failures int
+	// closesAt is the time writes are attempted again after the last failure
+	closesAt time.Time
+}
+
+func newBreakerNodeClient(logger logr.Logger, nodes nodeClient) *breakerNodeClient {
+	return &breakerNodeClient{nodeClient: nodes, log: logger}
+}
+
+func (c *breakerNodeClient) applyNodeCondition(ctx context.Context, nodeName string, condition corev1.NodeCondition) error {
+	return c.write(ctx, func() error {
+		return c.nodeClient.applyNodeCondition(ctx, nodeName, condition)
+	})
+}
+
+func (c *breakerNodeClient) patchNode(ctx context.Context, original, node *corev1.Node) error {
+	return c.write(ctx, func() error {
+		return c.nodeClient.patchNode(ctx, original, node)
+	})
+}
+
+func (c *breakerNodeClient) ensureNodeTermination(ctx context.Context, termination *v1alpha1.NodeTermination) error {
+	return c.write(ctx, func() error {
+		return c.nodeClient.ensureNodeTermination(ctx, termination)
+	})
+}
+
+func (c *breakerNodeClient) deleteNodeTermination(ctx context.Context, nodeName string) error {
+	return c.write(ctx, func() error {
+		return c.nodeClient.deleteNodeTermination(ctx, nodeName)
+	})
+}
+
+func (c *breakerNodeClient) drainNode(ctx context.Context, nodeName string, timeout time.Duration) error {
+	return c.write(ctx, func() error {
+		return c.nodeClient.drainNode(ctx, nodeName, timeout)
+	})
+}
+
+func (c *breakerNodeClient) updateDaemonSet(ctx context.Context, ds *appsv1.DaemonSet) error {
+	return c.write(ctx, func() error {
+		return c.nodeClient.updateDaemonSet(ctx, ds)
+	})
+}
+
+// write runs fn once the breaker allows it, until it succeeds, fails permanently or ctx is done
+func (c *breakerNodeClient) write(ctx context.Context, fn func() error) error {
+	for {
+		if err := c.waitClosed(ctx); err != nil {
+			return err
+		}
+		err := fn()
+		if err == nil || !isRetriableWriteError(err) {
+			c.reset()
+			return err
+		}
+		c.recordFailure(err)
+	}
+}
+
+// waitClosed waits until writes are attempted again after the last failure
+func (c *breakerNodeClient) waitClosed(ctx context.Context) error {
+	c.lock.Lock()
+	delay := time.Until(c.closesAt)
+	c.lock.Unlock()
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *breakerNodeClient) recordFailure(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delay := writeRetryMax
+	// Past 10 failures the backoff is larger than the maximum
+	if c.failures < 10 {
+		if backoff := writeRetryInitial << uint(c.failures); backoff < writeRetryMax {
+			delay = backoff
+		}
+	}
+	// The server may ask for a longer delay, e.g. when throttling
+	if seconds, ok := apierrors.SuggestsClientDelay(err); ok && time.Duration(seconds)*time.Second > delay {
+		delay = time.Duration(seconds) * time.Second
+	}
+	delay = wait.Jitter(delay, writeRetryJitter)
+	c.failures++
+	c.closesAt = time.Now().Add(delay)
+
+	if c.failures == breakerThreshold {
+		c.log.Error(err, "Writes to the API server keep failing, spacing out retries", "failures", c.failures)
+	} else {
+		c.log.V(1).Info("Write to the API server failed, retrying", "error", err.Error(), "failures", c.failures, "delay", delay)
+	}
+}
+
+func (c *breakerNodeClient) reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.failures >= breakerThreshold {
+		c.log.Info("Writes to the API server succeed again", "failures", c.failures)
+	}
+	c.failures = 0
+	c.closesAt = time.Time{}
+}
+
+// isRetriableWriteError returns whether a write failed because the API server is browned
+// out, timed out, throttled the request or could not be reached. Other errors, e.g. a
+// forbidden request or a conflict, fail the same way when retried.
+func isRetriableWriteError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		statusErr := &apierrors.StatusError{ErrStatus: status.Status()}
+		return apierrors.IsServerTimeout(statusErr) || apierrors.IsTimeout(statusErr) || apierrors.IsTooManyRequests(statusErr) ||
+			apierrors.IsInternalError(statusErr) || apierrors.IsServiceUnavailable(statusErr) || apierrors.IsUnexpectedServerError(statusErr) ||
+			statusErr.Status().Code == http.StatusGatewayTimeout
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
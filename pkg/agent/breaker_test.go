@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	logrtesting "github.com/go-logr/logr/testing"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func TestIsRetriableWriteError(t *testing.T) {
+	refused := &url.Error{Op: "Patch", URL: "https://apiserver/api/v1/nodes/node", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+	nodes := corev1.Resource("nodes")
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"server timeout", apierrors.NewServerTimeout(nodes, "patch", 1), true},
+		{"timeout", apierrors.NewTimeoutError("request timed out", 1), true},
+		{"throttled", apierrors.NewTooManyRequests("throttled", 1), true},
+		{"wrapped throttled", fmt.Errorf("error patching node: %w", apierrors.NewTooManyRequests("throttled", 1)), true},
+		{"refused connection", refused, true},
+		{"wrapped refused connection", fmt.Errorf("error patching node: %w", refused), true},
+		{"wrapped service unavailable", fmt.Errorf("error applying condition: %w", apierrors.NewServiceUnavailable("unavailable")), true},
+		{"unexpected server error", apierrors.NewGenericServerResponse(http.StatusBadGateway, "patch", nodes, "node", "", 0, true), true},
+		{"closed connection", fmt.Errorf("error patching node: %w", io.ErrUnexpectedEOF), true},
+		{"internal error", apierrors.NewInternalError(fmt.Errorf("broken")), true},
+		{"service unavailable", apierrors.NewServiceUnavailable("unavailable"), true},
+		{"forbidden", apierrors.NewForbidden(nodes, "node", fmt.Errorf("denied")), false},
+		{"conflict", apierrors.NewConflict(appsv1.Resource("daemonsets"), "kured", fmt.Errorf("changed")), false},
+		{"not found", apierrors.NewNotFound(nodes, "node"), false},
+		{"cancelled", context.Canceled, false},
+		{"cancelled request", &url.Error{Op: "Patch", URL: "https://apiserver/api/v1/nodes/node", Err: context.Canceled}, false},
+		{"other", fmt.Errorf("drain did not complete"), false},
+	}
+	for _, test := range tests {
+		if got := isRetriableWriteError(test.err); got != test.want {
+			t.Errorf("%s: isRetriableWriteError(%v) = %v, want %v", test.name, test.err, got, test.want)
+		}
+	}
+}
+
+// failingDrainClient fails the first drains of the node with err
+type failingDrainClient struct {
+	*fakeNodeClient
+	failures int
+	err      error
+}
+
+func (c *failingDrainClient) drainNode(ctx context.Context, nodeName string, timeout time.Duration) error {
+	if c.failures > 0 {
+		c.failures--
+		return c.err
+	}
+	return c.fakeNodeClient.drainNode(ctx, nodeName, timeout)
+}
+
+func TestBreakerRetriesDrain(t *testing.T) {
+	nodes := &failingDrainClient{fakeNodeClient: newFakeNodeClient(testNode("node")), failures: 2, err: apierrors.NewTooManyRequests("throttled", 0)}
+	breaker := newBreakerNodeClient(logrtesting.NullLogger{}, nodes)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if err := breaker.drainNode(ctx, "node", time.Second); err != nil {
+		t.Fatalf("drain failed: %v", err)
+	}
+	if drains := nodes.drainCount("node"); drains != 1 {
+		t.Errorf("node drained %d times, want once", drains)
+	}
+
+	// Errors of a working API server are returned at once
+	nodes.failures, nodes.err = 1, apierrors.NewForbidden(corev1.Resource("pods"), "pod", fmt.Errorf("denied"))
+	if err := breaker.drainNode(ctx, "node", time.Second); !apierrors.IsForbidden(err) {
+		t.Errorf("drain returned %v, want the forbidden error", err)
+	}
+}
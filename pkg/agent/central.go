@@ -0,0 +1,363 @@
+//go:build !lite
+// +build !lite
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/alexander-demichev/termination-handler/pkg/actions"
+	"github.com/alexander-demichev/termination-handler/pkg/metrics"
+	"github.com/alexander-demichev/termination-handler/pkg/providers"
+	"github.com/go-logr/logr"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CentralHandler handles the termination notices of every node of the cluster from a single
+// deployment, for clusters that can not afford an agent on every node. It polls a
+// FleetProvider for the notices of the instances backing the nodes, which are mapped to their
+// nodes by provider ID, and runs a node handler fed by the fleet for every node with a notice.
+type CentralHandler struct {
+	client       client.Client
+	fleet        providers.FleetProvider
+	nodeSelector labels.Selector
+	log          logr.Logger
+	runner       *nodeRunner
+
+	*settingsHolder
+}
+
+// nodeRunner runs a node handler for every node of a cluster with a termination notice, the
+// node handlers poll the notices of the last poll of the fleet instead of a provider. They
+// share the event broadcaster of the runner, so running a handler only watches its node.
+// Nodes with a new notice are queued and their handlers started at the rate limit of the
+// options, so a mass reclaim does not flood the API server.
+type nodeRunner struct {
+	nodes       nodeClient
+	broadcaster record.EventBroadcaster
+	notices     *fleetNotices
+	queue       workqueue.RateLimitingInterface
+	startWorker sync.Once
+	log         logr.Logger
+
+	// lock guards the options the node handlers are constructed with, the queued nodes and
+	// the running handlers
+	lock     sync.Mutex
+	opts     Options
+	queued   map[string]bool
+	handlers map[string]*centralNode
+	stopped  bool
+}
+
+// centralNode is a node handler run by a nodeRunner
+type centralNode struct {
+	handler Handler
+	stop    chan struct{}
+	// done is closed once the handler stopped
+	done     chan struct{}
+	stopping bool
+}
+
+// NewCentralHandler constructs a CentralHandler polling fleet, the API server is reached with
+// cfg. The options apply to every node handler, the node name, metadata service and state
+// file of opts are ignored. Only the nodes matching the node selector of opts are polled.
+func NewCentralHandler(logger logr.Logger, cfg *rest.Config, fleet providers.FleetProvider, opts Options) (*CentralHandler, error) {
+	// Fail fast rather than once a termination notice arrives if the options are invalid
+	if _, err := actions.NewCondition(opts.Condition); err != nil {
+		return nil, err
+	}
+	if _, err := actions.NewDeferral(opts.Deferral); err != nil {
+		return nil, err
+	}
+
+	c, err := client.New(cfg, client.Options{Scheme: handlerScheme})
+	if err != nil {
+		return nil, fmt.Errorf("error creating client: %v", err)
+	}
+	nodes, eventSink, err := newNodeClientFor(cfg, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CentralHandler{
+		client:         c,
+		fleet:          fleet,
+		nodeSelector:   opts.NodeSelector,
+		log:            logger.WithName("central"),
+		runner:         newNodeRunner(logger.WithName("central"), nodes, eventSink, fleet, opts),
+		settingsHolder: newSettingsHolder(opts.Settings),
+	}, nil
+}
+
+// newNodeRunner constructs a nodeRunner acting on the nodes with nodes, events are recorded
+// to eventSink until shutdown is called. The node name, metadata service and state file of
+// opts are ignored.
+func newNodeRunner(logger logr.Logger, nodes nodeClient, eventSink record.EventSink, fleet providers.FleetProvider, opts Options) *nodeRunner {
+	opts.MetadataURL = ""
+	opts.StateFile = ""
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(eventSink)
+	opts.broadcaster = broadcaster
+	return &nodeRunner{
+		nodes:       nodes,
+		broadcaster: broadcaster,
+		notices:     &fleetNotices{eventType: fleet.EventType()},
+		queue:       workqueue.NewNamedRateLimitingQueue(nodeRateLimiter(opts.NodeRateLimit), "termination_handler_nodes"),
+		log:         logger,
+		opts:        opts,
+		queued:      map[string]bool{},
+		handlers:    map[string]*centralNode{},
+	}
+}
+
+// nodeRateLimiter returns the rate limiter of the node handlers started by a nodeRunner
+func nodeRateLimiter(limit RateLimit) workqueue.RateLimiter {
+	if limit.QPS <= 0 {
+		return &workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Inf, 0)}
+	}
+	return &workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(limit.QPS), limit.Burst)}
+}
+
+// Run polls the fleet provider and runs the node handlers until stop is closed. The node
+// handlers get the shutdown budget to complete the actions in flight.
+func (h *CentralHandler) Run(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	wg := &sync.WaitGroup{}
+	h.log.Info("Polling the cloud provider for the termination notices of the nodes")
+	_ = pollImmediateUntil(ctx, h.pollInterval, func() (bool, error) {
+		h.poll(ctx, wg)
+		return false, nil
+	})
+
+	h.runner.stopAll()
+	wg.Wait()
+	h.runner.shutdown()
+	metrics.SetWatchedNodes(0)
+	return nil
+}
+
+// UpdateSettings replaces the settings of the central handler and of every node handler
+func (h *CentralHandler) UpdateSettings(settings Settings) {
+	h.settingsHolder.UpdateSettings(settings)
+	h.runner.updateSettings(settings)
+}
+
+// poll polls the fleet provider for the notices of the instances of the nodes once and runs
+// the node handlers for them. Failures are logged and reported by the node handlers, the
+// next poll retries.
+func (h *CentralHandler) poll(ctx context.Context, wg *sync.WaitGroup) {
+	var listOpts []client.ListOption
+	if h.nodeSelector != nil {
+		listOpts = append(listOpts, client.MatchingLabelsSelector{Selector: h.nodeSelector})
+	}
+	nodeList := &corev1.NodeList{}
+	if err := h.client.List(ctx, nodeList, listOpts...); err != nil {
+		h.log.Error(err, "Error listing nodes")
+		return
+	}
+
+	nodeNames := make(map[string]string, len(nodeList.Items))
+	providerIDs := make([]string, 0, len(nodeList.Items))
+	for _, node := range nodeList.Items {
+		if node.Spec.ProviderID == "" {
+			h.log.V(2).Info("Skipping node without a provider ID", "node", node.Name)
+			continue
+		}
+		nodeNames[node.Spec.ProviderID] = node.Name
+		providerIDs = append(providerIDs, node.Spec.ProviderID)
+	}
+
+	metrics.SetWatchedNodes(len(providerIDs))
+
+	pollCtx, cancel := context.WithTimeout(ctx, h.pollInterval())
+	defer cancel()
+	var reported map[string]*providers.TerminationNotice
+	err := catchPanic(h.log, func() error {
+		var err error
+		reported, err = h.fleet.PollFleet(pollCtx, h.log, providerIDs)
+		return err
+	})
+	if err != nil {
+		h.log.Error(err, "Error polling the cloud provider for termination notices")
+		h.runner.fail(err)
+		return
+	}
+
+	notices := make(map[string]*providers.TerminationNotice, len(reported))
+	for providerID, notice := range reported {
+		nodeName, ok := nodeNames[providerID]
+		if !ok {
+			h.log.V(2).Info("Ignoring termination notice of an instance without a node", "providerID", providerID)
+			continue
+		}
+		notices[nodeName] = notice
+	}
+	h.runner.run(wg, notices)
+	recordClusterStatus(h.ClusterStatus())
+}
+
+// ClusterStatus implements ClusterStatusReporter, it summarizes the nodes with a termination
+// notice and the progress of their handlers
+func (h *CentralHandler) ClusterStatus() ClusterStatus {
+	status := newClusterStatus(h.runner.terminatingNodes())
+	if err := h.runner.notices.lastError(); err != nil {
+		status.LastError = err.Error()
+	}
+	return status
+}
+
+// run updates the termination notices of the nodes with the result of a successful poll of
+// the fleet and queues every node with a notice that has no handler, the handlers are started
+// at the rate limit. The handlers of nodes whose notice was cancelled are stopped once they
+// are back to polling, those of deleted nodes stop by themselves. The handlers are tracked by
+// wg.
+func (r *nodeRunner) run(wg *sync.WaitGroup, notices map[string]*providers.TerminationNotice) {
+	r.startWorker.Do(func() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r.startNext(wg) {
+			}
+		}()
+	})
+	r.notices.update(notices)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for nodeName, node := range r.handlers {
+		select {
+		case <-node.done:
+			delete(r.handlers, nodeName)
+			continue
+		default:
+		}
+		if !node.stopping && notices[nodeName] == nil && node.handler.Status().State == StatePolling {
+			r.log.Info("Termination notice cancelled, no longer handling the node", "node", nodeName)
+			node.stopping = true
+			close(node.stop)
+		}
+	}
+
+	for nodeName := range notices {
+		if _, ok := r.handlers[nodeName]; ok || r.queued[nodeName] {
+			continue
+		}
+		r.queued[nodeName] = true
+		r.queue.AddRateLimited(nodeName)
+	}
+}
+
+// startNext starts the handler of the next queued node, if its notice was not cancelled
+// meanwhile. It returns false once the queue is shut down.
+func (r *nodeRunner) startNext(wg *sync.WaitGroup) bool {
+	item, shutdown := r.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer r.queue.Done(item)
+	nodeName := item.(string)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.queued, nodeName)
+	if r.stopped || !r.notices.has(nodeName) {
+		return true
+	}
+
+	opts := r.opts
+	opts.NodeName = nodeName
+	opts.fleet = r.notices
+	handler, err := newNodeHandler(r.log, r.nodes, nil, opts)
+	if err != nil {
+		r.log.Error(err, "Error constructing the handler of a node with a termination notice", "node", nodeName)
+		return true
+	}
+
+	node := &centralNode{handler: handler, stop: make(chan struct{}), done: make(chan struct{})}
+	r.handlers[nodeName] = node
+	r.log.Info("Termination notice detected, handling the node", "node", nodeName)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(node.done)
+		if err := handler.Run(node.stop); err != nil {
+			r.log.Error(err, "Error running the handler of a node", "node", nodeName)
+		}
+	}()
+	return true
+}
+
+// terminatingNodes returns the status of the running node handlers
+func (r *nodeRunner) terminatingNodes() []TerminatingNode {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	nodes := make([]TerminatingNode, 0, len(r.handlers))
+	for nodeName, node := range r.handlers {
+		select {
+		case <-node.done:
+			continue
+		default:
+		}
+		status := node.handler.Status()
+		nodes = append(nodes, TerminatingNode{
+			NodeName:       nodeName,
+			State:          status.State,
+			Notice:         status.Notice,
+			PendingActions: status.PendingActions,
+			LastError:      status.LastError,
+		})
+	}
+	return nodes
+}
+
+// fail records a failed poll of the fleet, which the node handlers report
+func (r *nodeRunner) fail(err error) {
+	r.notices.fail(err)
+}
+
+// updateSettings replaces the settings of every node handler
+func (r *nodeRunner) updateSettings(settings Settings) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.opts.Settings = settings
+	for _, node := range r.handlers {
+		node.handler.UpdateSettings(settings)
+	}
+}
+
+// stopAll stops every node handler, they get the shutdown budget to complete the actions in
+// flight. The queued nodes are no longer started.
+func (r *nodeRunner) stopAll() {
+	r.queue.ShutDown()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stopped = true
+	for _, node := range r.handlers {
+		if !node.stopping {
+			node.stopping = true
+			close(node.stop)
+		}
+	}
+}
+
+// shutdown shuts down the event broadcaster of the node handlers, once they all stopped
+func (r *nodeRunner) shutdown() {
+	r.broadcaster.Shutdown()
+}
@@ -0,0 +1,104 @@
+//go:build !lite
+// +build !lite
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/actions"
+	"github.com/alexander-demichev/termination-handler/pkg/providers"
+	"github.com/go-logr/logr"
+	logrtesting "github.com/go-logr/logr/testing"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// fakeFleet is a FleetProvider the tests pass the notices to the node runner for themselves
+type fakeFleet struct{}
+
+func (fakeFleet) PollFleet(ctx context.Context, logger logr.Logger, providerIDs []string) (map[string]*providers.TerminationNotice, error) {
+	return nil, nil
+}
+
+func (fakeFleet) EventType() string { return "Termination" }
+
+// startRunner returns a node runner of nodes stopped when the test ends, and the wait group
+// tracking its handlers
+func startRunner(t *testing.T, nodes *fakeNodeClient, limit RateLimit) (*nodeRunner, *sync.WaitGroup) {
+	opts := Options{
+		CloudProvider: "exec",
+		Settings:      testSettings(),
+		Actions:       actions.Actions{MarkNode: true},
+		NodeRateLimit: limit,
+	}
+	runner := newNodeRunner(logrtesting.NullLogger{}, nodes, fakeEventSink{}, fakeFleet{}, opts)
+	wg := &sync.WaitGroup{}
+	t.Cleanup(func() {
+		runner.stopAll()
+		wg.Wait()
+		runner.shutdown()
+	})
+	return runner, wg
+}
+
+// markedNodes returns the number of nodes with the terminating condition
+func markedNodes(nodes *fakeNodeClient, names []string) int {
+	marked := 0
+	for _, name := range names {
+		if condition := terminatingCondition(nodes.node(name)); condition != nil && condition.Status == corev1.ConditionTrue {
+			marked++
+		}
+	}
+	return marked
+}
+
+func TestNodeRunnerLimitsRate(t *testing.T) {
+	var names []string
+	nodes := newFakeNodeClient()
+	notices := map[string]*providers.TerminationNotice{}
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("node-%d", i)
+		names = append(names, name)
+		nodes.setNode(testNode(name))
+		notices[name] = &providers.TerminationNotice{Deadline: time.Now().Add(2 * time.Minute)}
+	}
+	runner, wg := startRunner(t, nodes, RateLimit{QPS: 10, Burst: 2})
+
+	start := time.Now()
+	runner.run(wg, notices)
+	// Polls of the fleet while the nodes are queued do not queue them again
+	runner.run(wg, notices)
+	err := wait.PollImmediate(10*time.Millisecond, testTimeout, func() (bool, error) {
+		return markedNodes(nodes, names) == len(names), nil
+	})
+	if err != nil {
+		t.Fatalf("%d of %d nodes marked", markedNodes(nodes, names), len(names))
+	}
+	// The burst starts at once, the others a tenth of a second apart
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("%d nodes marked in %v, faster than the rate limit", len(names), elapsed)
+	}
+}
+
+func TestNodeRunnerSkipsCancelledNotices(t *testing.T) {
+	nodes := newFakeNodeClient(testNode("first"), testNode("second"))
+	runner, wg := startRunner(t, nodes, RateLimit{QPS: 2, Burst: 1})
+
+	notice := &providers.TerminationNotice{Deadline: time.Now().Add(2 * time.Minute)}
+	runner.run(wg, map[string]*providers.TerminationNotice{"first": notice, "second": notice})
+	// The notice of the second node is cancelled before its handler is due
+	runner.run(wg, map[string]*providers.TerminationNotice{"first": notice})
+
+	waitForNode(t, nodes, "first", func(node *corev1.Node) bool {
+		return terminatingCondition(node) != nil
+	})
+	time.Sleep(time.Second)
+	if condition := terminatingCondition(nodes.node("second")); condition != nil {
+		t.Errorf("node with a cancelled notice marked: %+v", condition)
+	}
+}
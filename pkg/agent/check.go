@@ -0,0 +1,26 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/alexander-demichev/termination-handler/pkg/providers"
+	"github.com/go-logr/logr"
+)
+
+// CheckTermination polls the termination notice endpoint of the cloud provider once. It returns
+// the termination notice, or nil if the instance is not marked for termination. The metadata
+// service of the provider is reached at metadataURL, or its default address if it is empty.
+// The request is aborted once ctx is done.
+func CheckTermination(ctx context.Context, logger logr.Logger, httpClient *http.Client, cloudProvider, metadataURL, nodeName string) (*notify.Notice, error) {
+	provider, err := providers.New(cloudProvider, providers.Options{NodeName: nodeName, HTTPClient: httpClient, MetadataURL: metadataURL})
+	if err != nil {
+		return nil, err
+	}
+	notice, err := provider.Poll(ctx, logger)
+	if err != nil || notice == nil {
+		return nil, err
+	}
+	return newNotice(notice, nodeName, cloudProvider, provider.EventType()), nil
+}
@@ -0,0 +1,142 @@
+//go:build !lite
+// +build !lite
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/actions"
+	"github.com/alexander-demichev/termination-handler/pkg/conditions"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CleanupOptions configures the removal of stale terminating conditions
+type CleanupOptions struct {
+	// ConditionType is the type of the terminating condition, the default type if empty
+	ConditionType string
+	// GracePeriod is how long after the expected termination an instance has to keep
+	// running before its terminating condition is considered stale
+	GracePeriod time.Duration
+	// DryRun reports the stale conditions without removing them
+	DryRun bool
+}
+
+// StaleCondition describes a terminating condition found to be stale
+type StaleCondition struct {
+	Node string
+	// ExpectedTermination is the deadline of the notice, or the time the condition was
+	// added if the deadline is unknown
+	ExpectedTermination time.Time
+	// LastHeartbeat is the last time the kubelet reported the node as ready
+	LastHeartbeat time.Time
+}
+
+// CleanupStaleConditions lists the nodes with the terminating condition and removes the
+// condition, and the notice annotation paired with it, from nodes whose instance is still
+// healthy more than the grace period after its expected termination. Such conditions are
+// left behind by cancelled interruptions, simulations or handler bugs, and would otherwise
+// keep the node marked for deletion. The metadata services of the cloud providers can
+// only be reached from the instance itself, so an instance is considered healthy when
+// its kubelet still reports the node as ready after the expected termination.
+func CleanupStaleConditions(ctx context.Context, logger logr.Logger, cfg *rest.Config, opts CleanupOptions) ([]StaleCondition, error) {
+	c, err := client.New(cfg, client.Options{Scheme: handlerScheme})
+	if err != nil {
+		return nil, fmt.Errorf("error creating client: %v", err)
+	}
+
+	conditionType := actions.TerminatingConditionType
+	if opts.ConditionType != "" {
+		conditionType = corev1.NodeConditionType(opts.ConditionType)
+	}
+
+	nodes := &corev1.NodeList{}
+	if err := c.List(ctx, nodes); err != nil {
+		return nil, fmt.Errorf("error listing nodes: %v", err)
+	}
+
+	var stale []StaleCondition
+	now := time.Now()
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		staleCondition, ok := findStaleCondition(logger, node, conditionType, opts.GracePeriod, now)
+		if !ok {
+			continue
+		}
+		stale = append(stale, staleCondition)
+		if opts.DryRun {
+			continue
+		}
+
+		if err := removeTerminationCondition(ctx, c, node, conditionType); err != nil {
+			return stale, fmt.Errorf("error removing condition from node %s: %v", node.Name, err)
+		}
+		logger.Info("Removed stale terminating condition", "node", node.Name)
+	}
+	return stale, nil
+}
+
+// findStaleCondition returns the stale terminating condition of the node, if any
+func findStaleCondition(logger logr.Logger, node *corev1.Node, conditionType corev1.NodeConditionType, gracePeriod time.Duration, now time.Time) (StaleCondition, bool) {
+	terminating := conditions.Find(node.Status.Conditions, conditionType)
+	ready := conditions.Find(node.Status.Conditions, corev1.NodeReady)
+	if terminating == nil || terminating.Status != corev1.ConditionTrue {
+		return StaleCondition{}, false
+	}
+
+	expected := terminating.LastTransitionTime.Time
+	if value, ok := node.Annotations[terminationNoticeAnnotation]; ok {
+		annotation := noticeAnnotation{}
+		if err := json.Unmarshal([]byte(value), &annotation); err != nil {
+			logger.Error(err, "Ignoring invalid notice annotation", "node", node.Name)
+		} else if annotation.Deadline != "" {
+			deadline, err := time.Parse(time.RFC3339, annotation.Deadline)
+			if err != nil {
+				logger.Error(err, "Ignoring invalid notice deadline", "node", node.Name)
+			} else {
+				expected = deadline
+			}
+		}
+	}
+
+	// The instance must have been reported healthy after the grace period
+	// following its expected termination
+	if ready == nil || ready.Status != corev1.ConditionTrue {
+		return StaleCondition{}, false
+	}
+	cutoff := expected.Add(gracePeriod)
+	if now.Before(cutoff) || ready.LastHeartbeatTime.Time.Before(cutoff) {
+		return StaleCondition{}, false
+	}
+
+	return StaleCondition{
+		Node:                node.Name,
+		ExpectedTermination: expected,
+		LastHeartbeat:       ready.LastHeartbeatTime.Time,
+	}, true
+}
+
+// removeTerminationCondition removes the terminating condition and the notice annotation from the node
+func removeTerminationCondition(ctx context.Context, c client.Client, node *corev1.Node, conditionType corev1.NodeConditionType) error {
+	if conditions.Remove(&node.Status.Conditions, conditionType) {
+		if err := c.Status().Update(ctx, node); err != nil {
+			return fmt.Errorf("error updating node status: %v", err)
+		}
+	}
+
+	if _, ok := node.Annotations[terminationNoticeAnnotation]; !ok {
+		return nil
+	}
+	original := node.DeepCopy()
+	delete(node.Annotations, terminationNoticeAnnotation)
+	if err := c.Patch(ctx, node, client.MergeFrom(original)); err != nil {
+		return fmt.Errorf("error removing notice annotation: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/go-logr/logr"
+)
+
+// drainDeferred returns whether the drain on the notice is not due yet
+func (h *handlerBase) drainDeferred(notice notify.Notice) bool {
+	now := time.Now()
+	return h.deferral.DrainTime(notice, now).After(now)
+}
+
+// waitForDeferral blocks until the drain on the notice is due, the node is marked and
+// cordoned meanwhile
+func (h *handlerBase) waitForDeferral(ctx context.Context, logger logr.Logger, notice notify.Notice) error {
+	at := h.deferral.DrainTime(notice, time.Now())
+	wait := time.Until(at)
+	if wait <= 0 {
+		return nil
+	}
+
+	logger.Info("Scheduled maintenance is not imminent, deferring the drain", "deadline", notice.Deadline, "drainAt", at)
+	h.setState(StateDeferred)
+	h.hintDescheduler(logger, deferralHint, true)
+	defer h.hintDescheduler(logger, deferralHint, false)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		logger.Info("Deferral elapsed, draining the node")
+		h.setState(StateActing)
+		return nil
+	}
+}
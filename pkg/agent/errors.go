@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the handler, they are matched with errors.Is as they are usually wrapped
+var (
+	// ErrNodeNotFound matches the errors of a node that does not exist
+	ErrNodeNotFound = errors.New("node not found")
+	// ErrMachineNotFound matches the errors of a node without a Machine
+	ErrMachineNotFound = errors.New("machine not found for node")
+)
+
+// NodeNotFoundError is returned when the node does not exist, Err is the error returned
+// by the API server. It matches ErrNodeNotFound.
+type NodeNotFoundError struct {
+	Node string
+	Err  error
+}
+
+func (e *NodeNotFoundError) Error() string {
+	return fmt.Sprintf("node %q not found", e.Node)
+}
+
+func (e *NodeNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+func (e *NodeNotFoundError) Is(target error) bool {
+	return target == ErrNodeNotFound
+}
+
+// MachineNotFoundError is returned when no Machine references the node, Namespace is the
+// namespace searched, all namespaces if empty. Err is the error returned by the API server,
+// e.g. if the Machine API is not installed, if any. It matches ErrMachineNotFound.
+type MachineNotFoundError struct {
+	Node      string
+	Namespace string
+	Err       error
+}
+
+func (e *MachineNotFoundError) Error() string {
+	msg := fmt.Sprintf("machine not found for node %q", e.Node)
+	if e.Namespace != "" {
+		msg += fmt.Sprintf(" in namespace %q", e.Namespace)
+	}
+	if e.Err != nil {
+		msg += fmt.Sprintf(": %v", e.Err)
+	}
+	return msg
+}
+
+func (e *MachineNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+func (e *MachineNotFoundError) Is(target error) bool {
+	return target == ErrMachineNotFound
+}
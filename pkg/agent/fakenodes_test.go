@@ -0,0 +1,267 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/apis/v1alpha1"
+	"github.com/alexander-demichev/termination-handler/pkg/conditions"
+	jsonpatch "github.com/evanphx/json-patch"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// fakeNodeClient is an in-memory nodeClient with the semantics of the API server the handler
+// relies on: condition applies own only their condition, patches are merge patches of the
+// changes, updates of DaemonSets conflict on stale resource versions and node watches see
+// every write
+type fakeNodeClient struct {
+	lock          sync.Mutex
+	nodes         map[string]*corev1.Node
+	terminations  map[string]*v1alpha1.NodeTermination
+	daemonSets    map[string]*appsv1.DaemonSet
+	machines      map[string]*corev1.ObjectReference
+	watchers      []*watch.FakeWatcher
+	version       int
+	drained       map[string]int
+	writes        int
+	writeErr      error
+	drainDuration time.Duration
+}
+
+func newFakeNodeClient(nodes ...*corev1.Node) *fakeNodeClient {
+	c := &fakeNodeClient{
+		nodes:        map[string]*corev1.Node{},
+		terminations: map[string]*v1alpha1.NodeTermination{},
+		daemonSets:   map[string]*appsv1.DaemonSet{},
+		machines:     map[string]*corev1.ObjectReference{},
+		drained:      map[string]int{},
+	}
+	for _, node := range nodes {
+		c.storeNode(node.DeepCopy())
+	}
+	return c
+}
+
+// storeNode stores node with a new resource version and sends it to the watchers, the lock
+// must be held unless the client is not shared yet
+func (c *fakeNodeClient) storeNode(node *corev1.Node) {
+	c.version++
+	node.ResourceVersion = strconv.Itoa(c.version)
+	_, exists := c.nodes[node.Name]
+	c.nodes[node.Name] = node
+	for _, watcher := range c.watchers {
+		if exists {
+			watcher.Modify(node.DeepCopy())
+		} else {
+			watcher.Add(node.DeepCopy())
+		}
+	}
+}
+
+// node returns a copy of the stored node, nil if it does not exist
+func (c *fakeNodeClient) node(name string) *corev1.Node {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if node, ok := c.nodes[name]; ok {
+		return node.DeepCopy()
+	}
+	return nil
+}
+
+// setNode replaces the stored node, as another writer would
+func (c *fakeNodeClient) setNode(node *corev1.Node) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.storeNode(node.DeepCopy())
+}
+
+// drainCount returns the number of drains of the node
+func (c *fakeNodeClient) drainCount(name string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.drained[name]
+}
+
+// writeCount returns the number of writes of nodes
+func (c *fakeNodeClient) writeCount() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.writes
+}
+
+func (c *fakeNodeClient) getNode(ctx context.Context, name string) (*corev1.Node, error) {
+	if node := c.node(name); node != nil {
+		return node, nil
+	}
+	return nil, &NodeNotFoundError{Node: name, Err: apierrors.NewNotFound(corev1.Resource("nodes"), name)}
+}
+
+func (c *fakeNodeClient) listWatchNode(name string) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			list := &corev1.NodeList{ListMeta: metav1.ListMeta{ResourceVersion: strconv.Itoa(c.version)}}
+			if node, ok := c.nodes[name]; ok {
+				list.Items = append(list.Items, *node.DeepCopy())
+			}
+			return list, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			watcher := watch.NewFakeWithChanSize(100, false)
+			c.watchers = append(c.watchers, watcher)
+			return watcher, nil
+		},
+	}
+}
+
+// write runs update on the stored node, failing with writeErr if set
+func (c *fakeNodeClient) write(name string, update func(node *corev1.Node) error) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+	node, ok := c.nodes[name]
+	if !ok {
+		return &NodeNotFoundError{Node: name, Err: apierrors.NewNotFound(corev1.Resource("nodes"), name)}
+	}
+	node = node.DeepCopy()
+	if err := update(node); err != nil {
+		return err
+	}
+	c.writes++
+	c.storeNode(node)
+	return nil
+}
+
+func (c *fakeNodeClient) applyNodeCondition(ctx context.Context, nodeName string, condition corev1.NodeCondition) error {
+	return c.write(nodeName, func(node *corev1.Node) error {
+		// The apply owns only this condition, the others are kept as they are
+		current := conditions.Find(node.Status.Conditions, condition.Type)
+		if current == nil {
+			node.Status.Conditions = append(node.Status.Conditions, condition)
+		} else {
+			*current = condition
+		}
+		return nil
+	})
+}
+
+func (c *fakeNodeClient) patchNode(ctx context.Context, original, modified *corev1.Node) error {
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return err
+	}
+	modifiedJSON, err := json.Marshal(modified)
+	if err != nil {
+		return err
+	}
+	patch, err := jsonpatch.CreateMergePatch(originalJSON, modifiedJSON)
+	if err != nil {
+		return err
+	}
+	return c.write(modified.Name, func(node *corev1.Node) error {
+		current, err := json.Marshal(node)
+		if err != nil {
+			return err
+		}
+		patched, err := jsonpatch.MergePatch(current, patch)
+		if err != nil {
+			return err
+		}
+		*node = corev1.Node{}
+		return json.Unmarshal(patched, node)
+	})
+}
+
+func (c *fakeNodeClient) listPolicies(ctx context.Context) ([]v1alpha1.TerminationPolicy, error) {
+	return nil, nil
+}
+
+func (c *fakeNodeClient) ensureNodeTermination(ctx context.Context, termination *v1alpha1.NodeTermination) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.terminations[termination.Name]; !ok {
+		c.terminations[termination.Name] = termination.DeepCopy()
+	}
+	return nil
+}
+
+func (c *fakeNodeClient) deleteNodeTermination(ctx context.Context, nodeName string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.terminations, nodeName)
+	return nil
+}
+
+func (c *fakeNodeClient) drainNode(ctx context.Context, nodeName string, timeout time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(c.drainDuration):
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.drained[nodeName]++
+	return nil
+}
+
+func (c *fakeNodeClient) findMachine(ctx context.Context, namespace, nodeName string) (*corev1.ObjectReference, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if machine, ok := c.machines[nodeName]; ok {
+		return machine.DeepCopy(), nil
+	}
+	return nil, &MachineNotFoundError{Node: nodeName, Namespace: namespace}
+}
+
+func (c *fakeNodeClient) getDaemonSet(ctx context.Context, namespace, name string) (*appsv1.DaemonSet, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if ds, ok := c.daemonSets[namespace+"/"+name]; ok {
+		return ds.DeepCopy(), nil
+	}
+	return nil, apierrors.NewNotFound(appsv1.Resource("daemonsets"), name)
+}
+
+func (c *fakeNodeClient) updateDaemonSet(ctx context.Context, ds *appsv1.DaemonSet) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := ds.Namespace + "/" + ds.Name
+	current, ok := c.daemonSets[key]
+	if !ok {
+		return apierrors.NewNotFound(appsv1.Resource("daemonsets"), ds.Name)
+	}
+	if current.ResourceVersion != ds.ResourceVersion {
+		return apierrors.NewConflict(appsv1.Resource("daemonsets"), ds.Name, nil)
+	}
+	c.version++
+	ds = ds.DeepCopy()
+	ds.ResourceVersion = strconv.Itoa(c.version)
+	c.daemonSets[key] = ds
+	return nil
+}
+
+// testNode returns a ready node with the name
+func testNode(name string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID("uid-" + name)},
+		Spec:       corev1.NodeSpec{ProviderID: "aws:///us-east-1a/i-" + name},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+			{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+		}},
+	}
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/alexander-demichev/termination-handler/pkg/providers"
+	"github.com/go-logr/logr"
+)
+
+// fleetNotices holds the result of the last poll of a FleetProvider by a central handler, or
+// of the metadata service by a multi-node handler, the termination notices are keyed by node name
+type fleetNotices struct {
+	lock      sync.RWMutex
+	notices   map[string]*providers.TerminationNotice
+	err       error
+	eventType string
+}
+
+// update replaces the notices with the result of a successful poll
+func (n *fleetNotices) update(notices map[string]*providers.TerminationNotice) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.notices = notices
+	n.err = nil
+}
+
+// fail records a failed poll, which the node handlers report until the next successful one
+func (n *fleetNotices) fail(err error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.err = err
+}
+
+// has returns whether the last successful poll reported a notice for the node
+func (n *fleetNotices) has(nodeName string) bool {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.notices[nodeName] != nil
+}
+
+// lastError returns the error of the last poll, nil if it succeeded
+func (n *fleetNotices) lastError() error {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.err
+}
+
+// fleetProvider implements providers.Provider for the node handlers of a central or
+// multi-node handler, a poll returns the notice of the node from the last poll of the fleet
+type fleetProvider struct {
+	notices  *fleetNotices
+	nodeName string
+}
+
+func (p *fleetProvider) Poll(ctx context.Context, logger logr.Logger) (*providers.TerminationNotice, error) {
+	p.notices.lock.RLock()
+	defer p.notices.lock.RUnlock()
+	if p.notices.err != nil {
+		return nil, p.notices.err
+	}
+	return p.notices.notices[p.nodeName], nil
+}
+
+// CheckAdvisory always returns false, fleet providers do not report advisories
+func (p *fleetProvider) CheckAdvisory(ctx context.Context) (bool, error) {
+	return false, nil
+}
+
+func (p *fleetProvider) EventType() string {
+	return p.notices.eventType
+}
@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/go-logr/logr"
+)
+
+// handledEventAnnotation holds the key of the last notice the notifications were sent for
+const handledEventAnnotation = "termination-handler/handled-event"
+
+// handledEvents records the notice the notifications were sent for, so a restarted
+// handler resuming the handling of a notice does not send them again
+type handledEvents interface {
+	handled(ctx context.Context, key string) (bool, error)
+	record(ctx context.Context, key string) error
+}
+
+// noticeKey identifies the event of a notice across restarts of the handler, by its event ID
+// if the provider has one, its deadline if known or else the time it was detected
+func noticeKey(notice notify.Notice) string {
+	id := notice.EventID
+	switch {
+	case id != "":
+	case !notice.Deadline.IsZero():
+		id = notice.Deadline.UTC().Format(time.RFC3339)
+	default:
+		id = notice.DetectedAt.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%s/%s/%s", notice.Provider, notice.EventType, id)
+}
+
+// nodeHandledEvents records the handled notice in an annotation of the node
+type nodeHandledEvents struct {
+	nodes    nodeClient
+	nodeName string
+}
+
+func (e *nodeHandledEvents) handled(ctx context.Context, key string) (bool, error) {
+	node, err := e.nodes.getNode(ctx, e.nodeName)
+	if errors.Is(err, ErrNodeNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error fetching node: %w", err)
+	}
+	return node.Annotations[handledEventAnnotation] == key, nil
+}
+
+func (e *nodeHandledEvents) record(ctx context.Context, key string) error {
+	node, err := e.nodes.getNode(ctx, e.nodeName)
+	if errors.Is(err, ErrNodeNotFound) {
+		// Nothing is restarted on a deleted node
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching node: %w", err)
+	}
+	original := node.DeepCopy()
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	node.Annotations[handledEventAnnotation] = key
+	return e.nodes.patchNode(ctx, original, node)
+}
+
+// fileHandledEvents records the handled notice in a local file, for standalone handlers
+type fileHandledEvents struct {
+	path string
+}
+
+func (e *fileHandledEvents) handled(ctx context.Context, key string) (bool, error) {
+	data, err := ioutil.ReadFile(e.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return string(bytes.TrimSpace(data)) == key, nil
+}
+
+func (e *fileHandledEvents) record(ctx context.Context, key string) error {
+	// Written through a temporary file so a crash never leaves a partial key
+	tmp, err := ioutil.TempFile(filepath.Dir(e.path), ".handled-event-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(key + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), e.path)
+}
+
+// notifyOnce sends the notifications for the notice, unless they were already sent for it
+// before the handler restarted. Failing to check or record the notice must not prevent the
+// notifications, so errors are only logged.
+func (h *handlerBase) notifyOnce(ctx context.Context, logger logr.Logger, notice notify.Notice) {
+	if h.handled == nil {
+		sendNotifications(ctx, logger, h.notifiers, notice)
+		return
+	}
+
+	key := noticeKey(notice)
+	handled, err := h.handled.handled(ctx, key)
+	if err != nil {
+		logger.Error(err, "Error checking whether the notifications were already sent")
+	}
+	if handled {
+		logger.Info("Notifications were already sent for the notice, not sending them again", "event", key)
+		return
+	}
+
+	sendNotifications(ctx, logger, h.notifiers, notice)
+	if err := h.handled.record(ctx, key); err != nil {
+		logger.Error(err, "Error recording that the notifications were sent")
+	}
+}
@@ -0,0 +1,752 @@
+// Package agent runs the termination handler: it polls the cloud provider of the package
+// providers for termination notices and takes the actions of the package actions on the nodes
+// running on the terminated instances. The handler binary is a thin wrapper around it:
+// controllers embed a Handler with NewHandlerForClient or add it to their manager with
+// NewRunnable, or embed a Poller to receive the notices on a channel and take their own actions.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/actions"
+	"github.com/alexander-demichev/termination-handler/pkg/apis/v1alpha1"
+	"github.com/alexander-demichev/termination-handler/pkg/audit"
+	"github.com/alexander-demichev/termination-handler/pkg/conditions"
+	"github.com/alexander-demichev/termination-handler/pkg/metrics"
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/alexander-demichev/termination-handler/pkg/providers"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+)
+
+const (
+	// terminationNoticeAnnotation holds a JSON description of the termination notice
+	terminationNoticeAnnotation = "termination-handler/notice"
+
+	// eventSourceComponent is the component reported as the source of events
+	eventSourceComponent = "termination-handler"
+
+	// markNodeAction, cordonAction, drainAction and nodeTerminationAction are the names of the
+	// actions reported in metrics
+	markNodeAction        = "mark_node"
+	cordonAction          = "cordon"
+	drainAction           = "drain"
+	nodeTerminationAction = "node_termination"
+)
+
+// Handler represents a handler that will run to check the termination
+// notice endpoint and mark node for deletion
+type Handler interface {
+	Run(stop <-chan struct{}) error
+	Status() Status
+	UpdateSettings(settings Settings)
+	Simulate(request SimulationRequest) error
+}
+
+// Options configure a Handler. The zero value of a field disables what it configures, except
+// where a default is documented.
+type Options struct {
+	// CloudProvider is the name of a registered cloud provider, see providers.Register
+	CloudProvider string
+	// MetadataURL is the base URL of the metadata service, the default of the provider if empty
+	MetadataURL string
+	// HTTPClient polls the metadata service, a client constructed by providers.NewPollClient
+	// with the default options if nil
+	HTTPClient *http.Client
+	// NodeName is the name of the node, or of the instance of a standalone handler
+	NodeName string
+	// Namespace is the namespace the Machine of the node lives in, all namespaces if empty
+	Namespace string
+	// NodeSelector restricts the nodes that are actively handled, all nodes if nil
+	NodeSelector labels.Selector
+	// Settings can be changed while running with UpdateSettings, see DefaultSettings
+	Settings  Settings
+	Condition actions.ConditionOptions
+	Deferral  actions.DeferralOptions
+	Actions   actions.Actions
+	// Notifiers are published every termination notice to, and Auditor records the
+	// detections and actions if not nil
+	Notifiers []notify.Notifier
+	Auditor   audit.Auditor
+	// StateFile records the notice the notifications of a standalone handler were sent for,
+	// not recorded if empty. Handlers of nodes record it in an annotation of the node.
+	StateFile string
+	// NodeTerminations creates a NodeTermination for the notice instead of marking, cordoning
+	// and draining the node, the NodeTermination controller then takes the actions, see
+	// NodeTerminationReconciler. Not supported in lite builds.
+	NodeTerminations bool
+	// DeschedulerHints labels and taints the node while a termination is advised or deferred,
+	// so the descheduler moves workloads off the node before it is drained
+	DeschedulerHints bool
+	// Kured coordinates drains with kured if not nil, see KuredOptions. Not supported in lite
+	// builds.
+	Kured *KuredOptions
+	// MCOCoordination waits for drains of the OpenShift Machine Config Operator in progress
+	// before draining the node, and skips the drain if the MCO drained the node already
+	MCOCoordination bool
+	// NodeRateLimit spaces out the nodes a central or management cluster handler starts
+	// acting on, so a mass reclaim does not flood the API server. Not limited if zero.
+	NodeRateLimit RateLimit
+
+	// fleet is set by a central or multi-node handler for its node handlers, see handlerBase
+	fleet *fleetNotices
+	// broadcaster is set by a central handler to share its event broadcaster with its node
+	// handlers, which otherwise start their own
+	broadcaster record.EventBroadcaster
+}
+
+// RateLimit is a token bucket limit of QPS per second with bursts of Burst
+type RateLimit struct {
+	QPS   float64
+	Burst int
+}
+
+// pollClient returns the HTTP client of the options, constructing the default one if unset
+func (o Options) pollClient() (*http.Client, error) {
+	if o.HTTPClient != nil {
+		return o.HTTPClient, nil
+	}
+	return providers.NewPollClient(providers.PollClientOptions{})
+}
+
+// NewHandler constructs a Handler acting on the node of opts, the API server is reached with cfg
+func NewHandler(logger logr.Logger, cfg *rest.Config, opts Options) (Handler, error) {
+	nodes, eventSink, err := newNodeClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newNodeHandler(logger, nodes, eventSink, opts)
+}
+
+// newNodeHandler constructs a Handler acting on the node of opts with nodes, events are
+// recorded to eventSink
+func newNodeHandler(logger logr.Logger, nodes nodeClient, eventSink record.EventSink, opts Options) (Handler, error) {
+	condition, err := actions.NewCondition(opts.Condition)
+	if err != nil {
+		return nil, err
+	}
+	actionDeferral, err := actions.NewDeferral(opts.Deferral)
+	if err != nil {
+		return nil, err
+	}
+	httpClient, err := opts.pollClient()
+	if err != nil {
+		return nil, err
+	}
+	if opts.NodeTerminations && !nodeTerminationsSupported {
+		return nil, errors.New("NodeTerminations are not supported in lite builds")
+	}
+	nodeName := opts.NodeName
+
+	// Fail fast rather than once a termination notice arrives if the node can not be fetched
+	if _, err := nodes.getNode(context.TODO(), nodeName); err != nil {
+		return nil, fmt.Errorf("error fetching node %q: %w", nodeName, err)
+	}
+	nodeCache := newCachedNodeClient(nodes, nodeName)
+	nodes = newBreakerNodeClient(logger.WithValues("node", nodeName), nodeCache)
+
+	// A broadcaster started for the handler is shut down once it stops, a shared one by its owner
+	var ownBroadcaster record.EventBroadcaster
+	broadcaster := opts.broadcaster
+	if broadcaster == nil {
+		broadcaster = record.NewBroadcaster()
+		broadcaster.StartRecordingToSink(eventSink)
+		ownBroadcaster = broadcaster
+	}
+	recorder := broadcaster.NewRecorder(eventScheme, corev1.EventSource{Component: eventSourceComponent, Host: nodeName})
+
+	logger = logger.WithValues("node", nodeName, "namespace", opts.Namespace)
+	tracker := newStatusTracker(StatusConfig{
+		CloudProvider: opts.CloudProvider,
+		NodeName:      nodeName,
+		Namespace:     opts.Namespace,
+		NodeSelector:  selectorString(opts.NodeSelector),
+	})
+
+	base := &handlerBase{
+		nodes:         nodes,
+		nodeCache:     nodeCache,
+		httpClient:    httpClient,
+		cloudProvider: opts.CloudProvider,
+		metadataURL:   opts.MetadataURL,
+		nodeName:      nodeName,
+		nodeSelector:  opts.NodeSelector,
+		condition:     condition,
+		deferral:      actionDeferral,
+		actions:       opts.Actions,
+		namespace:     opts.Namespace,
+		log:           logger,
+		notifiers:     opts.Notifiers,
+		auditor:       opts.Auditor,
+		recorder:      recorder,
+		broadcaster:   ownBroadcaster,
+		handled:       &nodeHandledEvents{nodes: nodes, nodeName: nodeName},
+		fleet:         opts.fleet,
+
+		nodeTerminations: opts.NodeTerminations,
+		kured:            opts.Kured,
+		mcoCoordination:  opts.MCOCoordination,
+
+		statusTracker:  tracker,
+		settingsHolder: newSettingsHolder(opts.Settings),
+		simulations:    make(chan notify.Notice, 1),
+	}
+
+	if opts.DeschedulerHints {
+		base.hints = &deschedulerHints{reasons: map[string]bool{}}
+	}
+
+	handler, err := newProviderHandler(base)
+	if err != nil {
+		base.stopEvents()
+		return nil, err
+	}
+	return handler, nil
+}
+
+// NewStandaloneHandler constructs a Handler for instances that are not Kubernetes nodes. No
+// API server is contacted, termination notices are only published to the notifiers, e.g.
+// local hooks, and audited. Events are logged instead of being recorded. The options acting
+// on a node are ignored.
+func NewStandaloneHandler(logger logr.Logger, opts Options) (Handler, error) {
+	h, err := newStandaloneHandler(logger, opts)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// newStandaloneHandler constructs the standalone handler of NewStandaloneHandler
+func newStandaloneHandler(logger logr.Logger, opts Options) (*handlerBase, error) {
+	httpClient, err := opts.pollClient()
+	if err != nil {
+		return nil, err
+	}
+	nodeName := opts.NodeName
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(klog.Infof)
+	recorder := broadcaster.NewRecorder(eventScheme, corev1.EventSource{Component: eventSourceComponent, Host: nodeName})
+
+	logger = logger.WithValues("node", nodeName)
+	tracker := newStatusTracker(StatusConfig{
+		CloudProvider: opts.CloudProvider,
+		NodeName:      nodeName,
+	})
+
+	var handled handledEvents
+	if opts.StateFile != "" {
+		handled = &fileHandledEvents{path: opts.StateFile}
+	}
+
+	base := &handlerBase{
+		httpClient:    httpClient,
+		cloudProvider: opts.CloudProvider,
+		metadataURL:   opts.MetadataURL,
+		nodeName:      nodeName,
+		log:           logger,
+		notifiers:     opts.Notifiers,
+		auditor:       opts.Auditor,
+		recorder:      recorder,
+		broadcaster:   broadcaster,
+		handled:       handled,
+
+		statusTracker:  tracker,
+		settingsHolder: newSettingsHolder(opts.Settings),
+		simulations:    make(chan notify.Notice, 1),
+	}
+	if _, err := newProviderHandler(base); err != nil {
+		base.stopEvents()
+		return nil, err
+	}
+	return base, nil
+}
+
+// newProviderHandler validates the cloud provider of base, which runs the same way for every
+// provider, only the provider polled differs
+func newProviderHandler(base *handlerBase) (Handler, error) {
+	// The provider is constructed once to validate the options, so constructing it for a
+	// poll loop can not fail while running
+	provider, err := base.newProvider()
+	if err != nil {
+		return nil, err
+	}
+	base.eventType = provider.EventType()
+	return base, nil
+}
+
+// handlerBase holds the state shared by the provider handlers and implements
+// the actions taken once a provider detected a termination notice
+type handlerBase struct {
+	// nodes is nil for standalone handlers
+	nodes         nodeClient
+	nodeCache     *cachedNodeClient
+	httpClient    *http.Client
+	cloudProvider string
+	metadataURL   string
+	nodeName      string
+	nodeSelector  labels.Selector
+	condition     *actions.Condition
+	deferral      *actions.Deferral
+	actions       actions.Actions
+	namespace     string
+	log           logr.Logger
+	notifiers     []notify.Notifier
+	auditor       audit.Auditor
+	recorder      record.EventRecorder
+	// broadcaster records the events of recorder, it is shut down once Run returns. It is nil
+	// if the handler shares the broadcaster of a central handler.
+	broadcaster record.EventBroadcaster
+	// handled records the notice the notifications were sent for, nil if not recorded
+	handled handledEvents
+	// eventType is the event type of the termination notices of the cloud provider
+	eventType string
+	// fleet holds the termination notices polled by a central or multi-node handler for its
+	// node handlers, which poll it instead of a provider, nil otherwise
+	fleet *fleetNotices
+	// nodeTerminations delegates the actions on the node to the NodeTermination controller
+	nodeTerminations bool
+	// hints tracks the descheduler hints on the node, nil if they are disabled
+	hints *deschedulerHints
+	// kured coordinates drains with kured, nil if disabled
+	kured *KuredOptions
+	// mcoCoordination coordinates drains with the Machine Config Operator
+	mcoCoordination bool
+
+	*statusTracker
+	*settingsHolder
+
+	// simulations holds a simulated notice until the poll loop picks it up
+	simulations chan notify.Notice
+	// advisoryActive is 1 while the cloud provider signals a termination is likely
+	advisoryActive int32
+	// marked is set once the handler added the terminating condition to the node
+	marked bool
+}
+
+// actOnTermination marks the node for deletion and publishes the termination notice. Waiting
+// for the actions to be due stops with ctx, while the actions run until actionCtx is done.
+func (h *handlerBase) actOnTermination(ctx, actionCtx context.Context, logger logr.Logger, notice notify.Notice) error {
+	h.setState(StateDetected)
+	metrics.RecordTerminationDetected(notice.Provider, notice.EventType)
+
+	if h.nodes == nil {
+		return h.actStandalone(actionCtx, logger, notice)
+	}
+
+	// Failing to resolve the policy must not prevent the node from being marked,
+	// so fall back to the default actions
+	policy, err := resolvePolicy(actionCtx, h.nodes, h.nodeName)
+	if err != nil {
+		logger.Error(err, "Error resolving termination policy, using the default actions")
+	}
+	if policy.name != "" {
+		logger = logger.WithValues("policy", policy.name)
+	}
+	if notice.Deadline.IsZero() && policy.defaultDeadline != nil {
+		notice.Deadline = notice.DetectedAt.Add(policy.defaultDeadline.Duration)
+	}
+	if !notice.Deadline.IsZero() {
+		metrics.SetTerminationDeadline(notice.Provider, h.nodeName, notice.Deadline)
+	}
+	if policy.excluded {
+		logger.Info("Node is excluded from termination handling by policy, no actions taken")
+		h.setNotice(notice, nil)
+		h.setState(StateDone)
+		return nil
+	}
+
+	machine := h.lookupMachine(actionCtx, logger)
+	if machine != nil {
+		logger = logger.WithValues("machine", machine.Namespace+"/"+machine.Name)
+		h.recorder.Eventf(machine, corev1.EventTypeWarning, actions.TerminationRequestedReason, "The cloud provider will terminate the instance of node %s", h.nodeName)
+	}
+
+	markNode := policy.markNode && h.actions.MarkNode
+	actsOnNode := markNode || h.actions.Cordon || h.actions.Drain
+	var pending []string
+	if h.nodeTerminations {
+		if actsOnNode {
+			pending = append(pending, nodeTerminationAction)
+		}
+	} else {
+		if markNode {
+			pending = append(pending, markNodeAction)
+		}
+		if h.actions.Cordon {
+			pending = append(pending, cordonAction)
+		}
+		if h.actions.Drain {
+			pending = append(pending, drainAction)
+		}
+	}
+	if policy.notify && len(h.notifiers) > 0 {
+		pending = append(pending, notifyAction)
+	}
+	h.setNotice(notice, pending)
+
+	// The node is no longer acted on once deleted, but the notifications, e.g. local hooks,
+	// still run as the instance is going away
+	stopIfNodeDeleted := func(err error) error {
+		if !h.nodeDeleted() && !errors.Is(err, ErrNodeNotFound) {
+			return err
+		}
+		logger.Info("Node deleted, sending the notifications before stopping")
+		if policy.notify {
+			h.notifyOnce(actionCtx, logger, notice)
+			h.completeAction(notifyAction)
+		}
+		return nil
+	}
+
+	if err := h.waitWhilePaused(ctx, logger); err != nil {
+		return stopIfNodeDeleted(err)
+	}
+
+	h.setState(StateActing)
+	if actsOnNode {
+		auditDetection(actionCtx, logger, h.auditor, notice)
+	}
+	if h.nodeTerminations {
+		if actsOnNode {
+			logger.V(1).Info("Instance marked for termination, creating NodeTermination")
+			if err := h.runAction(actionCtx, logger, notice, nodeTerminationAction, func() error {
+				return createNodeTermination(actionCtx, h.nodes, notice, h.actions, markNode, h.deferral.DrainTime(notice, time.Now()))
+			}); err != nil {
+				return stopIfNodeDeleted(fmt.Errorf("error creating NodeTermination: %w", err))
+			}
+			h.marked = markNode
+		}
+		h.setState(StateDone)
+		if policy.notify {
+			h.notifyOnce(actionCtx, logger, notice)
+			h.completeAction(notifyAction)
+		}
+		return nil
+	}
+	if markNode {
+		logger.V(1).Info("Instance marked for termination, marking Machine for deletion")
+		if err := h.runAction(actionCtx, logger, notice, markNodeAction, func() error {
+			return markNodeForDeletion(actionCtx, h.nodes, h.condition, notice)
+		}); err != nil {
+			return stopIfNodeDeleted(fmt.Errorf("error marking machine: %w", err))
+		}
+		h.marked = true
+	} else if h.actions.Cordon || h.actions.Drain {
+		// Without the terminating condition, the annotation is what a restarted handler
+		// resumes from, so it is written before the node is acted on
+		if err := annotateNode(actionCtx, h.nodes, notice); err != nil {
+			return stopIfNodeDeleted(fmt.Errorf("error annotating node: %w", err))
+		}
+	}
+	if h.actions.Cordon {
+		logger.V(1).Info("Cordoning node")
+		if err := h.runAction(actionCtx, logger, notice, cordonAction, func() error {
+			return cordonNode(actionCtx, h.nodes, h.nodeName)
+		}); err != nil {
+			return stopIfNodeDeleted(err)
+		}
+	}
+	if h.actions.Drain {
+		// Only the drain is deferred, the notifications are not held back until it is due
+		if policy.notify && h.drainDeferred(notice) {
+			h.notifyOnce(actionCtx, logger, notice)
+			h.completeAction(notifyAction)
+		}
+		if err := h.waitForDeferral(ctx, logger, notice); err != nil {
+			return stopIfNodeDeleted(err)
+		}
+		if delay := h.actions.DrainDelayFor(notice, time.Now()); delay > 0 {
+			logger.Info("Waiting before draining the node", "delay", delay)
+			select {
+			case <-actionCtx.Done():
+				return actionCtx.Err()
+			case <-time.After(delay):
+			}
+		}
+		if h.awaitMCODrain(actionCtx, logger, notice) {
+			h.completeAction(drainAction)
+		} else {
+			releaseKuredLock := h.acquireKuredLock(actionCtx, logger, notice)
+			logger.V(1).Info("Draining node")
+			err := h.runAction(actionCtx, logger, notice, drainAction, func() error {
+				return h.nodes.drainNode(actionCtx, h.nodeName, h.actions.DrainTimeout)
+			})
+			releaseKuredLock()
+			if err != nil {
+				return stopIfNodeDeleted(err)
+			}
+		}
+	}
+	h.setState(StateDone)
+
+	if policy.notify {
+		h.notifyOnce(actionCtx, logger, notice)
+		h.completeAction(notifyAction)
+	}
+
+	return nil
+}
+
+// actStandalone publishes the termination notice of a standalone handler, which
+// takes no actions on the cluster
+func (h *handlerBase) actStandalone(ctx context.Context, logger logr.Logger, notice notify.Notice) error {
+	if !notice.Deadline.IsZero() {
+		metrics.SetTerminationDeadline(notice.Provider, h.nodeName, notice.Deadline)
+	}
+	logger.Info("Instance marked for termination, running hooks and notifications")
+	var pending []string
+	if len(h.notifiers) > 0 {
+		pending = append(pending, notifyAction)
+	}
+	h.setNotice(notice, pending)
+	auditDetection(ctx, logger, h.auditor, notice)
+	h.notifyOnce(ctx, logger, notice)
+	h.completeAction(notifyAction)
+	h.setState(StateDone)
+	return nil
+}
+
+// runAction runs an action on the node, audits its result and records its latency
+func (h *handlerBase) runAction(ctx context.Context, logger logr.Logger, notice notify.Notice, action string, run func() error) error {
+	err := catchPanic(logger, run)
+	auditAction(ctx, logger, h.auditor, notice, action, err)
+	if err != nil {
+		h.setError(err)
+		return err
+	}
+	metrics.RecordActionCompleted(notice.Provider, action, time.Since(notice.DetectedAt))
+	h.completeAction(action)
+	return nil
+}
+
+// sendNotifications publishes the termination notice to every notifier. Failures are only
+// logged as they must not prevent the remaining notifiers from being called.
+func sendNotifications(ctx context.Context, logger logr.Logger, notifiers []notify.Notifier, notice notify.Notice) {
+	for _, notifier := range notifiers {
+		notifier := notifier
+		if err := catchPanic(logger, func() error { return notifier.Notify(ctx, notice) }); err != nil {
+			logger.Error(err, "Error sending termination notification")
+		}
+	}
+}
+
+// auditDetection records the detection of the termination notice. Records that could not
+// be delivered stay spooled by the auditor, so failures are only logged.
+func auditDetection(ctx context.Context, logger logr.Logger, auditor audit.Auditor, notice notify.Notice) {
+	if auditor == nil {
+		return
+	}
+
+	detection := audit.Record{
+		Time:      notice.DetectedAt,
+		Type:      audit.RecordTypeDetection,
+		Node:      notice.NodeName,
+		Provider:  notice.Provider,
+		EventType: notice.EventType,
+		EventID:   notice.EventID,
+		Deadline:  noticeDeadline(notice),
+		Simulated: notice.Simulated,
+		Raw:       notice.Raw,
+	}
+	if err := auditor.Audit(ctx, detection); err != nil {
+		logger.Error(err, "Error delivering audit record")
+	}
+}
+
+// auditAction records the result of an action taken for the termination notice
+func auditAction(ctx context.Context, logger logr.Logger, auditor audit.Auditor, notice notify.Notice, action string, actionErr error) {
+	if auditor == nil {
+		return
+	}
+
+	result := audit.Record{
+		Time:      time.Now(),
+		Type:      audit.RecordTypeAction,
+		Node:      notice.NodeName,
+		Provider:  notice.Provider,
+		EventType: notice.EventType,
+		EventID:   notice.EventID,
+		Deadline:  noticeDeadline(notice),
+		Action:    action,
+		Result:    audit.ResultSuccess,
+		Simulated: notice.Simulated,
+	}
+	if actionErr != nil {
+		result.Result = audit.ResultFailure
+		result.Error = actionErr.Error()
+	}
+	if err := auditor.Audit(ctx, result); err != nil {
+		logger.Error(err, "Error delivering audit record")
+	}
+}
+
+// noticeDeadline returns the deadline of the notice, nil if it is unknown
+func noticeDeadline(notice notify.Notice) *time.Time {
+	if notice.Deadline.IsZero() {
+		return nil
+	}
+	return &notice.Deadline
+}
+
+func markNodeForDeletion(ctx context.Context, nodes nodeClient, condition *actions.Condition, notice notify.Notice) error {
+	terminatingCondition, err := condition.Render(notice)
+	if err != nil {
+		return err
+	}
+
+	node, err := nodes.getNode(ctx, notice.NodeName)
+	if err != nil {
+		return fmt.Errorf("error fetching node: %w", err)
+	}
+
+	// A condition already marked true is kept as is
+	if current := conditions.Find(node.Status.Conditions, terminatingCondition.Type); current == nil || current.Status != corev1.ConditionTrue {
+		if err := nodes.applyNodeCondition(ctx, node.Name, conditions.Update(current, terminatingCondition)); err != nil {
+			return fmt.Errorf("error applying node condition: %w", err)
+		}
+	}
+
+	// The condition is what MachineHealthChecks act on, the annotation only
+	// adds details so it is written once the condition is in place
+	if err := annotateNodeWithNotice(ctx, nodes, node, notice); err != nil {
+		return fmt.Errorf("error annotating node: %w", err)
+	}
+	return nil
+}
+
+// createNodeTermination creates the NodeTermination of the notice, owned by the node so it is
+// deleted with it. The drain is deferred until drainAt if it is in the future.
+func createNodeTermination(ctx context.Context, nodes nodeClient, notice notify.Notice, nodeActions actions.Actions, markNode bool, drainAt time.Time) error {
+	node, err := nodes.getNode(ctx, notice.NodeName)
+	if err != nil {
+		return fmt.Errorf("error fetching node: %w", err)
+	}
+
+	termination := &v1alpha1.NodeTermination{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: node.Name,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "v1",
+				Kind:       "Node",
+				Name:       node.Name,
+				UID:        node.UID,
+			}},
+		},
+		Spec: v1alpha1.NodeTerminationSpec{
+			NodeName:   node.Name,
+			Provider:   notice.Provider,
+			EventType:  notice.EventType,
+			EventID:    notice.EventID,
+			DetectedAt: metav1.NewTime(notice.DetectedAt),
+			Simulated:  notice.Simulated,
+			Actions: v1alpha1.NodeTerminationActions{
+				MarkNode:     markNode,
+				Cordon:       nodeActions.Cordon,
+				Drain:        nodeActions.Drain,
+				DrainTimeout: metav1.Duration{Duration: nodeActions.DrainTimeout},
+				DrainDelay:   metav1.Duration{Duration: nodeActions.DrainDelay},
+			},
+		},
+	}
+	if !notice.Deadline.IsZero() {
+		deadline := metav1.NewTime(notice.Deadline)
+		termination.Spec.Deadline = &deadline
+	}
+	if nodeActions.Drain && drainAt.After(time.Now()) {
+		notBefore := metav1.NewTime(drainAt)
+		termination.Spec.Actions.DrainNotBefore = &notBefore
+	}
+	return nodes.ensureNodeTermination(ctx, termination)
+}
+
+// cordonNode marks the node unschedulable
+func cordonNode(ctx context.Context, nodes nodeClient, nodeName string) error {
+	node, err := nodes.getNode(ctx, nodeName)
+	if err != nil {
+		return fmt.Errorf("error fetching node: %w", err)
+	}
+	if node.Spec.Unschedulable {
+		return nil
+	}
+
+	original := node.DeepCopy()
+	node.Spec.Unschedulable = true
+	if err := nodes.patchNode(ctx, original, node); err != nil {
+		return fmt.Errorf("error cordoning node: %w", err)
+	}
+	return nil
+}
+
+// noticeAnnotation is the machine readable description of the termination
+// notice stored in the terminationNoticeAnnotation annotation
+type noticeAnnotation struct {
+	EventType  string `json:"eventType"`
+	EventID    string `json:"eventID,omitempty"`
+	Provider   string `json:"provider"`
+	Deadline   string `json:"deadline,omitempty"`
+	DetectedAt string `json:"detectedAt"`
+	Simulated  bool   `json:"simulated,omitempty"`
+	Raw        string `json:"raw,omitempty"`
+	Deferrable bool   `json:"deferrable,omitempty"`
+}
+
+// annotateNodeWithNotice stores the details of the notice in an annotation paired with
+// the terminating condition, so controllers do not have to parse the condition message
+func annotateNodeWithNotice(ctx context.Context, nodes nodeClient, node *corev1.Node, notice notify.Notice) error {
+	value, err := noticeAnnotationValue(notice)
+	if err != nil {
+		return err
+	}
+
+	if node.Annotations[terminationNoticeAnnotation] == value {
+		return nil
+	}
+	original := node.DeepCopy()
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	node.Annotations[terminationNoticeAnnotation] = value
+	return nodes.patchNode(ctx, original, node)
+}
+
+// annotateNode fetches the node of the notice and annotates it with the notice
+func annotateNode(ctx context.Context, nodes nodeClient, notice notify.Notice) error {
+	node, err := nodes.getNode(ctx, notice.NodeName)
+	if err != nil {
+		return fmt.Errorf("error fetching node: %w", err)
+	}
+	return annotateNodeWithNotice(ctx, nodes, node, notice)
+}
+
+// noticeAnnotationValue returns the value of the terminationNoticeAnnotation annotation for the notice
+func noticeAnnotationValue(notice notify.Notice) (string, error) {
+	annotation := noticeAnnotation{
+		EventType:  notice.EventType,
+		EventID:    notice.EventID,
+		Provider:   notice.Provider,
+		DetectedAt: notice.DetectedAt.UTC().Format(time.RFC3339),
+		Simulated:  notice.Simulated,
+		Raw:        notice.Raw,
+		Deferrable: notice.Deferrable,
+	}
+	if !notice.Deadline.IsZero() {
+		annotation.Deadline = notice.Deadline.UTC().Format(time.RFC3339)
+	}
+
+	value, err := json.Marshal(annotation)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling notice: %w", err)
+	}
+	return string(value), nil
+}
@@ -0,0 +1,471 @@
+package agent
+
+import (
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/actions"
+	"github.com/alexander-demichev/termination-handler/pkg/conditions"
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/alexander-demichev/termination-handler/pkg/testutil/fakeimds"
+	logrtesting "github.com/go-logr/logr/testing"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// The tests of this file run the whole node handler against a fake metadata server and an
+// in-memory API server, and check what ends up on the node.
+
+// testTimeout bounds waiting for the handler to act
+const testTimeout = 10 * time.Second
+
+// fakeEventSink discards the recorded events
+type fakeEventSink struct{}
+
+func (fakeEventSink) Create(event *corev1.Event) (*corev1.Event, error) { return event, nil }
+func (fakeEventSink) Update(event *corev1.Event) (*corev1.Event, error) { return event, nil }
+func (fakeEventSink) Patch(event *corev1.Event, data []byte) (*corev1.Event, error) {
+	return event, nil
+}
+
+// testSettings poll often, so the tests do not wait for the handler
+func testSettings() Settings {
+	settings := DefaultSettings()
+	settings.PollInterval = 50 * time.Millisecond
+	settings.ShutdownBudget = time.Second
+	settings.Retry.InitialInterval = 10 * time.Millisecond
+	return settings
+}
+
+// startHandler runs a node handler of the node of nodes against imds until the test ends, on
+// AWS unless another cloud provider is given
+func startHandler(t *testing.T, nodes *fakeNodeClient, imds *fakeimds.Server, opts Options) Handler {
+	t.Helper()
+	server := httptest.NewServer(imds)
+	t.Cleanup(server.Close)
+
+	if opts.CloudProvider == "" {
+		opts.CloudProvider = "aws"
+	}
+	opts.MetadataURL = server.URL
+	opts.HTTPClient = server.Client()
+	if opts.NodeName == "" {
+		opts.NodeName = "node"
+	}
+	if opts.Settings.PollInterval == 0 {
+		opts.Settings = testSettings()
+	}
+	handler, err := newNodeHandler(logrtesting.NullLogger{}, nodes, fakeEventSink{}, opts)
+	if err != nil {
+		t.Fatalf("constructing handler: %v", err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() { done <- handler.Run(stop) }()
+	t.Cleanup(func() {
+		close(stop)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("handler failed: %v", err)
+			}
+		case <-time.After(testTimeout):
+			t.Error("handler did not stop")
+		}
+	})
+	return handler
+}
+
+// terminating returns a fake metadata server reporting a termination notice from the start
+func terminating() *fakeimds.Server {
+	return fakeimds.New(fakeimds.Timeline{{Phase: fakeimds.PhaseTerminating}}, fakeimds.Options{NoticePeriod: 2 * time.Minute})
+}
+
+// waitForNode waits until the node satisfies done
+func waitForNode(t *testing.T, nodes *fakeNodeClient, name string, done func(*corev1.Node) bool) *corev1.Node {
+	t.Helper()
+	var node *corev1.Node
+	err := wait.PollImmediate(10*time.Millisecond, testTimeout, func() (bool, error) {
+		node = nodes.node(name)
+		return node != nil && done(node), nil
+	})
+	if err != nil {
+		t.Fatalf("node not updated as expected: %+v", node)
+	}
+	return node
+}
+
+// waitForGoroutines waits until at most max goroutines run, it returns the number running
+func waitForGoroutines(max int, timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	for {
+		n := runtime.NumGoroutine()
+		if n <= max || time.Now().After(deadline) {
+			return n
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// terminatingCondition returns the terminating condition of the node, nil if there is none
+func terminatingCondition(node *corev1.Node) *corev1.NodeCondition {
+	return conditions.Find(node.Status.Conditions, actions.TerminatingConditionType)
+}
+
+func TestHandlerMarksNode(t *testing.T) {
+	nodes := newFakeNodeClient(testNode("node"))
+	startHandler(t, nodes, terminating(), Options{Actions: actions.Actions{MarkNode: true}})
+
+	node := waitForNode(t, nodes, "node", func(node *corev1.Node) bool {
+		return node.Annotations[terminationNoticeAnnotation] != ""
+	})
+	condition := terminatingCondition(node)
+	if condition == nil || condition.Status != corev1.ConditionTrue || condition.Reason != actions.TerminationRequestedReason {
+		t.Errorf("terminating condition %+v, want true with reason %s", condition, actions.TerminationRequestedReason)
+	}
+	if condition != nil && (condition.LastTransitionTime.IsZero() || condition.LastHeartbeatTime.IsZero()) {
+		t.Errorf("terminating condition %+v without its times", condition)
+	}
+	if ready := conditions.Find(node.Status.Conditions, corev1.NodeReady); ready == nil || ready.Status != corev1.ConditionTrue {
+		t.Errorf("ready condition lost: %+v", node.Status.Conditions)
+	}
+	if node.Spec.Unschedulable {
+		t.Error("node cordoned in mark-only mode")
+	}
+
+	// Wait for more polls, the notice is acted on once
+	time.Sleep(5 * testSettings().PollInterval)
+	if drains := nodes.drainCount("node"); drains != 0 {
+		t.Errorf("node drained %d times in mark-only mode", drains)
+	}
+}
+
+func TestHandlerKeepsConditionsOfOtherWriters(t *testing.T) {
+	node := testNode("node")
+	transition := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	node.Status.Conditions = append(node.Status.Conditions, corev1.NodeCondition{
+		Type:               corev1.NodeMemoryPressure,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: transition,
+	})
+	nodes := newFakeNodeClient(node)
+	startHandler(t, nodes, terminating(), Options{Actions: actions.Actions{MarkNode: true}})
+
+	node = waitForNode(t, nodes, "node", func(node *corev1.Node) bool {
+		condition := terminatingCondition(node)
+		return condition != nil && condition.Status == corev1.ConditionTrue
+	})
+	if len(node.Status.Conditions) != 3 {
+		t.Fatalf("got conditions %+v, want ready, memory pressure and terminating", node.Status.Conditions)
+	}
+	memory := conditions.Find(node.Status.Conditions, corev1.NodeMemoryPressure)
+	if memory == nil || memory.Status != corev1.ConditionFalse || !memory.LastTransitionTime.Equal(&transition) {
+		t.Errorf("memory pressure condition changed: %+v", memory)
+	}
+}
+
+func TestHandlerKeepsTransitionTimeOfMarkedNode(t *testing.T) {
+	node := testNode("node")
+	transition := metav1.NewTime(time.Now().Add(-time.Minute).Truncate(time.Second))
+	node.Status.Conditions = append(node.Status.Conditions, corev1.NodeCondition{
+		Type:               actions.TerminatingConditionType,
+		Status:             corev1.ConditionTrue,
+		Reason:             actions.TerminationRequestedReason,
+		LastHeartbeatTime:  transition,
+		LastTransitionTime: transition,
+	})
+	nodes := newFakeNodeClient(node)
+	startHandler(t, nodes, terminating(), Options{Actions: actions.Actions{MarkNode: true}})
+
+	node = waitForNode(t, nodes, "node", func(node *corev1.Node) bool {
+		return node.Annotations[terminationNoticeAnnotation] != ""
+	})
+	condition := terminatingCondition(node)
+	if condition == nil || !condition.LastTransitionTime.Equal(&transition) {
+		t.Errorf("terminating condition %+v, want the transition time %v kept", condition, transition)
+	}
+}
+
+func TestHandlerCordonsAndDrainsNode(t *testing.T) {
+	nodes := newFakeNodeClient(testNode("node"))
+	startHandler(t, nodes, terminating(), Options{Actions: actions.Actions{
+		MarkNode:     true,
+		Cordon:       true,
+		Drain:        true,
+		DrainTimeout: time.Second,
+	}})
+
+	waitForNode(t, nodes, "node", func(*corev1.Node) bool {
+		return nodes.drainCount("node") > 0
+	})
+	node := nodes.node("node")
+	if !node.Spec.Unschedulable {
+		t.Error("drained node not cordoned")
+	}
+	if condition := terminatingCondition(node); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Errorf("terminating condition %+v, want true", condition)
+	}
+
+	time.Sleep(5 * testSettings().PollInterval)
+	if drains := nodes.drainCount("node"); drains != 1 {
+		t.Errorf("node drained %d times, want once", drains)
+	}
+}
+
+func TestHandlerWithoutNotice(t *testing.T) {
+	nodes := newFakeNodeClient(testNode("node"))
+	imds := fakeimds.New(nil, fakeimds.Options{})
+	handler := startHandler(t, nodes, imds, Options{Actions: actions.Actions{MarkNode: true, Cordon: true, Drain: true}})
+
+	err := wait.PollImmediate(10*time.Millisecond, testTimeout, func() (bool, error) {
+		return handler.Status().State == StatePolling, nil
+	})
+	if err != nil {
+		t.Fatalf("handler in state %s, want %s", handler.Status().State, StatePolling)
+	}
+	time.Sleep(5 * testSettings().PollInterval)
+	if writes := nodes.writeCount(); writes != 0 {
+		t.Errorf("node written %d times without a notice: %+v", writes, nodes.node("node"))
+	}
+	if drains := nodes.drainCount("node"); drains != 0 {
+		t.Errorf("node drained %d times without a notice", drains)
+	}
+}
+
+func TestHandlerActsOnLaterNotice(t *testing.T) {
+	nodes := newFakeNodeClient(testNode("node"))
+	imds := fakeimds.New(nil, fakeimds.Options{NoticePeriod: 2 * time.Minute})
+	startHandler(t, nodes, imds, Options{Actions: actions.Actions{MarkNode: true, Cordon: true}})
+
+	time.Sleep(5 * testSettings().PollInterval)
+	if condition := terminatingCondition(nodes.node("node")); condition != nil {
+		t.Fatalf("terminating condition %+v before the notice", condition)
+	}
+
+	imds.SetPhase(fakeimds.PhaseTerminating)
+	node := waitForNode(t, nodes, "node", func(node *corev1.Node) bool {
+		return node.Spec.Unschedulable
+	})
+	if condition := terminatingCondition(node); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Errorf("terminating condition %+v, want true", condition)
+	}
+}
+
+func TestHandlerStopsItsGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	// Cleanups run last in first out, so this one runs once the handler and the server stopped
+	t.Cleanup(func() {
+		if n := waitForGoroutines(before, testTimeout); n > before {
+			buf := make([]byte, 1<<20)
+			t.Errorf("%d goroutines left after the handler stopped, %d before it started:\n%s", n, before, buf[:runtime.Stack(buf, true)])
+		}
+	})
+	nodes := newFakeNodeClient(testNode("node"))
+	startHandler(t, nodes, terminating(), Options{Actions: actions.Actions{MarkNode: true}})
+
+	waitForNode(t, nodes, "node", func(node *corev1.Node) bool {
+		return node.Annotations[terminationNoticeAnnotation] != ""
+	})
+}
+
+func TestHandlerLeavesPausedNode(t *testing.T) {
+	nodes := newFakeNodeClient(testNode("node"))
+	startHandler(t, nodes, terminating(), Options{Actions: actions.Actions{MarkNode: true, Cordon: true}})
+
+	node := waitForNode(t, nodes, "node", func(node *corev1.Node) bool {
+		return node.Spec.Unschedulable && terminatingCondition(node) != nil
+	})
+
+	// An operator pauses the handler and reverts its actions
+	node.Annotations[pausedAnnotation] = "true"
+	node.Spec.Unschedulable = false
+	node.Status.Conditions = node.Status.Conditions[:1]
+	nodes.setNode(node)
+	time.Sleep(5 * testSettings().PollInterval)
+	node = nodes.node("node")
+	if node.Spec.Unschedulable {
+		t.Error("paused node cordoned again")
+	}
+	if condition := terminatingCondition(node); condition != nil {
+		t.Errorf("terminating condition %+v added again to the paused node", condition)
+	}
+
+	// The actions are restored once the node is resumed
+	delete(node.Annotations, pausedAnnotation)
+	nodes.setNode(node)
+	waitForNode(t, nodes, "node", func(node *corev1.Node) bool {
+		return node.Spec.Unschedulable && terminatingCondition(node) != nil
+	})
+}
+
+func TestHandlerDefersOnlyDrain(t *testing.T) {
+	nodes := newFakeNodeClient(testNode("node"))
+	imds := fakeimds.New(fakeimds.Timeline{{Phase: fakeimds.PhaseMaintenance}}, fakeimds.Options{NoticePeriod: 10 * time.Second})
+	handler := startHandler(t, nodes, imds, Options{
+		CloudProvider: "azure",
+		Actions:       actions.Actions{MarkNode: true, Cordon: true, Drain: true, DrainTimeout: time.Second},
+		// The reboot is drained for 3s before it, whose NotBefore has a precision of seconds
+		Deferral: actions.DeferralOptions{LeadTime: 7 * time.Second},
+	})
+
+	// The node is marked and cordoned at once, while the drain waits
+	waitForNode(t, nodes, "node", func(node *corev1.Node) bool {
+		return node.Spec.Unschedulable && terminatingCondition(node) != nil
+	})
+	err := wait.PollImmediate(10*time.Millisecond, testTimeout, func() (bool, error) {
+		return handler.Status().State == StateDeferred, nil
+	})
+	if err != nil {
+		t.Errorf("handler in state %s, want %s", handler.Status().State, StateDeferred)
+	}
+	if drains := nodes.drainCount("node"); drains != 0 {
+		t.Fatalf("node drained %d times before the deferral elapsed", drains)
+	}
+
+	waitForNode(t, nodes, "node", func(*corev1.Node) bool {
+		return nodes.drainCount("node") > 0
+	})
+}
+
+func TestHandlerIgnoresMaintenanceWithoutDeferral(t *testing.T) {
+	nodes := newFakeNodeClient(testNode("node"))
+	imds := fakeimds.New(fakeimds.Timeline{{Phase: fakeimds.PhaseMaintenance}}, fakeimds.Options{NoticePeriod: 10 * time.Second})
+	startHandler(t, nodes, imds, Options{CloudProvider: "azure", Actions: actions.Actions{MarkNode: true}})
+
+	time.Sleep(5 * testSettings().PollInterval)
+	if writes := nodes.writeCount(); writes != 0 {
+		t.Errorf("node written %d times for maintenance while drains are not deferred: %+v", writes, nodes.node("node"))
+	}
+}
+
+func TestHandlerDoesNotDeferInterruption(t *testing.T) {
+	nodes := newFakeNodeClient(testNode("node"))
+	startHandler(t, nodes, terminating(), Options{
+		Actions: actions.Actions{MarkNode: true, Cordon: true, Drain: true, DrainTimeout: time.Second},
+		// The spot interruption is two minutes ahead, but it is not scheduled maintenance
+		Deferral: actions.DeferralOptions{LeadTime: time.Second},
+	})
+
+	waitForNode(t, nodes, "node", func(*corev1.Node) bool {
+		return nodes.drainCount("node") > 0
+	})
+}
+
+func TestHandlerStatusReportsReloadedSettings(t *testing.T) {
+	nodes := newFakeNodeClient(testNode("node"))
+	handler := startHandler(t, nodes, fakeimds.New(nil, fakeimds.Options{}), Options{Actions: actions.Actions{MarkNode: true}})
+	if interval := handler.Status().Config.PollInterval; interval != testSettings().PollInterval.String() {
+		t.Errorf("status reports the poll interval %s, want %s", interval, testSettings().PollInterval)
+	}
+
+	settings := testSettings()
+	settings.PollInterval = 20 * time.Millisecond
+	handler.UpdateSettings(settings)
+	if interval := handler.Status().Config.PollInterval; interval != settings.PollInterval.String() {
+		t.Errorf("status reports the poll interval %s after a reload, want %s", interval, settings.PollInterval)
+	}
+}
+
+// annotatedNode returns a node carrying the notice annotation of a handler that acted on notice
+// before it was restarted
+func annotatedNode(t *testing.T, notice notify.Notice) *corev1.Node {
+	t.Helper()
+	value, err := noticeAnnotationValue(notice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := testNode("node")
+	node.Annotations = map[string]string{terminationNoticeAnnotation: value}
+	return node
+}
+
+func TestHandlerResumesDeferralAfterRestart(t *testing.T) {
+	// The previous handler marked and cordoned the node, and was restarted while the drain
+	// on the scheduled maintenance was deferred
+	notice := notify.Notice{
+		NodeName:   "node",
+		Provider:   "azure",
+		EventType:  "Reboot",
+		DetectedAt: time.Now().Add(-time.Minute).Truncate(time.Second),
+		Deadline:   time.Now().Add(10 * time.Second).Truncate(time.Second),
+		Deferrable: true,
+	}
+	node := annotatedNode(t, notice)
+	node.Spec.Unschedulable = true
+	node.Status.Conditions = append(node.Status.Conditions, corev1.NodeCondition{
+		Type:               actions.TerminatingConditionType,
+		Status:             corev1.ConditionTrue,
+		Reason:             actions.TerminationRequestedReason,
+		LastTransitionTime: metav1.NewTime(notice.DetectedAt),
+	})
+	nodes := newFakeNodeClient(node)
+	handler := startHandler(t, nodes, fakeimds.New(nil, fakeimds.Options{}), Options{
+		Actions:  actions.Actions{MarkNode: true, Cordon: true, Drain: true, DrainTimeout: time.Second},
+		Deferral: actions.DeferralOptions{LeadTime: 7 * time.Second},
+	})
+
+	err := wait.PollImmediate(10*time.Millisecond, testTimeout, func() (bool, error) {
+		return handler.Status().State == StateDeferred, nil
+	})
+	if err != nil {
+		t.Fatalf("handler in state %s, want the recovered drain %s", handler.Status().State, StateDeferred)
+	}
+	if drains := nodes.drainCount("node"); drains != 0 {
+		t.Fatalf("node drained %d times in the deferral window", drains)
+	}
+	waitForNode(t, nodes, "node", func(*corev1.Node) bool {
+		return nodes.drainCount("node") > 0
+	})
+}
+
+func TestHandlerResumesDrainOfCordonedNodeAfterRestart(t *testing.T) {
+	// The previous handler only cordons and drains, it was restarted before the drain
+	notice := notify.Notice{
+		NodeName:   "node",
+		Provider:   "aws",
+		EventType:  "SpotInterruption",
+		DetectedAt: time.Now().Add(-time.Minute).Truncate(time.Second),
+		Deadline:   time.Now().Add(time.Minute).Truncate(time.Second),
+	}
+	node := annotatedNode(t, notice)
+	node.Spec.Unschedulable = true
+	nodes := newFakeNodeClient(node)
+	startHandler(t, nodes, fakeimds.New(nil, fakeimds.Options{}), Options{
+		Actions: actions.Actions{Cordon: true, Drain: true, DrainTimeout: time.Second},
+	})
+
+	waitForNode(t, nodes, "node", func(*corev1.Node) bool {
+		return nodes.drainCount("node") > 0
+	})
+	if condition := terminatingCondition(nodes.node("node")); condition != nil {
+		t.Errorf("terminating condition %+v added in a mode not marking nodes", condition)
+	}
+}
+
+func TestHandlerAnnotatesNodeWithoutMarking(t *testing.T) {
+	nodes := newFakeNodeClient(testNode("node"))
+	startHandler(t, nodes, terminating(), Options{Actions: actions.Actions{Cordon: true}})
+
+	node := waitForNode(t, nodes, "node", func(node *corev1.Node) bool {
+		return node.Spec.Unschedulable
+	})
+	if node.Annotations[terminationNoticeAnnotation] == "" {
+		t.Error("cordoned node without the notice annotation")
+	}
+}
+
+func TestHandlerLeavesNodeCordonedByOthers(t *testing.T) {
+	node := testNode("node")
+	node.Spec.Unschedulable = true
+	nodes := newFakeNodeClient(node)
+	startHandler(t, nodes, fakeimds.New(nil, fakeimds.Options{}), Options{Actions: actions.Actions{Cordon: true, Drain: true}})
+
+	time.Sleep(5 * testSettings().PollInterval)
+	if drains := nodes.drainCount("node"); drains != 0 {
+		t.Errorf("node cordoned by an operator drained %d times", drains)
+	}
+}
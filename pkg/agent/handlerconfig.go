@@ -0,0 +1,78 @@
+//go:build !lite
+// +build !lite
+
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alexander-demichev/termination-handler/pkg/apis/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// HandlerConfigReconciler is the configuration controller. It validates every
+// TerminationHandlerConfig and records the result in its status, so a bad change is
+// reported on the resource before the agents pick it up. The agents still validate the
+// configuration they load and keep the current one if it is invalid.
+type HandlerConfigReconciler struct {
+	client   client.Client
+	validate func(*v1alpha1.TerminationHandlerConfigSpec) error
+	log      logr.Logger
+	recorder record.EventRecorder
+}
+
+// NewHandlerConfigReconciler constructs a HandlerConfigReconciler with the client of mgr,
+// validating the configurations with validate
+func NewHandlerConfigReconciler(logger logr.Logger, mgr manager.Manager, validate func(*v1alpha1.TerminationHandlerConfigSpec) error) *HandlerConfigReconciler {
+	return &HandlerConfigReconciler{
+		client:   mgr.GetClient(),
+		validate: validate,
+		log:      logger.WithName("handler-config"),
+		recorder: mgr.GetEventRecorderFor(eventSourceComponent),
+	}
+}
+
+// SetupWithManager adds the controller to mgr
+func (r *HandlerConfigReconciler) SetupWithManager(mgr manager.Manager) error {
+	return builder.ControllerManagedBy(mgr).
+		For(&v1alpha1.TerminationHandlerConfig{}).
+		Complete(r)
+}
+
+// Reconcile implements reconcile.Reconciler, it validates the spec of the
+// TerminationHandlerConfig unless its generation was validated already
+func (r *HandlerConfigReconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
+	ctx := context.Background()
+	handlerConfig := &v1alpha1.TerminationHandlerConfig{}
+	if err := r.client.Get(ctx, req.NamespacedName, handlerConfig); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	if handlerConfig.Status.ObservedGeneration == handlerConfig.Generation {
+		return reconcile.Result{}, nil
+	}
+	logger := r.log.WithValues("config", handlerConfig.Name, "generation", handlerConfig.Generation)
+
+	status := v1alpha1.TerminationHandlerConfigStatus{ObservedGeneration: handlerConfig.Generation, Valid: true}
+	if err := r.validate(&handlerConfig.Spec); err != nil {
+		status.Valid = false
+		status.Message = err.Error()
+		logger.Info("Invalid configuration, the agents keep their current configuration", "reason", err.Error())
+		r.recorder.Eventf(handlerConfig, corev1.EventTypeWarning, "InvalidConfig", "Generation %d is invalid, the agents keep their current configuration: %v", handlerConfig.Generation, err)
+	} else {
+		logger.Info("Configuration validated")
+		r.recorder.Eventf(handlerConfig, corev1.EventTypeNormal, "ValidConfig", "Generation %d is valid, the agents apply it on their next reload", handlerConfig.Generation)
+	}
+
+	handlerConfig.Status = status
+	if err := r.client.Status().Update(ctx, handlerConfig); err != nil {
+		return reconcile.Result{}, fmt.Errorf("error updating the status of the configuration: %v", err)
+	}
+	return reconcile.Result{}, nil
+}
@@ -0,0 +1,203 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/conditions"
+	"github.com/alexander-demichev/termination-handler/pkg/metrics"
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/alexander-demichev/termination-handler/pkg/providers"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// conditionHeartbeatInterval is the interval at which the terminating condition is refreshed
+	// once the node is marked, matching the interval of the kubelet's node status updates
+	conditionHeartbeatInterval = time.Minute
+
+	// cancelConfirmations is the number of consecutive polls that must no longer report the
+	// notice before it is considered cancelled, so a single odd response does not unmark the
+	// node even if the condition TTL is shorter than the poll interval
+	cancelConfirmations = 3
+
+	// terminationCancelledReason is the reason of the terminating condition once the notice is cancelled
+	terminationCancelledReason = "TerminationCancelled"
+)
+
+// watchTerminating keeps the handler running once the actions for the notice are taken, so
+// metrics and status stay served until the node is deleted or ctx is done. If the handler
+// marked the node, the heartbeat of the terminating condition is refreshed and the
+// condition is added again as soon as something removes it, as is the cordon. The termination
+// notice endpoint keeps being polled to verify the condition is still justified, as some
+// interruptions resolve without the instance being terminated. Once the notice has not been
+// reported for the condition TTL, it is considered cancelled and the condition is set to
+// false. It returns whether the notice was cancelled.
+func (h *handlerBase) watchTerminating(ctx context.Context, logger logr.Logger, notice notify.Notice) (bool, error) {
+	if h.nodes == nil {
+		<-ctx.Done()
+		return false, nil
+	}
+
+	provider, err := h.newProvider()
+	if err != nil {
+		return false, err
+	}
+
+	absent := 0
+	var absentSince time.Time
+	// pollNotice returns whether the notice is cancelled
+	pollNotice := func() bool {
+		pollCtx, cancel := h.pollContext(ctx)
+		defer cancel()
+		var current *providers.TerminationNotice
+		err := catchPanic(logger, func() error {
+			var err error
+			current, err = provider.Poll(pollCtx, logger)
+			return err
+		})
+		// The sinks are only sent the remaining time when it is set
+		if !notice.Deadline.IsZero() {
+			metrics.SetTerminationDeadline(notice.Provider, h.nodeName, notice.Deadline)
+		}
+		switch {
+		case err != nil:
+			logger.V(1).Info("Error polling termination endpoint", "error", err.Error())
+		case current != nil:
+			absent = 0
+		default:
+			if absent == 0 {
+				absentSince = time.Now()
+			}
+			absent++
+			return absent >= cancelConfirmations && time.Since(absentSince) >= h.condition.TTL()
+		}
+		return false
+	}
+
+	pollTimer := time.NewTimer(0)
+	defer pollTimer.Stop()
+	heartbeat := time.NewTicker(conditionHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		var deleted bool
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-pollTimer.C:
+			// Simulated notices are never reported by the cloud provider
+			if !notice.Simulated && pollNotice() {
+				return true, h.cancelTermination(ctx, logger)
+			}
+			pollTimer.Reset(h.pollInterval())
+			continue
+		case <-heartbeat.C:
+			deleted = h.checkNode(ctx, logger, notice, true)
+		case <-h.nodeChanges():
+			deleted = h.checkNode(ctx, logger, notice, false)
+		}
+		if deleted {
+			return false, nil
+		}
+	}
+}
+
+// checkNode restores the terminating condition and the cordon if something reverted them,
+// the heartbeat of the condition is refreshed if heartbeat is set. Paused nodes are left as
+// they are, so operators can revert the actions. It returns whether the node was deleted.
+func (h *handlerBase) checkNode(ctx context.Context, logger logr.Logger, notice notify.Notice, heartbeat bool) bool {
+	node, err := h.nodes.getNode(ctx, h.nodeName)
+	if errors.Is(err, ErrNodeNotFound) {
+		return true
+	}
+	if err != nil {
+		logger.Error(err, "Error fetching node to refresh the terminating condition")
+		return false
+	}
+	if nodePaused(node) {
+		logger.V(1).Info("Node is paused, not refreshing the terminating condition and the cordon", "annotation", pausedAnnotation)
+		return false
+	}
+
+	if h.marked {
+		current := conditions.Find(node.Status.Conditions, h.condition.Type())
+		if heartbeat || current == nil || current.Status != corev1.ConditionTrue {
+			if err := h.refreshCondition(ctx, logger, node, notice); err != nil {
+				logger.Error(err, "Error refreshing the terminating condition")
+			}
+		}
+	}
+	// The NodeTermination controller cordons the node, if delegated
+	if h.actions.Cordon && !h.nodeTerminations && !node.Spec.Unschedulable {
+		logger.Info("Node was uncordoned, cordoning it again")
+		if err := cordonNode(ctx, h.nodes, h.nodeName); err != nil {
+			logger.Error(err, "Error cordoning node")
+		}
+	}
+	return false
+}
+
+// cancelTermination sets the terminating condition added by the handler to false and removes
+// the notice annotation, once the cloud provider no longer reports the notice. A
+// NodeTermination is deleted, so its controller stops acting on the node.
+func (h *handlerBase) cancelTermination(ctx context.Context, logger logr.Logger) error {
+	logger.Info("Termination notice is no longer reported by the cloud provider, the termination was cancelled")
+	h.clearNotice()
+	metrics.ClearTerminationDeadline(h.nodeName)
+	if h.nodeTerminations {
+		if err := h.nodes.deleteNodeTermination(ctx, h.nodeName); err != nil {
+			return fmt.Errorf("error deleting NodeTermination: %w", err)
+		}
+	}
+	if !h.marked && !h.actions.Cordon && !h.actions.Drain {
+		return nil
+	}
+
+	node, err := h.nodes.getNode(ctx, h.nodeName)
+	if err != nil {
+		return fmt.Errorf("error fetching node: %w", err)
+	}
+	if h.marked {
+		current := conditions.Find(node.Status.Conditions, h.condition.Type())
+		err = h.nodes.applyNodeCondition(ctx, h.nodeName, conditions.Update(current, corev1.NodeCondition{
+			Type:    h.condition.Type(),
+			Status:  corev1.ConditionFalse,
+			Reason:  terminationCancelledReason,
+			Message: "The cloud provider no longer reports the termination notice",
+		}))
+		if err != nil {
+			return fmt.Errorf("error applying node condition: %w", err)
+		}
+		h.marked = false
+	}
+
+	if _, ok := node.Annotations[terminationNoticeAnnotation]; ok {
+		original := node.DeepCopy()
+		delete(node.Annotations, terminationNoticeAnnotation)
+		if err := h.nodes.patchNode(ctx, original, node); err != nil {
+			return fmt.Errorf("error removing notice annotation: %w", err)
+		}
+	}
+	return nil
+}
+
+// refreshCondition updates the heartbeat of the terminating condition of the node,
+// or adds it again if it was removed or is no longer true
+func (h *handlerBase) refreshCondition(ctx context.Context, logger logr.Logger, node *corev1.Node, notice notify.Notice) error {
+	condition, err := h.condition.Render(notice)
+	if err != nil {
+		return err
+	}
+
+	current := conditions.Find(node.Status.Conditions, condition.Type)
+	if current != nil && current.Status == corev1.ConditionTrue {
+		// Only the heartbeat is refreshed
+		condition.Reason, condition.Message = current.Reason, current.Message
+	} else {
+		logger.Info("Terminating condition was removed from the node, adding it again")
+	}
+	return h.nodes.applyNodeCondition(ctx, node.Name, conditions.Update(current, condition))
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// deschedulerHintKey is the key of the label and the taint hinting the descheduler that
+	// the instance of the node is likely to be terminated. Pods whose required node affinity
+	// excludes the label are evicted by the RemovePodsViolatingNodeAffinity strategy, pods not
+	// tolerating the PreferNoSchedule taint by RemovePodsViolatingNodeTaints with
+	// includePreferNoSchedule, and the scheduler avoids the node.
+	deschedulerHintKey = "termination-handler/termination-advised"
+
+	// deschedulerHintTimeout bounds updating the hints, which outlive the context of a poll
+	deschedulerHintTimeout = 30 * time.Second
+)
+
+// Reasons for the descheduler hints
+const (
+	// advisoryHint is set while the cloud provider signals a termination is likely
+	advisoryHint = "advisory"
+	// deferralHint is set while the drain on a notice of scheduled maintenance is deferred
+	deferralHint = "deferral"
+)
+
+// deschedulerHints tracks the reasons for the hints on the node, they are removed once no
+// reason is left
+type deschedulerHints struct {
+	lock    sync.Mutex
+	reasons map[string]bool
+}
+
+// hintDescheduler sets or clears a reason for the descheduler hints and adds or removes the
+// hints accordingly. The hints only start rebalancing workloads early, failing to update them
+// is logged. Nothing is done unless descheduler hints are enabled.
+func (h *handlerBase) hintDescheduler(logger logr.Logger, reason string, active bool) {
+	if h.hints == nil || h.nodes == nil {
+		return
+	}
+	h.hints.lock.Lock()
+	defer h.hints.lock.Unlock()
+	if h.hints.reasons[reason] == active {
+		return
+	}
+	if active {
+		h.hints.reasons[reason] = true
+	} else {
+		delete(h.hints.reasons, reason)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), deschedulerHintTimeout)
+	defer cancel()
+	hinted := len(h.hints.reasons) > 0
+	if err := setDeschedulerHints(ctx, h.nodes, h.nodeName, hinted); err != nil {
+		logger.Error(err, "Error updating the descheduler hints of the node", "reason", reason)
+		return
+	}
+	if hinted {
+		logger.V(1).Info("Hinting the descheduler to move workloads off the node", "reason", reason)
+	} else {
+		logger.V(1).Info("Removed the descheduler hints of the node")
+	}
+}
+
+// clearStaleHints removes the hints a previous run of the handler may have left on the node,
+// they are added again while a reason remains
+func (h *handlerBase) clearStaleHints(logger logr.Logger) {
+	if h.hints == nil || h.nodes == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deschedulerHintTimeout)
+	defer cancel()
+	if err := setDeschedulerHints(ctx, h.nodes, h.nodeName, false); err != nil {
+		logger.Error(err, "Error removing stale descheduler hints of the node")
+	}
+}
+
+// setDeschedulerHints adds or removes the label and the taint of deschedulerHintKey
+func setDeschedulerHints(ctx context.Context, nodes nodeClient, nodeName string, hinted bool) error {
+	node, err := nodes.getNode(ctx, nodeName)
+	if err != nil {
+		return fmt.Errorf("error fetching node: %w", err)
+	}
+	original := node.DeepCopy()
+
+	_, labelled := node.Labels[deschedulerHintKey]
+	if hinted && !labelled {
+		if node.Labels == nil {
+			node.Labels = map[string]string{}
+		}
+		node.Labels[deschedulerHintKey] = "true"
+	} else if !hinted && labelled {
+		delete(node.Labels, deschedulerHintKey)
+	}
+
+	var taints []corev1.Taint
+	tainted := false
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == deschedulerHintKey {
+			tainted = true
+			if !hinted {
+				continue
+			}
+		}
+		taints = append(taints, taint)
+	}
+	if hinted && !tainted {
+		taints = append(taints, corev1.Taint{Key: deschedulerHintKey, Value: "true", Effect: corev1.TaintEffectPreferNoSchedule})
+	}
+	if labelled == hinted && tainted == hinted {
+		return nil
+	}
+	node.Spec.Taints = taints
+
+	if err := nodes.patchNode(ctx, original, node); err != nil {
+		return fmt.Errorf("error patching node: %v", err)
+	}
+	return nil
+}
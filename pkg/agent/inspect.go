@@ -0,0 +1,121 @@
+//go:build !lite
+// +build !lite
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/actions"
+	"github.com/alexander-demichev/termination-handler/pkg/conditions"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NodeTermination summarizes the termination handling of a node, for inspection tools
+type NodeTermination struct {
+	Node string
+	// Condition is the terminating condition, nil if the node has none
+	Condition *corev1.NodeCondition
+	// EventType, Provider, Deadline and Simulated describe the termination notice,
+	// they are empty if the node has no notice annotation
+	EventType string
+	Provider  string
+	Deadline  *time.Time
+	Simulated bool
+	// Paused is whether the handler is paused on the node
+	Paused bool
+	// Cordoned is whether the node is unschedulable
+	Cordoned bool
+	// Taints are the taints of the node
+	Taints []corev1.Taint
+}
+
+// Terminating returns whether the node is marked for termination
+func (t NodeTermination) Terminating() bool {
+	return t.Condition != nil && t.Condition.Status == corev1.ConditionTrue
+}
+
+// InspectNode returns the termination handling of the node, the terminating condition
+// has the conditionType type, the default type if empty
+func InspectNode(node *corev1.Node, conditionType string) NodeTermination {
+	if conditionType == "" {
+		conditionType = string(actions.TerminatingConditionType)
+	}
+
+	t := NodeTermination{
+		Node:     node.Name,
+		Paused:   node.Annotations[pausedAnnotation] == "true",
+		Cordoned: node.Spec.Unschedulable,
+		Taints:   node.Spec.Taints,
+	}
+	t.Condition = conditions.Find(node.Status.Conditions, corev1.NodeConditionType(conditionType))
+
+	if value, ok := node.Annotations[terminationNoticeAnnotation]; ok {
+		annotation := noticeAnnotation{}
+		if err := json.Unmarshal([]byte(value), &annotation); err == nil {
+			t.EventType = annotation.EventType
+			t.Provider = annotation.Provider
+			t.Simulated = annotation.Simulated
+			if deadline, err := time.Parse(time.RFC3339, annotation.Deadline); err == nil {
+				t.Deadline = &deadline
+			}
+		}
+	}
+	return t
+}
+
+// NodeEvents returns the events recorded by the handler for the node, oldest first
+func NodeEvents(ctx context.Context, clientset kubernetes.Interface, nodeName string) ([]corev1.Event, error) {
+	selector := fields.Set{
+		"involvedObject.kind": "Node",
+		"involvedObject.name": nodeName,
+		"source":              eventSourceComponent,
+	}.AsSelector().String()
+	events, err := clientset.CoreV1().Events(metav1.NamespaceAll).List(ctx, metav1.ListOptions{FieldSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("error listing events: %v", err)
+	}
+
+	sort.Slice(events.Items, func(i, j int) bool {
+		return eventTime(events.Items[i]).Before(eventTime(events.Items[j]))
+	})
+	return events.Items, nil
+}
+
+// eventTime returns the last time the event was observed
+func eventTime(event corev1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	return event.EventTime.Time
+}
+
+// SetNodePaused pauses or resumes the actions of the handler on the node
+func SetNodePaused(ctx context.Context, clientset kubernetes.Interface, nodeName string, paused bool) error {
+	// A null value removes the annotation in a merge patch
+	var value interface{}
+	if paused {
+		value = "true"
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{pausedAnnotation: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := clientset.CoreV1().Nodes().Patch(ctx, nodeName, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("error patching node: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+//go:build !lite
+// +build !lite
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/apis/v1alpha1"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// mirrorPodAnnotation is set on the mirror pods of static pods, which can not be evicted
+	mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+	// evictionRetryInterval is the interval at which evictions blocked by a
+	// PodDisruptionBudget and pods still terminating are checked again
+	evictionRetryInterval = 5 * time.Second
+)
+
+// handlerScheme is the scheme used by the handler clients, it knows about
+// the core types and the termination handler API types
+var handlerScheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(handlerScheme))
+	utilruntime.Must(v1alpha1.AddToScheme(handlerScheme))
+}
+
+// eventScheme is the scheme events are recorded with
+var eventScheme = clientgoscheme.Scheme
+
+// nodeTerminationsSupported is whether node handlers can create NodeTerminations
+const nodeTerminationsSupported = true
+
+// ctrlNodeClient implements nodeClient with controller-runtime and client-go
+type ctrlNodeClient struct {
+	client    client.Client
+	clientset kubernetes.Interface
+}
+
+// NewHandlerForClient constructs a Handler acting on the node of opts with c, e.g. the client
+// of the controller-runtime manager of a controller embedding the handler. The scheme of c
+// must know the core types, TerminationPolicies are ignored if it does not know them. The
+// requests c can not send, e.g. watches and evictions, are sent with cfg.
+func NewHandlerForClient(logger logr.Logger, cfg *rest.Config, c client.Client, opts Options) (Handler, error) {
+	nodes, eventSink, err := newNodeClientFor(cfg, c)
+	if err != nil {
+		return nil, err
+	}
+	return newNodeHandler(logger, nodes, eventSink, opts)
+}
+
+// newNodeClient constructs the client acting on the node and the sink events are recorded to
+func newNodeClient(cfg *rest.Config) (nodeClient, record.EventSink, error) {
+	c, err := client.New(cfg, client.Options{Scheme: handlerScheme})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating client: %v", err)
+	}
+	return newNodeClientFor(cfg, c)
+}
+
+// newNodeClientFor constructs the client acting on the node with c and the sink events are
+// recorded to
+func newNodeClientFor(cfg *rest.Config, c client.Client) (nodeClient, record.EventSink, error) {
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating clientset: %v", err)
+	}
+
+	sink := &typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")}
+	return &ctrlNodeClient{client: c, clientset: clientset}, sink, nil
+}
+
+func (c *ctrlNodeClient) getNode(ctx context.Context, name string) (*corev1.Node, error) {
+	node := &corev1.Node{}
+	if err := c.client.Get(ctx, client.ObjectKey{Name: name}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, &NodeNotFoundError{Node: name, Err: err}
+		}
+		return nil, err
+	}
+	return node, nil
+}
+
+func (c *ctrlNodeClient) findMachine(ctx context.Context, namespace, nodeName string) (*corev1.ObjectReference, error) {
+	return findMachine(ctx, c.clientset.CoreV1().RESTClient(), namespace, nodeName)
+}
+
+func (c *ctrlNodeClient) listWatchNode(name string) cache.ListerWatcher {
+	return cache.NewListWatchFromClient(c.clientset.CoreV1().RESTClient(), "nodes", metav1.NamespaceAll, fields.OneTermEqualSelector("metadata.name", name))
+}
+
+func (c *ctrlNodeClient) applyNodeCondition(ctx context.Context, nodeName string, condition corev1.NodeCondition) error {
+	patch, err := conditionApplyPatch(nodeName, condition)
+	if err != nil {
+		return err
+	}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}
+	if err := c.client.Status().Patch(ctx, node, client.RawPatch(types.ApplyPatchType, patch), client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+		if apierrors.IsNotFound(err) {
+			return &NodeNotFoundError{Node: nodeName, Err: err}
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *ctrlNodeClient) patchNode(ctx context.Context, original, node *corev1.Node) error {
+	if err := c.client.Patch(ctx, node, client.MergeFrom(original)); err != nil {
+		if apierrors.IsNotFound(err) {
+			return &NodeNotFoundError{Node: node.Name, Err: err}
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *ctrlNodeClient) listPolicies(ctx context.Context) ([]v1alpha1.TerminationPolicy, error) {
+	policies := &v1alpha1.TerminationPolicyList{}
+	if err := c.client.List(ctx, policies); err != nil {
+		if meta.IsNoMatchError(err) || runtime.IsNotRegisteredError(err) {
+			// The CRD is not installed, or the scheme of a client passed to
+			// NewHandlerForClient does not know it
+			return nil, nil
+		}
+		return nil, err
+	}
+	return policies.Items, nil
+}
+
+func (c *ctrlNodeClient) ensureNodeTermination(ctx context.Context, termination *v1alpha1.NodeTermination) error {
+	existing := &v1alpha1.NodeTermination{}
+	err := c.client.Get(ctx, client.ObjectKey{Name: termination.Name}, existing)
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return err
+	case existing.Status.Phase != v1alpha1.NodeTerminationCompleted:
+		return nil
+	default:
+		// The instance of a node is not terminated twice, but a notice may be cancelled
+		if err := c.client.Delete(ctx, existing, client.Preconditions{UID: &existing.UID}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return c.client.Create(ctx, termination)
+}
+
+func (c *ctrlNodeClient) deleteNodeTermination(ctx context.Context, nodeName string) error {
+	termination := &v1alpha1.NodeTermination{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}
+	if err := c.client.Delete(ctx, termination); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (c *ctrlNodeClient) getDaemonSet(ctx context.Context, namespace, name string) (*appsv1.DaemonSet, error) {
+	ds := &appsv1.DaemonSet{}
+	if err := c.client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, ds); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+func (c *ctrlNodeClient) updateDaemonSet(ctx context.Context, ds *appsv1.DaemonSet) error {
+	return c.client.Update(ctx, ds)
+}
+
+// drainNode evicts the pods running on the node, respecting PodDisruptionBudgets, until
+// no evictable pod is left or the timeout expires. DaemonSet and mirror pods are skipped
+// as they would be recreated on the node or can not be evicted.
+func (c *ctrlNodeClient) drainNode(ctx context.Context, nodeName string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var lastErr error
+	err := wait.PollImmediateUntil(evictionRetryInterval, func() (bool, error) {
+		pods, err := c.clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+		})
+		if err != nil {
+			lastErr = fmt.Errorf("error listing pods: %v", err)
+			return false, nil
+		}
+
+		remaining := 0
+		lastErr = nil
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if !evictable(pod) {
+				continue
+			}
+			remaining++
+			if pod.DeletionTimestamp != nil {
+				// Already evicted, waiting for the pod to terminate
+				continue
+			}
+
+			err := c.clientset.CoreV1().Pods(pod.Namespace).Evict(ctx, &policyv1beta1.Eviction{
+				ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+			})
+			switch {
+			case err == nil, apierrors.IsNotFound(err):
+			case apierrors.IsTooManyRequests(err):
+				// Blocked by a PodDisruptionBudget, retried on the next iteration
+				lastErr = fmt.Errorf("eviction of pod %s/%s blocked by a disruption budget", pod.Namespace, pod.Name)
+			default:
+				lastErr = fmt.Errorf("error evicting pod %s/%s: %v", pod.Namespace, pod.Name, err)
+			}
+		}
+		return remaining == 0, nil
+	}, ctx.Done())
+	if err != nil {
+		if lastErr != nil {
+			return fmt.Errorf("drain did not complete within %v: %v", timeout, lastErr)
+		}
+		return fmt.Errorf("drain did not complete within %v, pods are still terminating", timeout)
+	}
+	return nil
+}
+
+// evictable returns whether the pod has to be evicted to drain the node
+func evictable(pod *corev1.Pod) bool {
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false
+	}
+	if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+		return false
+	}
+	for _, owner := range pod.OwnerReferences {
+		if owner.Controller != nil && *owner.Controller && owner.Kind == "DaemonSet" {
+			return false
+		}
+	}
+	return true
+}
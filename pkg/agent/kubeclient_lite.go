@@ -0,0 +1,165 @@
+//go:build lite
+// +build lite
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/apis/v1alpha1"
+	jsonpatch "github.com/evanphx/json-patch"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+// liteScheme only knows about the core types, so the full client-go scheme is not loaded
+var liteScheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(corev1.AddToScheme(liteScheme))
+}
+
+// eventScheme is the scheme events are recorded with
+var eventScheme = liteScheme
+
+// nodeTerminationsSupported is whether node handlers can create NodeTerminations
+const nodeTerminationsSupported = false
+
+// restNodeClient implements nodeClient with a REST client for the core API group
+type restNodeClient struct {
+	client rest.Interface
+}
+
+// newNodeClient constructs the client acting on the node and the sink events are recorded to
+func newNodeClient(cfg *rest.Config) (nodeClient, record.EventSink, error) {
+	config := rest.CopyConfig(cfg)
+	config.APIPath = "/api"
+	config.GroupVersion = &corev1.SchemeGroupVersion
+	config.NegotiatedSerializer = serializer.NewCodecFactory(liteScheme).WithoutConversion()
+	config.ContentType = runtime.ContentTypeJSON
+	if config.UserAgent == "" {
+		config.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+
+	c, err := rest.RESTClientFor(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating client: %v", err)
+	}
+	return &restNodeClient{client: c}, &restEventSink{client: c}, nil
+}
+
+func (c *restNodeClient) getNode(ctx context.Context, name string) (*corev1.Node, error) {
+	node := &corev1.Node{}
+	if err := c.client.Get().Resource("nodes").Name(name).Do(ctx).Into(node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, &NodeNotFoundError{Node: name, Err: err}
+		}
+		return nil, err
+	}
+	return node, nil
+}
+
+func (c *restNodeClient) findMachine(ctx context.Context, namespace, nodeName string) (*corev1.ObjectReference, error) {
+	return findMachine(ctx, c.client, namespace, nodeName)
+}
+
+func (c *restNodeClient) listWatchNode(name string) cache.ListerWatcher {
+	return cache.NewListWatchFromClient(c.client, "nodes", metav1.NamespaceAll, fields.OneTermEqualSelector("metadata.name", name))
+}
+
+func (c *restNodeClient) applyNodeCondition(ctx context.Context, nodeName string, condition corev1.NodeCondition) error {
+	patch, err := conditionApplyPatch(nodeName, condition)
+	if err != nil {
+		return err
+	}
+	err = c.client.Patch(types.ApplyPatchType).Resource("nodes").Name(nodeName).SubResource("status").
+		Param("fieldManager", fieldManager).Param("force", "true").Body(patch).Do(ctx).Error()
+	if apierrors.IsNotFound(err) {
+		return &NodeNotFoundError{Node: nodeName, Err: err}
+	}
+	return err
+}
+
+func (c *restNodeClient) patchNode(ctx context.Context, original, node *corev1.Node) error {
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return err
+	}
+	modifiedJSON, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	patch, err := jsonpatch.CreateMergePatch(originalJSON, modifiedJSON)
+	if err != nil {
+		return fmt.Errorf("error creating patch: %w", err)
+	}
+	if err := c.client.Patch(types.MergePatchType).Resource("nodes").Name(node.Name).Body(patch).Do(ctx).Into(node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return &NodeNotFoundError{Node: node.Name, Err: err}
+		}
+		return err
+	}
+	return nil
+}
+
+// listPolicies returns no policies, TerminationPolicies are not supported in lite builds
+func (c *restNodeClient) listPolicies(ctx context.Context) ([]v1alpha1.TerminationPolicy, error) {
+	return nil, nil
+}
+
+func (c *restNodeClient) ensureNodeTermination(ctx context.Context, termination *v1alpha1.NodeTermination) error {
+	return errors.New("NodeTerminations are not supported in lite builds")
+}
+
+func (c *restNodeClient) deleteNodeTermination(ctx context.Context, nodeName string) error {
+	return errors.New("NodeTerminations are not supported in lite builds")
+}
+
+func (c *restNodeClient) drainNode(ctx context.Context, nodeName string, timeout time.Duration) error {
+	return errors.New("draining is not supported in lite builds")
+}
+
+func (c *restNodeClient) getDaemonSet(ctx context.Context, namespace, name string) (*appsv1.DaemonSet, error) {
+	return nil, errors.New("DaemonSets are not supported in lite builds")
+}
+
+func (c *restNodeClient) updateDaemonSet(ctx context.Context, ds *appsv1.DaemonSet) error {
+	return errors.New("DaemonSets are not supported in lite builds")
+}
+
+// restEventSink implements record.EventSink with a REST client for the core API group
+type restEventSink struct {
+	client rest.Interface
+}
+
+func (s *restEventSink) Create(event *corev1.Event) (*corev1.Event, error) {
+	result := &corev1.Event{}
+	err := s.client.Post().Namespace(event.Namespace).Resource("events").Body(event).Do(context.TODO()).Into(result)
+	return result, err
+}
+
+func (s *restEventSink) Update(event *corev1.Event) (*corev1.Event, error) {
+	result := &corev1.Event{}
+	err := s.client.Put().Namespace(event.Namespace).Resource("events").Name(event.Name).Body(event).Do(context.TODO()).Into(result)
+	return result, err
+}
+
+func (s *restEventSink) Patch(event *corev1.Event, data []byte) (*corev1.Event, error) {
+	result := &corev1.Event{}
+	err := s.client.Patch(types.StrategicMergePatchType).Namespace(event.Namespace).Resource("events").Name(event.Name).Body(data).Do(context.TODO()).Into(result)
+	return result, err
+}
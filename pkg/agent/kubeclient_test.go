@@ -0,0 +1,31 @@
+//go:build !lite
+// +build !lite
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCtrlNodeClientWritesToDeletedNode(t *testing.T) {
+	nodes := &ctrlNodeClient{client: fake.NewFakeClient()}
+	ctx := context.Background()
+
+	err := nodes.applyNodeCondition(ctx, "node", corev1.NodeCondition{Type: "Terminating", Status: corev1.ConditionTrue})
+	if !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("applyNodeCondition: got %v, want ErrNodeNotFound", err)
+	}
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+	modified := node.DeepCopy()
+	modified.Spec.Unschedulable = true
+	if err := nodes.patchNode(ctx, node, modified); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("patchNode: got %v, want ErrNodeNotFound", err)
+	}
+}
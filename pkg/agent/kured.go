@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// kuredLockAnnotation is the annotation of the kured DaemonSet holding its reboot lock
+	kuredLockAnnotation = "weave.works/kured-node-lock"
+	// kuredLockHolderPrefix prefixes the node name in the lock taken by the handler, so kured
+	// on the node does not mistake the lock for one it took before rebooting
+	kuredLockHolderPrefix = "termination-handler/"
+	// kuredLockRetryInterval is the interval at which a lock held by another node is checked
+	kuredLockRetryInterval = 5 * time.Second
+	// kuredReleaseTimeout bounds releasing the lock, which outlives the drain
+	kuredReleaseTimeout = 30 * time.Second
+)
+
+// KuredOptions configures the coordination of drains with kured, the reboot daemon, so both
+// do not drain nodes at once. The handler takes the reboot lock of kured before draining the
+// node and releases it once drained.
+type KuredOptions struct {
+	// Namespace and Name are those of the kured DaemonSet, nothing is coordinated if it does
+	// not exist
+	Namespace string
+	Name      string
+	// LockTTL is the time after which kured considers the lock taken by the handler expired,
+	// so a lock that could not be released does not block reboots forever
+	LockTTL time.Duration
+	// MaxWait bounds the time waited for a lock held by another node, the node is drained
+	// anyway once it is up. The wait also ends once the drain would no longer complete
+	// before the deadline.
+	MaxWait time.Duration
+}
+
+// kuredLock is the value of kuredLockAnnotation
+type kuredLock struct {
+	NodeID   string        `json:"nodeID"`
+	Metadata interface{}   `json:"metadata,omitempty"`
+	Created  time.Time     `json:"created"`
+	TTL      time.Duration `json:"TTL"`
+}
+
+// expired reports whether kured would take over the lock
+func (l *kuredLock) expired(now time.Time) bool {
+	return l.TTL > 0 && l.Created.Add(l.TTL).Before(now)
+}
+
+// acquireKuredLock takes the reboot lock of kured before the node is drained, waiting while
+// another node holds it. It returns the function releasing the lock once the node is drained.
+// Coordination must not prevent the drain, failures are logged and the node drained anyway.
+func (h *handlerBase) acquireKuredLock(ctx context.Context, logger logr.Logger, notice notify.Notice) func() {
+	release := func() {}
+	if h.kured == nil {
+		return release
+	}
+	opts := h.kured
+	logger = logger.WithValues("daemonSet", opts.Namespace+"/"+opts.Name)
+	holder := kuredLockHolderPrefix + h.nodeName
+
+	waitUntil := time.Now().Add(opts.MaxWait)
+	if !notice.Deadline.IsZero() {
+		if latest := notice.Deadline.Add(-h.actions.DrainTimeout); latest.Before(waitUntil) {
+			waitUntil = latest
+		}
+	}
+
+	waiting := false
+	for {
+		acquired, current, err := h.tryKuredLock(ctx, holder)
+		switch {
+		case apierrors.IsNotFound(err):
+			logger.V(2).Info("kured is not installed, draining without coordination")
+			return release
+		case apierrors.IsConflict(err):
+			// The lock changed since it was read, try again at once
+			continue
+		case err != nil:
+			logger.Error(err, "Error taking the reboot lock of kured, draining without coordination")
+			return release
+		case acquired:
+			logger.Info("Took the reboot lock of kured for the drain")
+			return func() {
+				releaseCtx, cancel := context.WithTimeout(context.Background(), kuredReleaseTimeout)
+				defer cancel()
+				if err := h.releaseKuredLock(releaseCtx, holder); err != nil {
+					logger.Error(err, "Error releasing the reboot lock of kured, it expires after its TTL", "ttl", opts.LockTTL)
+					return
+				}
+				logger.Info("Released the reboot lock of kured")
+			}
+		case current == h.nodeName:
+			// kured is rebooting the node and drained it already
+			logger.Info("kured holds the reboot lock for the node, draining")
+			return release
+		}
+
+		if !time.Now().Before(waitUntil) {
+			logger.Info("Reboot lock of kured still held by another node, draining anyway", "holder", current)
+			return release
+		}
+		if !waiting {
+			logger.Info("Waiting for the reboot lock of kured held by another node", "holder", current, "until", waitUntil)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return release
+		case <-time.After(kuredLockRetryInterval):
+		}
+	}
+}
+
+// tryKuredLock takes the lock for holder if it is free or expired, it returns whether the lock
+// is held by holder and else the current holder
+func (h *handlerBase) tryKuredLock(ctx context.Context, holder string) (bool, string, error) {
+	ds, err := h.nodes.getDaemonSet(ctx, h.kured.Namespace, h.kured.Name)
+	if err != nil {
+		return false, "", err
+	}
+	now := time.Now()
+	if value, ok := ds.Annotations[kuredLockAnnotation]; ok {
+		current := &kuredLock{}
+		if err := json.Unmarshal([]byte(value), current); err != nil {
+			return false, "", fmt.Errorf("error parsing lock %q: %v", value, err)
+		}
+		if current.NodeID == holder {
+			return true, holder, nil
+		}
+		if !current.expired(now) {
+			return false, current.NodeID, nil
+		}
+	}
+
+	value, err := json.Marshal(&kuredLock{NodeID: holder, Created: now.UTC(), TTL: h.kured.LockTTL})
+	if err != nil {
+		return false, "", err
+	}
+	if ds.Annotations == nil {
+		ds.Annotations = map[string]string{}
+	}
+	ds.Annotations[kuredLockAnnotation] = string(value)
+	// The update fails with a conflict if the lock was taken since it was read
+	if err := h.nodes.updateDaemonSet(ctx, ds); err != nil {
+		return false, "", err
+	}
+	return true, holder, nil
+}
+
+// releaseKuredLock removes the lock if it is still held by holder
+func (h *handlerBase) releaseKuredLock(ctx context.Context, holder string) error {
+	for {
+		ds, err := h.nodes.getDaemonSet(ctx, h.kured.Namespace, h.kured.Name)
+		if err != nil {
+			return err
+		}
+		current := &kuredLock{}
+		if value, ok := ds.Annotations[kuredLockAnnotation]; !ok || json.Unmarshal([]byte(value), current) != nil || current.NodeID != holder {
+			return nil
+		}
+		delete(ds.Annotations, kuredLockAnnotation)
+		err = h.nodes.updateDaemonSet(ctx, ds)
+		if !apierrors.IsConflict(err) {
+			return err
+		}
+	}
+}
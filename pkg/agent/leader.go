@@ -0,0 +1,167 @@
+//go:build !lite
+// +build !lite
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/metrics"
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// ErrLeadershipLost is returned by RunLeaderElected if the lease could not be renewed, the
+// replica should exit and restart as a standby
+var ErrLeadershipLost = errors.New("leadership lost")
+
+// LeaderElectionOptions configure the election of the replica acting on termination notices
+type LeaderElectionOptions struct {
+	// Namespace and Name are those of the Lease the replicas compete for
+	Namespace string
+	Name      string
+	// Identity identifies the replica in the Lease, the hostname with a unique suffix if empty
+	Identity      string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// RunLeaderElected runs run once the replica holds the Lease of opts until stop is closed or
+// the Lease is lost, so only one of several replicas of a central or management cluster
+// handler acts. On stop, run completes the actions in flight before the Lease is released,
+// so the next leader takes over the nodes being handled without waiting for the Lease to
+// expire, and without two replicas acting on them at once. The next leader resumes the
+// actions from the state recorded on the nodes.
+func RunLeaderElected(logger logr.Logger, cfg *rest.Config, opts LeaderElectionOptions, stop <-chan struct{}, run func(stop <-chan struct{}) error) error {
+	log := logger.WithName("leader-election").WithValues("lease", opts.Namespace+"/"+opts.Name)
+
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("error creating clientset: %v", err)
+	}
+	identity := opts.Identity
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("error getting hostname: %v", err)
+		}
+		identity = hostname + "_" + string(uuid.NewUUID())
+	}
+
+	// The election is cancelled once run returns rather than on stop, the Lease is held
+	// while the actions in flight complete. lock guards whether run was started, whether it
+	// may still be, as the Lease may be acquired concurrently with stop, and whether the
+	// Lease was lost.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var lock sync.Mutex
+	var leading, stopping, lost bool
+	var runErr error
+	done := make(chan struct{})
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Namespace: opts.Namespace, Name: opts.Name},
+			Client:     clientset.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+		},
+		LeaseDuration:   opts.LeaseDuration,
+		RenewDeadline:   opts.RenewDeadline,
+		RetryPeriod:     opts.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            opts.Name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				lock.Lock()
+				if stopping {
+					lock.Unlock()
+					return
+				}
+				leading = true
+				lock.Unlock()
+				defer close(done)
+				defer cancel()
+				log.Info("Acquired leadership, handling termination notices", "identity", identity)
+				metrics.SetLeader(true)
+				defer metrics.SetLeader(false)
+
+				runStop := make(chan struct{})
+				runDone := make(chan struct{})
+				go func() {
+					select {
+					case <-stop:
+						close(runStop)
+					case <-leaderCtx.Done():
+						log.Info("Lost leadership, stopping")
+						lock.Lock()
+						lost = true
+						lock.Unlock()
+						close(runStop)
+					case <-runDone:
+					}
+				}()
+				runErr = run(runStop)
+				close(runDone)
+			},
+			OnStoppedLeading: func() {
+				lock.Lock()
+				defer lock.Unlock()
+				if leading {
+					log.Info("Released leadership")
+				}
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					log.Info("Standing by, another replica is the leader", "leader", leader)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error constructing leader elector: %v", err)
+	}
+
+	// Stop competing for the Lease if stopped before acquiring it, a leader cancels the
+	// election itself once run returned
+	stopElection := func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		stopping = true
+		if !leading {
+			cancel()
+		}
+		return leading
+	}
+	go func() {
+		select {
+		case <-stop:
+			stopElection()
+		case <-ctx.Done():
+		}
+	}()
+
+	log.Info("Waiting for leadership", "identity", identity)
+	metrics.SetLeader(false)
+	elector.Run(ctx)
+
+	if !stopElection() {
+		return nil
+	}
+	<-done
+	lock.Lock()
+	defer lock.Unlock()
+	if lost {
+		return ErrLeadershipLost
+	}
+	return runErr
+}
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+// machineGroupVersion is the API of the Machines backing the nodes, as served by the Machine API
+var machineGroupVersion = schema.GroupVersion{Group: "machine.openshift.io", Version: "v1beta1"}
+
+// machineList holds the fields of a list of Machines needed to find the Machine of a node, so
+// the Machine API types are not needed
+type machineList struct {
+	Items []struct {
+		metav1.ObjectMeta `json:"metadata"`
+		Status            struct {
+			NodeRef *corev1.ObjectReference `json:"nodeRef"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// findMachine lists the Machines in namespace, all namespaces if empty, with client and returns
+// a reference to the one whose nodeRef is the node. Any REST client of the API server can be
+// used as the request is sent to an absolute path.
+func findMachine(ctx context.Context, client rest.Interface, namespace, nodeName string) (*corev1.ObjectReference, error) {
+	resource := path.Join("/apis", machineGroupVersion.Group, machineGroupVersion.Version)
+	if namespace != "" {
+		resource = path.Join(resource, "namespaces", namespace)
+	}
+	resource = path.Join(resource, "machines")
+
+	data, err := client.Get().AbsPath(resource).Do(ctx).Raw()
+	if err != nil {
+		// The Machine API is not installed
+		if apierrors.IsNotFound(err) {
+			return nil, &MachineNotFoundError{Node: nodeName, Namespace: namespace, Err: err}
+		}
+		return nil, fmt.Errorf("error listing machines: %v", err)
+	}
+
+	list := machineList{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("error decoding machines: %v", err)
+	}
+	for _, machine := range list.Items {
+		if machine.Status.NodeRef == nil || machine.Status.NodeRef.Name != nodeName {
+			continue
+		}
+		return &corev1.ObjectReference{
+			APIVersion:      machineGroupVersion.String(),
+			Kind:            "Machine",
+			Namespace:       machine.Namespace,
+			Name:            machine.Name,
+			UID:             machine.UID,
+			ResourceVersion: machine.ResourceVersion,
+		}, nil
+	}
+	return nil, &MachineNotFoundError{Node: nodeName, Namespace: namespace}
+}
+
+// lookupMachine returns a reference to the Machine of the node, nil if it has none or the
+// lookup failed. The Machine only enriches the logs and events, so failures are only logged.
+func (h *handlerBase) lookupMachine(ctx context.Context, logger logr.Logger) *corev1.ObjectReference {
+	machine, err := h.nodes.findMachine(ctx, h.namespace, h.nodeName)
+	if errors.Is(err, ErrMachineNotFound) {
+		logger.V(1).Info("No Machine found for the node", "reason", err.Error())
+		return nil
+	}
+	if err != nil {
+		logger.Error(err, "Error looking up the Machine of the node")
+		return nil
+	}
+	return machine
+}
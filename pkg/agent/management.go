@@ -0,0 +1,356 @@
+//go:build !lite
+// +build !lite
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+
+	"github.com/alexander-demichev/termination-handler/pkg/actions"
+	"github.com/alexander-demichev/termination-handler/pkg/metrics"
+	"github.com/alexander-demichev/termination-handler/pkg/providers"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// ManagementTargetNode writes the terminating condition to the node of a Machine in its
+	// workload cluster, where the node handler actions are taken
+	ManagementTargetNode = "node"
+	// ManagementTargetMachine annotates the Machine in the management cluster, so its
+	// MachineSet deletes it first and controllers can act on it. The annotations are kept if
+	// the notice is cancelled.
+	ManagementTargetMachine = "machine"
+
+	// capiDeleteMachineAnnotation marks a Machine to be deleted first when its MachineSet scales down
+	capiDeleteMachineAnnotation = "cluster.x-k8s.io/delete-machine"
+	// kubeconfigSecretKey is the key of the kubeconfig in the kubeconfig Secret of a workload cluster
+	kubeconfigSecretKey = "value"
+)
+
+// capiGroupVersion is the API of the Cluster API Machines of the workload clusters
+var capiGroupVersion = schema.GroupVersion{Group: "cluster.x-k8s.io", Version: "v1alpha3"}
+
+// capiMachineList holds the fields of a list of Cluster API Machines needed to map them to
+// instances and nodes, so the Cluster API types are not needed
+type capiMachineList struct {
+	Items []capiMachine `json:"items"`
+}
+
+// capiMachine holds the fields of a Cluster API Machine needed to map it to its instance and node
+type capiMachine struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		ClusterName string  `json:"clusterName"`
+		ProviderID  *string `json:"providerID"`
+	} `json:"spec"`
+	Status struct {
+		NodeRef *corev1.ObjectReference `json:"nodeRef"`
+	} `json:"status"`
+}
+
+// reference returns a reference to the Machine, events are recorded on
+func (m *capiMachine) reference() *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion:      capiGroupVersion.String(),
+		Kind:            "Machine",
+		Namespace:       m.Namespace,
+		Name:            m.Name,
+		UID:             m.UID,
+		ResourceVersion: m.ResourceVersion,
+	}
+}
+
+// ManagementHandler runs on a Cluster API management cluster and handles the termination
+// notices of the Machines of its workload clusters. It polls a FleetProvider, i.e. the API of
+// the infrastructure provider, for the notices of the instances of the Machines and either
+// runs node handlers acting on the nodes in the workload clusters, reached with the
+// kubeconfig Secrets of the clusters, or marks the Machines directly.
+type ManagementHandler struct {
+	clientset kubernetes.Interface
+	fleet     providers.FleetProvider
+	target    string
+	opts      Options
+	log       logr.Logger
+	recorder  record.EventRecorder
+
+	*settingsHolder
+
+	// lock guards the node runners of the workload clusters
+	lock     sync.Mutex
+	clusters map[types.NamespacedName]*nodeRunner
+}
+
+// NewManagementHandler constructs a ManagementHandler polling fleet, the management cluster is
+// reached with cfg. target is ManagementTargetNode or ManagementTargetMachine. The Machines
+// are watched in the namespace of opts, all namespaces if empty. The options apply to every
+// node handler, only the notifiers and settings are used to mark Machines.
+func NewManagementHandler(logger logr.Logger, cfg *rest.Config, fleet providers.FleetProvider, target string, opts Options) (*ManagementHandler, error) {
+	switch target {
+	case ManagementTargetNode:
+		// Fail fast rather than once a termination notice arrives if the options are invalid
+		if _, err := actions.NewCondition(opts.Condition); err != nil {
+			return nil, err
+		}
+		if _, err := actions.NewDeferral(opts.Deferral); err != nil {
+			return nil, err
+		}
+	case ManagementTargetMachine:
+	default:
+		return nil, fmt.Errorf("unknown management target %q, must be %s or %s", target, ManagementTargetNode, ManagementTargetMachine)
+	}
+
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating clientset: %v", err)
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+
+	return &ManagementHandler{
+		clientset:      clientset,
+		fleet:          fleet,
+		target:         target,
+		opts:           opts,
+		log:            logger.WithName("management"),
+		recorder:       broadcaster.NewRecorder(eventScheme, corev1.EventSource{Component: eventSourceComponent}),
+		settingsHolder: newSettingsHolder(opts.Settings),
+		clusters:       map[types.NamespacedName]*nodeRunner{},
+	}, nil
+}
+
+// Run polls the fleet provider for the notices of the Machines and acts on them until stop is
+// closed. The node handlers get the shutdown budget to complete the actions in flight.
+func (h *ManagementHandler) Run(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	wg := &sync.WaitGroup{}
+	h.log.Info("Polling the infrastructure provider for the termination notices of the Machines", "target", h.target)
+	_ = pollImmediateUntil(ctx, h.pollInterval, func() (bool, error) {
+		h.poll(ctx, wg)
+		return false, nil
+	})
+
+	h.lock.Lock()
+	for _, runner := range h.clusters {
+		runner.stopAll()
+	}
+	h.lock.Unlock()
+	wg.Wait()
+	for _, runner := range h.clusters {
+		runner.shutdown()
+	}
+	metrics.SetWatchedNodes(0)
+	return nil
+}
+
+// UpdateSettings replaces the settings of the management handler and of every node handler
+func (h *ManagementHandler) UpdateSettings(settings Settings) {
+	h.settingsHolder.UpdateSettings(settings)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.opts.Settings = settings
+	for _, runner := range h.clusters {
+		runner.updateSettings(settings)
+	}
+}
+
+// poll polls the fleet provider for the notices of the instances of the Machines once and acts
+// on them. Failures are logged, the next poll retries.
+func (h *ManagementHandler) poll(ctx context.Context, wg *sync.WaitGroup) {
+	machines, err := h.listMachines(ctx)
+	if err != nil {
+		h.log.Error(err, "Error listing Machines")
+		return
+	}
+
+	byProviderID := make(map[string]*capiMachine, len(machines))
+	providerIDs := make([]string, 0, len(machines))
+	for i := range machines {
+		machine := &machines[i]
+		if machine.Spec.ProviderID == nil || *machine.Spec.ProviderID == "" {
+			h.log.V(2).Info("Skipping Machine without a provider ID", "machine", machine.Namespace+"/"+machine.Name)
+			continue
+		}
+		byProviderID[*machine.Spec.ProviderID] = machine
+		providerIDs = append(providerIDs, *machine.Spec.ProviderID)
+	}
+
+	metrics.SetWatchedNodes(len(providerIDs))
+
+	pollCtx, cancel := context.WithTimeout(ctx, h.pollInterval())
+	defer cancel()
+	var reported map[string]*providers.TerminationNotice
+	err = catchPanic(h.log, func() error {
+		var err error
+		reported, err = h.fleet.PollFleet(pollCtx, h.log, providerIDs)
+		return err
+	})
+	if err != nil {
+		h.log.Error(err, "Error polling the infrastructure provider for termination notices")
+		h.lock.Lock()
+		for _, runner := range h.clusters {
+			runner.fail(err)
+		}
+		h.lock.Unlock()
+		return
+	}
+
+	notices := map[*capiMachine]*providers.TerminationNotice{}
+	for providerID, notice := range reported {
+		machine, ok := byProviderID[providerID]
+		if !ok {
+			h.log.V(2).Info("Ignoring termination notice of an instance without a Machine", "providerID", providerID)
+			continue
+		}
+		notices[machine] = notice
+	}
+
+	if h.target == ManagementTargetMachine {
+		for machine, notice := range notices {
+			if err := h.markMachine(ctx, machine, notice); err != nil {
+				h.log.Error(err, "Error marking Machine", "machine", machine.Namespace+"/"+machine.Name)
+			}
+		}
+		return
+	}
+	h.runNodes(ctx, wg, notices)
+}
+
+// listMachines lists the Cluster API Machines in the namespace of the options, all namespaces if empty
+func (h *ManagementHandler) listMachines(ctx context.Context) ([]capiMachine, error) {
+	resource := path.Join("/apis", capiGroupVersion.Group, capiGroupVersion.Version)
+	if h.opts.Namespace != "" {
+		resource = path.Join(resource, "namespaces", h.opts.Namespace)
+	}
+	resource = path.Join(resource, "machines")
+
+	data, err := h.clientset.CoreV1().RESTClient().Get().AbsPath(resource).Do(ctx).Raw()
+	if err != nil {
+		return nil, err
+	}
+	list := capiMachineList{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("error decoding machines: %v", err)
+	}
+	return list.Items, nil
+}
+
+// runNodes passes the notices of the Machines to the node runners of their workload clusters,
+// constructing the runners of the clusters with a notice that have none yet. Machines without
+// a node are skipped, they are handled once their node joined.
+func (h *ManagementHandler) runNodes(ctx context.Context, wg *sync.WaitGroup, notices map[*capiMachine]*providers.TerminationNotice) {
+	byCluster := map[types.NamespacedName]map[string]*providers.TerminationNotice{}
+	for machine, notice := range notices {
+		if machine.Status.NodeRef == nil {
+			h.log.V(1).Info("Skipping termination notice of a Machine without a node", "machine", machine.Namespace+"/"+machine.Name)
+			continue
+		}
+		cluster := types.NamespacedName{Namespace: machine.Namespace, Name: machine.Spec.ClusterName}
+		if byCluster[cluster] == nil {
+			byCluster[cluster] = map[string]*providers.TerminationNotice{}
+		}
+		byCluster[cluster][machine.Status.NodeRef.Name] = notice
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for cluster := range byCluster {
+		if _, ok := h.clusters[cluster]; ok {
+			continue
+		}
+		runner, err := h.newClusterRunner(ctx, cluster)
+		if err != nil {
+			h.log.Error(err, "Error connecting to workload cluster", "cluster", cluster.String())
+			continue
+		}
+		h.clusters[cluster] = runner
+	}
+	// Clusters without notices are passed none, so the handlers of cancelled notices stop
+	for cluster, runner := range h.clusters {
+		runner.run(wg, byCluster[cluster])
+	}
+}
+
+// newClusterRunner constructs the node runner of a workload cluster, which is reached with
+// the kubeconfig Secret Cluster API maintains for it
+func (h *ManagementHandler) newClusterRunner(ctx context.Context, cluster types.NamespacedName) (*nodeRunner, error) {
+	secret, err := h.clientset.CoreV1().Secrets(cluster.Namespace).Get(ctx, cluster.Name+"-kubeconfig", metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching kubeconfig secret: %v", err)
+	}
+	cfg, err := clientcmd.RESTConfigFromKubeConfig(secret.Data[kubeconfigSecretKey])
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubeconfig: %v", err)
+	}
+	nodes, eventSink, err := newNodeClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := h.opts
+	// The Machines of the workload cluster live in the management cluster
+	opts.Namespace = ""
+	return newNodeRunner(h.log.WithValues("cluster", cluster.String()), nodes, eventSink, h.fleet, opts), nil
+}
+
+// markMachine annotates the Machine with the notice and for deletion, unless it already is.
+// The notifications are sent when the Machine is first marked.
+func (h *ManagementHandler) markMachine(ctx context.Context, machine *capiMachine, reported *providers.TerminationNotice) error {
+	if _, ok := machine.Annotations[terminationNoticeAnnotation]; ok {
+		return nil
+	}
+
+	nodeName := machine.Name
+	if machine.Status.NodeRef != nil {
+		nodeName = machine.Status.NodeRef.Name
+	}
+	notice := newNotice(reported, nodeName, h.opts.CloudProvider, h.fleet.EventType())
+	value, err := noticeAnnotationValue(*notice)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				terminationNoticeAnnotation: value,
+				capiDeleteMachineAnnotation: "true",
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error marshalling patch: %v", err)
+	}
+
+	resource := path.Join("/apis", capiGroupVersion.Group, capiGroupVersion.Version, "namespaces", machine.Namespace, "machines", machine.Name)
+	if err := h.clientset.CoreV1().RESTClient().Patch(types.MergePatchType).AbsPath(resource).Body(patch).Do(ctx).Error(); err != nil {
+		return fmt.Errorf("error annotating machine: %v", err)
+	}
+
+	h.log.Info("Instance marked for termination, Machine marked for deletion", "machine", machine.Namespace+"/"+machine.Name, "eventType", notice.EventType)
+	metrics.RecordTerminationDetected(notice.Provider, notice.EventType)
+	h.recorder.Eventf(machine.reference(), corev1.EventTypeWarning, actions.TerminationRequestedReason, "The cloud provider will terminate the instance of Machine %s", machine.Name)
+	sendNotifications(ctx, h.log, h.opts.Notifiers, *notice)
+	return nil
+}
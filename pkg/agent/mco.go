@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// mcoStateAnnotation is the state of the machine config daemon on the node, Working while
+	// it updates the node
+	mcoStateAnnotation = "machineconfiguration.openshift.io/state"
+	mcoStateWorking    = "Working"
+	// mcoDesiredDrainAnnotation and mcoLastAppliedDrainAnnotation request and acknowledge the
+	// drains of the machine config controller, a request prefixed with mcoDrainPrefix drains the
+	// node and is complete once both annotations are equal
+	mcoDesiredDrainAnnotation     = "machineconfiguration.openshift.io/desiredDrain"
+	mcoLastAppliedDrainAnnotation = "machineconfiguration.openshift.io/lastAppliedDrain"
+	mcoDrainPrefix                = "drain-"
+
+	// mcoDrainCheckInterval is the interval at which a drain of the MCO in progress is checked
+	mcoDrainCheckInterval = 5 * time.Second
+)
+
+// mcoDrainState is the state of a drain of the Machine Config Operator on a node
+type mcoDrainState int
+
+const (
+	mcoNotDraining mcoDrainState = iota
+	mcoDraining
+	mcoDrained
+)
+
+// mcoDrain returns the state of a drain of the Machine Config Operator on node. Releases
+// without drain requests drain the node from the daemon while it is working.
+func mcoDrain(node *corev1.Node) mcoDrainState {
+	desired, ok := node.Annotations[mcoDesiredDrainAnnotation]
+	if !ok {
+		if node.Annotations[mcoStateAnnotation] == mcoStateWorking {
+			return mcoDraining
+		}
+		return mcoNotDraining
+	}
+	if !strings.HasPrefix(desired, mcoDrainPrefix) {
+		return mcoNotDraining
+	}
+	if node.Annotations[mcoLastAppliedDrainAnnotation] == desired {
+		return mcoDrained
+	}
+	return mcoDraining
+}
+
+// awaitMCODrain waits for a drain of the Machine Config Operator in progress on the node, so
+// the node is not drained twice at once. It returns whether the MCO drained the node, which
+// then needs no drain. The wait ends once the drain would no longer complete before the
+// deadline, the node is then drained anyway. Nothing is done unless MCO coordination is enabled.
+func (h *handlerBase) awaitMCODrain(ctx context.Context, logger logr.Logger, notice notify.Notice) bool {
+	if !h.mcoCoordination {
+		return false
+	}
+	waiting := false
+	for {
+		node, err := h.nodes.getNode(ctx, h.nodeName)
+		if err != nil {
+			logger.Error(err, "Error fetching node to check for drains of the Machine Config Operator, draining")
+			return false
+		}
+		switch mcoDrain(node) {
+		case mcoNotDraining:
+			if waiting {
+				logger.Info("Machine Config Operator stopped draining the node, draining")
+			}
+			return false
+		case mcoDrained:
+			logger.Info("Machine Config Operator drained the node already, skipping the drain")
+			return true
+		}
+
+		if !notice.Deadline.IsZero() && !time.Now().Before(notice.Deadline.Add(-h.actions.DrainTimeout)) {
+			logger.Info("Machine Config Operator still draining the node, draining anyway to meet the deadline")
+			return false
+		}
+		if !waiting {
+			logger.Info("Waiting for the drain of the Machine Config Operator in progress")
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(mcoDrainCheckInterval):
+		}
+	}
+}
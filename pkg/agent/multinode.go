@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/alexander-demichev/termination-handler/pkg/providers"
+	"github.com/go-logr/logr"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/rest"
+)
+
+// MultiNodeHandler handles the termination notices of an instance for several nodes running
+// on it, e.g. nested or virtual nodes sharing a host. The metadata service is polled once for
+// all of them and its notices are fanned out to a node handler for every node, which takes
+// the actions on its node.
+type MultiNodeHandler struct {
+	cloudProvider string
+	metadataURL   string
+	httpClient    *http.Client
+	nodeNames     []string
+	notices       *fleetNotices
+	handlers      []Handler
+	log           logr.Logger
+
+	*settingsHolder
+}
+
+// NewMultiNodeHandler constructs a MultiNodeHandler for the nodes named nodeNames, the API
+// server is reached with cfg. The options apply to every node handler, the node name of opts
+// is ignored and the provider is polled with the first node name. Advisories are not checked.
+func NewMultiNodeHandler(logger logr.Logger, cfg *rest.Config, nodeNames []string, opts Options) (*MultiNodeHandler, error) {
+	if len(nodeNames) == 0 {
+		return nil, errors.New("no node names")
+	}
+	httpClient, err := opts.pollClient()
+	if err != nil {
+		return nil, err
+	}
+	nodes, eventSink, err := newNodeClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &MultiNodeHandler{
+		cloudProvider:  opts.CloudProvider,
+		metadataURL:    opts.MetadataURL,
+		httpClient:     httpClient,
+		nodeNames:      nodeNames,
+		log:            logger.WithName("multi-node"),
+		settingsHolder: newSettingsHolder(opts.Settings),
+	}
+	// The provider is constructed once to validate the options
+	provider, err := h.newProvider()
+	if err != nil {
+		return nil, err
+	}
+	h.notices = &fleetNotices{eventType: provider.EventType()}
+
+	opts.HTTPClient = httpClient
+	opts.fleet = h.notices
+	for _, nodeName := range nodeNames {
+		opts.NodeName = nodeName
+		handler, err := newNodeHandler(logger, nodes, eventSink, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error constructing the handler of node %q: %w", nodeName, err)
+		}
+		h.handlers = append(h.handlers, handler)
+	}
+	return h, nil
+}
+
+// newProvider constructs the provider polled for the notices of the instance
+func (h *MultiNodeHandler) newProvider() (providers.Provider, error) {
+	return providers.New(h.cloudProvider, providers.Options{
+		NodeName:           h.nodeNames[0],
+		HTTPClient:         h.httpClient,
+		MetadataURL:        h.metadataURL,
+		ClockSkewAllowance: h.clockSkewAllowance,
+	})
+}
+
+// Run polls the provider and runs the node handlers until stop is closed. The node handlers
+// get the shutdown budget to complete the actions in flight.
+func (h *MultiNodeHandler) Run(stop <-chan struct{}) error {
+	provider, err := h.newProvider()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	h.log.Info("Polling the metadata service for the termination notices of the nodes", "nodes", h.nodeNames)
+	go func() {
+		_ = pollImmediateUntil(ctx, h.pollInterval, func() (bool, error) {
+			h.poll(ctx, provider)
+			return false, nil
+		})
+	}()
+
+	errs := make(chan error, len(h.handlers))
+	for _, handler := range h.handlers {
+		go func(handler Handler) {
+			errs <- handler.Run(stop)
+		}(handler)
+	}
+	var runErrs []error
+	for range h.handlers {
+		if err := <-errs; err != nil {
+			runErrs = append(runErrs, err)
+		}
+	}
+	return utilerrors.NewAggregate(runErrs)
+}
+
+// UpdateSettings replaces the settings of the multi-node handler and of every node handler
+func (h *MultiNodeHandler) UpdateSettings(settings Settings) {
+	h.settingsHolder.UpdateSettings(settings)
+	for _, handler := range h.handlers {
+		handler.UpdateSettings(settings)
+	}
+}
+
+// poll polls the provider once and fans its notice out to every node. Failures are reported
+// by the node handlers, the next poll retries.
+func (h *MultiNodeHandler) poll(ctx context.Context, provider providers.Provider) {
+	pollCtx, cancel := context.WithTimeout(ctx, h.pollInterval())
+	defer cancel()
+	var notice *providers.TerminationNotice
+	err := catchPanic(h.log, func() error {
+		var err error
+		notice, err = provider.Poll(pollCtx, h.log)
+		return err
+	})
+	if err != nil {
+		h.notices.fail(err)
+		return
+	}
+
+	notices := map[string]*providers.TerminationNotice{}
+	if notice != nil {
+		for _, nodeName := range h.nodeNames {
+			notices[nodeName] = notice
+		}
+	}
+	h.notices.update(notices)
+}
@@ -0,0 +1,195 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/alexander-demichev/termination-handler/pkg/conditions"
+	jsonpatch "github.com/evanphx/json-patch"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/cache"
+)
+
+// cachedNodeClient serves the reads of the node of the handler from an informer watching only
+// that node, so the repeated reads of the handler do not hit the API server. Reads fall back
+// to the API server until the informer synced. Writes that would not change the cached node
+// are skipped. Changes of the node are signalled on changes, so the handler reacts to
+// external changes without waiting for its next check.
+type cachedNodeClient struct {
+	nodeClient
+	nodeName string
+	informer cache.SharedIndexInformer
+	changes  chan struct{}
+	// deleted is closed once the node is deleted
+	deleted     chan struct{}
+	deletedOnce sync.Once
+}
+
+func newCachedNodeClient(nodes nodeClient, nodeName string) *cachedNodeClient {
+	c := &cachedNodeClient{
+		nodeClient: nodes,
+		nodeName:   nodeName,
+		informer:   cache.NewSharedIndexInformer(nodes.listWatchNode(nodeName), &corev1.Node{}, 0, cache.Indexers{}),
+		changes:    make(chan struct{}, 1),
+		deleted:    make(chan struct{}),
+	}
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(_, _ interface{}) { c.changed() },
+		DeleteFunc: func(_ interface{}) {
+			c.deletedOnce.Do(func() { close(c.deleted) })
+			c.changed()
+		},
+	})
+	return c
+}
+
+// run runs the informer until ctx is done
+func (c *cachedNodeClient) run(ctx context.Context) {
+	c.informer.Run(ctx.Done())
+}
+
+// changed signals a change of the node, without blocking if a change is already pending
+func (c *cachedNodeClient) changed() {
+	select {
+	case c.changes <- struct{}{}:
+	default:
+	}
+}
+
+func (c *cachedNodeClient) getNode(ctx context.Context, name string) (*corev1.Node, error) {
+	if name != c.nodeName || !c.informer.HasSynced() {
+		return c.nodeClient.getNode(ctx, name)
+	}
+
+	obj, exists, err := c.informer.GetStore().GetByKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, &NodeNotFoundError{Node: name, Err: apierrors.NewNotFound(corev1.Resource("nodes"), name)}
+	}
+	// Callers modify the node to compute patches, the cached object must not change
+	return obj.(*corev1.Node).DeepCopy(), nil
+}
+
+// cachedNode returns the cached node, nil if name is not the node of the handler or the cache is not synced
+func (c *cachedNodeClient) cachedNode(name string) *corev1.Node {
+	if name != c.nodeName || !c.informer.HasSynced() {
+		return nil
+	}
+	obj, exists, err := c.informer.GetStore().GetByKey(name)
+	if err != nil || !exists {
+		return nil
+	}
+	return obj.(*corev1.Node)
+}
+
+func (c *cachedNodeClient) applyNodeCondition(ctx context.Context, nodeName string, condition corev1.NodeCondition) error {
+	if cached := c.cachedNode(nodeName); cached != nil {
+		if current := conditions.Find(cached.Status.Conditions, condition.Type); current != nil && conditions.Equal(*current, condition) {
+			return nil
+		}
+	}
+	return c.nodeClient.applyNodeCondition(ctx, nodeName, condition)
+}
+
+func (c *cachedNodeClient) patchNode(ctx context.Context, original, node *corev1.Node) error {
+	if cached := c.cachedNode(node.Name); cached != nil {
+		// The write is still sent if this can not be determined
+		if unchanged, err := patchUnchanged(cached, original, node); err == nil && unchanged {
+			return nil
+		}
+	}
+	return c.nodeClient.patchNode(ctx, original, node)
+}
+
+// patchUnchanged returns whether merge patching cached with the changes made to node since
+// original leaves it unchanged
+func patchUnchanged(cached, original, node *corev1.Node) (bool, error) {
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return false, err
+	}
+	modifiedJSON, err := json.Marshal(node)
+	if err != nil {
+		return false, err
+	}
+	cachedJSON, err := json.Marshal(cached)
+	if err != nil {
+		return false, err
+	}
+
+	patch, err := jsonpatch.CreateMergePatch(originalJSON, modifiedJSON)
+	if err != nil {
+		return false, err
+	}
+	patched, err := jsonpatch.MergePatch(cachedJSON, patch)
+	if err != nil {
+		return false, err
+	}
+	return jsonpatch.Equal(patched, cachedJSON), nil
+}
+
+// startNodeCache starts watching the node until ctx is done, if the handler has a node. The
+// node is watched as long as actions run, which may outlive polling. The returned channel is
+// closed once the watch stopped.
+func (h *handlerBase) startNodeCache(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+	if h.nodeCache == nil {
+		close(done)
+		return done
+	}
+	go func() {
+		defer close(done)
+		h.nodeCache.run(ctx)
+	}()
+	return done
+}
+
+// nodeChanges returns the channel signalling changes of the node, nil if the handler has no node
+func (h *handlerBase) nodeChanges() <-chan struct{} {
+	if h.nodeCache == nil {
+		return nil
+	}
+	return h.nodeCache.changes
+}
+
+// nodeDeleted returns whether the node of the handler was deleted
+func (h *handlerBase) nodeDeleted() bool {
+	if h.nodeCache == nil {
+		return false
+	}
+	select {
+	case <-h.nodeCache.deleted:
+		return true
+	default:
+		return false
+	}
+}
+
+// untilNodeDeleted returns a context that is done once ctx is done or the node is deleted, so
+// the handler stops rather than polling for a node that no longer exists
+func (h *handlerBase) untilNodeDeleted(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if h.nodeCache != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+			case <-h.nodeCache.deleted:
+				cancel()
+			}
+		}()
+	}
+	return ctx, cancel
+}
+
+// stopError returns the error the handler stops with, none if it stopped because the node was deleted
+func (h *handlerBase) stopError(err error) error {
+	if h.nodeDeleted() {
+		h.log.Info("Node deleted, stopping")
+		return nil
+	}
+	return err
+}
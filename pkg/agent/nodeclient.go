@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/apis/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// fieldManager is the field manager of the conditions applied by the handler
+const fieldManager = "termination-handler"
+
+// nodeClient is the API server access the handler needs to act on its node. Default builds
+// implement it with controller-runtime, lite builds with a minimal REST client that avoids
+// controller-runtime and the full client-go scheme.
+type nodeClient interface {
+	getNode(ctx context.Context, name string) (*corev1.Node, error)
+	// listWatchNode lists and watches only the node with the name
+	listWatchNode(name string) cache.ListerWatcher
+	// applyNodeCondition sets the condition of the node with a server-side apply of the node
+	// status, which owns only that condition, so there is no read-modify-write race with
+	// the kubelet and other writers of node conditions
+	applyNodeCondition(ctx context.Context, nodeName string, condition corev1.NodeCondition) error
+	// patchNode merge patches the changes made to node since original
+	patchNode(ctx context.Context, original, node *corev1.Node) error
+	// listPolicies returns the TerminationPolicies, none if the CRD is not installed
+	listPolicies(ctx context.Context) ([]v1alpha1.TerminationPolicy, error)
+	// ensureNodeTermination creates the NodeTermination, replacing a completed one of the
+	// node. A NodeTermination still in progress is kept, so the controller resumes it.
+	ensureNodeTermination(ctx context.Context, termination *v1alpha1.NodeTermination) error
+	// deleteNodeTermination deletes the NodeTermination of the node, if any
+	deleteNodeTermination(ctx context.Context, nodeName string) error
+	// drainNode evicts the pods running on the node
+	drainNode(ctx context.Context, nodeName string, timeout time.Duration) error
+	// findMachine returns a reference to the Machine of the node, looked up in namespace
+	// or all namespaces if empty
+	findMachine(ctx context.Context, namespace, nodeName string) (*corev1.ObjectReference, error)
+	// getDaemonSet and updateDaemonSet read and update the DaemonSet holding the reboot lock
+	// of kured, the update fails with a conflict if the DaemonSet changed since it was read
+	getDaemonSet(ctx context.Context, namespace, name string) (*appsv1.DaemonSet, error)
+	updateDaemonSet(ctx context.Context, ds *appsv1.DaemonSet) error
+}
+
+// conditionApplyPatch returns the server-side apply patch of the node status holding only the
+// condition. It is built by hand as marshalling a Node would include zero values of the other
+// status fields, which the handler would then own.
+func conditionApplyPatch(nodeName string, condition corev1.NodeCondition) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Node",
+		"metadata":   map[string]interface{}{"name": nodeName},
+		"status": map[string]interface{}{
+			"conditions": []corev1.NodeCondition{condition},
+		},
+	})
+}
@@ -0,0 +1,206 @@
+//go:build !lite
+// +build !lite
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/actions"
+	"github.com/alexander-demichev/termination-handler/pkg/apis/v1alpha1"
+	"github.com/alexander-demichev/termination-handler/pkg/metrics"
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// NodeTerminationReconciler is the NodeTermination controller. It takes the actions of a
+// NodeTermination on its node as a state machine, Detected, Cordoned, Drained and Completed,
+// recording the phase reached in the status, so a restarted controller resumes from the last
+// phase recorded. The actions are idempotent, those of a phase whose status update was lost
+// are taken again.
+type NodeTerminationReconciler struct {
+	client    client.Client
+	nodes     nodeClient
+	condition *actions.Condition
+	log       logr.Logger
+	recorder  record.EventRecorder
+}
+
+// NewNodeTerminationReconciler constructs a NodeTerminationReconciler with the client and
+// the config of mgr, the terminating condition is rendered with the condition options. The
+// scheme of mgr must know the core and the termination handler API types. Nodes and pods are
+// read from the API server rather than the cache of mgr, which would watch them all.
+func NewNodeTerminationReconciler(logger logr.Logger, mgr manager.Manager, condition actions.ConditionOptions) (*NodeTerminationReconciler, error) {
+	terminatingCondition, err := actions.NewCondition(condition)
+	if err != nil {
+		return nil, err
+	}
+	c := &client.DelegatingClient{
+		Reader:       mgr.GetAPIReader(),
+		Writer:       mgr.GetClient(),
+		StatusClient: mgr.GetClient(),
+	}
+	nodes, _, err := newNodeClientFor(mgr.GetConfig(), c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NodeTerminationReconciler{
+		client:    mgr.GetClient(),
+		nodes:     nodes,
+		condition: terminatingCondition,
+		log:       logger.WithName("node-termination"),
+		recorder:  mgr.GetEventRecorderFor(eventSourceComponent),
+	}, nil
+}
+
+// SetupWithManager adds the controller to mgr, reconciling up to maxConcurrent NodeTerminations
+// at once as drains take long
+func (r *NodeTerminationReconciler) SetupWithManager(mgr manager.Manager, maxConcurrent int) error {
+	return builder.ControllerManagedBy(mgr).
+		For(&v1alpha1.NodeTermination{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: maxConcurrent}).
+		Complete(r)
+}
+
+// Reconcile implements reconcile.Reconciler, it takes the actions leading to the next phase
+// of the NodeTermination and records it. The status update triggers the next reconcile.
+func (r *NodeTerminationReconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
+	ctx := context.Background()
+	termination := &v1alpha1.NodeTermination{}
+	if err := r.client.Get(ctx, req.NamespacedName, termination); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	phase := termination.Status.Phase
+	if phase == v1alpha1.NodeTerminationCompleted {
+		return reconcile.Result{}, nil
+	}
+	logger := r.log.WithValues("node", termination.Spec.NodeName, "phase", phase)
+
+	next, retryAfter, err := r.step(ctx, logger, termination)
+	var message string
+	switch {
+	case errors.Is(err, ErrNodeNotFound):
+		logger.Info("Node deleted, completing the termination")
+		next, message = v1alpha1.NodeTerminationCompleted, "The node was deleted"
+	case err != nil:
+		logger.Error(err, "Error taking the actions of the termination")
+		termination.Status.Message = err.Error()
+		if updateErr := r.client.Status().Update(ctx, termination); updateErr != nil {
+			logger.Error(updateErr, "Error updating the status of the termination")
+		}
+		return reconcile.Result{}, err
+	case retryAfter > 0:
+		return reconcile.Result{RequeueAfter: retryAfter}, nil
+	}
+
+	now := metav1.Now()
+	termination.Status.Phase = next
+	termination.Status.LastTransitionTime = &now
+	termination.Status.Message = message
+	if err := r.client.Status().Update(ctx, termination); err != nil {
+		return reconcile.Result{}, fmt.Errorf("error updating the status of the termination: %v", err)
+	}
+	logger.Info("Termination progressed", "next", next)
+	r.recorder.Eventf(termination, corev1.EventTypeNormal, string(next), "The termination of node %s reached phase %s", termination.Spec.NodeName, next)
+	return reconcile.Result{}, nil
+}
+
+// step takes the actions leading from the phase of termination to the next phase and returns
+// the next phase, or the delay after which to try again if the actions are not due yet
+func (r *NodeTerminationReconciler) step(ctx context.Context, logger logr.Logger, termination *v1alpha1.NodeTermination) (v1alpha1.NodeTerminationPhase, time.Duration, error) {
+	spec := termination.Spec
+	notice := nodeTerminationNotice(termination)
+
+	switch termination.Status.Phase {
+	case "":
+		// The status of a new NodeTermination is recorded before acting on the node
+		return v1alpha1.NodeTerminationDetected, 0, nil
+
+	case v1alpha1.NodeTerminationDetected:
+		if spec.Actions.MarkNode {
+			logger.V(1).Info("Marking node")
+			if err := r.runAction(notice, markNodeAction, func() error {
+				return markNodeForDeletion(ctx, r.nodes, r.condition, notice)
+			}); err != nil {
+				return "", 0, fmt.Errorf("error marking node: %w", err)
+			}
+		}
+		if spec.Actions.Cordon {
+			logger.V(1).Info("Cordoning node")
+			if err := r.runAction(notice, cordonAction, func() error {
+				return cordonNode(ctx, r.nodes, spec.NodeName)
+			}); err != nil {
+				return "", 0, err
+			}
+		}
+		return v1alpha1.NodeTerminationCordoned, 0, nil
+
+	case v1alpha1.NodeTerminationCordoned:
+		if spec.Actions.Drain {
+			if notBefore := spec.Actions.DrainNotBefore; notBefore != nil {
+				if remaining := time.Until(notBefore.Time); remaining > 0 {
+					logger.V(1).Info("Drain deferred to the maintenance window", "drainAt", notBefore.Time)
+					return "", remaining, nil
+				}
+			}
+			// The drain delay runs from the time the node was cordoned
+			nodeActions := actions.Actions{DrainTimeout: spec.Actions.DrainTimeout.Duration, DrainDelay: spec.Actions.DrainDelay.Duration}
+			if cordonedAt := termination.Status.LastTransitionTime; cordonedAt != nil {
+				delay := nodeActions.DrainDelayFor(notice, cordonedAt.Time)
+				if remaining := time.Until(cordonedAt.Add(delay)); remaining > 0 {
+					logger.V(1).Info("Waiting before draining the node", "delay", remaining)
+					return "", remaining, nil
+				}
+			}
+			logger.V(1).Info("Draining node")
+			if err := r.runAction(notice, drainAction, func() error {
+				return r.nodes.drainNode(ctx, spec.NodeName, nodeActions.DrainTimeout)
+			}); err != nil {
+				return "", 0, err
+			}
+		}
+		return v1alpha1.NodeTerminationDrained, 0, nil
+
+	case v1alpha1.NodeTerminationDrained:
+		return v1alpha1.NodeTerminationCompleted, 0, nil
+	}
+	return "", 0, fmt.Errorf("unknown phase %q", termination.Status.Phase)
+}
+
+// runAction runs an action on the node and records its latency
+func (r *NodeTerminationReconciler) runAction(notice notify.Notice, action string, run func() error) error {
+	if err := catchPanic(r.log, run); err != nil {
+		return err
+	}
+	metrics.RecordActionCompleted(notice.Provider, action, time.Since(notice.DetectedAt))
+	return nil
+}
+
+// nodeTerminationNotice returns the termination notice described by termination
+func nodeTerminationNotice(termination *v1alpha1.NodeTermination) notify.Notice {
+	spec := termination.Spec
+	notice := notify.Notice{
+		NodeName:   spec.NodeName,
+		Provider:   spec.Provider,
+		EventType:  spec.EventType,
+		EventID:    spec.EventID,
+		DetectedAt: spec.DetectedAt.Time,
+		Simulated:  spec.Simulated,
+	}
+	if spec.Deadline != nil {
+		notice.Deadline = spec.Deadline.Time
+	}
+	return notice
+}
@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/go-logr/logr"
+)
+
+// Poller polls the cloud provider for termination notices without acting on them, for
+// controllers that embed the handler and take their own actions
+type Poller interface {
+	// Run polls until ctx is done or polling fails. Every termination notice detected is
+	// sent on the Notices channel, a notice the provider cancels is followed by the next one.
+	Run(ctx context.Context) error
+	// Notices returns the channel the termination notices are sent on, it is closed once Run
+	// returns. Polling waits until a notice is received.
+	Notices() <-chan notify.Notice
+	// Status returns the current status of the poller
+	Status() Status
+	// UpdateSettings replaces the settings, they take effect from the next poll
+	UpdateSettings(settings Settings)
+}
+
+// noticePoller implements Poller with a standalone handler publishing the notices to a channel
+type noticePoller struct {
+	*handlerBase
+	notices chan notify.Notice
+}
+
+// NewPoller constructs a Poller for the cloud provider of opts. Only the provider, the
+// metadata service, the node name and the settings of opts are used, the notifiers are
+// replaced by the Notices channel.
+func NewPoller(logger logr.Logger, opts Options) (Poller, error) {
+	notices := make(chan notify.Notice)
+	opts.Notifiers = []notify.Notifier{channelNotifier(notices)}
+	opts.Auditor = nil
+	opts.StateFile = ""
+	h, err := newStandaloneHandler(logger, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &noticePoller{handlerBase: h, notices: notices}, nil
+}
+
+func (p *noticePoller) Run(ctx context.Context) error {
+	// Run waits for every goroutine it starts, so no notice is sent once it returns
+	defer close(p.notices)
+	return p.handlerBase.Run(ctx.Done())
+}
+
+func (p *noticePoller) Notices() <-chan notify.Notice {
+	return p.notices
+}
+
+// channelNotifier sends the notices on a channel
+type channelNotifier chan notify.Notice
+
+// Notify implements notify.Notifier
+func (n channelNotifier) Notify(ctx context.Context, notice notify.Notice) error {
+	select {
+	case n <- notice:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,21 @@
+package agent
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/go-logr/logr"
+)
+
+// catchPanic runs fn and returns its error. A panic is recovered, logged with its stack and
+// returned as an error, so a bug in a poll, an action or a notifier is reported like any other
+// failure rather than stopping the detection of termination notices.
+func catchPanic(logger logr.Logger, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+			logger.Error(err, "Recovered from panic", "stack", string(debug.Stack()))
+		}
+	}()
+	return fn()
+}
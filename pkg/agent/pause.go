@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/metrics"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// pausedAnnotation pauses the actions of the handler on a node while set to "true"
+	pausedAnnotation = "termination-handler/paused"
+
+	// pausedRecheckInterval is the interval at which the annotations of a
+	// paused node are checked again
+	pausedRecheckInterval = 10 * time.Second
+)
+
+// waitWhilePaused blocks while the node has the paused annotation, so operators can stop the
+// handler from acting on a node during incidents. Termination notices are still detected,
+// the actions are taken once the annotation is removed.
+func (h *handlerBase) waitWhilePaused(ctx context.Context, logger logr.Logger) error {
+	paused := false
+	defer func() {
+		if paused {
+			metrics.SetPaused(h.cloudProvider, false)
+		}
+	}()
+
+	return wait.PollImmediateUntil(pausedRecheckInterval, func() (bool, error) {
+		node, err := h.nodes.getNode(ctx, h.nodeName)
+		if err != nil {
+			// Not being able to tell whether the node is paused must not prevent it from
+			// being marked before the instance is terminated
+			logger.Error(err, "Error fetching node to check whether it is paused, not pausing")
+			return true, nil
+		}
+		if !nodePaused(node) {
+			if paused {
+				logger.Info("Node is no longer paused, resuming actions")
+			}
+			return true, nil
+		}
+
+		if !paused {
+			logger.Info("Termination notice detected but the node is paused, no actions taken until the annotation is removed", "annotation", pausedAnnotation)
+			h.setState(StatePaused)
+			metrics.SetPaused(h.cloudProvider, true)
+			paused = true
+		}
+		return false, nil
+	}, ctx.Done())
+}
+
+// nodePaused returns whether the node has the paused annotation
+func nodePaused(node *corev1.Node) bool {
+	return node.Annotations[pausedAnnotation] == "true"
+}
@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/alexander-demichev/termination-handler/pkg/apis/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// resolvedPolicy holds the actions taken for a termination notice after
+// applying the TerminationPolicy matching the node
+type resolvedPolicy struct {
+	// name of the matching policy, empty if no policy matched
+	name string
+
+	excluded        bool
+	markNode        bool
+	notify          bool
+	defaultDeadline *metav1.Duration
+}
+
+// defaultPolicy is used when no TerminationPolicy matches the node
+var defaultPolicy = resolvedPolicy{markNode: true, notify: true}
+
+// resolvePolicy returns the policy for the node, the matching TerminationPolicy with the
+// highest priority wins and ties are broken by name
+func resolvePolicy(ctx context.Context, nodes nodeClient, nodeName string) (resolvedPolicy, error) {
+	policies, err := nodes.listPolicies(ctx)
+	if err != nil {
+		return defaultPolicy, fmt.Errorf("error listing termination policies: %v", err)
+	}
+	if len(policies) == 0 {
+		return defaultPolicy, nil
+	}
+
+	node, err := nodes.getNode(ctx, nodeName)
+	if err != nil {
+		return defaultPolicy, fmt.Errorf("error fetching node: %w", err)
+	}
+
+	var matching []v1alpha1.TerminationPolicy
+	for _, policy := range policies {
+		selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.NodeSelector)
+		if err != nil {
+			return defaultPolicy, fmt.Errorf("invalid node selector in termination policy %q: %v", policy.Name, err)
+		}
+		if selector.Matches(labels.Set(node.Labels)) {
+			matching = append(matching, policy)
+		}
+	}
+	if len(matching) == 0 {
+		return defaultPolicy, nil
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		if matching[i].Spec.Priority != matching[j].Spec.Priority {
+			return matching[i].Spec.Priority > matching[j].Spec.Priority
+		}
+		return matching[i].Name < matching[j].Name
+	})
+
+	spec := matching[0].Spec
+	policy := resolvedPolicy{
+		name:            matching[0].Name,
+		excluded:        spec.Excluded,
+		markNode:        spec.Actions.MarkNode == nil || *spec.Actions.MarkNode,
+		notify:          spec.Actions.Notify == nil || *spec.Actions.Notify,
+		defaultDeadline: spec.DefaultDeadline,
+	}
+	return policy, nil
+}
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/metrics"
+	"github.com/alexander-demichev/termination-handler/pkg/providers"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Reasons of the events emitted when the termination notice endpoint becomes unreachable or recovers
+const (
+	metadataUnreachableReason = "TerminationNoticesUnobservable"
+	metadataRecoveredReason   = "TerminationNoticesObservable"
+)
+
+// isFatalPollError returns whether polling can not recover from err without a configuration
+// change, i.e. the endpoint rejects the requests with a client error status that is not
+// retryable. Timeouts, connection failures, server errors and throttling responses asking to
+// retry after a delay are transient.
+func isFatalPollError(err error, retryableStatuses []int) bool {
+	var statusErr *providers.UnexpectedStatusError
+	if !errors.As(err, &statusErr) || statusErr.RetryAfter > 0 {
+		return false
+	}
+	for _, status := range retryableStatuses {
+		if statusErr.StatusCode == status {
+			return false
+		}
+	}
+	return statusErr.StatusCode >= 400 && statusErr.StatusCode < 500
+}
+
+// pollFailures counts the consecutive failed polls of a poll loop
+type pollFailures struct {
+	consecutive int
+	// retryAfter is the delay the endpoint asked for with the last failed poll
+	retryAfter time.Duration
+}
+
+// retryInterval wraps interval so that transiently failed polls are retried with the
+// exponential backoff of the retry policy, or after the delay the endpoint asked for if
+// longer. Both are capped at the regular interval so a throttling endpoint can not delay
+// the detection of a termination notice more than a regular poll would.
+func (f *pollFailures) retryInterval(interval func() time.Duration, policy func() RetryPolicy) func() time.Duration {
+	return func() time.Duration {
+		regular := interval()
+		if f.consecutive == 0 {
+			return regular
+		}
+		retry := policy()
+		backoff := float64(retry.InitialInterval)
+		for i := 1; i < f.consecutive && backoff < float64(regular); i++ {
+			backoff *= retry.Multiplier
+		}
+		if backoff < float64(f.retryAfter) {
+			backoff = float64(f.retryAfter)
+		}
+		if backoff < float64(regular) {
+			return time.Duration(backoff)
+		}
+		return regular
+	}
+}
+
+// toleratePollFailures wraps a poll condition so that a transiently failed poll does not stop
+// polling, fatal failures are returned as are failures exceeding the attempts of the retry
+// policy. Brief outages of the metadata service are common, so failures are only reported
+// once threshold consecutive polls have failed: a warning event is
+// emitted for the node, the endpoint is reported as unreachable and the handler is no longer
+// ready, until a poll succeeds again. The consecutive failures are counted in failures.
+func (h *handlerBase) toleratePollFailures(logger logr.Logger, failures *pollFailures, condition wait.ConditionFunc) wait.ConditionFunc {
+	nodeRef := &corev1.ObjectReference{
+		Kind: "Node",
+		Name: h.nodeName,
+		// Nodes use their name as UID for events, this matches what the kubelet does
+		UID: types.UID(h.nodeName),
+	}
+
+	return func() (bool, error) {
+		done, err := condition()
+		if err == nil {
+			if failures.consecutive >= h.unreachableThreshold() {
+				logger.Info("Termination notice endpoint reachable again", "failures", failures.consecutive)
+				h.recorder.Eventf(nodeRef, corev1.EventTypeNormal, metadataRecoveredReason, "Termination notice endpoint reachable again after %d failed polls", failures.consecutive)
+				metrics.SetMetadataUnreachable(h.cloudProvider, false)
+				h.setMetadataUnreachable(false)
+			}
+			failures.consecutive = 0
+			failures.retryAfter = 0
+			return done, nil
+		}
+		failures.retryAfter = 0
+		var statusErr *providers.UnexpectedStatusError
+		if errors.As(err, &statusErr) {
+			failures.retryAfter = statusErr.RetryAfter
+		}
+		retry := h.retryPolicy()
+		if isFatalPollError(err, retry.RetryableStatuses) {
+			return false, err
+		}
+
+		failures.consecutive++
+		if retry.MaxAttempts > 0 && failures.consecutive >= retry.MaxAttempts {
+			return false, fmt.Errorf("giving up after %d consecutive failed polls: %w", failures.consecutive, err)
+		}
+		threshold := h.unreachableThreshold()
+		if failures.consecutive < threshold {
+			logger.V(1).Info("Error polling termination endpoint, retrying", "error", err.Error(), "failures", failures.consecutive)
+			return false, nil
+		}
+		logger.Error(err, "Error polling termination endpoint, retrying", "failures", failures.consecutive)
+		if failures.consecutive == threshold {
+			h.recorder.Eventf(nodeRef, corev1.EventTypeWarning, metadataUnreachableReason, "Termination notices can not be observed, the last %d polls failed: %v", failures.consecutive, err)
+			metrics.SetMetadataUnreachable(h.cloudProvider, true)
+			h.setMetadataUnreachable(true)
+		}
+		return false, nil
+	}
+}
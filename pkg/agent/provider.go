@@ -0,0 +1,43 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/alexander-demichev/termination-handler/pkg/providers"
+)
+
+// newProvider constructs the provider polled by a poll loop of the handler, provider
+// deadlines are corrected with the clock skew allowance of the settings. The node handlers
+// of a central or multi-node handler read the notices of the fleet instead.
+func (h *handlerBase) newProvider() (providers.Provider, error) {
+	if h.fleet != nil {
+		return &fleetProvider{notices: h.fleet, nodeName: h.nodeName}, nil
+	}
+	return providers.New(h.cloudProvider, providers.Options{
+		NodeName:           h.nodeName,
+		HTTPClient:         h.httpClient,
+		MetadataURL:        h.metadataURL,
+		ClockSkewAllowance: h.clockSkewAllowance,
+		ReportMaintenance:  h.deferral != nil,
+	})
+}
+
+// newNotice returns the notify.Notice of n, detected now on the node by provider, whose event
+// type is used if n has no kind
+func newNotice(n *providers.TerminationNotice, nodeName, provider, eventType string) *notify.Notice {
+	notice := &notify.Notice{
+		NodeName:   nodeName,
+		Provider:   provider,
+		EventType:  n.Kind,
+		EventID:    n.EventID,
+		DetectedAt: time.Now(),
+		Deadline:   n.Deadline,
+		Raw:        n.Raw,
+		Deferrable: n.Deferrable,
+	}
+	if notice.EventType == "" {
+		notice.EventType = eventType
+	}
+	return notice
+}
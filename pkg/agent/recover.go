@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/conditions"
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// recoverNotice returns the notice a previous instance of the handler was acting on when it
+// stopped, e.g. because its pod was restarted mid-incident, so the remaining actions are resumed
+// without waiting for the cloud provider to report the notice again. The notice is recovered
+// from the terminating condition and the notice annotation of the node, or from the annotation
+// alone in the modes not marking the node. It is nil if the node is not marked for termination.
+// A node cordoned without the annotation was not cordoned by the handler, which writes the
+// annotation first, and is left alone.
+func (h *handlerBase) recoverNotice(ctx context.Context, logger logr.Logger) *notify.Notice {
+	if h.nodes == nil {
+		return nil
+	}
+
+	node, err := h.nodes.getNode(ctx, h.nodeName)
+	if err != nil {
+		logger.Error(err, "Error fetching node to recover the termination state")
+		return nil
+	}
+	value, annotated := node.Annotations[terminationNoticeAnnotation]
+	condition := conditions.Find(node.Status.Conditions, h.condition.Type())
+	marked := condition != nil && condition.Status == corev1.ConditionTrue
+	if !marked && !annotated {
+		return nil
+	}
+
+	// The annotation is missing if the handler stopped before writing it
+	notice := &notify.Notice{
+		NodeName:   h.nodeName,
+		Provider:   h.cloudProvider,
+		EventType:  h.eventType,
+		DetectedAt: time.Now(),
+	}
+	if marked {
+		notice.DetectedAt = condition.LastTransitionTime.Time
+	}
+	if annotated {
+		annotation := noticeAnnotation{}
+		if err := json.Unmarshal([]byte(value), &annotation); err != nil {
+			logger.Error(err, "Ignoring invalid notice annotation")
+			if !marked {
+				return nil
+			}
+		} else {
+			notice.EventType = annotation.EventType
+			notice.EventID = annotation.EventID
+			notice.Simulated = annotation.Simulated
+			notice.Raw = annotation.Raw
+			notice.Deferrable = annotation.Deferrable
+			if detectedAt, err := time.Parse(time.RFC3339, annotation.DetectedAt); err == nil {
+				notice.DetectedAt = detectedAt
+			}
+			if deadline, err := time.Parse(time.RFC3339, annotation.Deadline); err == nil {
+				notice.Deadline = deadline
+			}
+		}
+	}
+
+	logger.Info("Node already carries a termination notice, resuming the remaining actions", "eventType", notice.EventType, "detectedAt", notice.DetectedAt)
+	return notice
+}
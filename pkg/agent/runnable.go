@@ -0,0 +1,44 @@
+//go:build !lite
+// +build !lite
+
+package agent
+
+import (
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// Runnable runs a Handler as a manager.Runnable, so binaries embedding several node agents
+// add termination handling to their controller-runtime manager with mgr.Add
+type Runnable struct {
+	Handler
+}
+
+// NewRunnable constructs a Runnable acting on the node of opts with the client and the
+// config of mgr, see NewHandlerForClient. Objects are read from the API server rather than
+// the cache of mgr: the cache is not started before mgr is, and it would otherwise watch
+// every node of the cluster from every replica.
+func NewRunnable(logger logr.Logger, mgr manager.Manager, opts Options) (*Runnable, error) {
+	c := &client.DelegatingClient{
+		Reader:       mgr.GetAPIReader(),
+		Writer:       mgr.GetClient(),
+		StatusClient: mgr.GetClient(),
+	}
+	handler, err := NewHandlerForClient(logger, mgr.GetConfig(), c, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Runnable{Handler: handler}, nil
+}
+
+// Start implements manager.Runnable, it runs the handler until stop is closed
+func (r *Runnable) Start(stop <-chan struct{}) error {
+	return r.Run(stop)
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. The handler acts on the node
+// it runs on, so it runs on every replica rather than only on the leader.
+func (r *Runnable) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/alexander-demichev/termination-handler/pkg/metrics"
+)
+
+// Run starts the handler and runs the termination logic until stop is closed or the handler
+// fails. Every goroutine started for the run is tracked, so none outlives Run.
+func (h *handlerBase) Run(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Actions in flight outlive the polling context on shutdown, bounded by the shutdown budget
+	actionCtx, cancelActions := context.WithCancel(context.Background())
+	// The node is watched and events are recorded as long as actions run
+	defer h.stopEvents()
+	defer metrics.ClearTerminationDeadline(h.nodeName)
+	cacheDone := h.startNodeCache(actionCtx)
+	defer func() {
+		cancelActions()
+		<-cacheDone
+	}()
+
+	wg := &sync.WaitGroup{}
+	errs := make(chan error, 1)
+	h.goTracked(wg, func() {
+		errs <- h.run(ctx, actionCtx, wg)
+	})
+
+	select {
+	case <-stop:
+		cancel()
+		h.awaitShutdown(cancelActions, wg)
+		return nil
+	case err := <-errs:
+		cancel()
+		wg.Wait()
+		return h.stopError(err)
+	}
+}
+
+// stopEvents shuts down the event broadcaster of the handler, if it has its own
+func (h *handlerBase) stopEvents() {
+	if h.broadcaster != nil {
+		h.broadcaster.Shutdown()
+	}
+}
+
+// goTracked runs fn in a goroutine tracked by wg, which is added to before the goroutine
+// starts so waiting on wg can not miss it
+func (h *handlerBase) goTracked(wg *sync.WaitGroup, fn func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		fn()
+	}()
+}
+
+// run polls for termination notices and acts on them until ctx is done, the node is deleted
+// or an error occurs. Goroutines it starts are tracked by wg.
+func (h *handlerBase) run(ctx, actionCtx context.Context, wg *sync.WaitGroup) error {
+	logger := h.log.WithValues("node", h.nodeName)
+	ctx, stopPolling := h.untilNodeDeleted(ctx)
+	defer stopPolling()
+	if err := h.waitForNodeSelector(ctx, logger); err != nil {
+		return fmt.Errorf("error waiting for node to match the node selector: %v", err)
+	}
+
+	logger.V(1).Info("Monitoring node termination")
+	h.setState(StatePolling)
+	h.clearStaleHints(logger)
+	h.goTracked(wg, func() {
+		h.watchAdvisories(ctx, logger)
+	})
+
+	// Resume the handling of a notice detected before the handler was restarted,
+	// polling resumes once a notice is cancelled
+	notice := h.recoverNotice(ctx, logger)
+	for {
+		if notice == nil {
+			var err error
+			if notice, err = h.pollUntilNotice(ctx, logger); err != nil {
+				return fmt.Errorf("error polling termination endpoint: %w", err)
+			}
+		}
+
+		// Will only get here if the provider reported a termination notice or a notice was recovered
+		if err := h.actOnTermination(ctx, actionCtx, logger, *notice); err != nil {
+			return err
+		}
+		cancelled, err := h.watchTerminating(ctx, logger, *notice)
+		if err != nil || !cancelled {
+			return err
+		}
+		logger.V(1).Info("Monitoring node termination")
+		h.setState(StatePolling)
+		notice = nil
+	}
+}
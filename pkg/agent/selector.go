@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// nodeSelectorRecheckInterval is the interval at which the labels of a node
+// not matching the node selector are checked again
+const nodeSelectorRecheckInterval = time.Minute
+
+// waitForNodeSelector blocks until the labels of the node match the node selector, so the
+// handler idles on nodes it should not handle and picks them up once they are relabelled
+func (h *handlerBase) waitForNodeSelector(ctx context.Context, logger logr.Logger) error {
+	if h.nodeSelector == nil || h.nodeSelector.Empty() {
+		return nil
+	}
+
+	idling := false
+	return wait.PollImmediateUntil(nodeSelectorRecheckInterval, func() (bool, error) {
+		node, err := h.nodes.getNode(ctx, h.nodeName)
+		if err != nil {
+			// Keep idling until the node can be fetched
+			logger.Error(err, "Error fetching node to match the node selector")
+			return false, nil
+		}
+		if h.nodeSelector.Matches(labels.Set(node.Labels)) {
+			return true, nil
+		}
+
+		if !idling {
+			logger.Info("Node does not match the node selector, idling", "nodeSelector", h.nodeSelector.String())
+			h.setState(StateIdle)
+			idling = true
+		}
+		return false, nil
+	}, ctx.Done())
+}
+
+// selectorString returns the string form of selector, empty for a nil selector
+func selectorString(selector labels.Selector) string {
+	if selector == nil {
+		return ""
+	}
+	return selector.String()
+}
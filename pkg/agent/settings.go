@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Settings are the handler settings that can be changed while the handler is running
+type Settings struct {
+	// PollInterval is the interval at which the termination notice endpoint is checked
+	PollInterval time.Duration
+	// PollJitter is the maximum fraction of PollInterval randomly added to every interval
+	PollJitter float64
+	// AdvisoryPollInterval is the interval at which the termination notice endpoint is checked
+	// while the cloud provider signals a termination is likely, disabled if zero
+	AdvisoryPollInterval time.Duration
+	// UnreachableThreshold is the number of consecutive failed polls after which the
+	// termination notice endpoint is reported as unreachable
+	UnreachableThreshold int
+	// ShutdownBudget is the time the actions in flight get to complete once the
+	// handler is stopped, before they are cancelled
+	ShutdownBudget time.Duration
+	// ClockSkewAllowance is how much earlier than reported the provider deadlines are
+	// assumed, if the metadata service does not report its time
+	ClockSkewAllowance time.Duration
+	// Retry configures retrying failed polls of the termination notice endpoint
+	Retry RetryPolicy
+}
+
+// DefaultSettings returns the settings the handler binary uses by default
+func DefaultSettings() Settings {
+	return Settings{
+		PollInterval:         5 * time.Second,
+		UnreachableThreshold: 3,
+		ShutdownBudget:       30 * time.Second,
+		Retry: RetryPolicy{
+			InitialInterval:   time.Second,
+			Multiplier:        2,
+			RetryableStatuses: []int{http.StatusNotFound, http.StatusRequestTimeout, http.StatusTooManyRequests},
+		},
+	}
+}
+
+// RetryPolicy configures retrying failed polls of the termination notice endpoint
+type RetryPolicy struct {
+	// InitialInterval is the delay before retrying the first of consecutive failed polls, it
+	// is multiplied by Multiplier with every further failure, capped at the poll interval
+	InitialInterval time.Duration
+	Multiplier      float64
+	// MaxAttempts is the number of consecutive failed polls after which polling fails,
+	// polls are retried indefinitely if zero
+	MaxAttempts int
+	// RetryableStatuses are the client error statuses that are retried, any other 4xx
+	// status fails polling. Server errors are always retried.
+	RetryableStatuses []int
+}
+
+// settingsHolder holds the current settings of a handler, it is embedded by the
+// provider handlers to implement the UpdateSettings method of the Handler interface
+type settingsHolder struct {
+	lock     sync.RWMutex
+	settings Settings
+}
+
+func newSettingsHolder(settings Settings) *settingsHolder {
+	return &settingsHolder{settings: settings}
+}
+
+// UpdateSettings replaces the settings, they take effect from the next poll
+func (s *settingsHolder) UpdateSettings(settings Settings) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.settings = settings
+}
+
+// pollInterval returns the time until the next poll, including the jitter
+func (s *settingsHolder) pollInterval() time.Duration {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.settings.PollJitter > 0 {
+		return wait.Jitter(s.settings.PollInterval, s.settings.PollJitter)
+	}
+	return s.settings.PollInterval
+}
+
+// basePollInterval returns the poll interval, without the jitter
+func (s *settingsHolder) basePollInterval() time.Duration {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.settings.PollInterval
+}
+
+// advisoryPollInterval returns the time until the next poll while the cloud
+// provider signals a termination is likely, including the jitter
+func (s *settingsHolder) advisoryPollInterval() time.Duration {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.settings.PollJitter > 0 && s.settings.AdvisoryPollInterval > 0 {
+		return wait.Jitter(s.settings.AdvisoryPollInterval, s.settings.PollJitter)
+	}
+	return s.settings.AdvisoryPollInterval
+}
+
+func (s *settingsHolder) shutdownBudget() time.Duration {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.settings.ShutdownBudget
+}
+
+func (s *settingsHolder) clockSkewAllowance() time.Duration {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.settings.ClockSkewAllowance
+}
+
+func (s *settingsHolder) retryPolicy() RetryPolicy {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.settings.Retry
+}
+
+func (s *settingsHolder) unreachableThreshold() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.settings.UnreachableThreshold
+}
+
+// pollImmediateUntil runs condition immediately and then every interval until it returns
+// true, returns an error or the context is done. Unlike wait.PollImmediateUntil, the interval
+// is read before every wait so changes to the settings apply without restarting the poll.
+func pollImmediateUntil(ctx context.Context, interval func() time.Duration, condition wait.ConditionFunc) error {
+	for {
+		done, err := condition()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		timer := time.NewTimer(interval())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return wait.ErrWaitTimeout
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// awaitShutdown waits for the run goroutine tracked by wg to return once polling was
+// cancelled. Actions in flight, e.g. a running drain, get up to the shutdown budget to
+// complete before cancelActions cancels them.
+func (h *handlerBase) awaitShutdown(cancelActions context.CancelFunc, wg *sync.WaitGroup) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	budget := h.shutdownBudget()
+	if h.Status().State == StateActing {
+		h.log.Info("Stopping, waiting for the actions in flight to complete", "budget", budget)
+	}
+
+	timer := time.NewTimer(budget)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		h.log.Info("Shutdown budget exceeded, cancelling the actions in flight", "budget", budget)
+		cancelActions()
+		<-done
+	}
+}
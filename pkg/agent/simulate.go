@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+)
+
+// SimulationRequest describes a synthetic termination notice injected into a running handler
+type SimulationRequest struct {
+	// EventType of the notice, the event type of the cloud provider if empty
+	EventType string `json:"eventType,omitempty"`
+	// DeadlineSeconds is the time after injection at which the instance is
+	// assumed to be terminated, the deadline is unknown if zero
+	DeadlineSeconds int64 `json:"deadlineSeconds,omitempty"`
+}
+
+// Simulate injects a synthetic termination notice, which the handler acts on at its next poll
+// exactly like on a notice observed from the cloud provider. The notice is marked as simulated
+// in the node annotation, notifications and audit records.
+func (h *handlerBase) Simulate(request SimulationRequest) error {
+	if state := h.Status().State; state != StatePolling {
+		return fmt.Errorf("handler is not polling for termination notices, state is %s", state)
+	}
+
+	notice := notify.Notice{
+		NodeName:   h.nodeName,
+		Provider:   h.cloudProvider,
+		EventType:  request.EventType,
+		DetectedAt: time.Now(),
+		Simulated:  true,
+	}
+	if notice.EventType == "" {
+		notice.EventType = h.eventType
+	}
+	if request.DeadlineSeconds > 0 {
+		notice.Deadline = notice.DetectedAt.Add(time.Duration(request.DeadlineSeconds) * time.Second)
+	}
+
+	select {
+	case h.simulations <- notice:
+		h.log.Info("Injected simulated termination notice", "eventType", notice.EventType)
+		return nil
+	default:
+		return fmt.Errorf("a simulated termination notice is already pending")
+	}
+}
+
+// pendingSimulation returns the simulated notice waiting to be acted on, if any
+func (h *handlerBase) pendingSimulation() *notify.Notice {
+	select {
+	case notice := <-h.simulations:
+		return &notice
+	default:
+		return nil
+	}
+}
+
+// maxSimulationRequestSize bounds the body of a simulation request
+const maxSimulationRequestSize = 64 << 10
+
+// SimulationHandler returns an http.Handler that injects the SimulationRequest posted
+// as JSON into the handler. An empty body simulates a notice with the default values.
+func SimulationHandler(h Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		request := SimulationRequest{}
+		body := http.MaxBytesReader(w, r.Body, maxSimulationRequestSize)
+		if err := json.NewDecoder(body).Decode(&request); err != nil && err != io.EOF {
+			http.Error(w, fmt.Sprintf("invalid simulation request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if err := h.Simulate(request); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
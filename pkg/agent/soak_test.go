@@ -0,0 +1,167 @@
+//go:build soak
+// +build soak
+
+package agent
+
+import (
+	"context"
+	"flag"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/actions"
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/alexander-demichev/termination-handler/pkg/testutil/fakeimds"
+	logrtesting "github.com/go-logr/logr/testing"
+)
+
+// The soak test runs a node handler against a flaky fake metadata server that interrupts the
+// node over and over, and checks that it detects every interruption without leaking
+// goroutines or memory. It is built with the soak tag, run it for hours with e.g.
+//
+//	go test -tags soak -run TestSoak -timeout 0 ./pkg/agent/ -soak.duration 4h
+
+var (
+	soakDuration    = flag.Duration("soak.duration", time.Minute, "duration of the soak test")
+	soakFailureRate = flag.Float64("soak.failure-rate", 0.2, "fraction of the metadata requests failed")
+)
+
+const (
+	// soakCycle is the interval the timeline of the metadata server repeats at, the node is
+	// interrupted after soakNoticeAt in every cycle until the next one starts
+	soakCycle    = 3 * time.Second
+	soakNoticeAt = time.Second
+	// soakGoroutineSlack is the number of goroutines a cycle may have in flight, e.g. the
+	// connections of polls
+	soakGoroutineSlack = 20
+	// soakHeapGrowth bounds the growth of the live heap over the run
+	soakHeapGrowth = 16 << 20
+)
+
+// countingNotifier counts the notices, by key
+type countingNotifier struct {
+	lock    sync.Mutex
+	notices map[string]int
+}
+
+func (n *countingNotifier) Notify(ctx context.Context, notice notify.Notice) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.notices[noticeKey(notice)]++
+	return nil
+}
+
+// count returns the number of notices and of the notices sent more than once
+func (n *countingNotifier) count() (int, int) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	duplicates := 0
+	for _, count := range n.notices {
+		if count > 1 {
+			duplicates++
+		}
+	}
+	return len(n.notices), duplicates
+}
+
+// heapInUse returns the live heap after a collection
+func heapInUse() uint64 {
+	runtime.GC()
+	stats := runtime.MemStats{}
+	runtime.ReadMemStats(&stats)
+	return stats.HeapInuse
+}
+
+func TestSoak(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	imds := fakeimds.New(fakeimds.Timeline{{At: soakNoticeAt, Phase: fakeimds.PhaseTerminating}}, fakeimds.Options{
+		NoticePeriod: 2 * time.Minute,
+		Repeat:       soakCycle,
+		FailureRate:  *soakFailureRate,
+		MaxLatency:   20 * time.Millisecond,
+	})
+	server := httptest.NewServer(imds)
+	client := server.Client()
+
+	settings := testSettings()
+	// Tolerate the injected failures without reporting the endpoint unreachable
+	settings.Retry.MaxAttempts = 0
+	nodes := newFakeNodeClient(testNode("node"))
+	notifier := &countingNotifier{notices: map[string]int{}}
+	handler, err := newNodeHandler(logrtesting.NullLogger{}, nodes, fakeEventSink{}, Options{
+		CloudProvider: "aws",
+		MetadataURL:   server.URL,
+		HTTPClient:    client,
+		NodeName:      "node",
+		Settings:      settings,
+		Actions:       actions.Actions{MarkNode: true},
+		Notifiers:     []notify.Notifier{notifier},
+	})
+	if err != nil {
+		t.Fatalf("constructing handler: %v", err)
+	}
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() { done <- handler.Run(stop) }()
+
+	// The baseline is taken once the handler went through a cycle, with its caches filled
+	time.Sleep(soakCycle)
+	baseGoroutines := runtime.NumGoroutine()
+	baseHeap := heapInUse()
+
+	maxGoroutines := baseGoroutines
+	end := time.After(*soakDuration)
+	ticker := time.NewTicker(soakCycle)
+	defer ticker.Stop()
+	for running := true; running; {
+		select {
+		case err := <-done:
+			t.Fatalf("handler stopped: %v", err)
+		case <-end:
+			running = false
+		case <-ticker.C:
+			if n := runtime.NumGoroutine(); n > maxGoroutines {
+				maxGoroutines = n
+			}
+		}
+	}
+	heap := heapInUse()
+	cycles := int(imds.Cycles())
+
+	close(stop)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("handler failed: %v", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("handler did not stop")
+	}
+	server.Close()
+	client.CloseIdleConnections()
+
+	// Every cycle but the current one went through a whole interruption
+	detections, duplicates := notifier.count()
+	t.Logf("%d cycles, %d detections, %d node writes, goroutines %d to %d, heap %d to %d bytes",
+		cycles, detections, nodes.writeCount(), baseGoroutines, maxGoroutines, baseHeap, heap)
+	if detections < cycles-1 || detections > cycles {
+		t.Errorf("%d interruptions detected in %d cycles", detections, cycles)
+	}
+	if duplicates > 0 {
+		t.Errorf("%d interruptions notified more than once", duplicates)
+	}
+	if maxGoroutines > baseGoroutines+soakGoroutineSlack {
+		t.Errorf("goroutines grew from %d to %d", baseGoroutines, maxGoroutines)
+	}
+	if heap > baseHeap+soakHeapGrowth {
+		t.Errorf("heap grew from %d to %d bytes", baseHeap, heap)
+	}
+	if n := waitForGoroutines(before, testTimeout); n > before {
+		buf := make([]byte, 1<<20)
+		t.Errorf("%d goroutines left after the handler stopped, %d before it started:\n%s", n, before, buf[:runtime.Stack(buf, true)])
+	}
+}
@@ -0,0 +1,240 @@
+//go:build !lite
+// +build !lite
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/actions"
+	"github.com/alexander-demichev/termination-handler/pkg/conditions"
+	"github.com/alexander-demichev/termination-handler/pkg/metrics"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// instanceTypeLabel is the well known label holding the instance type of a node
+	instanceTypeLabel = "node.kubernetes.io/instance-type"
+
+	// interruptionReportKey is the ConfigMap key holding the interruption report
+	interruptionReportKey = "report.json"
+)
+
+// Interruption is a single node interruption observed by the InterruptionStatsExporter
+type Interruption struct {
+	Node         string      `json:"node"`
+	Pool         string      `json:"pool"`
+	InstanceType string      `json:"instanceType"`
+	Time         metav1.Time `json:"time"`
+}
+
+// InterruptionReport is the report written to the ConfigMap
+type InterruptionReport struct {
+	Window        string                      `json:"window"`
+	GeneratedAt   metav1.Time                 `json:"generatedAt"`
+	Counts        []metrics.InterruptionCount `json:"counts"`
+	Interruptions []Interruption              `json:"interruptions"`
+}
+
+// InterruptionStatsExporter watches the nodes of the cluster for the terminating condition and
+// keeps a rolling window of interruptions per node pool and instance type, to help quantify
+// interruption rates. Interrupted nodes disappear shortly after, so the window can be persisted
+// to a ConfigMap report from which it is restored on start.
+type InterruptionStatsExporter struct {
+	client        client.Client
+	window        time.Duration
+	interval      time.Duration
+	poolLabel     string
+	conditionType corev1.NodeConditionType
+	report        *types.NamespacedName
+	log           logr.Logger
+
+	interruptions map[types.UID]Interruption
+}
+
+// NewInterruptionStatsExporter constructs an exporter. The pool of a node is read from the
+// poolLabel label. Interrupted nodes are recognized by the conditionType condition, the
+// default terminating condition if empty. If reportName is empty, no ConfigMap report is written.
+func NewInterruptionStatsExporter(logger logr.Logger, cfg *rest.Config, window, interval time.Duration, poolLabel, conditionType, reportNamespace, reportName string) (*InterruptionStatsExporter, error) {
+	c, err := client.New(cfg, client.Options{Scheme: scheme.Scheme})
+	if err != nil {
+		return nil, fmt.Errorf("error creating client: %v", err)
+	}
+
+	e := &InterruptionStatsExporter{
+		client:        c,
+		window:        window,
+		interval:      interval,
+		poolLabel:     poolLabel,
+		conditionType: actions.TerminatingConditionType,
+		log:           logger.WithName("interruption-stats"),
+		interruptions: map[types.UID]Interruption{},
+	}
+	if conditionType != "" {
+		e.conditionType = corev1.NodeConditionType(conditionType)
+	}
+	if reportName != "" {
+		e.report = &types.NamespacedName{Namespace: reportNamespace, Name: reportName}
+	}
+	return e, nil
+}
+
+// Run collects interruption statistics until stop is closed
+func (e *InterruptionStatsExporter) Run(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	if e.report != nil {
+		if err := e.loadReport(ctx); err != nil {
+			return fmt.Errorf("error loading interruption report: %v", err)
+		}
+	}
+
+	wait.Until(func() {
+		if err := e.collect(ctx); err != nil {
+			e.log.Error(err, "Error collecting interruption statistics")
+		}
+	}, e.interval, stop)
+	return nil
+}
+
+func (e *InterruptionStatsExporter) collect(ctx context.Context) error {
+	nodes := &corev1.NodeList{}
+	if err := e.client.List(ctx, nodes); err != nil {
+		return fmt.Errorf("error listing nodes: %v", err)
+	}
+
+	for _, node := range nodes.Items {
+		condition := conditions.Find(node.Status.Conditions, e.conditionType)
+		if condition == nil || condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		if _, ok := e.interruptions[node.UID]; !ok {
+			e.interruptions[node.UID] = Interruption{
+				Node:         node.Name,
+				Pool:         node.Labels[e.poolLabel],
+				InstanceType: node.Labels[instanceTypeLabel],
+				Time:         condition.LastTransitionTime,
+			}
+		}
+	}
+
+	// Drop interruptions that left the window
+	cutoff := time.Now().Add(-e.window)
+	for uid, interruption := range e.interruptions {
+		if interruption.Time.Time.Before(cutoff) {
+			delete(e.interruptions, uid)
+		}
+	}
+
+	counts := e.counts()
+	metrics.SetInterruptions(counts)
+
+	if e.report != nil {
+		if err := e.writeReport(ctx, counts); err != nil {
+			return fmt.Errorf("error writing interruption report: %v", err)
+		}
+	}
+	return nil
+}
+
+// counts aggregates the interruptions by pool and instance type
+func (e *InterruptionStatsExporter) counts() []metrics.InterruptionCount {
+	type key struct{ pool, instanceType string }
+	byKey := map[key]int{}
+	for _, interruption := range e.interruptions {
+		byKey[key{interruption.Pool, interruption.InstanceType}]++
+	}
+
+	counts := []metrics.InterruptionCount{}
+	for k, count := range byKey {
+		counts = append(counts, metrics.InterruptionCount{Pool: k.pool, InstanceType: k.instanceType, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Pool != counts[j].Pool {
+			return counts[i].Pool < counts[j].Pool
+		}
+		return counts[i].InstanceType < counts[j].InstanceType
+	})
+	return counts
+}
+
+// loadReport restores the interruptions recorded in an existing report
+func (e *InterruptionStatsExporter) loadReport(ctx context.Context) error {
+	cm := &corev1.ConfigMap{}
+	if err := e.client.Get(ctx, *e.report, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	report := InterruptionReport{}
+	if data, ok := cm.Data[interruptionReportKey]; ok {
+		if err := json.Unmarshal([]byte(data), &report); err != nil {
+			// A corrupt report should not prevent collecting new statistics
+			e.log.Error(err, "Ignoring invalid interruption report")
+			return nil
+		}
+	}
+
+	for _, interruption := range report.Interruptions {
+		// Interrupted nodes are gone, key restored interruptions by node name
+		e.interruptions[types.UID("restored/"+interruption.Node)] = interruption
+	}
+	return nil
+}
+
+func (e *InterruptionStatsExporter) writeReport(ctx context.Context, counts []metrics.InterruptionCount) error {
+	report := InterruptionReport{
+		Window:        e.window.String(),
+		GeneratedAt:   metav1.Now(),
+		Counts:        counts,
+		Interruptions: []Interruption{},
+	}
+	for _, interruption := range e.interruptions {
+		report.Interruptions = append(report.Interruptions, interruption)
+	}
+	sort.Slice(report.Interruptions, func(i, j int) bool {
+		return report.Interruptions[i].Time.Before(&report.Interruptions[j].Time)
+	})
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := e.client.Get(ctx, *e.report, cm); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: e.report.Namespace, Name: e.report.Name},
+			Data:       map[string]string{interruptionReportKey: string(data)},
+		}
+		return e.client.Create(ctx, cm)
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[interruptionReportKey] = string(data)
+	return e.client.Update(ctx, cm)
+}
@@ -0,0 +1,294 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/metrics"
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// notifyAction is the name of the notification action reported in the status
+const notifyAction = "notify"
+
+// State is the state of the handler's state machine
+type State string
+
+const (
+	// StateInitializing is the state of a handler that has not started running yet
+	StateInitializing State = "initializing"
+	// StateIdle is the state of a handler running on a node not matching the node selector
+	StateIdle State = "idle"
+	// StatePolling is the state of a handler polling the termination notice endpoint
+	StatePolling State = "polling"
+	// StateDetected is the state of a handler that observed a termination notice
+	StateDetected State = "detected"
+	// StatePaused is the state of a handler that detected a termination notice on a paused node
+	StatePaused State = "paused"
+	// StateDeferred is the state of a handler that marked and cordoned the node, waiting for
+	// the maintenance window or the lead time before the deadline to drain it
+	StateDeferred State = "deferred"
+	// StateActing is the state of a handler marking the node for deletion
+	StateActing State = "acting"
+	// StateDone is the state of a handler that finished marking the node for deletion
+	StateDone State = "done"
+)
+
+// Status is a snapshot of the handler's internal state, intended for debugging
+type Status struct {
+	State     State      `json:"state"`
+	LastPoll  *time.Time `json:"lastPoll,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+	// MetadataUnreachable is set while the termination notice endpoint can not be polled
+	MetadataUnreachable bool          `json:"metadataUnreachable,omitempty"`
+	Notice              *StatusNotice `json:"notice,omitempty"`
+	// PendingActions are the actions not taken yet for the notice
+	PendingActions []string     `json:"pendingActions,omitempty"`
+	Config         StatusConfig `json:"config"`
+}
+
+// StatusNotice is the termination notice the handler is acting on
+type StatusNotice struct {
+	Provider   string     `json:"provider"`
+	EventType  string     `json:"eventType"`
+	EventID    string     `json:"eventID,omitempty"`
+	DetectedAt time.Time  `json:"detectedAt"`
+	Deadline   *time.Time `json:"deadline,omitempty"`
+	Simulated  bool       `json:"simulated,omitempty"`
+	Raw        string     `json:"raw,omitempty"`
+}
+
+// StatusConfig is the configuration in effect for the handler, the poll interval is the
+// one of the current settings
+type StatusConfig struct {
+	CloudProvider string `json:"cloudProvider"`
+	NodeName      string `json:"nodeName"`
+	Namespace     string `json:"namespace"`
+	NodeSelector  string `json:"nodeSelector,omitempty"`
+	PollInterval  string `json:"pollInterval"`
+}
+
+// ClusterStatus summarizes the nodes with a termination notice handled by a central handler,
+// a single view of correlated terminations such as capacity reclaims of a zone
+type ClusterStatus struct {
+	// TerminatingNodes are sorted by deadline, the nodes with an unknown deadline last
+	TerminatingNodes []TerminatingNode `json:"terminatingNodes"`
+	// States counts the terminating nodes by the state of their handler
+	States map[State]int `json:"states,omitempty"`
+	// NextDeadline is the earliest deadline of the terminating nodes
+	NextDeadline *time.Time `json:"nextDeadline,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+}
+
+// TerminatingNode is the status of the handler of a node with a termination notice
+type TerminatingNode struct {
+	NodeName string        `json:"nodeName"`
+	State    State         `json:"state"`
+	Notice   *StatusNotice `json:"notice,omitempty"`
+	// PendingActions are the actions not taken yet, e.g. drain while the node is drained
+	PendingActions []string `json:"pendingActions,omitempty"`
+	LastError      string   `json:"lastError,omitempty"`
+}
+
+// ClusterStatusReporter is implemented by the handlers of many nodes reporting a ClusterStatus
+type ClusterStatusReporter interface {
+	ClusterStatus() ClusterStatus
+}
+
+// newClusterStatus summarizes the terminating nodes
+func newClusterStatus(nodes []TerminatingNode) ClusterStatus {
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := nodeDeadline(nodes[i]), nodeDeadline(nodes[j])
+		if a != nil && b != nil && !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		if (a == nil) != (b == nil) {
+			return b == nil
+		}
+		return nodes[i].NodeName < nodes[j].NodeName
+	})
+
+	status := ClusterStatus{TerminatingNodes: nodes, States: map[State]int{}}
+	for _, node := range nodes {
+		status.States[node.State]++
+		if deadline := nodeDeadline(node); deadline != nil && status.NextDeadline == nil {
+			status.NextDeadline = deadline
+		}
+	}
+	return status
+}
+
+// nodeDeadline returns the deadline of the notice of node, nil if unknown
+func nodeDeadline(node TerminatingNode) *time.Time {
+	if node.Notice == nil {
+		return nil
+	}
+	return node.Notice.Deadline
+}
+
+// recordClusterStatus reports the terminating nodes of status in the metrics
+func recordClusterStatus(status ClusterStatus) {
+	nodes := make([]metrics.TerminatingNode, 0, len(status.TerminatingNodes))
+	for _, node := range status.TerminatingNodes {
+		n := metrics.TerminatingNode{Node: node.NodeName, State: string(node.State), PendingActions: len(node.PendingActions)}
+		if deadline := nodeDeadline(node); deadline != nil {
+			n.Deadline = *deadline
+		}
+		nodes = append(nodes, n)
+	}
+	metrics.SetTerminatingNodes(nodes)
+}
+
+// statusTracker records the status of a handler, it is embedded by the
+// provider handlers to implement the Status method of the Handler interface
+type statusTracker struct {
+	lock   sync.RWMutex
+	status Status
+}
+
+func newStatusTracker(config StatusConfig) *statusTracker {
+	return &statusTracker{
+		status: Status{
+			State:  StateInitializing,
+			Config: config,
+		},
+	}
+}
+
+// Status returns a snapshot of the current status
+func (t *statusTracker) Status() Status {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	status := t.status
+	if status.LastPoll != nil {
+		lastPoll := *status.LastPoll
+		status.LastPoll = &lastPoll
+	}
+	if status.Notice != nil {
+		notice := *status.Notice
+		status.Notice = &notice
+	}
+	status.PendingActions = append([]string(nil), status.PendingActions...)
+	return status
+}
+
+// Status returns a snapshot of the current status, reporting the poll interval of the
+// current settings so hot reloads show
+func (h *handlerBase) Status() Status {
+	status := h.statusTracker.Status()
+	status.Config.PollInterval = h.settingsHolder.basePollInterval().String()
+	return status
+}
+
+func (t *statusTracker) setState(state State) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.status.State = state
+}
+
+// setNotice records the notice acted on and the actions to be taken for it
+func (t *statusTracker) setNotice(notice notify.Notice, pendingActions []string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.status.Notice = &StatusNotice{
+		Provider:   notice.Provider,
+		EventType:  notice.EventType,
+		EventID:    notice.EventID,
+		DetectedAt: notice.DetectedAt,
+		Deadline:   noticeDeadline(notice),
+		Simulated:  notice.Simulated,
+		Raw:        notice.Raw,
+	}
+	t.status.PendingActions = pendingActions
+}
+
+// clearNotice forgets the notice once it was cancelled
+func (t *statusTracker) clearNotice() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.status.Notice = nil
+	t.status.PendingActions = nil
+}
+
+// completeAction removes the action from the pending actions
+func (t *statusTracker) completeAction(action string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	pending := []string{}
+	for _, a := range t.status.PendingActions {
+		if a != action {
+			pending = append(pending, a)
+		}
+	}
+	t.status.PendingActions = pending
+}
+
+func (t *statusTracker) setMetadataUnreachable(unreachable bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.status.MetadataUnreachable = unreachable
+}
+
+func (t *statusTracker) setError(err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.status.LastError = err.Error()
+}
+
+// trackPolls wraps a poll condition function to record the time and error of every poll
+func (t *statusTracker) trackPolls(condition wait.ConditionFunc) wait.ConditionFunc {
+	return func() (bool, error) {
+		done, err := condition()
+
+		now := time.Now()
+		t.lock.Lock()
+		t.status.LastPoll = &now
+		if err != nil {
+			t.status.LastError = err.Error()
+		}
+		t.lock.Unlock()
+
+		return done, err
+	}
+}
+
+// StatusHandler returns an http.Handler that serves the status of the handler as JSON
+func StatusHandler(h Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(h.Status()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// ClusterStatusHandler returns an http.Handler that serves the cluster status of h as JSON
+func ClusterStatusHandler(h ClusterStatusReporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(h.ClusterStatus()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// ReadyHandler returns an http.Handler reporting the handler as not ready while the
+// termination notice endpoint is unreachable, so the degradation shows in the pod status
+func ReadyHandler(h Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.Status().MetadataUnreachable {
+			http.Error(w, "termination notice endpoint unreachable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/metrics"
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/alexander-demichev/termination-handler/pkg/providers"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// watchdogIntervals is the number of poll intervals without a completed poll after which the
+// poll loop is considered stalled. A poll is bounded by the poll interval and the retries of
+// failed polls by the backoff, so a healthy loop never stays this long without polling.
+const watchdogIntervals = 5
+
+// pollResult is the result of a poll loop
+type pollResult struct {
+	notice *notify.Notice
+	err    error
+}
+
+// pollUntilNotice polls the termination notice endpoint until it reports a notice or a simulated
+// notice is injected, and returns the notice. A watchdog supervises the poll loop: a loop that
+// has not completed a poll for watchdogIntervals poll intervals, e.g. because a request hangs
+// despite its timeout, is abandoned and a new loop is started, so detection does not silently stop.
+func (h *handlerBase) pollUntilNotice(ctx context.Context, logger logr.Logger) (*notify.Notice, error) {
+	for {
+		loopCtx, cancel := context.WithCancel(ctx)
+		var lastPoll int64
+		atomic.StoreInt64(&lastPoll, time.Now().UnixNano())
+		results := make(chan pollResult, 1)
+		go func() {
+			notice, err := h.pollLoop(loopCtx, logger, func() {
+				atomic.StoreInt64(&lastPoll, time.Now().UnixNano())
+			})
+			results <- pollResult{notice: notice, err: err}
+		}()
+
+		result, stalled := h.superviseLoop(ctx, results, &lastPoll)
+		cancel()
+		if !stalled {
+			return result.notice, result.err
+		}
+		logger.Error(nil, "Poll loop stalled, restarting it", "since", time.Unix(0, atomic.LoadInt64(&lastPoll)))
+		metrics.RecordPollLoopRestart(h.cloudProvider)
+	}
+}
+
+// superviseLoop waits for the result of a poll loop, it returns whether the loop stalled
+// instead. The loop is abandoned once ctx is done.
+func (h *handlerBase) superviseLoop(ctx context.Context, results <-chan pollResult, lastPoll *int64) (pollResult, bool) {
+	check := time.NewTicker(h.pollInterval())
+	defer check.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return pollResult{err: wait.ErrWaitTimeout}, false
+		case result := <-results:
+			return result, false
+		case <-check.C:
+			since := time.Since(time.Unix(0, atomic.LoadInt64(lastPoll)))
+			if since > watchdogIntervals*h.nextPollInterval() {
+				return pollResult{}, true
+			}
+		}
+	}
+}
+
+// pollLoop polls the termination notice endpoint until it reports a notice, a simulated
+// notice is injected or ctx is done. polled is called after every poll.
+func (h *handlerBase) pollLoop(ctx context.Context, logger logr.Logger, polled func()) (*notify.Notice, error) {
+	// A provider must not be shared with an abandoned loop
+	provider, err := h.newProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	var notice *notify.Notice
+	failures := &pollFailures{}
+	err = pollImmediateUntil(ctx, failures.retryInterval(h.nextPollInterval, h.retryPolicy), h.toleratePollFailures(logger, failures, h.trackPolls(func() (bool, error) {
+		defer polled()
+		if notice = h.pendingSimulation(); notice != nil {
+			return true, nil
+		}
+		metrics.RecordPoll(h.cloudProvider)
+
+		pollCtx, cancel := h.pollContext(ctx)
+		defer cancel()
+		var reported *providers.TerminationNotice
+		err := catchPanic(logger, func() error {
+			var err error
+			reported, err = provider.Poll(pollCtx, logger)
+			return err
+		})
+		if reported != nil {
+			notice = newNotice(reported, h.nodeName, h.cloudProvider, h.eventType)
+		}
+		return notice != nil, err
+	})))
+	return notice, err
+}
@@ -0,0 +1,96 @@
+//go:build !lite
+// +build !lite
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/alexander-demichev/termination-handler/pkg/conditions"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// BindingWebhookPath is the path the binding webhook is served at
+const BindingWebhookPath = "/validate-binding"
+
+// BindingValidator is a validating admission webhook for the pods/binding subresource. It
+// rejects binding pods to nodes with the terminating condition, closing the race where the
+// scheduler places pods on a node in the seconds before it is cordoned. The scheduler then
+// schedules the rejected pods again, onto other nodes. Pods a drain would not evict, e.g.
+// DaemonSet pods, are still bound. The webhook fails open: bindings are allowed if the node
+// can not be fetched.
+type BindingValidator struct {
+	nodes         client.Reader
+	pods          client.Reader
+	conditionType corev1.NodeConditionType
+	decoder       *admission.Decoder
+	log           logr.Logger
+}
+
+// NewBindingValidator constructs a BindingValidator rejecting bindings to nodes with the
+// condition of type conditionType. Nodes are read from the cache of mgr, pods, which are only
+// read for terminating nodes, from the API server.
+func NewBindingValidator(logger logr.Logger, mgr manager.Manager, conditionType string) (*BindingValidator, error) {
+	decoder, err := admission.NewDecoder(mgr.GetScheme())
+	if err != nil {
+		return nil, fmt.Errorf("error constructing decoder: %v", err)
+	}
+	return &BindingValidator{
+		nodes:         mgr.GetClient(),
+		pods:          mgr.GetAPIReader(),
+		conditionType: corev1.NodeConditionType(conditionType),
+		decoder:       decoder,
+		log:           logger.WithName("binding-webhook"),
+	}, nil
+}
+
+// SetupWithManager serves the webhook at BindingWebhookPath with the webhook server of mgr
+func (v *BindingValidator) SetupWithManager(mgr manager.Manager) {
+	mgr.GetWebhookServer().Register(BindingWebhookPath, &webhook.Admission{Handler: v})
+}
+
+// Handle implements admission.Handler
+func (v *BindingValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	binding := &corev1.Binding{}
+	if err := v.decoder.Decode(req, binding); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if binding.Target.Kind != "" && binding.Target.Kind != "Node" {
+		return admission.Allowed("")
+	}
+	nodeName := binding.Target.Name
+	logger := v.log.WithValues("pod", req.Namespace+"/"+binding.Name, "node", nodeName)
+
+	node := &corev1.Node{}
+	if err := v.nodes.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		if !apierrors.IsNotFound(err) {
+			logger.Error(err, "Error fetching node, allowing the binding")
+		}
+		return admission.Allowed("")
+	}
+	condition := conditions.Find(node.Status.Conditions, v.conditionType)
+	if condition == nil || condition.Status != corev1.ConditionTrue {
+		return admission.Allowed("")
+	}
+
+	// The binding is named after its pod
+	pod := &corev1.Pod{}
+	err := v.pods.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: binding.Name}, pod)
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.Error(err, "Error fetching pod, rejecting the binding to the terminating node")
+	}
+	if err == nil && !evictable(pod) {
+		return admission.Allowed("pods that are not drained may run on terminating nodes")
+	}
+
+	logger.V(1).Info("Rejecting the binding of a pod to a terminating node")
+	return admission.Denied(fmt.Sprintf("node %s is terminating, the cloud provider will reclaim its instance", nodeName))
+}
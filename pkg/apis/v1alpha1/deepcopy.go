@@ -0,0 +1,230 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto copies the receiver into out
+func (in *TerminationPolicyActions) DeepCopyInto(out *TerminationPolicyActions) {
+	*out = *in
+	if in.MarkNode != nil {
+		out.MarkNode = new(bool)
+		*out.MarkNode = *in.MarkNode
+	}
+	if in.Notify != nil {
+		out.Notify = new(bool)
+		*out.Notify = *in.Notify
+	}
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *TerminationPolicySpec) DeepCopyInto(out *TerminationPolicySpec) {
+	*out = *in
+	in.NodeSelector.DeepCopyInto(&out.NodeSelector)
+	in.Actions.DeepCopyInto(&out.Actions)
+	if in.DefaultDeadline != nil {
+		out.DefaultDeadline = new(metav1.Duration)
+		*out.DefaultDeadline = *in.DefaultDeadline
+	}
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *TerminationPolicy) DeepCopyInto(out *TerminationPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy returns a deep copy of the receiver
+func (in *TerminationPolicy) DeepCopy() *TerminationPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(TerminationPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *TerminationPolicy) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *TerminationPolicyList) DeepCopyInto(out *TerminationPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]TerminationPolicy, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy returns a deep copy of the receiver
+func (in *TerminationPolicyList) DeepCopy() *TerminationPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(TerminationPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *TerminationPolicyList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *NodeTerminationSpec) DeepCopyInto(out *NodeTerminationSpec) {
+	*out = *in
+	in.DetectedAt.DeepCopyInto(&out.DetectedAt)
+	if in.Deadline != nil {
+		out.Deadline = in.Deadline.DeepCopy()
+	}
+	in.Actions.DeepCopyInto(&out.Actions)
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *NodeTerminationActions) DeepCopyInto(out *NodeTerminationActions) {
+	*out = *in
+	if in.DrainNotBefore != nil {
+		out.DrainNotBefore = in.DrainNotBefore.DeepCopy()
+	}
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *NodeTerminationStatus) DeepCopyInto(out *NodeTerminationStatus) {
+	*out = *in
+	if in.LastTransitionTime != nil {
+		out.LastTransitionTime = in.LastTransitionTime.DeepCopy()
+	}
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *NodeTermination) DeepCopyInto(out *NodeTermination) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy returns a deep copy of the receiver
+func (in *NodeTermination) DeepCopy() *NodeTermination {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeTermination)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *NodeTermination) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *NodeTerminationList) DeepCopyInto(out *NodeTerminationList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]NodeTermination, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy returns a deep copy of the receiver
+func (in *NodeTerminationList) DeepCopy() *NodeTerminationList {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeTerminationList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *NodeTerminationList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *TerminationHandlerConfigSpec) DeepCopyInto(out *TerminationHandlerConfigSpec) {
+	*out = *in
+	in.Config.DeepCopyInto(&out.Config)
+	if in.Pools != nil {
+		out.Pools = make([]TerminationHandlerConfigPool, len(in.Pools))
+		for i := range in.Pools {
+			in.Pools[i].DeepCopyInto(&out.Pools[i])
+		}
+	}
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *TerminationHandlerConfigPool) DeepCopyInto(out *TerminationHandlerConfigPool) {
+	*out = *in
+	in.NodeSelector.DeepCopyInto(&out.NodeSelector)
+	in.Config.DeepCopyInto(&out.Config)
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *TerminationHandlerConfig) DeepCopyInto(out *TerminationHandlerConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy returns a deep copy of the receiver
+func (in *TerminationHandlerConfig) DeepCopy() *TerminationHandlerConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(TerminationHandlerConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *TerminationHandlerConfig) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *TerminationHandlerConfigList) DeepCopyInto(out *TerminationHandlerConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]TerminationHandlerConfig, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy returns a deep copy of the receiver
+func (in *TerminationHandlerConfigList) DeepCopy() *TerminationHandlerConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(TerminationHandlerConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *TerminationHandlerConfigList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
@@ -0,0 +1,3 @@
+// Package v1alpha1 contains the v1alpha1 API types of the termination handler
+// +groupName=termination-handler.io
+package v1alpha1
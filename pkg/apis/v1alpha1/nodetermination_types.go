@@ -0,0 +1,118 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NodeTerminationPhase is the progress of the actions taken for a termination notice
+type NodeTerminationPhase string
+
+const (
+	// NodeTerminationDetected is the phase of a termination notice no action was taken for yet
+	NodeTerminationDetected NodeTerminationPhase = "Detected"
+	// NodeTerminationCordoned is the phase once the node is marked and cordoned, as requested
+	NodeTerminationCordoned NodeTerminationPhase = "Cordoned"
+	// NodeTerminationDrained is the phase once the pods were evicted from the node, if requested
+	NodeTerminationDrained NodeTerminationPhase = "Drained"
+	// NodeTerminationCompleted is the phase once every action was taken, or the node was deleted
+	NodeTerminationCompleted NodeTerminationPhase = "Completed"
+)
+
+// NodeTerminationSpec describes the termination notice of a node and the actions to take
+type NodeTerminationSpec struct {
+	// NodeName is the name of the node running on the terminated instance
+	NodeName string `json:"nodeName"`
+
+	// Provider is the cloud provider that reported the termination notice
+	Provider string `json:"provider"`
+
+	// EventType and EventID identify the termination notice at the cloud provider
+	EventType string `json:"eventType"`
+	// +optional
+	EventID string `json:"eventID,omitempty"`
+
+	// DetectedAt is the time the termination notice was detected
+	DetectedAt metav1.Time `json:"detectedAt"`
+
+	// Deadline is the time the instance is terminated at, unknown if unset
+	// +optional
+	Deadline *metav1.Time `json:"deadline,omitempty"`
+
+	// Simulated is set for termination notices injected to test the handling
+	// +optional
+	Simulated bool `json:"simulated,omitempty"`
+
+	// Actions are the actions taken on the node
+	// +optional
+	Actions NodeTerminationActions `json:"actions,omitempty"`
+}
+
+// NodeTerminationActions are the actions taken on the node for a termination notice
+type NodeTerminationActions struct {
+	// MarkNode adds the terminating condition to the node
+	// +optional
+	MarkNode bool `json:"markNode,omitempty"`
+
+	// Cordon marks the node unschedulable
+	// +optional
+	Cordon bool `json:"cordon,omitempty"`
+
+	// Drain evicts the pods running on the node
+	// +optional
+	Drain bool `json:"drain,omitempty"`
+
+	// DrainTimeout bounds the time spent evicting pods
+	// +optional
+	DrainTimeout metav1.Duration `json:"drainTimeout,omitempty"`
+
+	// DrainDelay is the time waited once the node is cordoned before evicting pods, shortened
+	// so the drain can complete before the deadline
+	// +optional
+	DrainDelay metav1.Duration `json:"drainDelay,omitempty"`
+
+	// DrainNotBefore is the time the drain of a notice of scheduled maintenance is deferred
+	// to, e.g. the start of a maintenance window
+	// +optional
+	DrainNotBefore *metav1.Time `json:"drainNotBefore,omitempty"`
+}
+
+// NodeTerminationStatus is the progress of the actions taken for the termination notice
+type NodeTerminationStatus struct {
+	// Phase is the last phase reached, Detected if unset
+	// +optional
+	Phase NodeTerminationPhase `json:"phase,omitempty"`
+
+	// LastTransitionTime is the time the phase was reached
+	// +optional
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Message describes the error of the last attempt to reach the next phase, or why the
+	// phase was reached, empty if there is nothing to report
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+
+// NodeTermination records a termination notice of a node, created by the handler at detection
+// time. The NodeTermination controller takes the actions and records its progress in the
+// status, so the handling is observable and resumed after restarts. It is named after the
+// node and deleted with it.
+type NodeTermination struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NodeTerminationSpec   `json:"spec,omitempty"`
+	Status NodeTerminationStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// NodeTerminationList contains a list of NodeTermination
+type NodeTerminationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NodeTermination `json:"items"`
+}
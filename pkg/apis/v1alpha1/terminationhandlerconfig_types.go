@@ -0,0 +1,73 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// TerminationHandlerConfigSpec is the configuration shared by the agents
+type TerminationHandlerConfigSpec struct {
+	// Config is the configuration of every agent, in the format of the configuration file
+	// +optional
+	Config runtime.RawExtension `json:"config,omitempty"`
+
+	// Pools override the configuration for the nodes they select. The overrides of every pool
+	// selecting a node are merged on top of Config in order, later pools take precedence.
+	// +optional
+	Pools []TerminationHandlerConfigPool `json:"pools,omitempty"`
+}
+
+// TerminationHandlerConfigPool overrides the configuration for the nodes of a pool
+type TerminationHandlerConfigPool struct {
+	// Name identifies the pool in the status
+	Name string `json:"name"`
+
+	// NodeSelector selects the nodes of the pool, an empty selector selects all nodes
+	// +optional
+	NodeSelector metav1.LabelSelector `json:"nodeSelector,omitempty"`
+
+	// Config holds the configuration values overridden for the pool
+	// +optional
+	Config runtime.RawExtension `json:"config,omitempty"`
+}
+
+// TerminationHandlerConfigStatus is the result of the validation of the configuration
+type TerminationHandlerConfigStatus struct {
+	// ObservedGeneration is the generation of the spec that was validated
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Valid is set if the configuration of every pool is valid
+	// +optional
+	Valid bool `json:"valid,omitempty"`
+
+	// Message describes the problems found, empty if the configuration is valid
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+
+// TerminationHandlerConfig configures the agents of the cluster in place of their
+// configuration files, so DaemonSets do not need diverging flags. Agents started with
+// --handler-config watch it and apply changes like those of a configuration file, flags
+// still take precedence. The configuration controller validates it and reports the result
+// in the status.
+type TerminationHandlerConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TerminationHandlerConfigSpec   `json:"spec,omitempty"`
+	Status TerminationHandlerConfigStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TerminationHandlerConfigList contains a list of TerminationHandlerConfig
+type TerminationHandlerConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TerminationHandlerConfig `json:"items"`
+}
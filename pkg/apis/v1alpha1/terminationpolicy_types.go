@@ -0,0 +1,64 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TerminationPolicySpec defines how the termination handler acts on the nodes matching the policy
+type TerminationPolicySpec struct {
+	// NodeSelector selects the nodes the policy applies to, an empty selector selects all nodes
+	// +optional
+	NodeSelector metav1.LabelSelector `json:"nodeSelector,omitempty"`
+
+	// Priority decides which policy applies when several policies select a node,
+	// the policy with the highest priority wins, ties are broken by name
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// Excluded excludes the selected nodes from termination handling. Termination notices
+	// are still detected and reported in metrics, but no actions are taken.
+	// +optional
+	Excluded bool `json:"excluded,omitempty"`
+
+	// Actions selects the actions taken when a termination notice is detected
+	// +optional
+	Actions TerminationPolicyActions `json:"actions,omitempty"`
+
+	// DefaultDeadline is the time after detection at which the instance is assumed to be
+	// terminated when the cloud provider does not report a deadline
+	// +optional
+	DefaultDeadline *metav1.Duration `json:"defaultDeadline,omitempty"`
+}
+
+// TerminationPolicyActions selects the actions taken when a termination notice is detected,
+// unset actions are enabled
+type TerminationPolicyActions struct {
+	// MarkNode adds the Terminating condition to the node
+	// +optional
+	MarkNode *bool `json:"markNode,omitempty"`
+
+	// Notify publishes the termination notice to the configured notification sinks
+	// +optional
+	Notify *bool `json:"notify,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+
+// TerminationPolicy defines the actions, deadlines and exclusions of termination handling
+// for the nodes selected by the policy
+type TerminationPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TerminationPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TerminationPolicyList contains a list of TerminationPolicy
+type TerminationPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TerminationPolicy `json:"items"`
+}
@@ -0,0 +1,70 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// Record types
+const (
+	// RecordTypeDetection is the type of records written when a termination notice is detected
+	RecordTypeDetection = "detection"
+	// RecordTypeAction is the type of records written for every action taken by the handler
+	RecordTypeAction = "action"
+)
+
+// Action results
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Record is an audit record of a detection or of an action taken by the handler
+type Record struct {
+	Time      time.Time  `json:"time"`
+	Type      string     `json:"type"`
+	Node      string     `json:"node"`
+	Provider  string     `json:"provider"`
+	EventType string     `json:"eventType,omitempty"`
+	EventID   string     `json:"eventID,omitempty"`
+	Deadline  *time.Time `json:"deadline,omitempty"`
+	Action    string     `json:"action,omitempty"`
+	Result    string     `json:"result,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Simulated bool       `json:"simulated,omitempty"`
+	// Raw is the notice as reported by the provider, only recorded for detections
+	Raw string `json:"raw,omitempty"`
+}
+
+// Auditor stores audit records
+type Auditor interface {
+	Audit(ctx context.Context, record Record) error
+}
+
+// multiAuditor sends every record to all of its auditors
+type multiAuditor []Auditor
+
+// NewMultiAuditor returns an Auditor sending every record to all auditors. It returns nil if
+// no auditors are given, so that callers can treat auditing as disabled.
+func NewMultiAuditor(auditors ...Auditor) Auditor {
+	switch len(auditors) {
+	case 0:
+		return nil
+	case 1:
+		return auditors[0]
+	}
+	return multiAuditor(auditors)
+}
+
+// Audit implements Auditor, every auditor is called even if a previous one failed
+func (m multiAuditor) Audit(ctx context.Context, record Record) error {
+	var errs []error
+	for _, auditor := range m {
+		if err := auditor.Audit(ctx, record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
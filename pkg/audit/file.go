@@ -0,0 +1,52 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileAuditor appends audit records as JSON lines to a local file, typically on a hostPath
+// volume so the records survive the handler's pod until the node is torn down
+type FileAuditor struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+// NewFileAuditor opens path for appending, creating it if needed
+func NewFileAuditor(path string) (*FileAuditor, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log %q: %w", path, err)
+	}
+	return &FileAuditor{file: file}, nil
+}
+
+// Audit implements Auditor. Every record is synced to disk as the node may go away at any time.
+func (a *FileAuditor) Audit(_ context.Context, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshalling audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if _, err := a.file.Write(line); err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+	if err := a.file.Sync(); err != nil {
+		return fmt.Errorf("error syncing audit log: %w", err)
+	}
+	return nil
+}
+
+// Close closes the audit log
+func (a *FileAuditor) Close() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.file.Close()
+}
@@ -0,0 +1,177 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// SignatureHeader carries the hex encoded HMAC-SHA256 of the request body
+	SignatureHeader = "X-Termination-Handler-Signature"
+
+	spoolFileSuffix = ".json"
+
+	// maxDrainSize bounds the response body read before the connection is released
+	maxDrainSize = 64 << 10
+)
+
+// HTTPAuditor delivers signed audit records to an HTTPS endpoint. Every record is
+// written to a local spool directory before delivery is attempted and only removed
+// once the endpoint acknowledged it, so records survive endpoint outages and restarts.
+type HTTPAuditor struct {
+	url        string
+	signingKey []byte
+	spoolDir   string
+	client     *http.Client
+	backoff    wait.Backoff
+	log        logr.Logger
+
+	// flushLock serializes delivery of the spooled records
+	flushLock sync.Mutex
+	sequence  uint64
+}
+
+// NewHTTPAuditor constructs an auditor delivering records to url, signed with signingKey
+func NewHTTPAuditor(logger logr.Logger, url string, signingKey []byte, spoolDir string, client *http.Client) (*HTTPAuditor, error) {
+	if err := os.MkdirAll(spoolDir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating audit spool directory: %w", err)
+	}
+
+	return &HTTPAuditor{
+		url:        url,
+		signingKey: signingKey,
+		spoolDir:   spoolDir,
+		client:     client,
+		backoff: wait.Backoff{
+			Duration: 500 * time.Millisecond,
+			Factor:   2,
+			Jitter:   0.1,
+			Steps:    4,
+		},
+		log: logger.WithName("audit"),
+	}, nil
+}
+
+// Audit implements Auditor. The record is spooled and delivery of all spooled records is
+// attempted. A delivery failure is returned but the record stays spooled for a later flush.
+func (a *HTTPAuditor) Audit(ctx context.Context, record Record) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshalling audit record: %w", err)
+	}
+
+	// File names sort in the order the records were written
+	name := fmt.Sprintf("%020d-%06d%s", time.Now().UnixNano(), atomic.AddUint64(&a.sequence, 1), spoolFileSuffix)
+	if err := writeFileAtomic(filepath.Join(a.spoolDir, name), body); err != nil {
+		return fmt.Errorf("error spooling audit record: %w", err)
+	}
+
+	return a.Flush(ctx)
+}
+
+// Run periodically flushes the spool until stop is closed, delivering records
+// left over from failed deliveries or from previous runs of the handler
+func (a *HTTPAuditor) Run(interval time.Duration, stop <-chan struct{}) {
+	wait.Until(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		defer cancel()
+		if err := a.Flush(ctx); err != nil {
+			a.log.Error(err, "Error flushing audit records")
+		}
+	}, interval, stop)
+}
+
+// Flush delivers all spooled records in order, stopping at the first record that
+// could not be delivered
+func (a *HTTPAuditor) Flush(ctx context.Context) error {
+	a.flushLock.Lock()
+	defer a.flushLock.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(a.spoolDir, "*"+spoolFileSuffix))
+	if err != nil {
+		return fmt.Errorf("error listing audit spool: %w", err)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("error reading spooled audit record: %w", err)
+		}
+
+		if err := a.deliver(ctx, body); err != nil {
+			return err
+		}
+
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("error removing delivered audit record: %w", err)
+		}
+	}
+	return nil
+}
+
+// deliver sends a single record, retrying with exponential backoff
+func (a *HTTPAuditor) deliver(ctx context.Context, body []byte) error {
+	mac := hmac.New(sha256.New, a.signingKey)
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	var lastErr error
+	err := wait.ExponentialBackoff(a.backoff, func() (bool, error) {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+		if err != nil {
+			return false, fmt.Errorf("could not create request %q: %w", a.url, err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(SignatureHeader, signature)
+
+		resp, err := a.client.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("error sending audit record: %w", err)
+			return false, nil
+		}
+		// Draining the response lets the connection be reused for the next record
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxDrainSize))
+		resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			lastErr = fmt.Errorf("unexpected status sending audit record: %d", resp.StatusCode)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err == wait.ErrWaitTimeout && lastErr != nil {
+		return lastErr
+	}
+	return err
+}
+
+// writeFileAtomic writes the file through a temporary file so a crash never leaves a partial record
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,73 @@
+// Package conditions manages node conditions with the semantics of meta.SetStatusCondition:
+// the transition time only changes with the status, while the heartbeat, reason and message
+// follow every update. The helpers work both on condition slices, for writers replacing the
+// node status, and on single conditions, for writers applying only their own condition.
+package conditions
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Find returns the condition with the conditionType type, nil if there is none
+func Find(conditions []corev1.NodeCondition, conditionType corev1.NodeConditionType) *corev1.NodeCondition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// Update returns condition as it must be written to replace current, nil if the node has no
+// such condition yet. The transition time of current is kept unless the status changes. The
+// heartbeat and transition times default to now if condition leaves them unset.
+func Update(current *corev1.NodeCondition, condition corev1.NodeCondition) corev1.NodeCondition {
+	now := metav1.Now()
+	if condition.LastHeartbeatTime.IsZero() {
+		condition.LastHeartbeatTime = now
+	}
+	if current != nil && current.Status == condition.Status {
+		condition.LastTransitionTime = current.LastTransitionTime
+	} else if condition.LastTransitionTime.IsZero() {
+		condition.LastTransitionTime = now
+	}
+	return condition
+}
+
+// Set adds condition to conditions or updates the condition of its type with the semantics
+// of Update. It returns whether conditions changed, ignoring the heartbeat.
+func Set(conditions *[]corev1.NodeCondition, condition corev1.NodeCondition) bool {
+	current := Find(*conditions, condition.Type)
+	updated := Update(current, condition)
+	if current == nil {
+		*conditions = append(*conditions, updated)
+		return true
+	}
+
+	changed := current.Status != updated.Status || current.Reason != updated.Reason || current.Message != updated.Message
+	*current = updated
+	return changed
+}
+
+// Remove removes the condition with the conditionType type from conditions, returning whether
+// it was present
+func Remove(conditions *[]corev1.NodeCondition, conditionType corev1.NodeConditionType) bool {
+	kept := (*conditions)[:0]
+	for _, condition := range *conditions {
+		if condition.Type != conditionType {
+			kept = append(kept, condition)
+		}
+	}
+	removed := len(kept) != len(*conditions)
+	*conditions = kept
+	return removed
+}
+
+// Equal returns whether two conditions are equal, at the resolution of a second the times
+// are serialized with
+func Equal(a, b corev1.NodeCondition) bool {
+	return a.Type == b.Type && a.Status == b.Status && a.Reason == b.Reason && a.Message == b.Message &&
+		a.LastHeartbeatTime.Unix() == b.LastHeartbeatTime.Unix() &&
+		a.LastTransitionTime.Unix() == b.LastTransitionTime.Unix()
+}
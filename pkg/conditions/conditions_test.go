@@ -0,0 +1,261 @@
+package conditions
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const terminating corev1.NodeConditionType = "Terminating"
+
+var (
+	earlier = metav1.NewTime(time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC))
+	later   = metav1.NewTime(time.Date(2020, 9, 1, 11, 0, 0, 0, time.UTC))
+)
+
+func condition(status corev1.ConditionStatus, reason string, heartbeat, transition metav1.Time) corev1.NodeCondition {
+	return corev1.NodeCondition{
+		Type:               terminating,
+		Status:             status,
+		Reason:             reason,
+		Message:            "message",
+		LastHeartbeatTime:  heartbeat,
+		LastTransitionTime: transition,
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	current := condition(corev1.ConditionTrue, "TerminationRequested", earlier, earlier)
+
+	tests := []struct {
+		name      string
+		current   *corev1.NodeCondition
+		condition corev1.NodeCondition
+		// wantTransition is the expected transition time, now if zero
+		wantTransition metav1.Time
+		// wantHeartbeat is the expected heartbeat time, now if zero
+		wantHeartbeat metav1.Time
+	}{
+		{
+			name:      "new condition defaults both times to now",
+			condition: condition(corev1.ConditionTrue, "TerminationRequested", metav1.Time{}, metav1.Time{}),
+		},
+		{
+			name:           "new condition keeps the times set",
+			condition:      condition(corev1.ConditionTrue, "TerminationRequested", later, earlier),
+			wantTransition: earlier,
+			wantHeartbeat:  later,
+		},
+		{
+			name:           "same status keeps the transition time and refreshes the heartbeat",
+			current:        &current,
+			condition:      condition(corev1.ConditionTrue, "TerminationRequested", metav1.Time{}, metav1.Time{}),
+			wantTransition: earlier,
+		},
+		{
+			name:           "same status with another reason keeps the transition time",
+			current:        &current,
+			condition:      condition(corev1.ConditionTrue, "Rescheduled", later, later),
+			wantTransition: earlier,
+			wantHeartbeat:  later,
+		},
+		{
+			name:      "status change sets the transition time to now",
+			current:   &current,
+			condition: condition(corev1.ConditionFalse, "TerminationCancelled", metav1.Time{}, metav1.Time{}),
+		},
+		{
+			name:           "status change keeps the transition time set",
+			current:        &current,
+			condition:      condition(corev1.ConditionFalse, "TerminationCancelled", later, later),
+			wantTransition: later,
+			wantHeartbeat:  later,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now().Add(-time.Second)
+			got := Update(tt.current, tt.condition)
+
+			if got.Status != tt.condition.Status || got.Reason != tt.condition.Reason || got.Message != tt.condition.Message {
+				t.Errorf("got %+v, want the status, reason and message of %+v", got, tt.condition)
+			}
+			checkTime(t, "transition", got.LastTransitionTime, tt.wantTransition, before)
+			checkTime(t, "heartbeat", got.LastHeartbeatTime, tt.wantHeartbeat, before)
+		})
+	}
+}
+
+// checkTime checks that got is want, or a time after before if want is zero
+func checkTime(t *testing.T, name string, got, want metav1.Time, before time.Time) {
+	t.Helper()
+	if want.IsZero() {
+		if got.Time.Before(before) {
+			t.Errorf("%s time %v, want now", name, got)
+		}
+		return
+	}
+	if !got.Equal(&want) {
+		t.Errorf("%s time %v, want %v", name, got, want)
+	}
+}
+
+func TestSet(t *testing.T) {
+	ready := corev1.NodeCondition{Type: corev1.NodeReady, Status: corev1.ConditionTrue}
+
+	tests := []struct {
+		name           string
+		conditions     []corev1.NodeCondition
+		condition      corev1.NodeCondition
+		wantChanged    bool
+		wantLen        int
+		wantTransition metav1.Time
+	}{
+		{
+			name:        "adds a missing condition",
+			conditions:  []corev1.NodeCondition{ready},
+			condition:   condition(corev1.ConditionTrue, "TerminationRequested", later, later),
+			wantChanged: true,
+			wantLen:     2,
+			// A new condition keeps its transition time
+			wantTransition: later,
+		},
+		{
+			name:           "heartbeat only is not a change",
+			conditions:     []corev1.NodeCondition{ready, condition(corev1.ConditionTrue, "TerminationRequested", earlier, earlier)},
+			condition:      condition(corev1.ConditionTrue, "TerminationRequested", later, later),
+			wantLen:        2,
+			wantTransition: earlier,
+		},
+		{
+			name:           "reason change is a change without transition",
+			conditions:     []corev1.NodeCondition{ready, condition(corev1.ConditionTrue, "TerminationRequested", earlier, earlier)},
+			condition:      condition(corev1.ConditionTrue, "Rescheduled", later, later),
+			wantChanged:    true,
+			wantLen:        2,
+			wantTransition: earlier,
+		},
+		{
+			name:           "status change transitions",
+			conditions:     []corev1.NodeCondition{condition(corev1.ConditionTrue, "TerminationRequested", earlier, earlier), ready},
+			condition:      condition(corev1.ConditionFalse, "TerminationCancelled", later, later),
+			wantChanged:    true,
+			wantLen:        2,
+			wantTransition: later,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditions := append([]corev1.NodeCondition{}, tt.conditions...)
+			if changed := Set(&conditions, tt.condition); changed != tt.wantChanged {
+				t.Errorf("changed %v, want %v", changed, tt.wantChanged)
+			}
+			if len(conditions) != tt.wantLen {
+				t.Fatalf("got %d conditions, want %d", len(conditions), tt.wantLen)
+			}
+			got := Find(conditions, terminating)
+			if got == nil {
+				t.Fatalf("condition %s missing from %+v", terminating, conditions)
+			}
+			if got.Status != tt.condition.Status || got.Reason != tt.condition.Reason {
+				t.Errorf("got %+v, want the status and reason of %+v", got, tt.condition)
+			}
+			if !got.LastHeartbeatTime.Equal(&tt.condition.LastHeartbeatTime) {
+				t.Errorf("heartbeat time %v, want %v", got.LastHeartbeatTime, tt.condition.LastHeartbeatTime)
+			}
+			if !got.LastTransitionTime.Equal(&tt.wantTransition) {
+				t.Errorf("transition time %v, want %v", got.LastTransitionTime, tt.wantTransition)
+			}
+			if ready := Find(conditions, corev1.NodeReady); ready == nil || ready.Status != corev1.ConditionTrue {
+				t.Errorf("other condition changed: %+v", conditions)
+			}
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	ready := corev1.NodeCondition{Type: corev1.NodeReady, Status: corev1.ConditionTrue}
+	memory := corev1.NodeCondition{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionFalse}
+	terminatingCondition := condition(corev1.ConditionTrue, "TerminationRequested", earlier, earlier)
+
+	tests := []struct {
+		name        string
+		conditions  []corev1.NodeCondition
+		wantRemoved bool
+		want        []corev1.NodeConditionType
+	}{
+		{
+			name:       "empty",
+			conditions: nil,
+			want:       []corev1.NodeConditionType{},
+		},
+		{
+			name:       "absent",
+			conditions: []corev1.NodeCondition{ready, memory},
+			want:       []corev1.NodeConditionType{corev1.NodeReady, corev1.NodeMemoryPressure},
+		},
+		{
+			name:        "keeps the order of the other conditions",
+			conditions:  []corev1.NodeCondition{ready, terminatingCondition, memory},
+			wantRemoved: true,
+			want:        []corev1.NodeConditionType{corev1.NodeReady, corev1.NodeMemoryPressure},
+		},
+		{
+			name:        "only condition",
+			conditions:  []corev1.NodeCondition{terminatingCondition},
+			wantRemoved: true,
+			want:        []corev1.NodeConditionType{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditions := append([]corev1.NodeCondition{}, tt.conditions...)
+			if removed := Remove(&conditions, terminating); removed != tt.wantRemoved {
+				t.Errorf("removed %v, want %v", removed, tt.wantRemoved)
+			}
+			if len(conditions) != len(tt.want) {
+				t.Fatalf("got %+v, want the types %v", conditions, tt.want)
+			}
+			for i, conditionType := range tt.want {
+				if conditions[i].Type != conditionType {
+					t.Errorf("condition %d is %s, want %s", i, conditions[i].Type, conditionType)
+				}
+			}
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	base := condition(corev1.ConditionTrue, "TerminationRequested", earlier, earlier)
+	withMillis := metav1.NewTime(earlier.Add(300 * time.Millisecond))
+
+	tests := []struct {
+		name   string
+		modify func(*corev1.NodeCondition)
+		want   bool
+	}{
+		{name: "identical", modify: func(*corev1.NodeCondition) {}, want: true},
+		{name: "sub-second heartbeat", modify: func(c *corev1.NodeCondition) { c.LastHeartbeatTime = withMillis }, want: true},
+		{name: "sub-second transition", modify: func(c *corev1.NodeCondition) { c.LastTransitionTime = withMillis }, want: true},
+		{name: "type", modify: func(c *corev1.NodeCondition) { c.Type = corev1.NodeReady }},
+		{name: "status", modify: func(c *corev1.NodeCondition) { c.Status = corev1.ConditionFalse }},
+		{name: "reason", modify: func(c *corev1.NodeCondition) { c.Reason = "Rescheduled" }},
+		{name: "message", modify: func(c *corev1.NodeCondition) { c.Message = "other" }},
+		{name: "heartbeat", modify: func(c *corev1.NodeCondition) { c.LastHeartbeatTime = later }},
+		{name: "transition", modify: func(c *corev1.NodeCondition) { c.LastTransitionTime = later }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := base
+			tt.modify(&other)
+			if got := Equal(base, other); got != tt.want {
+				t.Errorf("Equal(%+v, %+v) = %v, want %v", base, other, got, tt.want)
+			}
+			if got := Equal(other, base); got != tt.want {
+				t.Errorf("Equal is not symmetric for %+v", other)
+			}
+		})
+	}
+}
@@ -0,0 +1,573 @@
+// Package config defines the configuration of the termination handler. The configuration
+// can be read from a YAML file and every option can be overridden with a command line flag
+// or the environment variable of the flag, flags taking precedence over the environment.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the configuration of the termination handler
+type Config struct {
+	// CloudProvider is the name of the cloud provider the handler is running on
+	CloudProvider string `json:"cloudProvider,omitempty"`
+	// NodeName is the name of the node the handler is running on
+	NodeName string `json:"nodeName,omitempty"`
+	// NodeNames are the names of several nodes running on the instance, e.g. nested or virtual
+	// nodes sharing a host, instead of NodeName. The metadata service is polled once and its
+	// notices are acted on for every node.
+	NodeNames []string `json:"nodeNames,omitempty"`
+	// Namespace is the namespace the machine for the node lives in, all namespaces if empty
+	Namespace string `json:"namespace,omitempty"`
+	// NodeSelector is a label selector restricting the nodes that are actively handled,
+	// the handler idles on nodes not matching it. All nodes are handled if empty.
+	NodeSelector string `json:"nodeSelector,omitempty"`
+	// PollInterval is the interval at which the termination notice endpoint is checked
+	PollInterval metav1.Duration `json:"pollInterval,omitempty"`
+	// PollJitter is the maximum fraction of the poll interval randomly added to every
+	// interval, so that the polls of many nodes do not synchronize
+	PollJitter float64 `json:"pollJitter,omitempty"`
+	// AdvisoryPollInterval is the interval at which the termination notice endpoint is checked
+	// while the cloud provider signals a termination is likely, e.g. with an AWS rebalance
+	// recommendation. Advisory signals are not checked if unset.
+	AdvisoryPollInterval metav1.Duration `json:"advisoryPollInterval,omitempty"`
+	// UnreachableThreshold is the number of consecutive failed polls after which the
+	// termination notice endpoint is reported as unreachable and the handler as not ready
+	UnreachableThreshold int `json:"unreachableThreshold,omitempty"`
+	// ShutdownBudget is the time the actions in flight, e.g. a running drain, get to
+	// complete once the handler receives SIGTERM
+	ShutdownBudget metav1.Duration `json:"shutdownBudget,omitempty"`
+	// ClockSkewAllowance is how much earlier than reported the provider deadlines are
+	// assumed, when the metadata service does not report its time to correct the local clock
+	ClockSkewAllowance metav1.Duration `json:"clockSkewAllowance,omitempty"`
+	// LogVerbosity is the klog verbosity, the -v flag is left untouched if unset
+	LogVerbosity *int `json:"logVerbosity,omitempty"`
+	// SimulationBindAddress is the address the endpoint injecting simulated termination
+	// notices binds to, disabled if empty
+	SimulationBindAddress string `json:"simulationBindAddress,omitempty"`
+	// Standalone runs the handler on an instance that is not a Kubernetes node, no API
+	// server is contacted and only hooks and notifications are run on termination
+	Standalone bool `json:"standalone,omitempty"`
+	// Central runs a single handler for every node of the cluster, which polls the cloud
+	// provider API through the exec provider plugin instead of the metadata service of a node.
+	// The plugin is supplied by the user, no fleet poller is built in for aws, azure or gcp.
+	Central bool `json:"central,omitempty"`
+	// Management runs the handler on a Cluster API management cluster for the Machines of its
+	// workload clusters
+	Management ManagementConfig `json:"management,omitempty"`
+	// NodeTerminations records termination notices as NodeTerminations acted on by the
+	// NodeTermination controller
+	NodeTerminations NodeTerminationsConfig `json:"nodeTerminations,omitempty"`
+	// DeschedulerHints labels and taints the node while the cloud provider advises a
+	// termination or the drain on a notice is deferred, for the descheduler to move
+	// workloads off the node early
+	DeschedulerHints bool `json:"deschedulerHints,omitempty"`
+	// BindingWebhook rejects binding pods to terminating nodes
+	BindingWebhook BindingWebhookConfig `json:"bindingWebhook,omitempty"`
+	// ConfigController validates the TerminationHandlerConfigs the agents are configured with
+	ConfigController bool `json:"configController,omitempty"`
+	// LeaderElection elects one of several replicas of a central or management cluster
+	// handler to act on termination notices
+	LeaderElection LeaderElectionConfig `json:"leaderElection,omitempty"`
+	// NodeRateLimit limits the rate at which a central or management cluster handler starts
+	// acting on nodes, so a mass reclaim does not flood the API server with writes and drains
+	NodeRateLimit RateLimitConfig `json:"nodeRateLimit,omitempty"`
+	// StateFile records the termination notice the notifications were sent for, so a
+	// restarted standalone handler does not send them again. Not recorded if empty.
+	StateFile string `json:"stateFile,omitempty"`
+	// Mode selects the actions taken on the node, one of mark-only, cordon-drain or full
+	Mode string `json:"mode,omitempty"`
+	// FeatureGates enables or disables features by name, see the features package
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+
+	Condition         ConditionConfig         `json:"condition,omitempty"`
+	Deferral          DeferralConfig          `json:"deferral,omitempty"`
+	Drain             DrainConfig             `json:"drain,omitempty"`
+	Metadata          MetadataConfig          `json:"metadata,omitempty"`
+	ExecProvider      ExecProviderConfig      `json:"execProvider,omitempty"`
+	Metrics           MetricsConfig           `json:"metrics,omitempty"`
+	Notifications     NotificationsConfig     `json:"notifications,omitempty"`
+	Audit             AuditConfig             `json:"audit,omitempty"`
+	InterruptionStats InterruptionStatsConfig `json:"interruptionStats,omitempty"`
+}
+
+// ConditionConfig configures the node condition added when a termination notice is detected
+type ConditionConfig struct {
+	// Type of the condition MachineHealthChecks act on
+	Type string `json:"type,omitempty"`
+	// Reason and Message are Go templates rendered with the termination notice, which has the
+	// NodeName, Provider, EventType, EventID, DetectedAt, Deadline, Simulated and Raw fields
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+	// TTL is the time the cloud provider must have stopped reporting the termination notice
+	// before the condition is considered stale and set to false
+	TTL metav1.Duration `json:"ttl,omitempty"`
+}
+
+// DeferralConfig configures deferring the drain on notices of scheduled maintenance
+type DeferralConfig struct {
+	// MaintenanceWindow is a cron expression matching the start of the maintenance windows
+	MaintenanceWindow string `json:"maintenanceWindow,omitempty"`
+	// LeadTime is the time before the deadline at which the node is drained at the latest,
+	// deferral is disabled if zero
+	LeadTime metav1.Duration `json:"leadTime,omitempty"`
+}
+
+// DrainConfig configures draining the node in the cordon-drain and full modes
+type DrainConfig struct {
+	// Timeout bounds the time spent evicting pods
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+	// Delay is the time waited after marking or cordoning the node before evicting
+	// pods, so external controllers such as MachineHealthChecks can own the drain
+	Delay metav1.Duration `json:"delay,omitempty"`
+	// Kured coordinates drains with the reboot lock of kured
+	Kured KuredConfig `json:"kured,omitempty"`
+	// MachineConfigOperator coordinates drains with the OpenShift Machine Config Operator,
+	// which drains nodes while updating them
+	MachineConfigOperator bool `json:"machineConfigOperator,omitempty"`
+}
+
+// KuredConfig configures taking the reboot lock of kured before draining, so kured and the
+// handler do not drain nodes at once
+type KuredConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Namespace and DaemonSet are those of the kured DaemonSet holding the lock
+	Namespace string `json:"namespace,omitempty"`
+	DaemonSet string `json:"daemonSet,omitempty"`
+	// LockTTL is the time after which kured takes over a lock the handler did not release
+	LockTTL metav1.Duration `json:"lockTTL,omitempty"`
+	// MaxWait bounds the time waited for a lock held by another node
+	MaxWait metav1.Duration `json:"maxWait,omitempty"`
+}
+
+// MetadataConfig configures how the instance metadata services are reached
+type MetadataConfig struct {
+	// AWSURL, AzureURL and GCPURL override the base URLs of the metadata services, e.g. to go
+	// through a metadata proxy. The default address of the metadata service is used if empty.
+	AWSURL   string `json:"awsURL,omitempty"`
+	AzureURL string `json:"azureURL,omitempty"`
+	GCPURL   string `json:"gcpURL,omitempty"`
+
+	// ProxyURL is the HTTP proxy requests are sent through, the HTTP_PROXY,
+	// HTTPS_PROXY and NO_PROXY environment variables are used if empty
+	ProxyURL     string          `json:"proxyURL,omitempty"`
+	Timeout      metav1.Duration `json:"timeout,omitempty"`
+	DialTimeout  metav1.Duration `json:"dialTimeout,omitempty"`
+	MaxIdleConns int             `json:"maxIdleConns,omitempty"`
+	// CAFile, CertFile and KeyFile configure TLS for metadata endpoints served over HTTPS
+	CAFile             string `json:"caFile,omitempty"`
+	CertFile           string `json:"certFile,omitempty"`
+	KeyFile            string `json:"keyFile,omitempty"`
+	MinTLSVersion      string `json:"minTLSVersion,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+
+	// AWSRetry, AzureRetry and GCPRetry configure retrying failed polls of each metadata
+	// service, as they behave differently under throttling
+	AWSRetry   RetryConfig `json:"awsRetry,omitempty"`
+	AzureRetry RetryConfig `json:"azureRetry,omitempty"`
+	GCPRetry   RetryConfig `json:"gcpRetry,omitempty"`
+}
+
+// URL returns the metadata base URL configured for the cloud provider, empty if not overridden
+func (c MetadataConfig) URL(cloudProvider string) string {
+	switch cloudProvider {
+	case "aws":
+		return c.AWSURL
+	case "azure":
+		return c.AzureURL
+	case "gcp":
+		return c.GCPURL
+	}
+	return ""
+}
+
+// Retry returns the retry configuration of the cloud provider, the default for providers
+// other than the built-in ones
+func (c MetadataConfig) Retry(cloudProvider string) RetryConfig {
+	switch cloudProvider {
+	case "aws":
+		return c.AWSRetry
+	case "azure":
+		return c.AzureRetry
+	case "gcp":
+		return c.GCPRetry
+	}
+	return defaultRetry()
+}
+
+// ExecProviderConfig configures the exec cloud provider, which polls a local plugin command
+// for termination notices instead of a metadata service. The command is run for every poll
+// with a JSON request on stdin and answers with JSON on stdout.
+type ExecProviderConfig struct {
+	// Command is the path of the plugin, the exec provider is not available if empty
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	// EventType is reported for the termination notices the plugin does not give a type
+	EventType string `json:"eventType,omitempty"`
+}
+
+// RetryConfig configures retrying the failed polls of a metadata service
+type RetryConfig struct {
+	// InitialInterval is the delay before retrying the first of consecutive failed polls
+	InitialInterval metav1.Duration `json:"initialInterval,omitempty"`
+	// Multiplier is the factor the delay grows by with every further failed poll, the delay
+	// is capped at the poll interval
+	Multiplier float64 `json:"multiplier,omitempty"`
+	// MaxAttempts is the number of consecutive failed polls after which the handler exits,
+	// so it is restarted. Polls are retried indefinitely if zero.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// RetryableStatuses are the client error statuses that are retried, any other 4xx status
+	// stops the handler. Server errors are always retried.
+	RetryableStatuses []int `json:"retryableStatuses,omitempty"`
+}
+
+// MetricsConfig configures the metrics endpoint and sinks
+type MetricsConfig struct {
+	// BindAddress is the address the metrics and status endpoints bind to, 0 disables them
+	BindAddress string       `json:"bindAddress,omitempty"`
+	StatsD      StatsDConfig `json:"statsd,omitempty"`
+}
+
+// StatsDConfig configures mirroring metrics to StatsD
+type StatsDConfig struct {
+	// Address of the StatsD server, StatsD is disabled if empty
+	Address   string   `json:"address,omitempty"`
+	Prefix    string   `json:"prefix,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	DogStatsD bool     `json:"dogStatsD,omitempty"`
+}
+
+// NotificationsConfig configures the sinks termination notices are published to
+type NotificationsConfig struct {
+	Timeout     metav1.Duration   `json:"timeout,omitempty"`
+	CloudEvents CloudEventsConfig `json:"cloudEvents,omitempty"`
+	NATS        NATSConfig        `json:"nats,omitempty"`
+	MQTT        MQTTConfig        `json:"mqtt,omitempty"`
+	Hook        HookConfig        `json:"hook,omitempty"`
+	File        FileConfig        `json:"file,omitempty"`
+}
+
+// FileConfig configures writing termination notices as JSON to a local file, for other
+// daemons of the node to consume
+type FileConfig struct {
+	// Path of the file, e.g. on a hostPath volume, disabled if empty
+	Path string `json:"path,omitempty"`
+}
+
+// HookConfig configures a local command run for termination notices. The notice is
+// passed as JSON on stdin and in TERMINATION_* environment variables.
+type HookConfig struct {
+	// Command is the path of the command, disabled if empty
+	Command string          `json:"command,omitempty"`
+	Args    []string        `json:"args,omitempty"`
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+}
+
+// CloudEventsConfig configures publishing CloudEvents
+type CloudEventsConfig struct {
+	// SinkURL is the URL CloudEvents are posted to, disabled if empty
+	SinkURL string    `json:"sinkURL,omitempty"`
+	TLS     TLSConfig `json:"tls,omitempty"`
+}
+
+// TLSConfig configures the TLS connection to an HTTPS endpoint
+type TLSConfig struct {
+	// CAFile is a PEM bundle used to verify the server, the system roots are used if empty
+	CAFile string `json:"caFile,omitempty"`
+	// CertFile and KeyFile are a PEM client certificate and key presented to the server
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// MinVersion is the minimum TLS version accepted, e.g. 1.3. TLS 1.2 is used if empty.
+	MinVersion string `json:"minVersion,omitempty"`
+}
+
+// NATSConfig configures publishing to NATS
+type NATSConfig struct {
+	// URL of the NATS server(s), disabled if empty
+	URL     string `json:"url,omitempty"`
+	Subject string `json:"subject,omitempty"`
+}
+
+// MQTTConfig configures publishing to an MQTT broker. The password is
+// read from the MQTT_PASSWORD environment variable.
+type MQTTConfig struct {
+	// BrokerURL is the URL of the broker, disabled if empty
+	BrokerURL string `json:"brokerURL,omitempty"`
+	Topic     string `json:"topic,omitempty"`
+	QoS       uint   `json:"qos,omitempty"`
+	ClientID  string `json:"clientID,omitempty"`
+	Username  string `json:"username,omitempty"`
+	CAFile    string `json:"caFile,omitempty"`
+	CertFile  string `json:"certFile,omitempty"`
+	KeyFile   string `json:"keyFile,omitempty"`
+	// MinTLSVersion is the minimum TLS version accepted, e.g. 1.3. TLS 1.2 is used if empty.
+	MinTLSVersion string `json:"minTLSVersion,omitempty"`
+}
+
+// AuditConfig configures auditing of detections and actions
+type AuditConfig struct {
+	// URL is the HTTPS endpoint audit records are sent to, disabled if empty
+	URL            string          `json:"url,omitempty"`
+	SigningKeyFile string          `json:"signingKeyFile,omitempty"`
+	SpoolDir       string          `json:"spoolDir,omitempty"`
+	FlushInterval  metav1.Duration `json:"flushInterval,omitempty"`
+	TLS            TLSConfig       `json:"tls,omitempty"`
+	// LogFile is the file audit records are appended to, disabled if empty
+	LogFile string `json:"logFile,omitempty"`
+}
+
+// ManagementConfig configures running on a Cluster API management cluster
+type ManagementConfig struct {
+	// Enabled polls the cloud provider API through the exec provider plugin for the Machines
+	// of the workload clusters instead of the metadata service of a node
+	Enabled bool `json:"enabled,omitempty"`
+	// Target is what is marked for a termination notice: node writes the terminating condition
+	// to the node in the workload cluster, reached with the kubeconfig Secret of the cluster,
+	// and takes the actions of the mode, machine annotates the Machine for deletion
+	Target string `json:"target,omitempty"`
+}
+
+// NodeTerminationsConfig configures recording termination notices as NodeTerminations
+type NodeTerminationsConfig struct {
+	// Enabled creates a NodeTermination for every termination notice instead of marking,
+	// cordoning and draining the node, the NodeTermination controller takes the actions
+	Enabled bool `json:"enabled,omitempty"`
+	// Controller runs the NodeTermination controller instead of the termination handler
+	Controller bool `json:"controller,omitempty"`
+	// Workers is the number of NodeTerminations the controller acts on at once
+	Workers int `json:"workers,omitempty"`
+}
+
+// BindingWebhookConfig configures the admission webhook rejecting the binding of pods to
+// nodes with the terminating condition
+type BindingWebhookConfig struct {
+	// Enabled runs the webhook instead of the termination handler
+	Enabled bool `json:"enabled,omitempty"`
+	// Port is the port the webhook is served at over TLS
+	Port int `json:"port,omitempty"`
+	// CertDir is the directory holding the serving certificate tls.crt and key tls.key
+	CertDir string `json:"certDir,omitempty"`
+}
+
+// LeaderElectionConfig configures the election of the replica acting on termination notices
+type LeaderElectionConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Namespace and Name are those of the Lease the replicas compete for
+	Namespace     string          `json:"namespace,omitempty"`
+	Name          string          `json:"name,omitempty"`
+	LeaseDuration metav1.Duration `json:"leaseDuration,omitempty"`
+	RenewDeadline metav1.Duration `json:"renewDeadline,omitempty"`
+	RetryPeriod   metav1.Duration `json:"retryPeriod,omitempty"`
+}
+
+// RateLimitConfig configures a token bucket rate limit
+type RateLimitConfig struct {
+	// QPS is the sustained rate per second, not limited if zero
+	QPS float64 `json:"qps,omitempty"`
+	// Burst is the number allowed at once above the sustained rate
+	Burst int `json:"burst,omitempty"`
+}
+
+// InterruptionStatsConfig configures the cluster wide interruption statistics exporter
+type InterruptionStatsConfig struct {
+	// Enabled runs the exporter instead of the node termination handler
+	Enabled         bool            `json:"enabled,omitempty"`
+	Window          metav1.Duration `json:"window,omitempty"`
+	Interval        metav1.Duration `json:"interval,omitempty"`
+	NodePoolLabel   string          `json:"nodePoolLabel,omitempty"`
+	ReportNamespace string          `json:"reportNamespace,omitempty"`
+	// ReportName is the name of the ConfigMap the report is written to, disabled if empty
+	ReportName string `json:"reportName,omitempty"`
+}
+
+// Default returns the default configuration
+func Default() *Config {
+	return &Config{
+		PollInterval:         metav1.Duration{Duration: 5 * time.Second},
+		UnreachableThreshold: 3,
+		ShutdownBudget:       metav1.Duration{Duration: 30 * time.Second},
+		Mode:                 "mark-only",
+		Condition: ConditionConfig{
+			Type:    "Terminating",
+			Reason:  "TerminationRequested",
+			Message: "The cloud provider has marked this instance for termination",
+			TTL:     metav1.Duration{Duration: time.Minute},
+		},
+		Drain: DrainConfig{
+			// Spot instances are reclaimed two minutes after the notice
+			Timeout: metav1.Duration{Duration: 90 * time.Second},
+			Kured: KuredConfig{
+				Namespace: "kube-system",
+				DaemonSet: "kured",
+				LockTTL:   metav1.Duration{Duration: 30 * time.Minute},
+				MaxWait:   metav1.Duration{Duration: 2 * time.Minute},
+			},
+		},
+		Metadata: MetadataConfig{
+			Timeout:     metav1.Duration{Duration: 5 * time.Second},
+			DialTimeout: metav1.Duration{Duration: 2 * time.Second},
+			// The termination notice and advisory endpoints may be polled concurrently
+			MaxIdleConns: 2,
+			AWSRetry:     defaultRetry(),
+			// IMDS answers 410 Gone while it is starting and asks for a retry
+			AzureRetry: defaultRetry(http.StatusGone),
+			GCPRetry:   defaultRetry(),
+		},
+		ExecProvider: ExecProviderConfig{
+			EventType: "Termination",
+		},
+		Metrics: MetricsConfig{
+			BindAddress: ":8080",
+			StatsD: StatsDConfig{
+				Prefix: "termination_handler",
+			},
+		},
+		Notifications: NotificationsConfig{
+			Timeout: metav1.Duration{Duration: 10 * time.Second},
+			NATS: NATSConfig{
+				Subject: "termination-handler.notices",
+			},
+			MQTT: MQTTConfig{
+				Topic: "termination-handler/notices",
+				QoS:   1,
+			},
+			Hook: HookConfig{
+				Timeout: metav1.Duration{Duration: time.Minute},
+			},
+		},
+		Audit: AuditConfig{
+			SpoolDir:      "/var/lib/termination-handler/audit",
+			FlushInterval: metav1.Duration{Duration: 30 * time.Second},
+		},
+		Management: ManagementConfig{
+			Target: "node",
+		},
+		NodeTerminations: NodeTerminationsConfig{
+			Workers: 10,
+		},
+		BindingWebhook: BindingWebhookConfig{
+			Port:    9443,
+			CertDir: "/tmp/k8s-webhook-server/serving-certs",
+		},
+		LeaderElection: LeaderElectionConfig{
+			Name:          "termination-handler",
+			LeaseDuration: metav1.Duration{Duration: 15 * time.Second},
+			RenewDeadline: metav1.Duration{Duration: 10 * time.Second},
+			RetryPeriod:   metav1.Duration{Duration: 2 * time.Second},
+		},
+		NodeRateLimit: RateLimitConfig{
+			QPS:   5,
+			Burst: 10,
+		},
+		InterruptionStats: InterruptionStatsConfig{
+			Window:   metav1.Duration{Duration: 7 * 24 * time.Hour},
+			Interval: metav1.Duration{Duration: time.Minute},
+		},
+	}
+}
+
+// defaultRetry returns the default retry configuration, retrying not found, timeout and
+// throttling responses as well as the additional statuses
+func defaultRetry(statuses ...int) RetryConfig {
+	return RetryConfig{
+		InitialInterval:   metav1.Duration{Duration: time.Second},
+		Multiplier:        2,
+		RetryableStatuses: append([]int{http.StatusNotFound, http.StatusRequestTimeout, http.StatusTooManyRequests}, statuses...),
+	}
+}
+
+// RequiresRestart reports whether applying other requires restarting the handler, which
+// is the case if any setting differs that can not be changed while the handler is running
+func (c *Config) RequiresRestart(other *Config) bool {
+	return !reflect.DeepEqual(c.withoutReloadable(), other.withoutReloadable())
+}
+
+// withoutReloadable returns a copy of the configuration with the settings that can be
+// changed while the handler is running cleared
+func (c *Config) withoutReloadable() Config {
+	clean := *c
+	clean.PollInterval = metav1.Duration{}
+	clean.PollJitter = 0
+	clean.AdvisoryPollInterval = metav1.Duration{}
+	clean.UnreachableThreshold = 0
+	clean.ShutdownBudget = metav1.Duration{}
+	clean.ClockSkewAllowance = metav1.Duration{}
+	clean.Metadata.AWSRetry = RetryConfig{}
+	clean.Metadata.AzureRetry = RetryConfig{}
+	clean.Metadata.GCPRetry = RetryConfig{}
+	clean.LogVerbosity = nil
+	return clean
+}
+
+// Loader loads the configuration from a file or a ConfigMap, flags set on the command
+// line take precedence over the loaded values
+type Loader struct {
+	source string
+	read   func() ([]byte, error)
+	flags  map[string]string
+}
+
+// NewLoader constructs a loader for the configuration file at path. It must be called once
+// fs has been parsed, the flags set on fs at that point are applied on every load.
+func NewLoader(path string, fs *flag.FlagSet) *Loader {
+	return &Loader{
+		source: path,
+		read: func() ([]byte, error) {
+			return ioutil.ReadFile(path)
+		},
+		flags: setFlags(fs),
+	}
+}
+
+// setFlags returns the values of the flags set on fs
+func setFlags(fs *flag.FlagSet) map[string]string {
+	flags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+	return flags
+}
+
+// FlagSet reports whether the named flag was set on the command line
+func (l *Loader) FlagSet(name string) bool {
+	_, ok := l.flags[name]
+	return ok
+}
+
+// Load reads the configuration on top of the defaults and applies the command line flags
+func (l *Loader) Load() (*Config, error) {
+	data, err := l.read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading config from %s: %w", l.source, err)
+	}
+	return l.parse(data)
+}
+
+func (l *Loader) parse(data []byte) (*Config, error) {
+	c := Default()
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, fmt.Errorf("error parsing config from %s: %w", l.source, err)
+	}
+
+	// Bind a flag set to the new configuration to apply the command line flags to it
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	c.BindFlags(fs)
+	for name, value := range l.flags {
+		if fs.Lookup(name) == nil {
+			// Not a configuration flag, e.g. one of the klog flags
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return nil, fmt.Errorf("error applying flag %q: %w", name, err)
+		}
+	}
+	return c, nil
+}
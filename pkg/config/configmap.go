@@ -0,0 +1,41 @@
+//go:build !lite
+// +build !lite
+
+package config
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// configMapReadTimeout bounds reading the configuration from a ConfigMap
+const configMapReadTimeout = 10 * time.Second
+
+// NewConfigMapLoader constructs a loader reading the configuration from the key of a ConfigMap.
+// It must be called once fs has been parsed, the flags set on fs at that point are applied on
+// every load.
+func NewConfigMapLoader(c client.Client, namespace, name, key string, fs *flag.FlagSet) *Loader {
+	return &Loader{
+		source: fmt.Sprintf("configmap %s/%s key %s", namespace, name, key),
+		read: func() ([]byte, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), configMapReadTimeout)
+			defer cancel()
+
+			cm := &corev1.ConfigMap{}
+			if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, cm); err != nil {
+				return nil, err
+			}
+			data, ok := cm.Data[key]
+			if !ok {
+				return nil, fmt.Errorf("key %q not found in configmap %s/%s", key, namespace, name)
+			}
+			return []byte(data), nil
+		},
+		flags: setFlags(fs),
+	}
+}
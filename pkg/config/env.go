@@ -0,0 +1,42 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvPrefix is the prefix of the environment variables that configure the handler
+const EnvPrefix = "TERMINATION_HANDLER_"
+
+// EnvVarName returns the environment variable configuring the named flag,
+// e.g. TERMINATION_HANDLER_CLOUD_PROVIDER for --cloud-provider
+func EnvVarName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// ApplyEnv sets every flag of fs that was not set on the command line from its environment
+// variable, if present. It must be called once fs has been parsed, the flags it sets are
+// then treated like flags set on the command line and take precedence over the config file.
+func ApplyEnv(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] {
+			return
+		}
+		value, ok := os.LookupEnv(EnvVarName(f.Name))
+		if !ok {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value %q for %s: %w", value, EnvVarName(f.Name), setErr)
+		}
+	})
+	return err
+}
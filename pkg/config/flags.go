@@ -0,0 +1,251 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/features"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BindFlags registers a flag for every option on fs, writing to the fields of c.
+// The current values of c are used as the flag defaults.
+func (c *Config) BindFlags(fs *flag.FlagSet) {
+	fs.Var((*durationValue)(&c.PollInterval), "poll-interval", "interval at which termination notice endpoint should be checked, e.g. 500ms or 5s")
+	fs.Var((*secondsValue)(&c.PollInterval), "poll-interval-seconds", "interval in seconds at which termination notice endpoint should be checked. Deprecated, use --poll-interval.")
+	fs.Var((*durationValue)(&c.AdvisoryPollInterval), "advisory-poll-interval", "interval at which termination notice endpoint should be checked while the cloud provider signals a termination is likely (AWS rebalance recommendation, Azure scheduled event, GCP maintenance event). If unspecified, advisory signals are not checked.")
+	fs.Float64Var(&c.PollJitter, "poll-jitter", c.PollJitter, "maximum fraction of the poll interval randomly added to every interval, e.g. 0.1 for up to 10%, so that the polls of many nodes do not synchronize")
+	fs.StringVar(&c.NodeName, "node-name", c.NodeName, "name of the node that the termination handler is running on")
+	fs.Var((*stringSliceValue)(&c.NodeNames), "node-names", "comma separated list of the names of several nodes running on the instance, e.g. nested or virtual nodes sharing a host, instead of --node-name. The metadata service is polled once and its termination notices are acted on for every node.")
+	fs.StringVar(&c.Namespace, "namespace", c.Namespace, "namespace that the machine for the node should live in. If unspecified, look for machines across all namespaces.")
+	fs.StringVar(&c.NodeSelector, "node-selector", c.NodeSelector, "label selector (e.g. node-lifecycle=spot) restricting the nodes that are actively handled. The handler idles on nodes not matching it. If unspecified, all nodes are handled.")
+	fs.StringVar(&c.CloudProvider, "cloud-provider", c.CloudProvider, "name of the cloud provider that the termination handler is running on, aws, azure, gcp, exec for a plugin set with --exec-provider-command or a provider compiled in")
+	fs.IntVar(&c.UnreachableThreshold, "unreachable-threshold", c.UnreachableThreshold, "number of consecutive failed polls after which the termination notice endpoint is reported as unreachable and the handler as not ready. Fewer failures are only logged at verbosity 1.")
+	fs.Var((*durationValue)(&c.ShutdownBudget), "shutdown-budget", "time the actions in flight, e.g. a running drain, get to complete on SIGTERM before they are cancelled. A second signal exits immediately.")
+	fs.Var((*durationValue)(&c.ClockSkewAllowance), "clock-skew-allowance", "time by which the termination deadlines reported by the cloud provider are brought forward, allowing for the clock of the instance to run late. Only applied if the metadata service does not report its time in the Date header, which is otherwise used to correct the deadlines.")
+	fs.BoolVar(&c.Standalone, "standalone", c.Standalone, "run on an instance that is not a Kubernetes node. No API server is contacted, only hooks and notifications are run on termination. The node name defaults to the hostname.")
+	fs.BoolVar(&c.Central, "central", c.Central, "run a single handler for every node of the cluster, e.g. as a Deployment rather than a DaemonSet. Requires --cloud-provider exec with a user-supplied plugin set with --exec-provider-command, which is sent fleet poll requests with the provider IDs of the nodes and reports their termination notices from the cloud provider API. No fleet poller is built in for aws, azure or gcp.")
+	fs.BoolVar(&c.Management.Enabled, "capi-management", c.Management.Enabled, "run on a Cluster API management cluster for the Machines of its workload clusters. The exec provider plugin is sent fleet poll requests with the provider IDs of the Machines. Requires --cloud-provider exec.")
+	fs.StringVar(&c.Management.Target, "capi-management-target", c.Management.Target, "what is marked for a termination notice on a management cluster: node writes the terminating condition to the node in the workload cluster and takes the actions of --mode, machine annotates the Machine for deletion")
+	fs.BoolVar(&c.NodeTerminations.Enabled, "node-terminations", c.NodeTerminations.Enabled, "create a NodeTermination for every termination notice instead of marking, cordoning and draining the node, the NodeTermination controller takes the actions of --mode")
+	fs.BoolVar(&c.NodeTerminations.Controller, "node-termination-controller", c.NodeTerminations.Controller, "run the NodeTermination controller instead of the termination handler")
+	fs.IntVar(&c.NodeTerminations.Workers, "node-termination-workers", c.NodeTerminations.Workers, "number of NodeTerminations the controller acts on at once")
+	fs.BoolVar(&c.DeschedulerHints, "descheduler-hints", c.DeschedulerHints, "while the cloud provider advises a termination, e.g. with a rebalance recommendation, or the drain on a notice is deferred, label the node and taint it PreferNoSchedule with termination-handler/termination-advised, so the node affinity and taint strategies of the descheduler move workloads off the node before it is drained")
+	fs.BoolVar(&c.BindingWebhook.Enabled, "binding-webhook", c.BindingWebhook.Enabled, "run the admission webhook rejecting the binding of pods to nodes with the terminating condition instead of the termination handler")
+	fs.IntVar(&c.BindingWebhook.Port, "binding-webhook-port", c.BindingWebhook.Port, "port the binding webhook is served at")
+	fs.StringVar(&c.BindingWebhook.CertDir, "binding-webhook-cert-dir", c.BindingWebhook.CertDir, "directory holding the serving certificate tls.crt and key tls.key of the binding webhook")
+	fs.BoolVar(&c.ConfigController, "config-controller", c.ConfigController, "run the controller validating the TerminationHandlerConfigs instead of the termination handler")
+	fs.BoolVar(&c.LeaderElection.Enabled, "leader-elect", c.LeaderElection.Enabled, "elect one of several replicas of a central or management cluster handler to act on termination notices, the others stand by")
+	fs.StringVar(&c.LeaderElection.Namespace, "leader-election-namespace", c.LeaderElection.Namespace, "namespace of the Lease the replicas compete for")
+	fs.StringVar(&c.LeaderElection.Name, "leader-election-name", c.LeaderElection.Name, "name of the Lease the replicas compete for")
+	fs.DurationVar(&c.LeaderElection.LeaseDuration.Duration, "leader-election-lease-duration", c.LeaderElection.LeaseDuration.Duration, "duration standby replicas wait before taking over a Lease that was not renewed")
+	fs.DurationVar(&c.LeaderElection.RenewDeadline.Duration, "leader-election-renew-deadline", c.LeaderElection.RenewDeadline.Duration, "duration the leader retries renewing the Lease before it stops acting and exits")
+	fs.DurationVar(&c.LeaderElection.RetryPeriod.Duration, "leader-election-retry-period", c.LeaderElection.RetryPeriod.Duration, "interval at which the Lease is renewed or acquisition is retried")
+	fs.Float64Var(&c.NodeRateLimit.QPS, "node-rate-limit-qps", c.NodeRateLimit.QPS, "nodes per second a central or management cluster handler starts acting on, so a mass reclaim does not flood the API server with writes and drains. If zero, not limited.")
+	fs.IntVar(&c.NodeRateLimit.Burst, "node-rate-limit-burst", c.NodeRateLimit.Burst, "nodes a central or management cluster handler starts acting on at once above --node-rate-limit-qps")
+	fs.StringVar(&c.StateFile, "state-file", c.StateFile, "file recording the termination notice the hooks and notifications were run for, so they are not run again when a standalone handler restarts. Nodes record it in an annotation instead. If unspecified, it is not recorded.")
+	fs.StringVar(&c.SimulationBindAddress, "simulation-bind-address", c.SimulationBindAddress, "address the endpoint used by the simulate command to inject termination notices binds to, e.g. 127.0.0.1:8081. If unspecified, simulation is disabled.")
+	fs.StringVar(&c.Mode, "mode", c.Mode, "actions taken on the node: mark-only adds the terminating condition, cordon-drain cordons and drains the node, full does both. cordon-drain and full require the NodeDrain feature gate.")
+	fs.Var((*durationValue)(&c.Drain.Timeout), "drain-timeout", "maximum time spent evicting the pods of the node in the cordon-drain and full modes")
+	fs.Var((*durationValue)(&c.Drain.Delay), "drain-delay", "time waited after marking or cordoning the node before evicting pods, giving external controllers a chance to own the drain. Shortened so the drain completes before the termination deadline.")
+	fs.BoolVar(&c.Drain.Kured.Enabled, "kured-coordination", c.Drain.Kured.Enabled, "take the reboot lock of kured before draining the node and release it once drained, so kured does not reboot other nodes during the drain. The drain waits while kured holds the lock for another node, at most --kured-max-wait and no longer than the drain can complete before the deadline. Nothing is coordinated if the kured DaemonSet does not exist.")
+	fs.StringVar(&c.Drain.Kured.Namespace, "kured-namespace", c.Drain.Kured.Namespace, "namespace of the kured DaemonSet")
+	fs.StringVar(&c.Drain.Kured.DaemonSet, "kured-daemonset", c.Drain.Kured.DaemonSet, "name of the kured DaemonSet, whose annotation holds the reboot lock")
+	fs.Var((*durationValue)(&c.Drain.Kured.LockTTL), "kured-lock-ttl", "time after which kured takes over a reboot lock the handler could not release")
+	fs.Var((*durationValue)(&c.Drain.Kured.MaxWait), "kured-max-wait", "maximum time waited for the reboot lock of kured held by another node before draining anyway")
+	fs.BoolVar(&c.Drain.MachineConfigOperator, "mco-coordination", c.Drain.MachineConfigOperator, "on OpenShift, wait for a drain of the Machine Config Operator in progress on the node before draining it, and skip the drain if the Machine Config Operator drained the node already. Requires the Terminating condition type OpenShift acts on.")
+	fs.Var((*mapBoolValue)(&c.FeatureGates), "feature-gates", "comma separated key=value pairs enabling or disabling features. Options are:\n"+strings.Join(features.Known(), "\n"))
+
+	fs.StringVar(&c.Condition.Type, "condition-type", c.Condition.Type, "type of the node condition added when a termination notice is detected, MachineHealthChecks must match it")
+	fs.StringVar(&c.Condition.Reason, "condition-reason", c.Condition.Reason, "reason of the node condition, a Go template with access to the notice fields, e.g. {{.EventType}}")
+	fs.DurationVar(&c.Condition.TTL.Duration, "condition-ttl", c.Condition.TTL.Duration, "time the cloud provider must have stopped reporting the termination notice before the node condition is considered stale and set to false")
+	fs.StringVar(&c.Condition.Message, "condition-message", c.Condition.Message, "message of the node condition, a Go template with access to the notice fields (NodeName, Provider, EventType, EventID, DetectedAt, Deadline, Simulated, Raw)")
+
+	fs.StringVar(&c.Deferral.MaintenanceWindow, "maintenance-window", c.Deferral.MaintenanceWindow, "cron expression matching the start of the maintenance windows the drain on notices of scheduled maintenance, e.g. an Azure reboot or GCP host maintenance, is deferred to. The node is marked and cordoned at once. Requires --deferral-lead-time and the MaintenanceWindowDeferral feature gate.")
+	fs.DurationVar(&c.Deferral.LeadTime.Duration, "deferral-lead-time", c.Deferral.LeadTime.Duration, "time before the deadline of a notice of scheduled maintenance at which the node is drained at the latest, the drain on notices with a later deadline is deferred. Disabled if zero. Requires the MaintenanceWindowDeferral feature gate.")
+
+	fs.StringVar(&c.Metadata.AWSURL, "aws-metadata-url", c.Metadata.AWSURL, "base URL of the EC2 instance metadata service, e.g. of a metadata proxy. If unspecified, http://169.254.169.254 is used.")
+	fs.StringVar(&c.Metadata.AzureURL, "azure-metadata-url", c.Metadata.AzureURL, "base URL of the Azure instance metadata service, e.g. of a metadata proxy. If unspecified, http://169.254.169.254 is used.")
+	fs.StringVar(&c.Metadata.GCPURL, "gcp-metadata-url", c.Metadata.GCPURL, "base URL of the GCE metadata server, e.g. of a metadata proxy. If unspecified, http://169.254.169.254 is used.")
+	fs.StringVar(&c.Metadata.ProxyURL, "metadata-proxy-url", c.Metadata.ProxyURL, "URL of an HTTP proxy the metadata service is reached through. If unspecified, the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables are used.")
+	fs.Var((*durationValue)(&c.Metadata.Timeout), "metadata-timeout", "timeout for a single request to the metadata service")
+	fs.Var((*durationValue)(&c.Metadata.DialTimeout), "metadata-dial-timeout", "timeout for connecting to the metadata service")
+	fs.IntVar(&c.Metadata.MaxIdleConns, "metadata-max-idle-conns", c.Metadata.MaxIdleConns, "number of connections to the metadata service kept open between polls")
+	fs.StringVar(&c.Metadata.CAFile, "metadata-ca-file", c.Metadata.CAFile, "PEM CA bundle used to verify a metadata service or proxy served over HTTPS")
+	fs.StringVar(&c.Metadata.CertFile, "metadata-cert-file", c.Metadata.CertFile, "PEM client certificate presented to a metadata service or proxy served over HTTPS")
+	fs.StringVar(&c.Metadata.KeyFile, "metadata-key-file", c.Metadata.KeyFile, "PEM client key presented to a metadata service or proxy served over HTTPS")
+	fs.StringVar(&c.Metadata.MinTLSVersion, "metadata-min-tls-version", c.Metadata.MinTLSVersion, "minimum TLS version (1.0, 1.1, 1.2 or 1.3) accepted from a metadata service or proxy served over HTTPS")
+	fs.BoolVar(&c.Metadata.InsecureSkipVerify, "metadata-insecure-skip-verify", c.Metadata.InsecureSkipVerify, "do not verify the certificate of a metadata service or proxy served over HTTPS")
+	c.Metadata.AWSRetry.bindFlags(fs, "aws", "the EC2 instance metadata service")
+	c.Metadata.AzureRetry.bindFlags(fs, "azure", "the Azure instance metadata service")
+	c.Metadata.GCPRetry.bindFlags(fs, "gcp", "the GCE metadata server")
+	fs.StringVar(&c.ExecProvider.Command, "exec-provider-command", c.ExecProvider.Command, "path of a plugin polled for termination notices with --cloud-provider exec. It is run for every poll with a JSON request on stdin and answers with JSON on stdout.")
+	fs.Var((*stringSliceValue)(&c.ExecProvider.Args), "exec-provider-args", "comma separated list of arguments passed to the exec provider plugin")
+	fs.StringVar(&c.ExecProvider.EventType, "exec-provider-event-type", c.ExecProvider.EventType, "event type reported for the termination notices of the exec provider plugin that do not have one")
+
+	fs.StringVar(&c.Metrics.BindAddress, "metrics-bind-address", c.Metrics.BindAddress, "address the Prometheus metrics and /statusz endpoints bind to. Set to 0 to disable the endpoints.")
+	fs.StringVar(&c.Metrics.StatsD.Address, "statsd-address", c.Metrics.StatsD.Address, "address (host:port) of a StatsD server that metrics should also be sent to. If unspecified, StatsD is disabled.")
+	fs.StringVar(&c.Metrics.StatsD.Prefix, "statsd-prefix", c.Metrics.StatsD.Prefix, "prefix prepended to the names of metrics sent to StatsD")
+	fs.Var((*stringSliceValue)(&c.Metrics.StatsD.Tags), "statsd-tags", "comma separated list of static tags (key:value) attached to every metric sent to StatsD. Requires --statsd-dogstatsd.")
+	fs.BoolVar(&c.Metrics.StatsD.DogStatsD, "statsd-dogstatsd", c.Metrics.StatsD.DogStatsD, "send metric labels as DogStatsD tags")
+
+	fs.Var((*durationValue)(&c.Notifications.Timeout), "notification-timeout", "timeout for publishing a termination notice to a notification sink")
+	fs.StringVar(&c.Notifications.CloudEvents.SinkURL, "cloudevents-sink-url", c.Notifications.CloudEvents.SinkURL, "URL of an HTTP sink (e.g. a Knative broker) that termination notices are published to as CloudEvents")
+	c.Notifications.CloudEvents.TLS.bindFlags(fs, "cloudevents", "the CloudEvents sink")
+	fs.StringVar(&c.Notifications.NATS.URL, "nats-url", c.Notifications.NATS.URL, "URL of the NATS server(s) that termination notices are published to")
+	fs.StringVar(&c.Notifications.NATS.Subject, "nats-subject", c.Notifications.NATS.Subject, "NATS subject that termination notices are published to")
+	fs.StringVar(&c.Notifications.MQTT.BrokerURL, "mqtt-broker-url", c.Notifications.MQTT.BrokerURL, "URL of the MQTT broker that termination notices are published to (e.g. tcp://broker:1883, ssl://broker:8883)")
+	fs.StringVar(&c.Notifications.MQTT.Topic, "mqtt-topic", c.Notifications.MQTT.Topic, "MQTT topic that termination notices are published to")
+	fs.UintVar(&c.Notifications.MQTT.QoS, "mqtt-qos", c.Notifications.MQTT.QoS, "MQTT QoS level (0, 1 or 2) used to publish termination notices")
+	fs.StringVar(&c.Notifications.MQTT.ClientID, "mqtt-client-id", c.Notifications.MQTT.ClientID, "MQTT client ID. If unspecified, termination-handler-<node name> is used.")
+	fs.StringVar(&c.Notifications.MQTT.Username, "mqtt-username", c.Notifications.MQTT.Username, "username for the MQTT broker, the password is read from the MQTT_PASSWORD environment variable")
+	fs.StringVar(&c.Notifications.MQTT.CAFile, "mqtt-ca-file", c.Notifications.MQTT.CAFile, "PEM CA bundle used to verify the MQTT broker")
+	fs.StringVar(&c.Notifications.MQTT.CertFile, "mqtt-cert-file", c.Notifications.MQTT.CertFile, "PEM client certificate presented to the MQTT broker")
+	fs.StringVar(&c.Notifications.MQTT.KeyFile, "mqtt-key-file", c.Notifications.MQTT.KeyFile, "PEM client key presented to the MQTT broker")
+	fs.StringVar(&c.Notifications.MQTT.MinTLSVersion, "mqtt-min-tls-version", c.Notifications.MQTT.MinTLSVersion, "minimum TLS version (1.0, 1.1, 1.2 or 1.3) accepted from the MQTT broker")
+	fs.StringVar(&c.Notifications.Hook.Command, "hook-command", c.Notifications.Hook.Command, "path of a local command run for termination notices, which receives the notice as JSON on stdin and in TERMINATION_* environment variables")
+	fs.Var((*stringSliceValue)(&c.Notifications.Hook.Args), "hook-args", "comma separated list of arguments passed to the hook command")
+	fs.Var((*durationValue)(&c.Notifications.Hook.Timeout), "hook-timeout", "time after which the hook command is killed")
+	fs.StringVar(&c.Notifications.File.Path, "notice-file", c.Notifications.File.Path, "file the termination notice is written to as JSON, replaced atomically, e.g. on a hostPath volume for other daemons of the node. If unspecified, no file is written.")
+
+	fs.StringVar(&c.Audit.URL, "audit-url", c.Audit.URL, "HTTPS endpoint that a signed audit record is sent to for every detection and action. If unspecified, auditing is disabled.")
+	fs.StringVar(&c.Audit.SigningKeyFile, "audit-signing-key-file", c.Audit.SigningKeyFile, "file containing the key used to sign audit records with HMAC-SHA256")
+	fs.StringVar(&c.Audit.SpoolDir, "audit-spool-dir", c.Audit.SpoolDir, "directory audit records are spooled in until they are delivered")
+	fs.Var((*durationValue)(&c.Audit.FlushInterval), "audit-flush-interval", "interval at which delivery of spooled audit records is retried")
+	c.Audit.TLS.bindFlags(fs, "audit", "the audit endpoint")
+	fs.StringVar(&c.Audit.LogFile, "audit-log-file", c.Audit.LogFile, "file every detection and action is appended to as JSON lines, e.g. on a hostPath volume. If unspecified, no audit log is written.")
+
+	fs.BoolVar(&c.InterruptionStats.Enabled, "interruption-stats", c.InterruptionStats.Enabled, "run the cluster wide interruption statistics exporter instead of the node termination handler")
+	fs.Var((*durationValue)(&c.InterruptionStats.Window), "interruption-stats-window", "rolling window over which interruption statistics are kept")
+	fs.Var((*durationValue)(&c.InterruptionStats.Interval), "interruption-stats-interval", "interval at which nodes are checked for interruptions")
+	fs.StringVar(&c.InterruptionStats.NodePoolLabel, "node-pool-label", c.InterruptionStats.NodePoolLabel, "label holding the node pool a node belongs to, used to group interruption statistics")
+	fs.StringVar(&c.InterruptionStats.ReportNamespace, "interruption-report-namespace", c.InterruptionStats.ReportNamespace, "namespace of the ConfigMap the interruption report is written to")
+	fs.StringVar(&c.InterruptionStats.ReportName, "interruption-report-name", c.InterruptionStats.ReportName, "name of the ConfigMap the interruption report is written to. If unspecified, no report is written.")
+}
+
+// bindFlags registers the TLS flags of an endpoint, named after prefix
+func (c *TLSConfig) bindFlags(fs *flag.FlagSet, prefix, endpoint string) {
+	fs.StringVar(&c.CAFile, prefix+"-ca-file", c.CAFile, "PEM CA bundle used to verify "+endpoint)
+	fs.StringVar(&c.CertFile, prefix+"-cert-file", c.CertFile, "PEM client certificate presented to "+endpoint)
+	fs.StringVar(&c.KeyFile, prefix+"-key-file", c.KeyFile, "PEM client key presented to "+endpoint)
+	fs.StringVar(&c.MinVersion, prefix+"-min-tls-version", c.MinVersion, "minimum TLS version (1.0, 1.1, 1.2 or 1.3) accepted from "+endpoint)
+}
+
+// bindFlags registers the retry flags of a metadata service, named after prefix
+func (c *RetryConfig) bindFlags(fs *flag.FlagSet, prefix, service string) {
+	fs.Var((*durationValue)(&c.InitialInterval), prefix+"-retry-initial-interval", "delay before retrying a failed poll of "+service+", growing with every further consecutive failure up to the poll interval")
+	fs.Float64Var(&c.Multiplier, prefix+"-retry-multiplier", c.Multiplier, "factor the retry delay of "+service+" grows by with every further consecutive failed poll")
+	fs.IntVar(&c.MaxAttempts, prefix+"-retry-max-attempts", c.MaxAttempts, "number of consecutive failed polls of "+service+" after which the handler exits, so it is restarted. If zero, polls are retried indefinitely.")
+	fs.Var((*intSliceValue)(&c.RetryableStatuses), prefix+"-retryable-statuses", "comma separated list of client error statuses (4xx) of "+service+" that are retried, any other 4xx status stops the handler. Server errors are always retried.")
+}
+
+// durationValue adapts a metav1.Duration to a flag.Value
+type durationValue metav1.Duration
+
+func (d *durationValue) String() string {
+	return d.Duration.String()
+}
+
+func (d *durationValue) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// secondsValue adapts a metav1.Duration to a flag.Value holding a number of seconds
+type secondsValue metav1.Duration
+
+func (d *secondsValue) String() string {
+	return strconv.FormatInt(int64(d.Duration/time.Second), 10)
+}
+
+func (d *secondsValue) Set(s string) error {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	d.Duration = time.Duration(v) * time.Second
+	return nil
+}
+
+// mapBoolValue adapts a map of booleans to a flag.Value holding comma separated key=value pairs
+type mapBoolValue map[string]bool
+
+func (m *mapBoolValue) String() string {
+	pairs := make([]string, 0, len(*m))
+	for key, value := range *m {
+		pairs = append(pairs, fmt.Sprintf("%s=%t", key, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m *mapBoolValue) Set(value string) error {
+	values := map[string]bool{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("missing bool value for %q", pair)
+		}
+		v, err := strconv.ParseBool(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return fmt.Errorf("invalid value of %s: %v", parts[0], err)
+		}
+		values[strings.TrimSpace(parts[0])] = v
+	}
+	*m = values
+	return nil
+}
+
+// stringSliceValue adapts a string slice to a flag.Value holding a comma separated list
+type stringSliceValue []string
+
+func (s *stringSliceValue) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceValue) Set(value string) error {
+	if value == "" {
+		*s = nil
+		return nil
+	}
+	*s = strings.Split(value, ",")
+	return nil
+}
+
+// intSliceValue adapts an int slice to a flag.Value holding a comma separated list
+type intSliceValue []int
+
+func (s *intSliceValue) String() string {
+	values := make([]string, len(*s))
+	for i, v := range *s {
+		values[i] = strconv.Itoa(v)
+	}
+	return strings.Join(values, ",")
+}
+
+func (s *intSliceValue) Set(value string) error {
+	values := []int{}
+	for _, item := range strings.Split(value, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", item)
+		}
+		values = append(values, v)
+	}
+	*s = values
+	return nil
+}
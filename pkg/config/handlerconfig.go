@@ -0,0 +1,155 @@
+//go:build !lite
+// +build !lite
+
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/alexander-demichev/termination-handler/pkg/apis/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NewHandlerConfigLoader constructs a loader reading the configuration from the
+// TerminationHandlerConfig named name, with the overrides of the pools selecting the node
+// named nodeName. Only the shared configuration is read if nodeName is empty. The scheme of c
+// must know the core and the termination handler API types. It must be called once fs has
+// been parsed, the flags set on fs at that point are applied on every load.
+func NewHandlerConfigLoader(c client.Client, name, nodeName string, fs *flag.FlagSet) *Loader {
+	return &Loader{
+		source: fmt.Sprintf("TerminationHandlerConfig %s", name),
+		read: func() ([]byte, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), configMapReadTimeout)
+			defer cancel()
+
+			handlerConfig := &v1alpha1.TerminationHandlerConfig{}
+			if err := c.Get(ctx, client.ObjectKey{Name: name}, handlerConfig); err != nil {
+				return nil, err
+			}
+			var nodeLabels labels.Set
+			if nodeName != "" && len(handlerConfig.Spec.Pools) > 0 {
+				node := &corev1.Node{}
+				if err := c.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+					return nil, fmt.Errorf("error fetching node to select its pools: %w", err)
+				}
+				nodeLabels = node.Labels
+			}
+			return mergeHandlerConfig(&handlerConfig.Spec, func(pool *v1alpha1.TerminationHandlerConfigPool) (bool, error) {
+				if nodeLabels == nil {
+					return false, nil
+				}
+				selector, err := metav1.LabelSelectorAsSelector(&pool.NodeSelector)
+				if err != nil {
+					return false, fmt.Errorf("invalid node selector of pool %q: %v", pool.Name, err)
+				}
+				return selector.Matches(nodeLabels), nil
+			})
+		},
+		flags: setFlags(fs),
+	}
+}
+
+// ValidateHandlerConfig checks the shared configuration of spec and that of every pool,
+// leaving the cloud provider and the node name to the flags of the agents
+func ValidateHandlerConfig(spec *v1alpha1.TerminationHandlerConfigSpec) error {
+	var errs []error
+	validate := func(source string, selected func(*v1alpha1.TerminationHandlerConfigPool) (bool, error)) {
+		data, err := mergeHandlerConfig(spec, selected)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		l := &Loader{source: source}
+		c, err := l.parse(data)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		if err := c.ValidateShared(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source, err))
+		}
+	}
+
+	validate("shared configuration", func(*v1alpha1.TerminationHandlerConfigPool) (bool, error) {
+		return false, nil
+	})
+	names := map[string]bool{}
+	for i := range spec.Pools {
+		pool := &spec.Pools[i]
+		if pool.Name == "" || names[pool.Name] {
+			errs = append(errs, fmt.Errorf("pool names must be unique and not empty, got %q", pool.Name))
+			continue
+		}
+		names[pool.Name] = true
+		if _, err := metav1.LabelSelectorAsSelector(&pool.NodeSelector); err != nil {
+			errs = append(errs, fmt.Errorf("invalid node selector of pool %q: %v", pool.Name, err))
+			continue
+		}
+		validate(fmt.Sprintf("pool %q", pool.Name), func(p *v1alpha1.TerminationHandlerConfigPool) (bool, error) {
+			return p == pool, nil
+		})
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// mergeHandlerConfig returns the shared configuration of spec with the overrides of the
+// selected pools merged on top in order, as JSON
+func mergeHandlerConfig(spec *v1alpha1.TerminationHandlerConfigSpec, selected func(*v1alpha1.TerminationHandlerConfigPool) (bool, error)) ([]byte, error) {
+	merged, err := rawConfig(spec.Config)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding shared configuration: %v", err)
+	}
+	for i := range spec.Pools {
+		pool := &spec.Pools[i]
+		ok, err := selected(pool)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		overrides, err := rawConfig(pool.Config)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding configuration of pool %q: %v", pool.Name, err)
+		}
+		mergeValues(merged, overrides)
+	}
+	return json.Marshal(merged)
+}
+
+// rawConfig decodes a configuration object, empty if unset
+func rawConfig(raw runtime.RawExtension) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if len(raw.Raw) == 0 {
+		return values, nil
+	}
+	if err := json.Unmarshal(raw.Raw, &values); err != nil {
+		return nil, err
+	}
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	return values, nil
+}
+
+// mergeValues merges overrides into values, objects are merged recursively and every other
+// value, lists included, is replaced
+func mergeValues(values, overrides map[string]interface{}) {
+	for key, override := range overrides {
+		if o, ok := override.(map[string]interface{}); ok {
+			if v, ok := values[key].(map[string]interface{}); ok {
+				mergeValues(v, o)
+				continue
+			}
+		}
+		values[key] = override
+	}
+}
@@ -0,0 +1,318 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"text/template"
+
+	"github.com/alexander-demichev/termination-handler/pkg/actions"
+	"github.com/alexander-demichev/termination-handler/pkg/features"
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// drainModes are the supported values of Mode, mapped to whether they drain the node
+var drainModes = map[string]bool{"mark-only": false, "cordon-drain": true, "full": true}
+
+// Validate checks the configuration as a whole and returns every problem found,
+// so a bad configuration is reported at startup rather than once a notice arrives
+func (c *Config) Validate() error {
+	return c.validate(true)
+}
+
+// ValidateShared checks a configuration shared by many agents, e.g. that of a
+// TerminationHandlerConfig, which may leave the cloud provider and the node name to the
+// flags of the agents
+func (c *Config) ValidateShared() error {
+	return c.validate(false)
+}
+
+func (c *Config) validate(complete bool) error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	// The interruption statistics exporter, the NodeTermination controller, the binding
+	// webhook and the configuration controller run cluster wide instead of on a node
+	if complete && !c.InterruptionStats.Enabled && !c.NodeTerminations.Controller && !c.BindingWebhook.Enabled && !c.ConfigController {
+		// Providers are registered with the providers package, an unsupported provider is
+		// reported when the handler is constructed
+		if c.CloudProvider == "" {
+			add("cloud provider must be set")
+		}
+		if c.CloudProvider == "exec" && c.ExecProvider.Command == "" {
+			add("the exec cloud provider requires an exec provider command")
+		}
+		// Central handlers and management clusters handle many nodes
+		if c.NodeName == "" && len(c.NodeNames) == 0 && !c.Central && !c.Management.Enabled {
+			add("node name must be set")
+		}
+	}
+
+	if c.PollInterval.Duration <= 0 {
+		add("poll interval must be positive, got %v", c.PollInterval.Duration)
+	}
+	if c.PollJitter < 0 {
+		add("poll jitter must not be negative, got %v", c.PollJitter)
+	}
+	if c.AdvisoryPollInterval.Duration < 0 {
+		add("advisory poll interval must not be negative, got %v", c.AdvisoryPollInterval.Duration)
+	}
+	if c.ShutdownBudget.Duration < 0 {
+		add("shutdown budget must not be negative, got %v", c.ShutdownBudget.Duration)
+	}
+	if c.ClockSkewAllowance.Duration < 0 {
+		add("clock skew allowance must not be negative, got %v", c.ClockSkewAllowance.Duration)
+	}
+	if c.UnreachableThreshold < 1 {
+		add("unreachable threshold must be at least 1, got %d", c.UnreachableThreshold)
+	}
+	if _, err := labels.Parse(c.NodeSelector); err != nil {
+		add("invalid node selector %q: %v", c.NodeSelector, err)
+	}
+	gate, err := features.NewGate(c.FeatureGates)
+	if err != nil {
+		add("invalid feature gates: %v", err)
+	}
+
+	if c.Standalone {
+		if c.Mode != "mark-only" {
+			add("mode %q can not be used standalone, no actions are taken on the cluster", c.Mode)
+		}
+		if c.InterruptionStats.Enabled {
+			add("interruption statistics can not be exported standalone")
+		}
+		if c.Central {
+			add("a central handler can not run standalone")
+		}
+		if c.Management.Enabled {
+			add("a management cluster handler can not run standalone")
+		}
+		if c.NodeTerminations.Enabled || c.NodeTerminations.Controller {
+			add("NodeTerminations can not be used standalone")
+		}
+		if c.BindingWebhook.Enabled {
+			add("the binding webhook can not run standalone")
+		}
+		if c.ConfigController {
+			add("the configuration controller can not run standalone")
+		}
+		if c.DeschedulerHints {
+			add("descheduler hints can not be used standalone, there is no node to hint")
+		}
+	} else if c.StateFile != "" {
+		add("the state file can only be used standalone")
+	}
+	if c.Central {
+		if c.CloudProvider != "exec" {
+			add("a central handler requires the exec cloud provider, whose user-supplied plugin polls the cloud provider API, there is no built-in fleet poller for aws, azure or gcp")
+		}
+		if c.InterruptionStats.Enabled {
+			add("interruption statistics can not be exported by a central handler")
+		}
+	}
+	if c.Management.Enabled {
+		if c.CloudProvider != "exec" {
+			add("a management cluster handler requires the exec cloud provider, whose plugin polls the cloud provider API")
+		}
+		if c.Central {
+			add("a central handler can not run on a management cluster")
+		}
+		if c.InterruptionStats.Enabled {
+			add("interruption statistics can not be exported by a management cluster handler")
+		}
+		if c.Management.Target != "node" && c.Management.Target != "machine" {
+			add("management target %q is not supported, must be node or machine", c.Management.Target)
+		}
+	}
+	if c.NodeTerminations.Controller {
+		if c.Central || c.Management.Enabled || c.InterruptionStats.Enabled {
+			add("the NodeTermination controller runs instead of the termination handler and the interruption statistics exporter")
+		}
+		if c.NodeTerminations.Workers < 1 {
+			add("NodeTermination workers must be at least 1, got %d", c.NodeTerminations.Workers)
+		}
+	}
+	if len(c.NodeNames) > 0 {
+		if c.NodeName != "" {
+			add("node name and node names can not both be set")
+		}
+		if c.Standalone || c.Central || c.Management.Enabled || c.InterruptionStats.Enabled || c.NodeTerminations.Controller || c.BindingWebhook.Enabled || c.ConfigController {
+			add("node names can only be set for handlers of the nodes of an instance")
+		}
+		seen := map[string]bool{}
+		for _, nodeName := range c.NodeNames {
+			if nodeName == "" || seen[nodeName] {
+				add("node names must be unique and not empty, got %q", nodeName)
+			}
+			seen[nodeName] = true
+		}
+	}
+	if c.BindingWebhook.Enabled {
+		if c.Central || c.Management.Enabled || c.InterruptionStats.Enabled || c.NodeTerminations.Controller {
+			add("the binding webhook runs instead of the termination handler, the interruption statistics exporter and the NodeTermination controller")
+		}
+		if c.BindingWebhook.Port < 1 || c.BindingWebhook.Port > 65535 {
+			add("binding webhook port must be between 1 and 65535, got %d", c.BindingWebhook.Port)
+		}
+	}
+	if c.ConfigController {
+		if c.Central || c.Management.Enabled || c.InterruptionStats.Enabled || c.NodeTerminations.Controller || c.BindingWebhook.Enabled {
+			add("the configuration controller runs instead of the termination handler, the interruption statistics exporter, the NodeTermination controller and the binding webhook")
+		}
+	}
+	if le := c.LeaderElection; le.Enabled {
+		if !c.Central && !c.Management.Enabled && !c.NodeTerminations.Controller {
+			add("leader election requires a central or management cluster handler or the NodeTermination controller, node handlers act on their own node")
+		}
+		if le.Namespace == "" || le.Name == "" {
+			add("leader election requires the namespace and name of a Lease")
+		}
+		if le.RetryPeriod.Duration <= 0 {
+			add("leader election retry period must be positive, got %v", le.RetryPeriod.Duration)
+		}
+		if le.RenewDeadline.Duration <= le.RetryPeriod.Duration {
+			add("leader election renew deadline must be longer than the retry period, got %v", le.RenewDeadline.Duration)
+		}
+		if le.LeaseDuration.Duration <= le.RenewDeadline.Duration {
+			add("leader election lease duration must be longer than the renew deadline, got %v", le.LeaseDuration.Duration)
+		}
+	}
+
+	if rl := c.NodeRateLimit; rl.QPS < 0 {
+		add("node rate limit QPS must not be negative, got %v", rl.QPS)
+	} else if rl.QPS > 0 && rl.Burst < 1 {
+		add("node rate limit burst must be at least 1, got %d", rl.Burst)
+	}
+
+	drains, ok := drainModes[c.Mode]
+	switch {
+	case !ok:
+		add("mode %q is not supported, must be one of mark-only, cordon-drain or full", c.Mode)
+	case drains && gate != nil && !gate.Enabled(features.NodeDrain):
+		add("mode %q requires the %s feature gate", c.Mode, features.NodeDrain)
+	case drains && c.Drain.Timeout.Duration <= 0:
+		add("drain timeout must be positive, got %v", c.Drain.Timeout.Duration)
+	}
+	if c.Drain.Delay.Duration < 0 {
+		add("drain delay must not be negative, got %v", c.Drain.Delay.Duration)
+	}
+	if kured := c.Drain.Kured; kured.Enabled {
+		if kured.Namespace == "" || kured.DaemonSet == "" {
+			add("kured coordination requires the namespace and name of the kured DaemonSet")
+		}
+		if kured.LockTTL.Duration <= 0 {
+			add("kured lock TTL must be positive, got %v", kured.LockTTL.Duration)
+		}
+		if kured.MaxWait.Duration < 0 {
+			add("kured max wait must not be negative, got %v", kured.MaxWait.Duration)
+		}
+		if c.NodeTerminations.Enabled {
+			add("kured coordination is not supported with NodeTerminations, the NodeTermination controller drains the nodes")
+		}
+	}
+
+	if c.Drain.MachineConfigOperator {
+		// The machine API of OpenShift acts on the condition of its own termination handler
+		if c.Condition.Type != string(actions.TerminatingConditionType) {
+			add("Machine Config Operator coordination requires the condition type %q OpenShift acts on, got %q", actions.TerminatingConditionType, c.Condition.Type)
+		}
+		if c.NodeTerminations.Enabled {
+			add("Machine Config Operator coordination is not supported with NodeTerminations, the NodeTermination controller drains the nodes")
+		}
+	}
+	if c.Condition.Type == "" {
+		add("condition type must be set")
+	}
+	if c.Condition.TTL.Duration < 0 {
+		add("condition TTL must not be negative, got %v", c.Condition.TTL.Duration)
+	}
+	for _, t := range []struct{ name, value string }{
+		{"condition reason", c.Condition.Reason},
+		{"condition message", c.Condition.Message},
+	} {
+		if _, err := template.New(t.name).Parse(t.value); err != nil {
+			add("invalid %s template: %v", t.name, err)
+		}
+	}
+	if c.Deferral.LeadTime.Duration < 0 {
+		add("deferral lead time must not be negative, got %v", c.Deferral.LeadTime.Duration)
+	}
+	if c.Deferral.MaintenanceWindow != "" {
+		if c.Deferral.LeadTime.Duration == 0 {
+			add("a maintenance window requires a deferral lead time")
+		}
+		if _, err := cron.ParseStandard(c.Deferral.MaintenanceWindow); err != nil {
+			add("invalid maintenance window %q: %v", c.Deferral.MaintenanceWindow, err)
+		}
+	}
+
+	if c.Metadata.Timeout.Duration <= 0 {
+		add("metadata timeout must be positive, got %v", c.Metadata.Timeout.Duration)
+	}
+	if c.Metadata.DialTimeout.Duration <= 0 {
+		add("metadata dial timeout must be positive, got %v", c.Metadata.DialTimeout.Duration)
+	}
+	for _, u := range []struct{ name, value string }{
+		{"AWS metadata URL", c.Metadata.AWSURL},
+		{"Azure metadata URL", c.Metadata.AzureURL},
+		{"GCP metadata URL", c.Metadata.GCPURL},
+		{"metadata proxy URL", c.Metadata.ProxyURL},
+	} {
+		if u.value == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u.value); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			add("invalid %s %q", u.name, u.value)
+		}
+	}
+	if (c.Metadata.CertFile == "") != (c.Metadata.KeyFile == "") {
+		add("metadata client certificate and key must be set together")
+	}
+	for _, r := range []struct {
+		provider string
+		retry    RetryConfig
+	}{
+		{"AWS", c.Metadata.AWSRetry},
+		{"Azure", c.Metadata.AzureRetry},
+		{"GCP", c.Metadata.GCPRetry},
+	} {
+		if r.retry.InitialInterval.Duration <= 0 {
+			add("%s retry initial interval must be positive, got %v", r.provider, r.retry.InitialInterval.Duration)
+		}
+		if r.retry.Multiplier < 1 {
+			add("%s retry multiplier must be at least 1, got %v", r.provider, r.retry.Multiplier)
+		}
+		if r.retry.MaxAttempts < 0 {
+			add("%s retry max attempts must not be negative, got %d", r.provider, r.retry.MaxAttempts)
+		}
+		for _, status := range r.retry.RetryableStatuses {
+			if status < 400 || status > 499 {
+				add("%s retryable status %d is not a client error status", r.provider, status)
+			}
+		}
+	}
+
+	if c.Notifications.Hook.Command != "" && c.Notifications.Hook.Timeout.Duration <= 0 {
+		add("hook timeout must be positive, got %v", c.Notifications.Hook.Timeout.Duration)
+	}
+	if c.Notifications.MQTT.QoS > 2 {
+		add("MQTT QoS must be 0, 1 or 2, got %d", c.Notifications.MQTT.QoS)
+	}
+	if c.Audit.URL != "" && c.Audit.SigningKeyFile == "" {
+		add("audit URL requires a signing key file")
+	}
+
+	if c.InterruptionStats.Enabled {
+		if c.InterruptionStats.Window.Duration <= 0 {
+			add("interruption statistics window must be positive, got %v", c.InterruptionStats.Window.Duration)
+		}
+		if c.InterruptionStats.Interval.Duration <= 0 {
+			add("interruption statistics interval must be positive, got %v", c.InterruptionStats.Interval.Duration)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
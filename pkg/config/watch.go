@@ -0,0 +1,42 @@
+package config
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Watch checks the configuration for changes every interval until stop is closed and calls
+// onChange with the new configuration. The contents are compared rather than relying on file
+// system events, as ConfigMap volumes are updated by swapping symlinks.
+func (l *Loader) Watch(logger logr.Logger, interval time.Duration, stop <-chan struct{}, onChange func(*Config)) {
+	logger = logger.WithValues("source", l.source)
+	last, err := l.read()
+	if err != nil {
+		logger.Error(err, "Error reading config")
+	}
+
+	wait.Until(func() {
+		data, err := l.read()
+		if err != nil {
+			logger.Error(err, "Error reading config")
+			return
+		}
+		if bytes.Equal(data, last) {
+			return
+		}
+		last = data
+
+		c, err := l.parse(data)
+		if err != nil {
+			// Keep the current configuration until the file is fixed
+			logger.Error(err, "Error parsing changed config, keeping the current configuration")
+			return
+		}
+
+		logger.Info("Configuration changed, applying new configuration")
+		onChange(c)
+	}, interval, stop)
+}
@@ -0,0 +1,98 @@
+// Package features holds the feature gates of the termination handler. Capabilities that
+// change how nodes are acted on ship behind a gate, disabled by default while in alpha,
+// and are enabled per cluster with --feature-gates.
+package features
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Feature is the name of a feature gate
+type Feature string
+
+const (
+	// MaintenanceWindowDeferral defers the drain on notices of scheduled maintenance to
+	// a maintenance window or the lead time before the deadline
+	MaintenanceWindowDeferral Feature = "MaintenanceWindowDeferral"
+
+	// NodeDrain allows the cordon-drain and full modes, which cordon and drain the node
+	NodeDrain Feature = "NodeDrain"
+)
+
+// Stage is the maturity of a feature
+type Stage string
+
+const (
+	// Alpha features are disabled by default and may change or be removed
+	Alpha Stage = "ALPHA"
+	// Beta features are enabled by default
+	Beta Stage = "BETA"
+	// GA features are always enabled, their gate only remains for compatibility
+	GA Stage = "GA"
+)
+
+// Spec describes a feature gate
+type Spec struct {
+	Default bool
+	Stage   Stage
+}
+
+// knownFeatures are the features that can be gated
+var knownFeatures = map[Feature]Spec{
+	MaintenanceWindowDeferral: {Default: false, Stage: Alpha},
+	NodeDrain:                 {Default: false, Stage: Alpha},
+}
+
+// Gate tells whether the known features are enabled
+type Gate struct {
+	enabled map[Feature]bool
+}
+
+// NewGate constructs a gate enabling or disabling the features by name, the remaining
+// features keep their default. It fails on unknown features and on disabling GA features.
+func NewGate(overrides map[string]bool) (*Gate, error) {
+	g := &Gate{enabled: map[Feature]bool{}}
+	for feature, spec := range knownFeatures {
+		g.enabled[feature] = spec.Default
+	}
+
+	for name, enabled := range overrides {
+		feature := Feature(name)
+		spec, ok := knownFeatures[feature]
+		if !ok {
+			return nil, fmt.Errorf("unknown feature gate %q, known feature gates are %s", name, strings.Join(Known(), ", "))
+		}
+		if spec.Stage == GA && !enabled {
+			return nil, fmt.Errorf("feature gate %q is GA and cannot be disabled", name)
+		}
+		g.enabled[feature] = enabled
+	}
+	return g, nil
+}
+
+// Enabled returns whether the feature is enabled, unknown features are disabled
+func (g *Gate) Enabled(feature Feature) bool {
+	return g.enabled[feature]
+}
+
+// String returns the enabled state of every known feature, sorted by name
+func (g *Gate) String() string {
+	pairs := make([]string, 0, len(g.enabled))
+	for feature, enabled := range g.enabled {
+		pairs = append(pairs, fmt.Sprintf("%s=%t", feature, enabled))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Known returns the descriptions of the known features, sorted by name, e.g. for flag usage
+func Known() []string {
+	known := make([]string, 0, len(knownFeatures))
+	for feature, spec := range knownFeatures {
+		known = append(known, fmt.Sprintf("%s=true|false (%s - default=%t)", feature, spec.Stage, spec.Default))
+	}
+	sort.Strings(known)
+	return known
+}
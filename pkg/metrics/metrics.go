@@ -0,0 +1,433 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/version"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	pollsName                = "polls_total"
+	pollFailuresName         = "poll_failures_total"
+	pollLoopRestartsName     = "poll_loop_restarts_total"
+	terminationsDetectedName = "terminations_detected_total"
+	deadlineRemainingName    = "termination_deadline_remaining_seconds"
+	actionLatencyName        = "detection_to_completion_seconds"
+	metadataUnreachableName  = "metadata_unreachable"
+	advisoryActiveName       = "advisory_active"
+	pausedName               = "paused"
+	interruptionsName        = "interruptions"
+	terminatingNodesName     = "terminating_nodes"
+	nodeDeadlineName         = "node_termination_deadline_timestamp_seconds"
+	nodePendingActionsName   = "node_termination_pending_actions"
+	isLeaderName             = "is_leader"
+	watchedNodesName         = "watched_nodes"
+	providerLabel            = "provider"
+	statusClassLabel         = "status_class"
+	kindLabel                = "kind"
+	nodeLabel                = "node"
+	stateLabel               = "state"
+	actionLabel              = "action"
+	eventTypeLabel           = "event_type"
+	metricsNamespace         = "termination_handler"
+)
+
+var (
+	// buildInfo exposes the build information with a constant value of 1
+	buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "build_info",
+		Help:      "Build information of the termination handler, the value is always 1",
+	}, []string{"version", "git_commit", "go_version"})
+
+	// pollsTotal counts the number of times the termination notice endpoint was polled
+	pollsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      pollsName,
+		Help:      "Number of times the termination notice endpoint was polled",
+	}, []string{providerLabel})
+
+	// pollFailuresTotal counts failed polls of the termination notice endpoint
+	pollFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      pollFailuresName,
+		Help:      "Number of failed polls of the termination notice endpoint by HTTP status class and error kind",
+	}, []string{providerLabel, statusClassLabel, kindLabel})
+
+	// pollLoopRestartsTotal counts the poll loops restarted by the watchdog after stalling
+	pollLoopRestartsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      pollLoopRestartsName,
+		Help:      "Number of times the termination notice poll loop stalled and was restarted",
+	}, []string{providerLabel})
+
+	// terminationsDetectedTotal counts the number of termination notices observed
+	terminationsDetectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      terminationsDetectedName,
+		Help:      "Number of termination notices detected",
+	}, []string{providerLabel, eventTypeLabel})
+
+	// metadataUnreachable reports whether the termination notice endpoint has been
+	// unreachable for too many consecutive polls to observe termination notices
+	metadataUnreachable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      metadataUnreachableName,
+		Help:      "Whether the termination notice endpoint has been unreachable for more consecutive polls than the configured threshold (1) or not (0)",
+	}, []string{providerLabel})
+
+	// advisoryActive reports whether the cloud provider signals that a termination is likely soon
+	advisoryActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      advisoryActiveName,
+		Help:      "Whether the cloud provider signals that a termination is likely soon, e.g. with a rebalance recommendation (1) or not (0)",
+	}, []string{providerLabel})
+
+	// paused reports whether a termination notice was detected on a node paused by the operator
+	paused = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      pausedName,
+		Help:      "Whether a termination notice was detected while the node is paused and no actions are taken (1) or not (0)",
+	}, []string{providerLabel})
+
+	// interruptions counts the interruptions observed across the cluster within the statistics window
+	interruptions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      interruptionsName,
+		Help:      "Number of nodes interrupted within the statistics window by node pool and instance type",
+	}, []string{"pool", "instance_type"})
+
+	// terminatingNodes counts the nodes handled by a central handler by the state of their handler
+	terminatingNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      terminatingNodesName,
+		Help:      "Number of nodes with a termination notice handled by the central handler by handler state",
+	}, []string{stateLabel})
+
+	// nodeDeadline reports the deadline of every node handled by a central handler
+	nodeDeadline = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      nodeDeadlineName,
+		Help:      "Unix time at which the instance of a node handled by the central handler is terminated, only reported if known",
+	}, []string{nodeLabel})
+
+	// nodePendingActions reports the actions not taken yet for every node handled by a central handler
+	nodePendingActions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      nodePendingActionsName,
+		Help:      "Number of actions not taken yet for the termination notice of a node handled by the central handler",
+	}, []string{nodeLabel})
+
+	// isLeader reports whether the replica holds the Lease of the leader election
+	isLeader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      isLeaderName,
+		Help:      "Whether the replica is the elected leader acting on termination notices (1) or stands by (0), only reported with leader election",
+	})
+
+	// watchedNodes reports the number of nodes a central or management cluster handler polls for
+	watchedNodes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      watchedNodesName,
+		Help:      "Number of nodes, or Machines on a management cluster, whose instances are polled for termination notices by the central or management cluster handler",
+	})
+
+	// actionLatency measures the time between the termination notice being detected
+	// and an action completing, buckets cover the 30s-2min notice windows of the providers
+	actionLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      actionLatencyName,
+		Help:      "Latency between detecting the termination notice and the completion of an action",
+		Buckets:   []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 90, 120, 180},
+	}, []string{providerLabel, actionLabel})
+
+	// deadlineRemaining reports the seconds remaining until the termination deadline
+	deadlineRemaining = &deadlineCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", deadlineRemainingName),
+			"Seconds remaining until the instance of the node is terminated by the cloud provider, only reported once termination was detected",
+			[]string{providerLabel, nodeLabel}, nil,
+		),
+		deadlines: map[string]nodeTerminationDeadline{},
+	}
+)
+
+func init() {
+	buildInfo.WithLabelValues(version.Version, version.GitCommit, version.GoVersion()).Set(1)
+
+	registry.MustRegister(
+		buildInfo,
+		pollsTotal,
+		pollFailuresTotal,
+		pollLoopRestartsTotal,
+		terminationsDetectedTotal,
+		metadataUnreachable,
+		advisoryActive,
+		paused,
+		interruptions,
+		terminatingNodes,
+		nodeDeadline,
+		nodePendingActions,
+		isLeader,
+		watchedNodes,
+		actionLatency,
+		deadlineRemaining,
+	)
+	registry.MustRegister(runtimeCollectors()...)
+}
+
+// deadlineCollector computes the time remaining until the deadlines at scrape time,
+// so the reported values stay accurate without the handler having to update them
+type deadlineCollector struct {
+	desc *prometheus.Desc
+
+	lock sync.RWMutex
+	// deadlines are keyed by node name
+	deadlines map[string]nodeTerminationDeadline
+}
+
+// nodeTerminationDeadline is the deadline of the termination of a node by a provider
+type nodeTerminationDeadline struct {
+	provider string
+	deadline time.Time
+}
+
+// Describe implements prometheus.Collector
+func (c *deadlineCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector
+func (c *deadlineCollector) Collect(ch chan<- prometheus.Metric) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	for node, d := range c.deadlines {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, time.Until(d.deadline).Seconds(), d.provider, node)
+	}
+}
+
+// Sink is an additional destination that every recorded metric is mirrored to,
+// for environments where the Prometheus endpoint is not scraped
+type Sink interface {
+	Count(name string, value int64, labels map[string]string)
+	Gauge(name string, value float64, labels map[string]string)
+	Timing(name string, value time.Duration, labels map[string]string)
+}
+
+var (
+	sinksLock sync.RWMutex
+	sinks     []Sink
+)
+
+// AddSink registers a sink that will receive all metrics recorded after the call
+func AddSink(s Sink) {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+	sinks = append(sinks, s)
+}
+
+// RemoveSink unregisters a sink added with AddSink, it receives no metrics recorded after the call
+func RemoveSink(s Sink) {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+	for i := range sinks {
+		if sinks[i] == s {
+			sinks = append(sinks[:i], sinks[i+1:]...)
+			return
+		}
+	}
+}
+
+func eachSink(fn func(Sink)) {
+	sinksLock.RLock()
+	defer sinksLock.RUnlock()
+	for _, s := range sinks {
+		fn(s)
+	}
+}
+
+// Handler returns an http.Handler serving the Prometheus metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+}
+
+// RecordPoll records a single poll of the termination notice endpoint
+func RecordPoll(provider string) {
+	pollsTotal.WithLabelValues(provider).Inc()
+	eachSink(func(s Sink) {
+		s.Count(pollsName, 1, map[string]string{providerLabel: provider})
+	})
+}
+
+// RecordPollFailure records a failed poll of the termination notice endpoint.
+// statusClass is the class of the HTTP response status (e.g. 5xx), or none if no
+// response was received, kind describes the cause of the failure.
+func RecordPollFailure(provider, statusClass, kind string) {
+	pollFailuresTotal.WithLabelValues(provider, statusClass, kind).Inc()
+	eachSink(func(s Sink) {
+		s.Count(pollFailuresName, 1, map[string]string{providerLabel: provider, statusClassLabel: statusClass, kindLabel: kind})
+	})
+}
+
+// RecordPollLoopRestart records that the poll loop stalled and was restarted
+func RecordPollLoopRestart(provider string) {
+	pollLoopRestartsTotal.WithLabelValues(provider).Inc()
+	eachSink(func(s Sink) {
+		s.Count(pollLoopRestartsName, 1, map[string]string{providerLabel: provider})
+	})
+}
+
+// SetMetadataUnreachable records whether the termination notice endpoint is considered unreachable
+func SetMetadataUnreachable(provider string, unreachable bool) {
+	value := 0.0
+	if unreachable {
+		value = 1
+	}
+	metadataUnreachable.WithLabelValues(provider).Set(value)
+	eachSink(func(s Sink) {
+		s.Gauge(metadataUnreachableName, value, map[string]string{providerLabel: provider})
+	})
+}
+
+// SetAdvisoryActive records whether the cloud provider signals that a termination is likely soon
+func SetAdvisoryActive(provider string, active bool) {
+	value := 0.0
+	if active {
+		value = 1
+	}
+	advisoryActive.WithLabelValues(provider).Set(value)
+	eachSink(func(s Sink) {
+		s.Gauge(advisoryActiveName, value, map[string]string{providerLabel: provider})
+	})
+}
+
+// SetPaused records whether actions on a detected termination notice are held back
+// because the node is paused
+func SetPaused(provider string, isPaused bool) {
+	value := 0.0
+	if isPaused {
+		value = 1
+	}
+	paused.WithLabelValues(provider).Set(value)
+	eachSink(func(s Sink) {
+		s.Gauge(pausedName, value, map[string]string{providerLabel: provider})
+	})
+}
+
+// InterruptionCount is the number of interruptions of a node pool and instance type
+type InterruptionCount struct {
+	Pool         string `json:"pool"`
+	InstanceType string `json:"instanceType"`
+	Count        int    `json:"count"`
+}
+
+// SetInterruptions replaces the reported interruption counts
+func SetInterruptions(counts []InterruptionCount) {
+	interruptions.Reset()
+	for _, c := range counts {
+		interruptions.WithLabelValues(c.Pool, c.InstanceType).Set(float64(c.Count))
+	}
+	eachSink(func(s Sink) {
+		for _, c := range counts {
+			s.Gauge(interruptionsName, float64(c.Count), map[string]string{"pool": c.Pool, "instance_type": c.InstanceType})
+		}
+	})
+}
+
+// TerminatingNode is a node with a termination notice handled by a central handler
+type TerminatingNode struct {
+	Node  string
+	State string
+	// Deadline is zero if unknown
+	Deadline       time.Time
+	PendingActions int
+}
+
+// SetTerminatingNodes replaces the reported terminating nodes
+func SetTerminatingNodes(nodes []TerminatingNode) {
+	terminatingNodes.Reset()
+	nodeDeadline.Reset()
+	nodePendingActions.Reset()
+	states := map[string]int{}
+	for _, n := range nodes {
+		states[n.State]++
+		if !n.Deadline.IsZero() {
+			nodeDeadline.WithLabelValues(n.Node).Set(float64(n.Deadline.Unix()))
+		}
+		nodePendingActions.WithLabelValues(n.Node).Set(float64(n.PendingActions))
+	}
+	for state, count := range states {
+		terminatingNodes.WithLabelValues(state).Set(float64(count))
+	}
+	eachSink(func(s Sink) {
+		for state, count := range states {
+			s.Gauge(terminatingNodesName, float64(count), map[string]string{stateLabel: state})
+		}
+		for _, n := range nodes {
+			s.Gauge(nodePendingActionsName, float64(n.PendingActions), map[string]string{nodeLabel: n.Node})
+		}
+	})
+}
+
+// SetLeader records whether the replica is the elected leader
+func SetLeader(leader bool) {
+	value := 0.0
+	if leader {
+		value = 1
+	}
+	isLeader.Set(value)
+	eachSink(func(s Sink) {
+		s.Gauge(isLeaderName, value, nil)
+	})
+}
+
+// SetWatchedNodes records the number of nodes a central or management cluster handler polls for
+func SetWatchedNodes(count int) {
+	watchedNodes.Set(float64(count))
+	eachSink(func(s Sink) {
+		s.Gauge(watchedNodesName, float64(count), nil)
+	})
+}
+
+// RecordTerminationDetected records that the instance was marked for termination by an event of eventType
+func RecordTerminationDetected(provider, eventType string) {
+	terminationsDetectedTotal.WithLabelValues(provider, eventType).Inc()
+	eachSink(func(s Sink) {
+		s.Count(terminationsDetectedName, 1, map[string]string{providerLabel: provider, eventTypeLabel: eventType})
+	})
+}
+
+// SetTerminationDeadline records the time at which the cloud provider will terminate the
+// instance of the node. Sinks are sent the time remaining, so it is set again on every poll
+// while the termination is pending for their gauges to count down.
+func SetTerminationDeadline(provider, node string, deadline time.Time) {
+	deadlineRemaining.lock.Lock()
+	deadlineRemaining.deadlines[node] = nodeTerminationDeadline{provider: provider, deadline: deadline}
+	deadlineRemaining.lock.Unlock()
+
+	eachSink(func(s Sink) {
+		s.Gauge(deadlineRemainingName, time.Until(deadline).Seconds(), map[string]string{providerLabel: provider, nodeLabel: node})
+	})
+}
+
+// ClearTerminationDeadline stops reporting the deadline of the node once the termination was
+// cancelled or the node is no longer handled
+func ClearTerminationDeadline(node string) {
+	deadlineRemaining.lock.Lock()
+	delete(deadlineRemaining.deadlines, node)
+	deadlineRemaining.lock.Unlock()
+}
+
+// RecordActionCompleted records the time taken from detection of the termination notice
+// until the given action completed
+func RecordActionCompleted(provider, action string, latency time.Duration) {
+	actionLatency.WithLabelValues(provider, action).Observe(latency.Seconds())
+	eachSink(func(s Sink) {
+		s.Timing(actionLatencyName, latency, map[string]string{providerLabel: provider, actionLabel: action})
+	})
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// recordingSink records the last value of every gauge, by node
+type recordingSink struct {
+	lock   sync.Mutex
+	gauges map[string][]float64
+}
+
+func (s *recordingSink) Count(name string, value int64, labels map[string]string) {}
+
+func (s *recordingSink) Gauge(name string, value float64, labels map[string]string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if name == deadlineRemainingName {
+		s.gauges[labels[nodeLabel]] = append(s.gauges[labels[nodeLabel]], value)
+	}
+}
+
+func (s *recordingSink) Timing(name string, value time.Duration, labels map[string]string) {}
+
+// collectDeadlines returns the remaining seconds the collector reports, by node
+func collectDeadlines(t *testing.T) map[string]float64 {
+	t.Helper()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(deadlineRemaining)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+	remaining := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == nodeLabel {
+					remaining[label.GetValue()] = metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	return remaining
+}
+
+func TestTerminationDeadlineByNode(t *testing.T) {
+	sink := &recordingSink{gauges: map[string][]float64{}}
+	AddSink(sink)
+	t.Cleanup(func() { RemoveSink(sink) })
+
+	now := time.Now()
+	SetTerminationDeadline("aws", "first", now.Add(2*time.Minute))
+	SetTerminationDeadline("aws", "second", now.Add(30*time.Second))
+	defer ClearTerminationDeadline("first")
+
+	remaining := collectDeadlines(t)
+	if len(remaining) != 2 || remaining["first"] <= 60 || remaining["second"] > 30 {
+		t.Errorf("got remaining seconds %v, want those of both nodes", remaining)
+	}
+
+	ClearTerminationDeadline("second")
+	if remaining := collectDeadlines(t); len(remaining) != 1 || remaining["first"] == 0 {
+		t.Errorf("got remaining seconds %v after clearing the second node, want the first one only", remaining)
+	}
+
+	// Setting the deadline again sends the sinks the time remaining by then
+	time.Sleep(10 * time.Millisecond)
+	SetTerminationDeadline("aws", "first", now.Add(2*time.Minute))
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	if gauges := sink.gauges["first"]; len(gauges) != 2 || gauges[1] >= gauges[0] {
+		t.Errorf("got gauges %v of the first node, want two counting down", gauges)
+	}
+}
+
+func TestRemoveSink(t *testing.T) {
+	sink := &recordingSink{gauges: map[string][]float64{}}
+	AddSink(sink)
+	RemoveSink(sink)
+
+	SetTerminationDeadline("aws", "removed", time.Now().Add(time.Minute))
+	defer ClearTerminationDeadline("removed")
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	if gauges := sink.gauges["removed"]; len(gauges) != 0 {
+		t.Errorf("removed sink got gauges %v", gauges)
+	}
+}
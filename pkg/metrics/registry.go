@@ -0,0 +1,23 @@
+//go:build !lite
+// +build !lite
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// registry is the registry the metrics are registered with, shared with controller-runtime
+// so its client and workqueue metrics are served as well
+var registry prometheus.Registerer = metrics.Registry
+
+// gatherer serves the metrics of registry
+var gatherer prometheus.Gatherer = metrics.Registry
+
+// runtimeCollectors returns the goroutine, memory and file descriptor collectors, to notice
+// leaks in long runs. The controller package of controller-runtime registers them with its
+// registry already.
+func runtimeCollectors() []prometheus.Collector {
+	return nil
+}
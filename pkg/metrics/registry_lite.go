@@ -0,0 +1,26 @@
+//go:build lite
+// +build lite
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// liteRegistry avoids depending on controller-runtime in lite builds
+var liteRegistry = prometheus.NewRegistry()
+
+// registry is the registry the metrics are registered with
+var registry prometheus.Registerer = liteRegistry
+
+// gatherer serves the metrics of registry
+var gatherer prometheus.Gatherer = liteRegistry
+
+// runtimeCollectors returns the goroutine, memory and file descriptor collectors, to notice
+// leaks in long runs
+func runtimeCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	}
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StatsDSink sends metrics to a StatsD server over UDP. When DogStatsD is enabled,
+// metric labels and the static tags are sent using the DogStatsD tag extension,
+// otherwise they are dropped as plain StatsD has no notion of tags.
+type StatsDSink struct {
+	conn      net.Conn
+	prefix    string
+	tags      []string
+	dogStatsD bool
+}
+
+// NewStatsDSink constructs a sink sending metrics to the StatsD server at address
+func NewStatsDSink(address, prefix string, tags []string, dogStatsD bool) (*StatsDSink, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to statsd server %q: %v", address, err)
+	}
+
+	return &StatsDSink{
+		conn:      conn,
+		prefix:    prefix,
+		tags:      tags,
+		dogStatsD: dogStatsD,
+	}, nil
+}
+
+// Count implements Sink
+func (s *StatsDSink) Count(name string, value int64, labels map[string]string) {
+	s.send(name, fmt.Sprintf("%d", value), "c", labels)
+}
+
+// Gauge implements Sink
+func (s *StatsDSink) Gauge(name string, value float64, labels map[string]string) {
+	s.send(name, fmt.Sprintf("%g", value), "g", labels)
+}
+
+// Timing implements Sink
+func (s *StatsDSink) Timing(name string, value time.Duration, labels map[string]string) {
+	s.send(name, fmt.Sprintf("%d", value.Milliseconds()), "ms", labels)
+}
+
+func (s *StatsDSink) send(name, value, metricType string, labels map[string]string) {
+	var b strings.Builder
+	if s.prefix != "" {
+		b.WriteString(s.prefix)
+		b.WriteString(".")
+	}
+	fmt.Fprintf(&b, "%s:%s|%s", name, value, metricType)
+
+	if s.dogStatsD {
+		tags := append([]string{}, s.tags...)
+		for k, v := range labels {
+			tags = append(tags, k+":"+v)
+		}
+		sort.Strings(tags)
+		if len(tags) > 0 {
+			b.WriteString("|#")
+			b.WriteString(strings.Join(tags, ","))
+		}
+	}
+
+	// Metrics are best effort, a lost datagram should never affect the handler
+	_, _ = s.conn.Write([]byte(b.String()))
+}
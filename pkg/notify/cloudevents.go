@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+const (
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+
+	// maxDrainSize bounds the response body read before the connection is released
+	maxDrainSize = 64 << 10
+
+	// CloudEventType is the type of the CloudEvents published for termination notices
+	CloudEventType = "com.github.alexander-demichev.termination-handler.terminating"
+)
+
+// cloudEvent is a CloudEvent in the structured JSON format, see
+// https://github.com/cloudevents/spec/blob/v1.0/json-format.md
+type cloudEvent struct {
+	SpecVersion     string         `json:"specversion"`
+	ID              string         `json:"id"`
+	Source          string         `json:"source"`
+	Type            string         `json:"type"`
+	Subject         string         `json:"subject"`
+	Time            time.Time      `json:"time"`
+	DataContentType string         `json:"datacontenttype"`
+	Data            cloudEventData `json:"data"`
+}
+
+type cloudEventData struct {
+	Node      string     `json:"node"`
+	Provider  string     `json:"provider"`
+	EventType string     `json:"eventType"`
+	EventID   string     `json:"eventID,omitempty"`
+	Deadline  *time.Time `json:"deadline,omitempty"`
+	Simulated bool       `json:"simulated,omitempty"`
+	Raw       string     `json:"raw,omitempty"`
+}
+
+// CloudEventsNotifier publishes termination notices as CloudEvents to an HTTP sink,
+// such as a Knative broker
+type CloudEventsNotifier struct {
+	sinkURL string
+	client  *http.Client
+}
+
+// NewCloudEventsNotifier constructs a notifier posting CloudEvents to sinkURL,
+// tlsOpts configure the connection to sinks served over HTTPS
+func NewCloudEventsNotifier(sinkURL string, timeout time.Duration, tlsOpts TLSOptions) (*CloudEventsNotifier, error) {
+	client, err := tlsOpts.HTTPClient(timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &CloudEventsNotifier{
+		sinkURL: sinkURL,
+		client:  client,
+	}, nil
+}
+
+// Notify implements Notifier
+func (n *CloudEventsNotifier) Notify(ctx context.Context, notice Notice) error {
+	event := cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              string(uuid.NewUUID()),
+		Source:          "/nodes/" + notice.NodeName,
+		Type:            CloudEventType,
+		Subject:         notice.NodeName,
+		Time:            notice.DetectedAt,
+		DataContentType: "application/json",
+		Data: cloudEventData{
+			Node:      notice.NodeName,
+			Provider:  notice.Provider,
+			EventType: notice.EventType,
+			EventID:   notice.EventID,
+			Simulated: notice.Simulated,
+			Raw:       notice.Raw,
+		},
+	}
+	if !notice.Deadline.IsZero() {
+		event.Data.Deadline = &notice.Deadline
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error marshalling cloud event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.sinkURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not create request %q: %w", n.sinkURL, err)
+	}
+	req.Header.Set("Content-Type", cloudEventsContentType)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending cloud event to %q: %w", n.sinkURL, err)
+	}
+	defer resp.Body.Close()
+	// Draining the response lets the connection be reused, a bounded amount is read so
+	// a misbehaving sink cannot stall the notification
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxDrainSize))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status sending cloud event: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// ExecNotifier runs a local hook command for termination notices. The notice is passed
+// as JSON on stdin and in TERMINATION_* environment variables.
+type ExecNotifier struct {
+	command string
+	args    []string
+	timeout time.Duration
+}
+
+// NewExecNotifier constructs a notifier running command with args, the hook is killed
+// if it does not exit within timeout
+func NewExecNotifier(command string, args []string, timeout time.Duration) *ExecNotifier {
+	return &ExecNotifier{
+		command: command,
+		args:    args,
+		timeout: timeout,
+	}
+}
+
+// Notify implements Notifier
+func (n *ExecNotifier) Notify(ctx context.Context, notice Notice) error {
+	data, err := marshalNotice(notice)
+	if err != nil {
+		return fmt.Errorf("error marshalling notice: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, n.command, n.args...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(),
+		"TERMINATION_NODE_NAME="+notice.NodeName,
+		"TERMINATION_PROVIDER="+notice.Provider,
+		"TERMINATION_EVENT_TYPE="+notice.EventType,
+		"TERMINATION_EVENT_ID="+notice.EventID,
+		"TERMINATION_DETECTED_AT="+notice.DetectedAt.UTC().Format(time.RFC3339),
+		fmt.Sprintf("TERMINATION_SIMULATED=%t", notice.Simulated),
+	)
+	if !notice.Deadline.IsZero() {
+		cmd.Env = append(cmd.Env, "TERMINATION_DEADLINE="+notice.Deadline.UTC().Format(time.RFC3339))
+	}
+	if notice.Raw != "" {
+		cmd.Env = append(cmd.Env, "TERMINATION_RAW="+notice.Raw)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error running hook %q: %w, output: %s", n.command, err, bytes.TrimSpace(output))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FileNotifier writes termination notices as JSON to a local file, e.g. on a hostPath volume,
+// for other daemons of the node to consume. The file holds the last notice published.
+type FileNotifier struct {
+	path string
+}
+
+// NewFileNotifier constructs a notifier writing notices to the file at path
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+// Notify implements Notifier
+func (n *FileNotifier) Notify(ctx context.Context, notice Notice) error {
+	data, err := marshalNotice(notice)
+	if err != nil {
+		return fmt.Errorf("error marshalling notice: %w", err)
+	}
+	if err := n.write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing notice file %q: %w", n.path, err)
+	}
+	return nil
+}
+
+// write replaces the file through a temporary file in the same directory, so readers never
+// see a partial notice
+func (n *FileNotifier) write(data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(n.path), "."+filepath.Base(n.path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	// Readable by the daemons of the node, which may not run as the same user
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), n.path)
+}
@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MQTTOptions configures the MQTT notifier
+type MQTTOptions struct {
+	// BrokerURL is the URL of the broker, e.g. tcp://broker:1883 or ssl://broker:8883
+	BrokerURL string
+	Topic     string
+	QoS       byte
+	ClientID  string
+	Username  string
+	Password  string
+	TLS       TLSOptions
+	Timeout   time.Duration
+}
+
+// MQTTNotifier publishes termination notices as JSON messages to an MQTT topic
+type MQTTNotifier struct {
+	client  mqtt.Client
+	topic   string
+	qos     byte
+	timeout time.Duration
+}
+
+// NewMQTTNotifier constructs a notifier publishing to an MQTT broker. The connection
+// is only established when the first notice is published, so an unavailable broker
+// does not prevent the handler from starting.
+func NewMQTTNotifier(opts MQTTOptions) (*MQTTNotifier, error) {
+	if opts.QoS > 2 {
+		return nil, fmt.Errorf("invalid MQTT QoS %d, must be 0, 1 or 2", opts.QoS)
+	}
+
+	clientOpts := mqtt.NewClientOptions().
+		AddBroker(opts.BrokerURL).
+		SetClientID(opts.ClientID).
+		SetUsername(opts.Username).
+		SetPassword(opts.Password).
+		SetConnectTimeout(opts.Timeout).
+		SetWriteTimeout(opts.Timeout)
+
+	brokerURL, err := url.Parse(opts.BrokerURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MQTT broker URL %q: %w", opts.BrokerURL, err)
+	}
+	switch brokerURL.Scheme {
+	case "ssl", "tls", "mqtts", "wss":
+		tlsConfig, err := opts.TLS.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		clientOpts.SetTLSConfig(tlsConfig)
+	}
+
+	return &MQTTNotifier{
+		client:  mqtt.NewClient(clientOpts),
+		topic:   opts.Topic,
+		qos:     opts.QoS,
+		timeout: opts.Timeout,
+	}, nil
+}
+
+// Notify implements Notifier
+func (n *MQTTNotifier) Notify(ctx context.Context, notice Notice) error {
+	data, err := marshalNotice(notice)
+	if err != nil {
+		return fmt.Errorf("error marshalling notice: %w", err)
+	}
+
+	if !n.client.IsConnected() {
+		if err := n.wait(ctx, n.client.Connect()); err != nil {
+			return fmt.Errorf("error connecting to MQTT broker: %w", err)
+		}
+	}
+
+	if err := n.wait(ctx, n.client.Publish(n.topic, n.qos, false, data)); err != nil {
+		return fmt.Errorf("error publishing to MQTT topic %q: %w", n.topic, err)
+	}
+	return nil
+}
+
+// wait blocks until the token completes, the timeout expires or the context is cancelled
+func (n *MQTTNotifier) wait(ctx context.Context, token mqtt.Token) error {
+	completed := make(chan bool, 1)
+	go func() {
+		completed <- token.WaitTimeout(n.timeout)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case ok := <-completed:
+		if !ok {
+			return fmt.Errorf("timed out after %v", n.timeout)
+		}
+		return token.Error()
+	}
+}
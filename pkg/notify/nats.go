@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSNotifier publishes termination notices as JSON messages to a NATS subject
+type NATSNotifier struct {
+	conn    *nats.Conn
+	subject string
+	timeout time.Duration
+}
+
+// NewNATSNotifier connects to the NATS server(s) at url and constructs a notifier
+// publishing to subject. The connection is kept open and reconnects automatically.
+func NewNATSNotifier(url, subject string, timeout time.Duration) (*NATSNotifier, error) {
+	conn, err := nats.Connect(url, nats.Name("termination-handler"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to NATS %q: %w", url, err)
+	}
+
+	return &NATSNotifier{
+		conn:    conn,
+		subject: subject,
+		timeout: timeout,
+	}, nil
+}
+
+// Notify implements Notifier
+func (n *NATSNotifier) Notify(ctx context.Context, notice Notice) error {
+	data, err := marshalNotice(notice)
+	if err != nil {
+		return fmt.Errorf("error marshalling notice: %w", err)
+	}
+
+	if err := n.conn.Publish(n.subject, data); err != nil {
+		return fmt.Errorf("error publishing to NATS subject %q: %w", n.subject, err)
+	}
+
+	// Make sure the message reached the server before the node goes away
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+	if err := n.conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("error flushing NATS connection: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Notice describes a termination notice observed by the handler
+type Notice struct {
+	// NodeName is the name of the node that is going to be terminated
+	NodeName string
+	// Provider is the cloud provider that issued the notice
+	Provider string
+	// EventType is the kind of event reported by the provider, e.g. Preempt
+	EventType string
+	// EventID is the provider's identifier of the event, it is empty if the provider has none
+	EventID string
+	// DetectedAt is the time the handler observed the notice
+	DetectedAt time.Time
+	// Deadline is the time the instance will be terminated, it is zero if unknown
+	Deadline time.Time
+	// Simulated is set for notices injected to rehearse the handling of terminations
+	Simulated bool
+	// Raw is the notice as reported by the provider, it is empty if the provider has none
+	Raw string
+	// Deferrable is set for notices of scheduled maintenance, whose drain may be deferred
+	Deferrable bool
+}
+
+// Notifier publishes termination notices to an external system
+type Notifier interface {
+	Notify(ctx context.Context, notice Notice) error
+}
+
+// noticePayload is the JSON representation of a Notice published by the message based notifiers
+type noticePayload struct {
+	NodeName   string     `json:"nodeName"`
+	Provider   string     `json:"provider"`
+	EventType  string     `json:"eventType"`
+	EventID    string     `json:"eventID,omitempty"`
+	DetectedAt time.Time  `json:"detectedAt"`
+	Deadline   *time.Time `json:"deadline,omitempty"`
+	Simulated  bool       `json:"simulated,omitempty"`
+	Raw        string     `json:"raw,omitempty"`
+}
+
+func marshalNotice(notice Notice) ([]byte, error) {
+	payload := noticePayload{
+		NodeName:   notice.NodeName,
+		Provider:   notice.Provider,
+		EventType:  notice.EventType,
+		EventID:    notice.EventID,
+		DetectedAt: notice.DetectedAt,
+		Simulated:  notice.Simulated,
+		Raw:        notice.Raw,
+	}
+	if !notice.Deadline.IsZero() {
+		payload.Deadline = &notice.Deadline
+	}
+	return json.Marshal(payload)
+}
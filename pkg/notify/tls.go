@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// tlsVersions are the TLS versions that can be set as minimum version
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSOptions configures a TLS connection, e.g. to a notification sink
+type TLSOptions struct {
+	// CAFile is a PEM bundle used to verify the server, the system roots are used if empty
+	CAFile string
+	// CertFile and KeyFile are a PEM client certificate and key presented to the server
+	CertFile string
+	KeyFile  string
+	// MinVersion is the minimum TLS version accepted, e.g. 1.3. TLS 1.2 is used if empty.
+	MinVersion string
+}
+
+// TLSConfig builds a tls.Config from the options
+func (o TLSOptions) TLSConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if o.MinVersion != "" {
+		version, ok := tlsVersions[o.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid minimum TLS version %q, must be one of 1.0, 1.1, 1.2 or 1.3", o.MinVersion)
+		}
+		config.MinVersion = version
+	}
+
+	if o.CAFile != "" {
+		caBytes, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file %q: %w", o.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("no certificates found in CA file %q", o.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// HTTPClient returns an HTTP client with the timeout that uses the options for HTTPS connections
+func (o TLSOptions) HTTPClient(timeout time.Duration) (*http.Client, error) {
+	tlsConfig, err := o.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}, nil
+}
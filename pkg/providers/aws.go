@@ -0,0 +1,61 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	awsTerminationEndpointPath = "/latest/meta-data/spot/termination-time"
+
+	// awsRebalanceEndpointPath returns the rebalance recommendation once EC2 signals
+	// an elevated risk of the spot instance being interrupted
+	awsRebalanceEndpointPath = "/latest/meta-data/events/recommendations/rebalance"
+
+	// awsSpotTerminationEventType is the event type reported for spot instance interruptions
+	awsSpotTerminationEventType = "SpotInterruption"
+)
+
+// awsAbsentStatuses are the statuses of the instance metadata endpoints while there is no
+// termination notice or rebalance recommendation
+var awsAbsentStatuses = []int{http.StatusNotFound}
+
+// pollAWS checks the termination notice endpoint once and returns the
+// termination notice, or nil if the instance is not marked for termination
+func pollAWS(ctx context.Context, logger logr.Logger, poller *endpointPoller) (*TerminationNotice, error) {
+	statusCode, body, err := poller.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	present, err := poller.checkStatus(statusCode, awsAbsentStatuses)
+	if err != nil {
+		return nil, err
+	}
+	if !present {
+		// Instance not terminated yet
+		logger.V(2).Info("Instance not marked for termination")
+		return nil, nil
+	}
+
+	// Instance marked for termination, the body contains the termination time
+	raw := string(bytes.TrimSpace(body))
+	deadline, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		logger.Error(err, "Could not parse termination time")
+	}
+	return &TerminationNotice{
+		Kind:     awsSpotTerminationEventType,
+		Deadline: poller.localDeadline(deadline),
+		Raw:      raw,
+	}, nil
+}
+
+// checkAWSRebalance checks the response of the rebalance recommendation endpoint, which
+// only responds successfully while a rebalance is recommended
+func checkAWSRebalance(body []byte) (bool, error) {
+	return true, nil
+}
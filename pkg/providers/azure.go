@@ -0,0 +1,174 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// azureTerminationEndpointPath see the following link for more details about the endpoint
+	// https://docs.microsoft.com/en-us/azure/virtual-machines/windows/scheduled-events#endpoint-discovery
+	azureTerminationEndpointPath = "/metadata/scheduledevents?api-version=2019-08-01"
+)
+
+// pollAzure checks the scheduled events endpoint once and returns the
+// termination notice, or nil if the instance is not marked for termination
+func pollAzure(ctx context.Context, logger logr.Logger, poller *endpointPoller) (*TerminationNotice, error) {
+	s := scheduledEvents{}
+	if err := poller.getJSON(ctx, &s); err != nil {
+		return nil, err
+	}
+
+	preempt, deadline := earliestPreemption(logger, s.Events)
+	if preempt == nil {
+		// Instance not terminated yet
+		logger.V(2).Info("Instance not marked for termination")
+		return nil, nil
+	}
+
+	// Instance marked for termination, the raw notice is the preemption event
+	raw, err := json.Marshal(preempt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal preemption event: %w", err)
+	}
+	return &TerminationNotice{
+		Kind:     preemptEventType,
+		Deadline: poller.localDeadline(deadline),
+		EventID:  preempt.EventID,
+		Raw:      string(raw),
+	}, nil
+}
+
+// earliestPreemption returns the preemption event starting first, nil if there is none, and
+// the deadline the actions are driven off: the earliest NotBefore of all events as another
+// event, e.g. a Freeze, can disrupt the instance before it is preempted. The deadline is zero
+// once the preemption has started, NotBefore is then empty.
+func earliestPreemption(logger logr.Logger, scheduled []events) (*events, time.Time) {
+	var preempt *events
+	var preemptStart, deadline time.Time
+	for i := range scheduled {
+		event := &scheduled[i]
+		var notBefore time.Time
+		if event.NotBefore != "" {
+			var err error
+			notBefore, err = time.Parse(time.RFC1123, event.NotBefore)
+			if err != nil {
+				// Handled like a started event, the deadline is unknown
+				logger.Error(err, "Could not parse event NotBefore time", "eventID", event.EventID, "eventType", event.EventType)
+			}
+		}
+
+		if event.EventType == preemptEventType {
+			// A started preemption comes first, its NotBefore is zero
+			if preempt == nil || (!preemptStart.IsZero() && notBefore.Before(preemptStart)) {
+				preempt, preemptStart = event, notBefore
+			}
+		}
+		if !notBefore.IsZero() && (deadline.IsZero() || notBefore.Before(deadline)) {
+			deadline = notBefore
+		}
+	}
+
+	if preempt == nil || preemptStart.IsZero() {
+		return preempt, time.Time{}
+	}
+	return preempt, deadline
+}
+
+// pollAzureMaintenance checks the scheduled events endpoint once and returns the deferrable
+// notice of the reboot or redeploy scheduled for the instance, nil if there is none
+func pollAzureMaintenance(ctx context.Context, logger logr.Logger, poller *endpointPoller) (*TerminationNotice, error) {
+	s := scheduledEvents{}
+	if err := poller.getJSON(ctx, &s); err != nil {
+		return nil, err
+	}
+	maintenance, notBefore := earliestMaintenance(logger, s.Events)
+	if maintenance == nil {
+		logger.V(2).Info("No maintenance scheduled")
+		return nil, nil
+	}
+	return maintenanceNotice(poller, maintenance, notBefore)
+}
+
+// maintenanceNotice returns the deferrable notice of the scheduled maintenance event, which
+// disrupts the instance at notBefore
+func maintenanceNotice(poller *endpointPoller, maintenance *events, notBefore time.Time) (*TerminationNotice, error) {
+	raw, err := json.Marshal(maintenance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal maintenance event: %w", err)
+	}
+	return &TerminationNotice{
+		Kind:       maintenance.EventType,
+		Deadline:   poller.localDeadline(notBefore),
+		EventID:    maintenance.EventID,
+		Raw:        string(raw),
+		Deferrable: true,
+	}, nil
+}
+
+// earliestMaintenance returns the reboot or redeploy event starting first, nil if there is
+// none, and its NotBefore time, zero once it has started
+func earliestMaintenance(logger logr.Logger, scheduled []events) (*events, time.Time) {
+	var maintenance *events
+	var start time.Time
+	for i := range scheduled {
+		event := &scheduled[i]
+		if !azureMaintenanceEventTypes[event.EventType] {
+			continue
+		}
+		var notBefore time.Time
+		if event.NotBefore != "" {
+			var err error
+			notBefore, err = time.Parse(time.RFC1123, event.NotBefore)
+			if err != nil {
+				logger.Error(err, "Could not parse event NotBefore time", "eventID", event.EventID, "eventType", event.EventType)
+			}
+		}
+		// A started event comes first, its NotBefore is zero
+		if maintenance == nil || (!start.IsZero() && notBefore.Before(start)) {
+			maintenance, start = event, notBefore
+		}
+	}
+	return maintenance, start
+}
+
+const preemptEventType = "Preempt"
+
+// azureMaintenanceEventTypes are the event types of scheduled maintenance reported as
+// deferrable notices. Freezes only pause the instance for seconds and are not reported.
+var azureMaintenanceEventTypes = map[string]bool{
+	"Reboot":   true,
+	"Redeploy": true,
+}
+
+// scheduledEvents represents metadata response, more detailed info can be found here:
+// https://docs.microsoft.com/en-us/azure/virtual-machines/linux/scheduled-events#use-the-api
+type scheduledEvents struct {
+	Events []events `json:"Events"`
+}
+
+type events struct {
+	EventID   string `json:"EventId"`
+	EventType string `json:"EventType"`
+	NotBefore string `json:"NotBefore"`
+}
+
+// checkAzureScheduledEvents checks whether the scheduled events response contains
+// maintenance other than a preemption, e.g. a reboot or redeploy
+func checkAzureScheduledEvents(body []byte) (bool, error) {
+	s := scheduledEvents{}
+	if err := json.Unmarshal(body, &s); err != nil {
+		return false, fmt.Errorf("failed to unmarshal responce body: %w", err)
+	}
+
+	for _, event := range s.Events {
+		if event.EventType != preemptEventType {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,99 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func BenchmarkPollAWS(b *testing.B) {
+	for _, bc := range []struct {
+		name       string
+		statusCode int
+		body       string
+	}{
+		{name: "no notice", statusCode: http.StatusNotFound, body: "<html><h1>404 - Not Found</h1></html>"},
+		{name: "notice", statusCode: http.StatusOK, body: "2020-10-26T15:57:00Z"},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			benchmarkPoll(b, pollAWS, awsTerminationEndpointPath, bc.statusCode, []byte(bc.body))
+		})
+	}
+}
+
+func BenchmarkPollAzure(b *testing.B) {
+	// Large payloads list many events, only the last being the preemption
+	for _, events := range []int{0, 1, 10, 1000} {
+		body := azureEventsBody(events)
+		b.Run(fmt.Sprintf("%d events", events), func(b *testing.B) {
+			benchmarkPoll(b, pollAzure, azureTerminationEndpointPath, http.StatusOK, body)
+		})
+	}
+}
+
+func BenchmarkPollGCP(b *testing.B) {
+	for _, body := range []string{"FALSE", "TRUE"} {
+		b.Run(body, func(b *testing.B) {
+			benchmarkPoll(b, pollGCP, gcpTerminationEndpointPath, http.StatusOK, []byte(body))
+		})
+	}
+}
+
+func BenchmarkCheckAzureScheduledEvents(b *testing.B) {
+	for _, events := range []int{1, 1000} {
+		body := azureEventsBody(events)
+		b.Run(fmt.Sprintf("%d events", events), func(b *testing.B) {
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := checkAzureScheduledEvents(body); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// benchmarkPoll polls a static response with poll, which covers the request, reading the body
+// into the reused buffer and parsing it, without the network
+func benchmarkPoll(b *testing.B, poll pollFunc, path string, statusCode int, body []byte) {
+	poller := newStaticPoller(b, "", path, statusCode, body)
+	ctx := context.Background()
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := poll(ctx, testLogger, poller); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// azureEventsBody returns a scheduled events response with count events, the last of which is
+// a preemption
+func azureEventsBody(count int) []byte {
+	scheduled := struct {
+		DocumentIncarnation int
+		Events              []events
+	}{DocumentIncarnation: count, Events: []events{}}
+	notBefore := time.Date(2020, 10, 26, 15, 57, 0, 0, time.UTC)
+	for i := 0; i < count; i++ {
+		eventType := "Freeze"
+		if i == count-1 {
+			eventType = preemptEventType
+		}
+		scheduled.Events = append(scheduled.Events, events{
+			EventID:   fmt.Sprintf("event-%d", i),
+			EventType: eventType,
+			NotBefore: notBefore.Add(time.Duration(i) * time.Second).Format(time.RFC1123),
+		})
+	}
+	body, err := json.Marshal(scheduled)
+	if err != nil {
+		panic(err)
+	}
+	return body
+}
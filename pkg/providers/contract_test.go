@@ -0,0 +1,190 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// contractFixture is a recorded state of the metadata service of a cloud provider, in
+// testdata/contract/<provider>/<state>.json, with the results every implementation of the
+// provider must report for it
+type contractFixture struct {
+	Description string `json:"description"`
+	// Options are the options the provider is constructed with
+	Options struct {
+		ReportMaintenance bool `json:"reportMaintenance"`
+	} `json:"options"`
+	// Responses are the recorded responses by request path, without the query
+	Responses map[string]struct {
+		Status int    `json:"status"`
+		Body   string `json:"body"`
+	} `json:"responses"`
+	Expect struct {
+		Notice   bool   `json:"notice"`
+		Kind     string `json:"kind"`
+		EventID  string `json:"eventID"`
+		Deadline string `json:"deadline"`
+		// EstimatedDeadline is set for providers not reporting the deadline, it must then
+		// be in the future
+		EstimatedDeadline bool `json:"estimatedDeadline"`
+		Advisory          bool `json:"advisory"`
+		PollError         bool `json:"pollError"`
+		AdvisoryError     bool `json:"advisoryError"`
+		// Deferrable is set for notices of scheduled maintenance
+		Deferrable bool `json:"deferrable"`
+	} `json:"expect"`
+}
+
+// contractHeaders are the request headers the metadata services reject requests without
+var contractHeaders = map[string]http.Header{
+	azureProvider: {"Metadata": []string{"true"}},
+	gcpProvider:   {"Metadata-Flavor": []string{"Google"}},
+}
+
+// TestProviderContract replays the recorded responses of every provider through a metadata
+// server and checks the notices and advisories the registered provider reports
+func TestProviderContract(t *testing.T) {
+	for _, provider := range []string{awsProvider, azureProvider, gcpProvider} {
+		paths, err := filepath.Glob(filepath.Join("testdata", "contract", provider, "*.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(paths) == 0 {
+			t.Errorf("no fixtures for provider %s", provider)
+		}
+		for _, path := range paths {
+			provider, path := provider, path
+			t.Run(provider+"/"+filepath.Base(path), func(t *testing.T) {
+				fixture := loadContractFixture(t, path)
+				server := httptest.NewServer(contractHandler(t, provider, fixture))
+				defer server.Close()
+				checkContract(t, provider, fixture, server)
+			})
+		}
+	}
+}
+
+func loadContractFixture(t *testing.T, path string) *contractFixture {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture := &contractFixture{}
+	if err := json.Unmarshal(data, fixture); err != nil {
+		t.Fatalf("invalid fixture %s: %v", path, err)
+	}
+	return fixture
+}
+
+// contractHandler serves the recorded responses of fixture, rejecting requests without the
+// headers of the provider like its metadata service
+func contractHandler(t *testing.T, provider string, fixture *contractFixture) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, values := range contractHeaders[provider] {
+			if r.Header.Get(name) != values[0] {
+				t.Errorf("request to %s without the header %s: %s", r.URL.Path, name, values[0])
+				http.Error(w, "missing header "+name, http.StatusBadRequest)
+				return
+			}
+		}
+		response, ok := fixture.Responses[r.URL.Path]
+		if !ok {
+			t.Errorf("request to %s, which is not recorded", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		if provider == gcpProvider {
+			w.Header().Set("Metadata-Flavor", "Google")
+		}
+		w.WriteHeader(response.Status)
+		w.Write([]byte(response.Body))
+	})
+}
+
+func checkContract(t *testing.T, provider string, fixture *contractFixture, server *httptest.Server) {
+	p, err := New(provider, Options{
+		NodeName:          "node",
+		HTTPClient:        server.Client(),
+		MetadataURL:       server.URL,
+		ReportMaintenance: fixture.Options.ReportMaintenance,
+	})
+	if err != nil {
+		t.Fatalf("constructing provider: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	expect := fixture.Expect
+
+	before := time.Now()
+	notice, err := p.Poll(ctx, testLogger)
+	switch {
+	case expect.PollError:
+		if err == nil {
+			t.Errorf("poll reported %+v, want an error", notice)
+		}
+	case err != nil:
+		t.Errorf("poll failed: %v", err)
+	case expect.Notice != (notice != nil):
+		t.Errorf("poll reported the notice %+v, want a notice %v", notice, expect.Notice)
+	case notice != nil:
+		kind := notice.Kind
+		if kind == "" {
+			kind = p.EventType()
+		}
+		if kind != expect.Kind {
+			t.Errorf("notice kind %q, want %q", kind, expect.Kind)
+		}
+		if notice.EventID != expect.EventID {
+			t.Errorf("notice event ID %q, want %q", notice.EventID, expect.EventID)
+		}
+		if notice.Raw == "" {
+			t.Error("notice without the raw event")
+		}
+		checkContractDeadline(t, notice.Deadline, expect.Deadline, expect.EstimatedDeadline, before)
+		if notice.Deferrable != expect.Deferrable {
+			t.Errorf("notice deferrable %v, want %v", notice.Deferrable, expect.Deferrable)
+		}
+	}
+
+	advisory, err := p.CheckAdvisory(ctx)
+	switch {
+	case expect.AdvisoryError:
+		if err == nil {
+			t.Errorf("advisory check reported %v, want an error", advisory)
+		}
+	case err != nil:
+		t.Errorf("advisory check failed: %v", err)
+	case advisory != expect.Advisory:
+		t.Errorf("advisory %v, want %v", advisory, expect.Advisory)
+	}
+}
+
+func checkContractDeadline(t *testing.T, deadline time.Time, want string, estimated bool, before time.Time) {
+	t.Helper()
+	if estimated {
+		if !deadline.After(before) {
+			t.Errorf("estimated deadline %v is not in the future", deadline)
+		}
+		return
+	}
+	if want == "" {
+		if !deadline.IsZero() {
+			t.Errorf("deadline %v, want none", deadline)
+		}
+		return
+	}
+	wantDeadline, err := time.Parse(time.RFC3339, want)
+	if err != nil {
+		t.Fatalf("invalid expected deadline %q: %v", want, err)
+	}
+	if !deadline.Equal(wantDeadline) {
+		t.Errorf("deadline %v, want %v", deadline, wantDeadline)
+	}
+}
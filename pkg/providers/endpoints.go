@@ -0,0 +1,129 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	azureProvider = "azure"
+	awsProvider   = "aws"
+	gcpProvider   = "gcp"
+
+	// defaultMetadataURL is the base URL of the instance metadata service of every supported cloud provider
+	defaultMetadataURL = "http://169.254.169.254"
+)
+
+// pollFunc checks the termination notice endpoint of a cloud provider once
+type pollFunc func(ctx context.Context, logger logr.Logger, poller *endpointPoller) (*TerminationNotice, error)
+
+// advisoryFunc checks the body of a successful response of the advisory endpoint of a cloud
+// provider, reporting whether the provider signals that a termination is likely soon
+type advisoryFunc func(body []byte) (bool, error)
+
+// providerEndpoint describes the metadata endpoints of a built-in cloud provider, the
+// functions checking their responses and the event type of its termination notices
+type providerEndpoint struct {
+	terminationPath string
+	advisoryPath    string
+	header          http.Header
+	poll            pollFunc
+	advisory        advisoryFunc
+	eventType       string
+	// absentStatuses are the statuses other than 200 the endpoints respond with when there
+	// is nothing to report, see endpointPoller.checkStatus
+	absentStatuses []int
+	// maintenance polls the advisory endpoint for scheduled maintenance while there is no
+	// termination notice, it is only called if Options.ReportMaintenance is set
+	maintenance pollFunc
+}
+
+// factory returns the Factory of the cloud provider with the endpoint, registered as name
+func (e providerEndpoint) factory(name string) Factory {
+	return func(opts Options) (Provider, error) {
+		poller, err := newEndpointPoller(opts.HTTPClient, name, metadataEndpoint(opts.MetadataURL, e.terminationPath), e.header)
+		if err != nil {
+			return nil, err
+		}
+		poller.skewAllowance = opts.ClockSkewAllowance
+		// Failures of the advisory endpoint are not recorded as poll failures
+		advisoryPoller, err := newEndpointPoller(opts.HTTPClient, "", metadataEndpoint(opts.MetadataURL, e.advisoryPath), e.header)
+		if err != nil {
+			return nil, err
+		}
+		return &metadataProvider{endpoint: e, poller: poller, advisoryPoller: advisoryPoller, reportMaintenance: opts.ReportMaintenance}, nil
+	}
+}
+
+// metadataProvider is the Provider of a built-in cloud provider
+type metadataProvider struct {
+	endpoint          providerEndpoint
+	poller            *endpointPoller
+	advisoryPoller    *endpointPoller
+	reportMaintenance bool
+}
+
+func (p *metadataProvider) Poll(ctx context.Context, logger logr.Logger) (*TerminationNotice, error) {
+	notice, err := p.endpoint.poll(ctx, logger, p.poller)
+	if notice != nil || err != nil || !p.reportMaintenance || p.endpoint.maintenance == nil {
+		return notice, err
+	}
+	return p.endpoint.maintenance(ctx, logger, p.advisoryPoller)
+}
+
+func (p *metadataProvider) CheckAdvisory(ctx context.Context) (bool, error) {
+	statusCode, body, err := p.advisoryPoller.get(ctx)
+	if err != nil {
+		return false, err
+	}
+	signalled, err := p.advisoryPoller.checkStatus(statusCode, p.endpoint.absentStatuses)
+	if err != nil || !signalled {
+		return false, err
+	}
+	return p.endpoint.advisory(body)
+}
+
+func (p *metadataProvider) EventType() string {
+	return p.endpoint.eventType
+}
+
+func init() {
+	Register(awsProvider, providerEndpoint{
+		terminationPath: awsTerminationEndpointPath,
+		advisoryPath:    awsRebalanceEndpointPath,
+		poll:            pollAWS,
+		advisory:        checkAWSRebalance,
+		eventType:       awsSpotTerminationEventType,
+		absentStatuses:  awsAbsentStatuses,
+	}.factory(awsProvider))
+	Register(azureProvider, providerEndpoint{
+		terminationPath: azureTerminationEndpointPath,
+		advisoryPath:    azureTerminationEndpointPath,
+		header:          http.Header{"Metadata": []string{"true"}},
+		poll:            pollAzure,
+		advisory:        checkAzureScheduledEvents,
+		maintenance:     pollAzureMaintenance,
+		eventType:       preemptEventType,
+	}.factory(azureProvider))
+	Register(gcpProvider, providerEndpoint{
+		terminationPath: gcpTerminationEndpointPath,
+		advisoryPath:    gcpMaintenanceEventEndpointPath,
+		header:          http.Header{"Metadata-Flavor": []string{"Google"}},
+		poll:            pollGCP,
+		advisory:        checkGCPMaintenanceEvent,
+		maintenance:     pollGCPMaintenance,
+		eventType:       gcpPreemptionEventType,
+	}.factory(gcpProvider))
+}
+
+// metadataEndpoint returns the URL of the metadata endpoint at path,
+// relative to metadataURL or the default metadata URL if it is empty
+func metadataEndpoint(metadataURL, path string) string {
+	if metadataURL == "" {
+		metadataURL = defaultMetadataURL
+	}
+	return strings.TrimSuffix(metadataURL, "/") + path
+}
@@ -0,0 +1,61 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Errors returned by the providers, they are matched with errors.Is as they are usually wrapped
+var (
+	// ErrMetadataUnreachable matches the errors of requests to a metadata endpoint that got no response
+	ErrMetadataUnreachable = errors.New("metadata endpoint unreachable")
+	// ErrUnsupported matches the errors of a cloud provider that is not registered
+	ErrUnsupported = errors.New("cloud provider not supported")
+)
+
+// UnexpectedStatusError is returned when a metadata endpoint responds with an unexpected status.
+// RetryAfter is the delay a throttling endpoint asked for with the Retry-After header, if any.
+type UnexpectedStatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *UnexpectedStatusError) Error() string {
+	return fmt.Sprintf("unexpected status: %d", e.StatusCode)
+}
+
+// MetadataUnreachableError is returned when a request to a metadata endpoint got no response,
+// Err is the error returned by the HTTP client. It matches ErrMetadataUnreachable.
+type MetadataUnreachableError struct {
+	URL string
+	Err error
+}
+
+func (e *MetadataUnreachableError) Error() string {
+	return fmt.Sprintf("could not get URL %q: %v", e.URL, e.Err)
+}
+
+func (e *MetadataUnreachableError) Unwrap() error {
+	return e.Err
+}
+
+func (e *MetadataUnreachableError) Is(target error) bool {
+	return target == ErrMetadataUnreachable
+}
+
+// UnsupportedError is returned for a cloud provider that is not registered, Supported
+// are the names of the registered providers. It matches ErrUnsupported.
+type UnsupportedError struct {
+	Provider  string
+	Supported []string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("cloud provider %q not supported, must be one of %s", e.Provider, strings.Join(e.Supported, ", "))
+}
+
+func (e *UnsupportedError) Is(target error) bool {
+	return target == ErrUnsupported
+}
@@ -0,0 +1,198 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/metrics"
+	"github.com/go-logr/logr"
+)
+
+// ExecName is the name of the provider polling an external plugin command, it is
+// registered by the binary once a plugin is configured
+const ExecName = "exec"
+
+// ExecProtocolVersion is the version of the exec provider protocol sent in every request
+const ExecProtocolVersion = "v1"
+
+// maxPluginStderrSize bounds the stderr of the plugin kept for error messages
+const maxPluginStderrSize = 4 << 10
+
+// Types of the requests sent to an exec provider plugin
+const (
+	// ExecRequestPoll asks whether the instance is marked for termination
+	ExecRequestPoll = "poll"
+	// ExecRequestAdvisory asks whether a termination is likely soon
+	ExecRequestAdvisory = "advisory"
+	// ExecRequestFleetPoll asks which of the instances of ProviderIDs are marked for
+	// termination, it is sent by central handlers
+	ExecRequestFleetPoll = "fleetPoll"
+)
+
+// ExecRequest is written as JSON to the stdin of the plugin command, which is run once per
+// request. The plugin answers with an ExecResponse on stdout and exits with status 0.
+type ExecRequest struct {
+	Version     string   `json:"version"`
+	Type        string   `json:"type"`
+	NodeName    string   `json:"nodeName"`
+	ProviderIDs []string `json:"providerIDs,omitempty"`
+}
+
+// ExecResponse is the answer of the plugin. Error reports a failed check, it is retried
+// like a failed request to a metadata service.
+type ExecResponse struct {
+	// Notice is set in the answer to a poll request if the instance is marked for termination
+	Notice *ExecNotice `json:"notice,omitempty"`
+	// Notices holds the notices of the instances marked for termination in the answer to a
+	// fleet poll request, keyed by the provider IDs of the request
+	Notices map[string]*ExecNotice `json:"notices,omitempty"`
+	// Advisory is set in the answer to an advisory request if a termination is likely soon
+	Advisory bool   `json:"advisory,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ExecNotice is a termination notice reported by the plugin, the event type configured for
+// the provider is used if EventType is empty. Raw is passed on as the raw notice.
+type ExecNotice struct {
+	EventType string          `json:"eventType,omitempty"`
+	EventID   string          `json:"eventID,omitempty"`
+	Deadline  *time.Time      `json:"deadline,omitempty"`
+	Raw       json.RawMessage `json:"raw,omitempty"`
+}
+
+// terminationNotice returns the TerminationNotice of n
+func (n *ExecNotice) terminationNotice() *TerminationNotice {
+	notice := &TerminationNotice{
+		Kind:    n.EventType,
+		EventID: n.EventID,
+		Raw:     string(n.Raw),
+	}
+	if n.Deadline != nil {
+		notice.Deadline = *n.Deadline
+	}
+	return notice
+}
+
+// execProvider polls an external plugin command for termination notices
+type execProvider struct {
+	nodeName  string
+	command   string
+	args      []string
+	eventType string
+}
+
+// NewExecFactory returns the factory of the exec provider running command with args,
+// eventType is reported for notices that do not have one. The command must exist when the
+// provider is constructed.
+func NewExecFactory(command string, args []string, eventType string) Factory {
+	return func(opts Options) (Provider, error) {
+		if _, err := exec.LookPath(command); err != nil {
+			return nil, fmt.Errorf("invalid exec provider command: %w", err)
+		}
+		return &execProvider{nodeName: opts.NodeName, command: command, args: args, eventType: eventType}, nil
+	}
+}
+
+// NewExecFleet returns a FleetProvider running command with args, which is sent fleet poll
+// requests. eventType is reported for notices that do not have one.
+func NewExecFleet(command string, args []string, eventType string) (FleetProvider, error) {
+	if _, err := exec.LookPath(command); err != nil {
+		return nil, fmt.Errorf("invalid exec provider command: %w", err)
+	}
+	return &execProvider{command: command, args: args, eventType: eventType}, nil
+}
+
+func (p *execProvider) Poll(ctx context.Context, logger logr.Logger) (*TerminationNotice, error) {
+	resp, err := p.run(ctx, ExecRequest{Version: ExecProtocolVersion, Type: ExecRequestPoll, NodeName: p.nodeName})
+	if err != nil {
+		metrics.RecordPollFailure(ExecName, statusClass(0), pollFailurePlugin)
+		return nil, err
+	}
+	if resp.Notice == nil {
+		logger.V(2).Info("Instance not marked for termination")
+		return nil, nil
+	}
+
+	return resp.Notice.terminationNotice(), nil
+}
+
+func (p *execProvider) PollFleet(ctx context.Context, logger logr.Logger, providerIDs []string) (map[string]*TerminationNotice, error) {
+	resp, err := p.run(ctx, ExecRequest{Version: ExecProtocolVersion, Type: ExecRequestFleetPoll, ProviderIDs: providerIDs})
+	if err != nil {
+		metrics.RecordPollFailure(ExecName, statusClass(0), pollFailurePlugin)
+		return nil, err
+	}
+
+	notices := make(map[string]*TerminationNotice, len(resp.Notices))
+	for providerID, notice := range resp.Notices {
+		if notice != nil {
+			notices[providerID] = notice.terminationNotice()
+		}
+	}
+	logger.V(2).Info("Polled instances for termination notices", "instances", len(providerIDs), "notices", len(notices))
+	return notices, nil
+}
+
+func (p *execProvider) CheckAdvisory(ctx context.Context) (bool, error) {
+	resp, err := p.run(ctx, ExecRequest{Version: ExecProtocolVersion, Type: ExecRequestAdvisory})
+	if err != nil {
+		return false, err
+	}
+	return resp.Advisory, nil
+}
+
+func (p *execProvider) EventType() string {
+	return p.eventType
+}
+
+// run runs the plugin command once with request on stdin and decodes its response. The
+// command is killed once ctx is done.
+func (p *execProvider) run(ctx context.Context, request ExecRequest) (*ExecResponse, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling plugin request: %w", err)
+	}
+
+	stdout := &limitedBuffer{limit: maxResponseSize}
+	stderr := &limitedBuffer{limit: maxPluginStderrSize}
+	cmd := exec.CommandContext(ctx, p.command, p.args...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error running plugin %q: %w, stderr: %s", p.command, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if stdout.truncated {
+		return nil, fmt.Errorf("response of plugin %q exceeds %d bytes", p.command, maxResponseSize)
+	}
+
+	resp := &ExecResponse{}
+	if err := json.Unmarshal(stdout.Bytes(), resp); err != nil {
+		return nil, fmt.Errorf("error decoding response of plugin %q: %w", p.command, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("plugin %q failed: %s", p.command, resp.Error)
+	}
+	return resp, nil
+}
+
+// limitedBuffer is a bytes.Buffer discarding what is written beyond limit, so the output of
+// a misbehaving plugin can not exhaust the memory of the handler
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.truncated = true
+		b.Buffer.Write(p[:room])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,53 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/alexander-demichev/termination-handler/pkg/metrics"
+)
+
+// Kinds of poll failures reported in metrics
+const (
+	pollFailureTimeout    = "timeout"
+	pollFailureDNS        = "dns"
+	pollFailureConnection = "connection"
+	pollFailureRead       = "read"
+	pollFailureUnmarshal  = "unmarshal"
+	pollFailureStatus     = "unexpected_status"
+	pollFailurePlugin     = "plugin"
+)
+
+// recordRequestFailure records a poll failure caused by an error returned by the HTTP client
+func recordRequestFailure(provider string, err error) {
+	metrics.RecordPollFailure(provider, statusClass(0), requestFailureKind(err))
+}
+
+// recordResponseFailure records a poll failure that happened after a response was received
+func recordResponseFailure(provider string, statusCode int, kind string) {
+	metrics.RecordPollFailure(provider, statusClass(statusCode), kind)
+}
+
+// requestFailureKind classifies an error returned by the HTTP client
+func requestFailureKind(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return pollFailureDNS
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return pollFailureTimeout
+	}
+
+	return pollFailureConnection
+}
+
+// statusClass returns the class of an HTTP status code, e.g. 5xx
+func statusClass(statusCode int) string {
+	if statusCode == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%dxx", statusCode/100)
+}
@@ -0,0 +1,20 @@
+package providers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+)
+
+// FleetProvider polls the API of a cloud provider, rather than the metadata service of an
+// instance, for the termination notices of many instances at once, so a single central
+// handler covers every node of a cluster. Instances are identified by the provider ID of
+// their node, e.g. aws:///us-east-1a/i-0123456789abcdef0. The only implementation is the
+// exec provider, NewExecFleet, whose plugin is supplied by the user.
+type FleetProvider interface {
+	// PollFleet returns the termination notices of the instances among providerIDs that are
+	// marked for termination, keyed by provider ID. The request is aborted once ctx is done.
+	PollFleet(ctx context.Context, logger logr.Logger, providerIDs []string) (map[string]*TerminationNotice, error)
+	// EventType returns the event type reported for the termination notices of the provider
+	EventType() string
+}
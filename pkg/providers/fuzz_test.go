@@ -0,0 +1,236 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// The metadata endpoints are link-local and answer under time pressure, so their responses are
+// parsed without trusting them: whatever the status and the body, polling must not panic and
+// must report either nothing, a notice or an error.
+
+// fuzzStatus restricts fuzzed status codes to those a server can send
+func fuzzStatus(t *testing.T, statusCode int) {
+	if statusCode < 100 || statusCode > 599 {
+		t.Skip()
+	}
+}
+
+func FuzzPollAWS(f *testing.F) {
+	f.Add(http.StatusOK, []byte("2020-09-01T10:00:00Z"))
+	f.Add(http.StatusOK, []byte(" 2020-09-01T10:00:00Z\n"))
+	f.Add(http.StatusOK, []byte("2020-09-01T10:00:00+02:00"))
+	f.Add(http.StatusOK, []byte("not a time"))
+	f.Add(http.StatusOK, []byte(""))
+	f.Add(http.StatusNotFound, []byte("<html>Not Found</html>"))
+	f.Add(http.StatusTooManyRequests, []byte(""))
+	f.Add(http.StatusInternalServerError, []byte("error"))
+
+	f.Fuzz(func(t *testing.T, statusCode int, body []byte) {
+		fuzzStatus(t, statusCode)
+		poller := newStaticPoller(t, "", awsTerminationEndpointPath, statusCode, body)
+		notice, err := pollAWS(context.Background(), testLogger, poller)
+		checkPollResult(t, statusCode, []int{http.StatusNotFound}, notice, err)
+		if notice == nil {
+			return
+		}
+		if notice.Kind != awsSpotTerminationEventType {
+			t.Errorf("notice kind %q, want %q", notice.Kind, awsSpotTerminationEventType)
+		}
+		if raw := string(bytes.TrimSpace(body)); notice.Raw != raw {
+			t.Errorf("raw notice %q, want %q", notice.Raw, raw)
+		}
+		if deadline, err := time.Parse(time.RFC3339, notice.Raw); err == nil && !notice.Deadline.Equal(deadline) {
+			t.Errorf("deadline %v, want %v", notice.Deadline, deadline)
+		}
+	})
+}
+
+func FuzzPollAzure(f *testing.F) {
+	f.Add(http.StatusOK, []byte(`{"DocumentIncarnation":0,"Events":[]}`))
+	f.Add(http.StatusOK, []byte(`{"Events":[{"EventId":"a","EventType":"Preempt","NotBefore":"Tue, 01 Sep 2020 10:00:00 GMT"}]}`))
+	f.Add(http.StatusOK, []byte(`{"Events":[{"EventId":"a","EventType":"Preempt","NotBefore":""}]}`))
+	f.Add(http.StatusOK, []byte(`{"Events":[{"EventId":"a","EventType":"Freeze","NotBefore":"Tue, 01 Sep 2020 09:59:00 GMT"},{"EventId":"b","EventType":"Preempt","NotBefore":"Tue, 01 Sep 2020 10:00:00 GMT"}]}`))
+	f.Add(http.StatusOK, []byte(`{"Events":[{"EventType":"Preempt","NotBefore":"tomorrow"}]}`))
+	f.Add(http.StatusOK, []byte(`{"Events":null}`))
+	f.Add(http.StatusOK, []byte(`null`))
+	f.Add(http.StatusOK, []byte(`{"Events":[`))
+	f.Add(http.StatusOK, []byte(`{"Events":[]} {"Events":[]}`))
+	f.Add(http.StatusServiceUnavailable, []byte(""))
+
+	f.Fuzz(func(t *testing.T, statusCode int, body []byte) {
+		fuzzStatus(t, statusCode)
+		poller := newStaticPoller(t, "", azureTerminationEndpointPath, statusCode, body)
+		notice, err := pollAzure(context.Background(), testLogger, poller)
+		checkPollResult(t, statusCode, nil, notice, err)
+		if statusCode == http.StatusOK && json.Unmarshal(body, &scheduledEvents{}) != nil && err == nil {
+			t.Errorf("invalid scheduled events %q accepted", body)
+		}
+		if notice == nil {
+			return
+		}
+		if notice.Kind != preemptEventType {
+			t.Errorf("notice kind %q, want %q", notice.Kind, preemptEventType)
+		}
+		event := events{}
+		if err := json.Unmarshal([]byte(notice.Raw), &event); err != nil {
+			t.Fatalf("raw notice %q is not an event: %v", notice.Raw, err)
+		}
+		if event.EventType != preemptEventType || event.EventID != notice.EventID {
+			t.Errorf("raw notice %q does not match the notice %+v", notice.Raw, notice)
+		}
+	})
+}
+
+func FuzzPollGCP(f *testing.F) {
+	f.Add(http.StatusOK, []byte("TRUE"))
+	f.Add(http.StatusOK, []byte("FALSE"))
+	f.Add(http.StatusOK, []byte("TRUE\n"))
+	f.Add(http.StatusOK, []byte(""))
+	f.Add(http.StatusForbidden, []byte("Metadata-Flavor header required"))
+
+	f.Fuzz(func(t *testing.T, statusCode int, body []byte) {
+		fuzzStatus(t, statusCode)
+		poller := newStaticPoller(t, "", gcpTerminationEndpointPath, statusCode, body)
+		before := time.Now()
+		notice, err := pollGCP(context.Background(), testLogger, poller)
+		checkPollResult(t, statusCode, nil, notice, err)
+		preempted := statusCode == http.StatusOK && bytes.Equal(body, gcpPreemptedValue)
+		if preempted != (notice != nil) {
+			t.Errorf("notice %+v for status %d and body %q", notice, statusCode, body)
+		}
+		if notice != nil && notice.Deadline.Before(before.Add(gcpPreemptionNotice)) {
+			t.Errorf("deadline %v is earlier than the preemption notice period", notice.Deadline)
+		}
+	})
+}
+
+// checkPollResult checks the invariants every poll function holds: notices are only reported
+// for 200 responses, absent statuses report nothing and other statuses are UnexpectedStatusErrors
+func checkPollResult(t *testing.T, statusCode int, absent []int, notice *TerminationNotice, err error) {
+	t.Helper()
+	if notice != nil && err != nil {
+		t.Fatalf("got both the notice %+v and the error %v", notice, err)
+	}
+	if notice != nil && statusCode != http.StatusOK {
+		t.Errorf("notice %+v for status %d", notice, statusCode)
+	}
+	for _, status := range absent {
+		if statusCode == status && (notice != nil || err != nil) {
+			t.Errorf("absent status %d reported the notice %+v and the error %v", statusCode, notice, err)
+		}
+	}
+	statusErr := &UnexpectedStatusError{}
+	if errors.As(err, &statusErr) && statusErr.StatusCode != statusCode {
+		t.Errorf("error reports status %d, want %d", statusErr.StatusCode, statusCode)
+	}
+	if statusCode != http.StatusOK && !containsStatus(absent, statusCode) && !errors.As(err, &statusErr) {
+		t.Errorf("status %d reported %v, want an UnexpectedStatusError", statusCode, err)
+	}
+}
+
+func containsStatus(statuses []int, statusCode int) bool {
+	for _, status := range statuses {
+		if status == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func FuzzEarliestPreemption(f *testing.F) {
+	f.Add([]byte(`[{"EventId":"a","EventType":"Preempt","NotBefore":"Tue, 01 Sep 2020 10:00:00 GMT"}]`))
+	f.Add([]byte(`[{"EventId":"a","EventType":"Preempt","NotBefore":""}]`))
+	f.Add([]byte(`[{"EventId":"a","EventType":"Preempt","NotBefore":"Tue, 01 Sep 2020 10:00:00 GMT"},{"EventId":"b","EventType":"Preempt","NotBefore":"Tue, 01 Sep 2020 09:00:00 GMT"}]`))
+	f.Add([]byte(`[{"EventId":"a","EventType":"Freeze","NotBefore":"Tue, 01 Sep 2020 09:00:00 GMT"},{"EventId":"b","EventType":"Preempt","NotBefore":"Tue, 01 Sep 2020 10:00:00 GMT"}]`))
+	f.Add([]byte(`[{"EventId":"a","EventType":"Reboot","NotBefore":"Tue, 01 Sep 2020 09:00:00 GMT"}]`))
+	f.Add([]byte(`[{"EventType":"Preempt","NotBefore":"2020-09-01T10:00:00Z"}]`))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		var scheduled []events
+		if err := json.Unmarshal(body, &scheduled); err != nil {
+			t.Skip()
+		}
+		preempt, deadline := earliestPreemption(testLogger, scheduled)
+
+		var earliest time.Time
+		started := false
+		hasPreempt := false
+		for _, event := range scheduled {
+			notBefore, err := time.Parse(time.RFC1123, event.NotBefore)
+			if event.EventType == preemptEventType {
+				hasPreempt = true
+				if event.NotBefore == "" || err != nil {
+					started = true
+				}
+			}
+			if event.NotBefore != "" && err == nil && (earliest.IsZero() || notBefore.Before(earliest)) {
+				earliest = notBefore
+			}
+		}
+
+		if hasPreempt != (preempt != nil) {
+			t.Fatalf("preemption %+v reported for events %+v", preempt, scheduled)
+		}
+		if preempt == nil {
+			if !deadline.IsZero() {
+				t.Errorf("deadline %v without preemption", deadline)
+			}
+			return
+		}
+		if preempt.EventType != preemptEventType {
+			t.Errorf("event %+v reported as preemption", preempt)
+		}
+		found := false
+		for i := range scheduled {
+			if preempt == &scheduled[i] {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("preemption %+v is not one of the events", preempt)
+		}
+		switch {
+		case started && !deadline.IsZero():
+			t.Errorf("deadline %v for a started preemption", deadline)
+		case !started && !deadline.Equal(earliest):
+			t.Errorf("deadline %v, want the earliest NotBefore %v", deadline, earliest)
+		}
+	})
+}
+
+func FuzzCheckAzureScheduledEvents(f *testing.F) {
+	f.Add([]byte(`{"Events":[]}`))
+	f.Add([]byte(`{"Events":[{"EventType":"Preempt"}]}`))
+	f.Add([]byte(`{"Events":[{"EventType":"Reboot"},{"EventType":"Preempt"}]}`))
+	f.Add([]byte(`{"Events":[{"EventType":"Freeze"}]}`))
+	f.Add([]byte(`{"Events":[{"EventType":""}]}`))
+	f.Add([]byte(`{`))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		advised, err := checkAzureScheduledEvents(body)
+
+		s := scheduledEvents{}
+		if json.Unmarshal(body, &s) != nil {
+			if err == nil || advised {
+				t.Errorf("invalid body %q reported %v, %v", body, advised, err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("valid body %q failed: %v", body, err)
+		}
+		want := false
+		for _, event := range s.Events {
+			want = want || event.EventType != preemptEventType
+		}
+		if advised != want {
+			t.Errorf("advisory %v for %q, want %v", advised, body, want)
+		}
+	})
+}
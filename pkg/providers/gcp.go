@@ -0,0 +1,92 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	gcpTerminationEndpointPath = "/computeMetadata/v1/instance/preempted"
+
+	// gcpMaintenanceEventEndpointPath returns the host maintenance event scheduled for the instance, NONE if there is none
+	gcpMaintenanceEventEndpointPath = "/computeMetadata/v1/instance/maintenance-event"
+
+	// gcpPreemptionNotice is the time between the preemption notice and the instance being stopped,
+	// the metadata server does not expose the deadline so it is estimated from the detection time
+	gcpPreemptionNotice = 30 * time.Second
+
+	// gcpMaintenanceNotice is the time between the maintenance event being reported and the host
+	// maintenance starting, the deadline is estimated from the detection time as well
+	gcpMaintenanceNotice = 60 * time.Second
+
+	// gcpPreemptionEventType is the event type reported for preemptible instances being preempted
+	gcpPreemptionEventType = "Preempted"
+)
+
+// gcpPreemptedValue is the value of the preempted endpoint once the instance is preempted
+var gcpPreemptedValue = []byte("TRUE")
+
+// gcpNoMaintenanceValue is the value of the maintenance event endpoint while no maintenance is scheduled
+var gcpNoMaintenanceValue = []byte("NONE")
+
+// gcpTerminateOnMaintenanceValue is the value of the maintenance event endpoint while host
+// maintenance terminating the instance is scheduled, as opposed to a live migration
+var gcpTerminateOnMaintenanceValue = []byte("TERMINATE_ON_HOST_MAINTENANCE")
+
+// pollGCP checks the preemption endpoint once and returns the
+// termination notice, or nil if the instance is not marked for termination
+func pollGCP(ctx context.Context, logger logr.Logger, poller *endpointPoller) (*TerminationNotice, error) {
+	statusCode, body, err := poller.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := poller.checkStatus(statusCode, nil); err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(body, gcpPreemptedValue) {
+		// Instance marked for termination
+		return &TerminationNotice{
+			Kind:     gcpPreemptionEventType,
+			Deadline: time.Now().Add(gcpPreemptionNotice),
+			Raw:      string(body),
+		}, nil
+	}
+
+	// Instance not terminated yet
+	logger.V(2).Info("Instance not marked for termination")
+	return nil, nil
+}
+
+// pollGCPMaintenance checks the maintenance event endpoint once and returns the deferrable
+// notice of the host maintenance terminating the instance, nil if there is none
+func pollGCPMaintenance(ctx context.Context, logger logr.Logger, poller *endpointPoller) (*TerminationNotice, error) {
+	statusCode, body, err := poller.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := poller.checkStatus(statusCode, nil); err != nil {
+		return nil, err
+	}
+
+	// Live migrations do not stop the instance, only terminations are reported
+	event := bytes.TrimSpace(body)
+	if !bytes.Equal(event, gcpTerminateOnMaintenanceValue) {
+		logger.V(2).Info("No host maintenance terminating the instance scheduled", "event", string(event))
+		return nil, nil
+	}
+	return &TerminationNotice{
+		Kind:       string(event),
+		Deadline:   time.Now().Add(gcpMaintenanceNotice),
+		Raw:        string(body),
+		Deferrable: true,
+	}, nil
+}
+
+// checkGCPMaintenanceEvent checks the response of the maintenance event endpoint
+func checkGCPMaintenanceEvent(body []byte) (bool, error) {
+	return !bytes.Equal(bytes.TrimSpace(body), gcpNoMaintenanceValue), nil
+}
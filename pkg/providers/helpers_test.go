@@ -0,0 +1,46 @@
+package providers
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	logrtesting "github.com/go-logr/logr/testing"
+)
+
+// testLogger discards the logs of the code under test
+var testLogger = logrtesting.NullLogger{}
+
+// staticTransport responds to every request with the same status, header and body without
+// a network round trip, so fuzzing and benchmarks measure the parsing alone
+type staticTransport struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+}
+
+func (t *staticTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	header := t.header
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		StatusCode:    t.statusCode,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(t.body)),
+		ContentLength: int64(len(t.body)),
+		Request:       request,
+	}, nil
+}
+
+// newStaticPoller returns a poller of the endpoint at path receiving statusCode and body
+func newStaticPoller(tb testing.TB, provider, path string, statusCode int, body []byte) *endpointPoller {
+	tb.Helper()
+	client := &http.Client{Transport: &staticTransport{statusCode: statusCode, body: body}}
+	poller, err := newEndpointPoller(client, provider, metadataEndpoint("", path), nil)
+	if err != nil {
+		tb.Fatalf("constructing poller: %v", err)
+	}
+	return poller
+}
@@ -0,0 +1,305 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+)
+
+// maxResponseSize bounds the body read from a metadata endpoint, the responses are small
+// and a misbehaving endpoint must not make the handler buffer an unbounded body
+const maxResponseSize = 1 << 20
+
+// maxRetainedBufferSize bounds the response buffer kept between polls, so a single large
+// response does not pin up to maxResponseSize of memory for the lifetime of the poller
+const maxRetainedBufferSize = 64 << 10
+
+// maxClockOffsetError is the error of the clock offset measured from the Date header of a
+// response, which has a resolution of a second and is set before the response is received.
+// Smaller offsets are not corrected, so deadlines stay stable when the clocks are in sync.
+const maxClockOffsetError = 2 * time.Second
+
+// PollClientOptions configures the HTTP client used to poll the metadata endpoints
+type PollClientOptions struct {
+	// ProxyURL is the proxy requests are sent through, the HTTP_PROXY, HTTPS_PROXY
+	// and NO_PROXY environment variables are used if empty
+	ProxyURL string
+	// Timeout bounds a single request
+	Timeout time.Duration
+	// DialTimeout bounds connecting to the endpoint
+	DialTimeout time.Duration
+	// MaxIdleConns is the number of connections kept open between polls
+	MaxIdleConns int
+	// TLS configures connections to metadata endpoints served over HTTPS
+	TLS notify.TLSOptions
+	// InsecureSkipVerify disables verifying the certificate of metadata endpoints served over HTTPS
+	InsecureSkipVerify bool
+}
+
+// NewPollClient returns the HTTP client used to poll the metadata endpoints. It keeps the
+// connections to the endpoints open between polls, so short poll intervals stay cheap. A
+// dedicated transport is used so other packages changing http.DefaultTransport have no effect.
+func NewPollClient(opts PollClientOptions) (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if opts.ProxyURL != "" {
+		proxyURL, err := url.Parse(opts.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %v", opts.ProxyURL, err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig, err := opts.TLS.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.InsecureSkipVerify = opts.InsecureSkipVerify
+
+	return &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &http.Transport{
+			Proxy: proxy,
+			DialContext: (&net.Dialer{
+				Timeout:   opts.DialTimeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: opts.DialTimeout,
+			// A stalled endpoint must not hold the poll until the overall timeout
+			ResponseHeaderTimeout: opts.Timeout,
+			MaxIdleConns:          opts.MaxIdleConns,
+			MaxIdleConnsPerHost:   opts.MaxIdleConns,
+			IdleConnTimeout:       90 * time.Second,
+			// The responses are tiny, compressing them only costs CPU
+			DisableCompression: true,
+		},
+	}, nil
+}
+
+// endpointPoller polls a metadata endpoint, reusing the request and the response
+// buffer between polls. It must not be used concurrently.
+type endpointPoller struct {
+	client   *http.Client
+	request  *http.Request
+	provider string
+	body     bytes.Buffer
+
+	// clockOffset is the offset of the clock of the metadata service from the local
+	// clock, measured from the last response if clockKnown
+	clockOffset time.Duration
+	clockKnown  bool
+	// skewAllowance returns the allowance for a late local clock used while the offset
+	// is not measured, none if nil
+	skewAllowance func() time.Duration
+	// retryAfter is the delay the last response asked for with the Retry-After header
+	retryAfter time.Duration
+}
+
+// newEndpointPoller constructs a poller sending a GET request with header to endpoint.
+// Failures are recorded in the poll failure metrics of provider, unless it is empty.
+func newEndpointPoller(client *http.Client, provider, endpoint string, header http.Header) (*endpointPoller, error) {
+	pollURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata endpoint %q: %v", endpoint, err)
+	}
+	if pollURL.Scheme != "http" && pollURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid metadata endpoint %q: scheme must be http or https", endpoint)
+	}
+
+	request := &http.Request{
+		Method:     http.MethodGet,
+		URL:        pollURL,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Host:       pollURL.Host,
+	}
+	if request.Header == nil {
+		request.Header = http.Header{}
+	}
+
+	return &endpointPoller{
+		client:   client,
+		request:  request,
+		provider: provider,
+	}, nil
+}
+
+// do sends the request, aborted once ctx is done, and records the clock offset and the
+// Retry-After delay of the response. The caller closes the body.
+func (p *endpointPoller) do(ctx context.Context) (*http.Response, error) {
+	resp, err := p.client.Do(p.request.WithContext(ctx))
+	if err != nil {
+		p.recordRequestFailure(err)
+		return nil, &MetadataUnreachableError{URL: p.request.URL.String(), Err: err}
+	}
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	p.clockKnown = err == nil
+	p.clockOffset = date.Sub(time.Now())
+	p.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	return resp, nil
+}
+
+// get polls the endpoint once and returns the status code and the body of the response, the
+// body is only valid until the next call. Failures are recorded in the poll failure metrics.
+func (p *endpointPoller) get(ctx context.Context) (int, []byte, error) {
+	resp, err := p.do(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	// Reading the whole body also lets the connection be reused for the next poll
+	if p.body.Cap() > maxRetainedBufferSize {
+		p.body = bytes.Buffer{}
+	}
+	p.body.Reset()
+	if _, err := p.body.ReadFrom(io.LimitReader(resp.Body, maxResponseSize+1)); err != nil {
+		p.recordResponseFailure(resp.StatusCode, pollFailureRead)
+		return resp.StatusCode, nil, fmt.Errorf("failed to read responce body: %w", err)
+	}
+	if p.body.Len() > maxResponseSize {
+		p.recordResponseFailure(resp.StatusCode, pollFailureRead)
+		return resp.StatusCode, nil, fmt.Errorf("response body of %q exceeds %d bytes", p.request.URL.String(), maxResponseSize)
+	}
+	return resp.StatusCode, p.body.Bytes(), nil
+}
+
+// getJSON polls the endpoint once and decodes the JSON body of the response into v, streamed
+// from the size-limited body so it is not buffered. Any status but 200 is a poll failure and
+// the body is not decoded. Failures are recorded in the poll failure metrics.
+func (p *endpointPoller) getJSON(ctx context.Context, v interface{}) error {
+	resp, err := p.do(ctx)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body := &io.LimitedReader{R: resp.Body, N: maxResponseSize + 1}
+	// Draining the rest of the body lets the connection be reused for the next poll
+	defer io.Copy(ioutil.Discard, body)
+	if _, err := p.checkStatus(resp.StatusCode, nil); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(body)
+	err = decoder.Decode(v)
+	if err == nil {
+		// Only whitespace may follow the value, as with json.Unmarshal
+		if _, tokenErr := decoder.Token(); tokenErr != io.EOF {
+			err = errTrailingData
+		}
+	}
+	if body.N <= 0 {
+		p.recordResponseFailure(resp.StatusCode, pollFailureRead)
+		return fmt.Errorf("response body of %q exceeds %d bytes", p.request.URL.String(), maxResponseSize)
+	}
+	if err != nil && !isJSONError(err) {
+		p.recordResponseFailure(resp.StatusCode, pollFailureRead)
+		return fmt.Errorf("failed to read responce body: %w", err)
+	}
+	if err != nil {
+		p.recordResponseFailure(resp.StatusCode, pollFailureUnmarshal)
+		return fmt.Errorf("failed to unmarshal responce body: %w", err)
+	}
+	return nil
+}
+
+// errTrailingData is returned by getJSON for a body with data after its JSON value
+var errTrailingData = errors.New("invalid data after the top-level value")
+
+// isJSONError returns whether err, returned by a json.Decoder, is caused by an invalid body
+// rather than by reading it. Read errors are returned as is, a truncated body as an EOF.
+func isJSONError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr) ||
+		err == io.EOF || err == io.ErrUnexpectedEOF || err == errTrailingData
+}
+
+// checkStatus classifies the status of the last response the same way for every provider and
+// returns whether its body holds the state of the endpoint. 200 does, the absent statuses are
+// the definitive states of the endpoint reporting there is nothing to report, e.g. 404 for an
+// AWS instance that is not marked for termination. Any other status is a poll failure: 429 and
+// 503 are throttling, the delay asked for with the Retry-After header is returned in the
+// UnexpectedStatusError. Whether a failure is retried is up to the retry policy.
+func (p *endpointPoller) checkStatus(statusCode int, absent []int) (bool, error) {
+	if statusCode == http.StatusOK {
+		return true, nil
+	}
+	for _, status := range absent {
+		if statusCode == status {
+			return false, nil
+		}
+	}
+
+	p.recordResponseFailure(statusCode, pollFailureStatus)
+	statusErr := &UnexpectedStatusError{StatusCode: statusCode}
+	if statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable {
+		statusErr.RetryAfter = p.retryAfter
+	}
+	return false, statusErr
+}
+
+// parseRetryAfter returns the delay of a Retry-After header, given in seconds or as an HTTP
+// date, zero if the header is empty or invalid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+func (p *endpointPoller) recordRequestFailure(err error) {
+	if p.provider != "" {
+		recordRequestFailure(p.provider, err)
+	}
+}
+
+func (p *endpointPoller) recordResponseFailure(statusCode int, kind string) {
+	if p.provider != "" {
+		recordResponseFailure(p.provider, statusCode, kind)
+	}
+}
+
+// localDeadline converts a deadline reported by the metadata service to the local clock, so an
+// instance with a drifting clock does not act too late. The clock offset measured from the last
+// response is used if the service reported its time, otherwise the deadline is brought forward
+// by the skew allowance.
+func (p *endpointPoller) localDeadline(deadline time.Time) time.Time {
+	if deadline.IsZero() {
+		return deadline
+	}
+	if p.clockKnown {
+		if p.clockOffset > maxClockOffsetError || p.clockOffset < -maxClockOffsetError {
+			return deadline.Add(-p.clockOffset)
+		}
+		return deadline
+	}
+	if p.skewAllowance != nil {
+		return deadline.Add(-p.skewAllowance())
+	}
+	return deadline
+}
@@ -0,0 +1,115 @@
+// Package providers detects the termination notices of cloud instances by polling the metadata
+// service of their cloud provider. The aws, azure and gcp providers are built in, others are
+// added with Register.
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Provider polls the metadata service of a cloud provider for termination notices. A Provider
+// is only used by one goroutine, a new one is constructed for every poll loop.
+type Provider interface {
+	// Poll checks the termination notice endpoint once and returns the termination notice,
+	// nil if the instance is not marked for termination. The request is aborted once ctx is
+	// done. Returning an UnexpectedStatusError lets the retry policy classify the failure.
+	Poll(ctx context.Context, logger logr.Logger) (*TerminationNotice, error)
+	// CheckAdvisory checks once whether the cloud provider signals that a termination is
+	// likely soon, the termination notice endpoint is then polled more frequently. Providers
+	// without such a signal always return false.
+	CheckAdvisory(ctx context.Context) (bool, error)
+	// EventType returns the event type reported for the termination notices of the provider
+	EventType() string
+}
+
+// TerminationNotice is a termination notice as reported by a Provider, the handler adds the
+// node, the provider and the time it was detected to publish it as a notify.Notice
+type TerminationNotice struct {
+	// Kind is the kind of event, e.g. Preempt, the event type of the provider if empty
+	Kind string
+	// Deadline is the time the instance will be terminated, zero if unknown
+	Deadline time.Time
+	// EventID is the identifier of the event, empty if the provider has none
+	EventID string
+	// Raw is the notice as reported by the provider, e.g. the scheduled event on Azure
+	Raw string
+	// Deferrable is set for scheduled maintenance, e.g. a reboot on Azure, as opposed to
+	// imminent terminations. The drain of the node may be deferred to a maintenance window.
+	Deferrable bool
+}
+
+// Options are passed to a Factory
+type Options struct {
+	// NodeName is the name of the node, or of the instance of a standalone handler
+	NodeName string
+	// HTTPClient is the client the metadata service is polled with
+	HTTPClient *http.Client
+	// MetadataURL is the base URL of the metadata service, the default of the provider if empty
+	MetadataURL string
+	// ClockSkewAllowance returns the allowance for a late local clock that deadlines reported
+	// by the provider are corrected with, nil if none
+	ClockSkewAllowance func() time.Duration
+	// ReportMaintenance reports scheduled maintenance stopping the instance, e.g. a reboot on
+	// Azure, as deferrable notices. It is only set while the drain on such notices is
+	// deferred, as the notices are otherwise acted on like terminations.
+	ReportMaintenance bool
+}
+
+// Factory constructs a Provider. Errors are returned for invalid options, they are
+// reported when the handler is constructed.
+type Factory func(opts Options) (Provider, error)
+
+// providers are the registered cloud providers by name
+var providers = struct {
+	sync.RWMutex
+	factories map[string]Factory
+}{factories: map[string]Factory{}}
+
+// Register makes a cloud provider available by name, e.g. to the --cloud-provider
+// flag, so builds can compile in their own providers. It is meant to be called from init
+// functions and panics if name is empty, factory is nil or the name is already registered.
+func Register(name string, factory Factory) {
+	if name == "" {
+		panic("providers: Register called with an empty name")
+	}
+	if factory == nil {
+		panic(fmt.Sprintf("providers: Register called with a nil factory for %q", name))
+	}
+
+	providers.Lock()
+	defer providers.Unlock()
+	if _, ok := providers.factories[name]; ok {
+		panic(fmt.Sprintf("providers: Register called twice for %q", name))
+	}
+	providers.factories[name] = factory
+}
+
+// Names returns the sorted names of the registered cloud providers
+func Names() []string {
+	providers.RLock()
+	defer providers.RUnlock()
+	names := make([]string, 0, len(providers.factories))
+	for name := range providers.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New constructs a Provider of the cloud provider registered as name
+func New(name string, opts Options) (Provider, error) {
+	providers.RLock()
+	factory, ok := providers.factories[name]
+	providers.RUnlock()
+	if !ok {
+		return nil, &UnsupportedError{Provider: name, Supported: Names()}
+	}
+	return factory(opts)
+}
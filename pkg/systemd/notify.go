@@ -0,0 +1,71 @@
+// Package systemd implements the sd_notify protocol, so systemd can supervise the termination
+// handler when it runs as a Type=notify service, e.g. standalone on instances that are not
+// Kubernetes nodes. See sd_notify(3).
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notification states understood by systemd
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Notifier sends notifications to the service manager
+type Notifier struct {
+	addr *net.UnixAddr
+}
+
+// NewNotifier returns a notifier for the socket in the NOTIFY_SOCKET environment variable,
+// nil if it is not set, i.e. the process is not run by systemd as a notify service
+func NewNotifier() *Notifier {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// Abstract socket names are given with a leading @
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	return &Notifier{addr: &net.UnixAddr{Name: socket, Net: "unixgram"}}
+}
+
+// Notify sends the state to the service manager
+func (n *Notifier) Notify(state string) error {
+	conn, err := net.DialUnix(n.addr.Net, nil, n.addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to notify socket: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("error sending notification: %v", err)
+	}
+	return nil
+}
+
+// WatchdogInterval returns the interval at which the service manager expects watchdog
+// notifications, zero if the watchdog is not enabled for this process
+func WatchdogInterval() (time.Duration, error) {
+	value := os.Getenv("WATCHDOG_USEC")
+	if value == "" {
+		return 0, nil
+	}
+	usec, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC %q", value)
+	}
+
+	// The watchdog applies to another process if WATCHDOG_PID is set to a different PID
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+	return time.Duration(usec) * time.Microsecond, nil
+}
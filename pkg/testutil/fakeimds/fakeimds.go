@@ -0,0 +1,365 @@
+// Package fakeimds is a fake instance metadata service emulating the termination notice
+// endpoints of AWS, Azure and GCP. It follows a scripted timeline of phases, e.g. an advisory
+// after 10s and a termination notice after 30s, so tests, end-to-end runs and game days can
+// exercise the termination handler without a real interruption. The endpoints of every
+// provider are served at once, the handler picks them by its cloud provider.
+package fakeimds
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Phase is the state of the emulated instance
+type Phase string
+
+const (
+	// PhaseNone reports no advisory and no termination notice
+	PhaseNone Phase = "none"
+	// PhaseAdvisory reports that a termination is likely: an AWS rebalance recommendation,
+	// an Azure Freeze event or a GCP live migration
+	PhaseAdvisory Phase = "advisory"
+	// PhaseMaintenance reports scheduled maintenance stopping the instance, reported as a
+	// deferrable notice while drains are deferred: an Azure Reboot event or a GCP host
+	// maintenance terminating the instance. AWS reports nothing.
+	PhaseMaintenance Phase = "maintenance"
+	// PhaseTerminating reports a termination notice: an AWS spot interruption, an Azure
+	// Preempt event or a GCP preemption
+	PhaseTerminating Phase = "terminating"
+)
+
+// ControlPath is the endpoint reporting the current phase on GET and switching to the
+// phase given by the phase query parameter on POST
+const ControlPath = "/fakeimds/phase"
+
+// awsToken is the session token handed out for IMDSv2 requests
+const awsToken = "fakeimds-token"
+
+// Step switches to Phase once At has passed since the server started
+type Step struct {
+	At    time.Duration
+	Phase Phase
+}
+
+// Timeline is the sequence of phases of the emulated instance, it starts in PhaseNone
+type Timeline []Step
+
+// ParseTimeline parses a comma separated list of phase@offset steps, e.g.
+// "advisory@10s,terminating@30s". An empty string is an empty timeline.
+func ParseTimeline(value string) (Timeline, error) {
+	var timeline Timeline
+	if value == "" {
+		return timeline, nil
+	}
+	for _, step := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(step), "@", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid step %q, must be phase@offset", step)
+		}
+		phase := Phase(parts[0])
+		if err := validatePhase(phase); err != nil {
+			return nil, err
+		}
+		at, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset of step %q: %v", step, err)
+		}
+		timeline = append(timeline, Step{At: at, Phase: phase})
+	}
+	return timeline, nil
+}
+
+func validatePhase(phase Phase) error {
+	switch phase {
+	case PhaseNone, PhaseAdvisory, PhaseMaintenance, PhaseTerminating:
+		return nil
+	}
+	return fmt.Errorf("unknown phase %q, must be one of none, advisory, maintenance or terminating", phase)
+}
+
+// Options configure the server
+type Options struct {
+	// NoticePeriod is the time from the start of the terminating or maintenance phase to
+	// the deadline
+	NoticePeriod time.Duration
+	// Repeat restarts the timeline at this interval, so long runs go through many
+	// interruptions. The timeline runs once if zero.
+	Repeat time.Duration
+	// FailureRate is the fraction of requests failed with a server error or a dropped
+	// connection, emulating a flaky metadata service
+	FailureRate float64
+	// MaxLatency is the maximum random delay added to every request
+	MaxLatency time.Duration
+}
+
+// Server is the fake instance metadata service, it implements http.Handler
+type Server struct {
+	opts Options
+	now  func() time.Time
+
+	lock     sync.RWMutex
+	start    time.Time
+	timeline Timeline
+	random   *rand.Rand
+}
+
+// New constructs a server following timeline from now on
+func New(timeline Timeline, opts Options) *Server {
+	steps := append(Timeline{}, timeline...)
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].At < steps[j].At })
+	return &Server{
+		opts:     opts,
+		now:      time.Now,
+		start:    time.Now(),
+		timeline: steps,
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// cycle returns the start of the current run of the timeline and the time elapsed since
+func (s *Server) cycle() (time.Time, time.Duration) {
+	elapsed := s.now().Sub(s.start)
+	if s.opts.Repeat <= 0 {
+		return s.start, elapsed
+	}
+	offset := elapsed % s.opts.Repeat
+	return s.start.Add(elapsed - offset), offset
+}
+
+// Phase returns the current phase and when it began
+func (s *Server) Phase() (Phase, time.Time) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	start, elapsed := s.cycle()
+	phase, since := PhaseNone, start
+	for _, step := range s.timeline {
+		if step.At > elapsed {
+			break
+		}
+		if step.Phase != phase {
+			phase, since = step.Phase, start.Add(step.At)
+		}
+	}
+	return phase, since
+}
+
+// Cycles returns the number of times the timeline started, including the current run
+func (s *Server) Cycles() int64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.opts.Repeat <= 0 {
+		return 1
+	}
+	return int64(s.now().Sub(s.start)/s.opts.Repeat) + 1
+}
+
+// SetPhase switches to phase now, the remaining steps of the timeline still apply. The
+// switch is added to the timeline, so it happens again in every repeated run.
+func (s *Server) SetPhase(phase Phase) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, at := s.cycle()
+	steps := Timeline{}
+	for _, step := range s.timeline {
+		if step.At <= at {
+			steps = append(steps, step)
+		}
+	}
+	steps = append(steps, Step{At: at, Phase: phase})
+	for _, step := range s.timeline {
+		if step.At > at {
+			steps = append(steps, step)
+		}
+	}
+	s.timeline = steps
+}
+
+// deadline returns the deadline of the termination notice or maintenance that began at since
+func (s *Server) deadline(since time.Time) time.Time {
+	return since.Add(s.opts.NoticePeriod).UTC().Truncate(time.Second)
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == ControlPath {
+		s.serveControl(w, r)
+		return
+	}
+	if s.injectFailure(w) {
+		return
+	}
+
+	phase, since := s.Phase()
+	switch r.URL.Path {
+	// AWS
+	case "/latest/api/token":
+		if r.Method != http.MethodPut {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		fmt.Fprint(w, awsToken)
+	case "/latest/meta-data/spot/termination-time":
+		if phase != PhaseTerminating {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, s.deadline(since).Format(time.RFC3339))
+	case "/latest/meta-data/spot/instance-action":
+		if phase != PhaseTerminating {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, map[string]string{"action": "terminate", "time": s.deadline(since).Format(time.RFC3339)})
+	case "/latest/meta-data/events/recommendations/rebalance":
+		if phase != PhaseAdvisory && phase != PhaseTerminating {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, map[string]string{"noticeTime": since.UTC().Format(time.RFC3339)})
+
+	// Azure
+	case "/metadata/scheduledevents":
+		if r.Header.Get("Metadata") != "true" {
+			http.Error(w, "Metadata header required", http.StatusBadRequest)
+			return
+		}
+		s.serveScheduledEvents(w, phase, since)
+
+	// GCP
+	case "/computeMetadata/v1/instance/preempted":
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "Metadata-Flavor header required", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Metadata-Flavor", "Google")
+		if phase == PhaseTerminating {
+			fmt.Fprint(w, "TRUE")
+		} else {
+			fmt.Fprint(w, "FALSE")
+		}
+	case "/computeMetadata/v1/instance/maintenance-event":
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "Metadata-Flavor header required", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Metadata-Flavor", "Google")
+		switch phase {
+		case PhaseAdvisory:
+			fmt.Fprint(w, "MIGRATE_ON_HOST_MAINTENANCE")
+		case PhaseMaintenance:
+			fmt.Fprint(w, "TERMINATE_ON_HOST_MAINTENANCE")
+		default:
+			fmt.Fprint(w, "NONE")
+		}
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// injectFailure delays the request by a random latency and fails it at the failure rate,
+// by responding with a server error or dropping the connection. It returns whether the
+// request failed.
+func (s *Server) injectFailure(w http.ResponseWriter) bool {
+	s.lock.Lock()
+	var latency time.Duration
+	if s.opts.MaxLatency > 0 {
+		latency = time.Duration(s.random.Int63n(int64(s.opts.MaxLatency)))
+	}
+	fail := s.random.Float64() < s.opts.FailureRate
+	drop := s.random.Intn(2) == 0
+	s.lock.Unlock()
+
+	time.Sleep(latency)
+	if !fail {
+		return false
+	}
+	if hijacker, ok := w.(http.Hijacker); ok && drop {
+		if conn, _, err := hijacker.Hijack(); err == nil {
+			conn.Close()
+			return true
+		}
+	}
+	http.Error(w, "injected failure", http.StatusInternalServerError)
+	return true
+}
+
+// serveControl reports or switches the phase
+func (s *Server) serveControl(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		phase := Phase(r.URL.Query().Get("phase"))
+		if err := validatePhase(phase); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.SetPhase(phase)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	phase, since := s.Phase()
+	writeJSON(w, map[string]interface{}{"phase": phase, "since": since.UTC().Format(time.RFC3339), "cycles": s.Cycles()})
+}
+
+// scheduledEvent is an event of the Azure scheduled events response
+type scheduledEvent struct {
+	EventID      string   `json:"EventId"`
+	EventType    string   `json:"EventType"`
+	ResourceType string   `json:"ResourceType"`
+	Resources    []string `json:"Resources"`
+	EventStatus  string   `json:"EventStatus"`
+	NotBefore    string   `json:"NotBefore"`
+}
+
+// serveScheduledEvents serves the Azure scheduled events of the phase
+func (s *Server) serveScheduledEvents(w http.ResponseWriter, phase Phase, since time.Time) {
+	events := []scheduledEvent{}
+	switch phase {
+	case PhaseAdvisory:
+		events = append(events, scheduledEvent{
+			EventID:   fmt.Sprintf("freeze-%d", since.Unix()),
+			EventType: "Freeze",
+			NotBefore: since.Add(s.opts.NoticePeriod).UTC().Format(http.TimeFormat),
+		})
+	case PhaseMaintenance:
+		events = append(events, scheduledEvent{
+			EventID:   fmt.Sprintf("reboot-%d", since.Unix()),
+			EventType: "Reboot",
+			NotBefore: s.deadline(since).Format(http.TimeFormat),
+		})
+	case PhaseTerminating:
+		events = append(events, scheduledEvent{
+			EventID:   fmt.Sprintf("preempt-%d", since.Unix()),
+			EventType: "Preempt",
+			NotBefore: s.deadline(since).Format(http.TimeFormat),
+		})
+	}
+	for i := range events {
+		events[i].ResourceType = "VirtualMachine"
+		events[i].Resources = []string{"fake-vm"}
+		events[i].EventStatus = "Scheduled"
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"DocumentIncarnation": len(events),
+		"Events":              events,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,28 @@
+// Package version holds the build information of the termination handler.
+// Version and GitCommit are set at build time, e.g.
+//
+//	go build -ldflags "-X github.com/alexander-demichev/termination-handler/pkg/version.Version=v0.1.0 \
+//	  -X github.com/alexander-demichev/termination-handler/pkg/version.GitCommit=$(git rev-parse HEAD)"
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+var (
+	// Version is the released version of the termination handler
+	Version = "dev"
+	// GitCommit is the git commit the termination handler was built from
+	GitCommit = "unknown"
+)
+
+// GoVersion returns the version of Go the termination handler was built with
+func GoVersion() string {
+	return runtime.Version()
+}
+
+// String returns a human readable description of the build
+func String() string {
+	return fmt.Sprintf("termination-handler %s (commit %s, %s)", Version, GitCommit, GoVersion())
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/actions"
+	"github.com/alexander-demichev/termination-handler/pkg/agent"
+	"github.com/alexander-demichev/termination-handler/pkg/audit"
+	"github.com/alexander-demichev/termination-handler/pkg/config"
+	"github.com/alexander-demichev/termination-handler/pkg/features"
+	"github.com/alexander-demichev/termination-handler/pkg/metrics"
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/alexander-demichev/termination-handler/pkg/providers"
+	"github.com/alexander-demichev/termination-handler/pkg/systemd"
+	"github.com/alexander-demichev/termination-handler/pkg/version"
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+)
+
+// newRunCommand constructs the command running the termination handler
+func newRunCommand(opts *rootOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "run",
+		Short: "Watch the termination notice endpoint and mark the node for deletion",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runHandler(opts)
+		},
+	}
+}
+
+// runHandler runs the termination handler, or the interruption statistics exporter, until
+// stopped. Invalid configuration is reported before anything is started.
+func runHandler(opts *rootOptions) error {
+	logger := opts.logger
+	logger.Info("Starting termination handler", "version", version.Version, "gitCommit", version.GitCommit, "goVersion", version.GoVersion())
+
+	// Get a config to talk to the apiserver, standalone handlers do not use it
+	var cfg *rest.Config
+	if opts.conf.Standalone {
+		if opts.configMap != "" {
+			return configError("--config-map can not be used with --standalone")
+		}
+		if opts.handlerConfig != "" {
+			return configError("--handler-config can not be used with --standalone")
+		}
+	} else {
+		var err error
+		cfg, err = opts.restConfig()
+		if err != nil {
+			return configError("error getting configuration: %w", err)
+		}
+	}
+
+	// Load the configuration from a file, ConfigMap or TerminationHandlerConfig, if configured
+	loader, err := opts.loadConfig(cfg)
+	if err != nil {
+		return configError("error loading configuration: %w", err)
+	}
+	conf := opts.conf
+	if conf.Standalone && conf.NodeName == "" {
+		if conf.NodeName, err = os.Hostname(); err != nil {
+			return configError("error getting hostname: %w", err)
+		}
+	}
+	if err := conf.Validate(); err != nil {
+		return configError("invalid configuration: %w", err)
+	}
+	registerExecProvider(conf)
+
+	// Mirror metrics to StatsD if configured
+	if statsd := conf.Metrics.StatsD; statsd.Address != "" {
+		sink, err := metrics.NewStatsDSink(statsd.Address, statsd.Prefix, statsd.Tags, statsd.DogStatsD)
+		if err != nil {
+			return configError("error constructing StatsD sink: %w", err)
+		}
+		metrics.AddSink(sink)
+	}
+
+	// Configure the sinks termination notices are published to
+	notifiers, err := buildNotifiers(conf)
+	if err != nil {
+		return configError("error constructing notifiers: %w", err)
+	}
+
+	// The first signal stops the handler, a second one exits immediately
+	stop := setupSignalHandler()
+
+	// Run the interruption statistics exporter instead of the handler if requested
+	if conf.InterruptionStats.Enabled {
+		return runInterruptionStats(logger, cfg, conf, stop)
+	}
+
+	// Run the NodeTermination controller instead of the handler if requested
+	if conf.NodeTerminations.Controller {
+		return runNodeTerminationController(logger, cfg, conf, stop)
+	}
+
+	// Run the binding webhook instead of the handler if requested
+	if conf.BindingWebhook.Enabled {
+		return runBindingWebhook(logger, cfg, conf, stop)
+	}
+
+	// Run the configuration controller instead of the handler if requested
+	if conf.ConfigController {
+		return runConfigController(logger, cfg, conf, stop)
+	}
+
+	// Configure auditing of detections and actions
+	var auditors []audit.Auditor
+	if conf.Audit.URL != "" {
+		signingKey, err := ioutil.ReadFile(conf.Audit.SigningKeyFile)
+		if err != nil {
+			return configError("error reading audit signing key: %w", err)
+		}
+		auditClient, err := tlsOptions(conf.Audit.TLS).HTTPClient(conf.Notifications.Timeout.Duration)
+		if err != nil {
+			return configError("error constructing audit client: %w", err)
+		}
+		httpAuditor, err := audit.NewHTTPAuditor(logger, conf.Audit.URL, signingKey, conf.Audit.SpoolDir, auditClient)
+		if err != nil {
+			return configError("error constructing auditor: %w", err)
+		}
+		go httpAuditor.Run(conf.Audit.FlushInterval.Duration, stop)
+		auditors = append(auditors, httpAuditor)
+	}
+	if conf.Audit.LogFile != "" {
+		fileAuditor, err := audit.NewFileAuditor(conf.Audit.LogFile)
+		if err != nil {
+			return configError("error constructing audit log: %w", err)
+		}
+		defer fileAuditor.Close()
+		auditors = append(auditors, fileAuditor)
+	}
+	auditor := audit.NewMultiAuditor(auditors...)
+
+	// Both were checked by Validate
+	nodeSelector, _ := labels.Parse(conf.NodeSelector)
+	gate, _ := features.NewGate(conf.FeatureGates)
+	logger.Info("Feature gates", "gates", gate.String())
+
+	modeActions, err := actions.ForMode(conf.Mode, conf.Drain.Timeout.Duration, conf.Drain.Delay.Duration)
+	if err != nil {
+		return configError("invalid mode: %w", err)
+	}
+	logger.Info("Operating mode", "mode", conf.Mode)
+
+	httpClient, err := pollClient(conf)
+	if err != nil {
+		return configError("error constructing metadata client: %w", err)
+	}
+
+	// Construct a termination handler
+	handlerOpts := agent.Options{
+		CloudProvider: conf.CloudProvider,
+		MetadataURL:   conf.Metadata.URL(conf.CloudProvider),
+		HTTPClient:    httpClient,
+		NodeName:      conf.NodeName,
+		Namespace:     conf.Namespace,
+		NodeSelector:  nodeSelector,
+		Settings:      handlerSettings(conf),
+		Condition:     conditionOptions(conf),
+		Deferral:      deferralOptions(logger, conf, gate),
+		Actions:       modeActions,
+		Notifiers:     notifiers,
+		Auditor:       auditor,
+		StateFile:     conf.StateFile,
+
+		NodeTerminations: conf.NodeTerminations.Enabled,
+		DeschedulerHints: conf.DeschedulerHints,
+		Kured:            kuredOptions(conf),
+		MCOCoordination:  conf.Drain.MachineConfigOperator,
+		NodeRateLimit:    agent.RateLimit{QPS: conf.NodeRateLimit.QPS, Burst: conf.NodeRateLimit.Burst},
+	}
+	// Run a single handler for every node of the cluster, of the workload clusters of a
+	// management cluster or of the instance if requested
+	if conf.Central || conf.Management.Enabled || len(conf.NodeNames) > 0 {
+		var fleetHandler fleetHandler
+		switch {
+		case conf.Central:
+			fleetHandler, err = newCentralHandler(logger, cfg, conf, handlerOpts)
+		case conf.Management.Enabled:
+			fleetHandler, err = newManagementHandler(logger, cfg, conf, handlerOpts)
+		default:
+			fleetHandler, err = agent.NewMultiNodeHandler(logger, cfg, conf.NodeNames, handlerOpts)
+			if errors.Is(err, providers.ErrUnsupported) {
+				err = configError("error constructing multi-node termination handler: %w", err)
+			} else if err != nil {
+				err = fmt.Errorf("error constructing multi-node termination handler: %w", err)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		watchConfig(logger, loader, opts.configReloadInterval, conf, stop, fleetHandler.UpdateSettings)
+		var statusHandlers map[string]http.Handler
+		if reporter, ok := fleetHandler.(agent.ClusterStatusReporter); ok {
+			statusHandlers = map[string]http.Handler{"/clusterz": agent.ClusterStatusHandler(reporter)}
+		}
+		serveMetrics(logger, conf.Metrics.BindAddress, statusHandlers)
+		run := fleetHandler.Run
+		if conf.LeaderElection.Enabled {
+			run = func(stop <-chan struct{}) error {
+				return runLeaderElected(logger, cfg, conf, stop, fleetHandler.Run)
+			}
+		}
+		if err := run(stop); err != nil {
+			return fmt.Errorf("error running termination handler: %w", err)
+		}
+		return nil
+	}
+
+	var handler agent.Handler
+	if conf.Standalone {
+		logger.Info("Running standalone, only hooks and notifications are run on termination")
+		handler, err = agent.NewStandaloneHandler(logger, handlerOpts)
+	} else {
+		handler, err = agent.NewHandler(logger, cfg, handlerOpts)
+	}
+	if errors.Is(err, providers.ErrUnsupported) {
+		return configError("error constructing termination handler: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("error constructing termination handler: %w", err)
+	}
+
+	// Apply changes of the configuration file that do not require a restart
+	watchConfig(logger, loader, opts.configReloadInterval, conf, stop, handler.UpdateSettings)
+
+	// Start serving Prometheus metrics, the handler status and readiness
+	serveMetrics(logger, conf.Metrics.BindAddress, map[string]http.Handler{
+		"/statusz": agent.StatusHandler(handler),
+		"/readyz":  agent.ReadyHandler(handler),
+	})
+
+	// Accept simulated termination notices if enabled
+	if conf.SimulationBindAddress != "" {
+		serveSimulation(logger, conf.SimulationBindAddress, handler)
+	}
+
+	// Let systemd supervise the handler when run as a notify service
+	if notifier := systemd.NewNotifier(); notifier != nil {
+		go notifySystemd(logger, notifier, handler, stop)
+	}
+
+	// Start the termination handler
+	if err := handler.Run(stop); err != nil {
+		return fmt.Errorf("error running termination handler: %w", err)
+	}
+	return nil
+}
+
+// fleetHandler handles the termination notices of many nodes with a node handler for each
+type fleetHandler interface {
+	Run(stop <-chan struct{}) error
+	UpdateSettings(settings agent.Settings)
+}
+
+// watchConfig applies the changes of the loaded configuration that do not require a restart
+// with update until stop is closed, if the configuration is loaded from a file or ConfigMap
+func watchConfig(logger logr.Logger, loader *config.Loader, interval time.Duration, conf *config.Config, stop <-chan struct{}, update func(agent.Settings)) {
+	if loader == nil {
+		return
+	}
+	go loader.Watch(logger, interval, stop, func(newConf *config.Config) {
+		if conf.RequiresRestart(newConf) {
+			logger.Info("Configuration changes that can not be applied while running were ignored, restart the handler to apply them")
+		}
+		applyLogVerbosity(logger, loader, newConf)
+		if err := newConf.Validate(); err != nil {
+			logger.Error(err, "Ignoring invalid configuration change")
+			return
+		}
+		update(handlerSettings(newConf))
+	})
+}
+
+// handlerSettings returns the handler settings that can be changed without a restart
+func handlerSettings(conf *config.Config) agent.Settings {
+	return agent.Settings{
+		PollInterval:         conf.PollInterval.Duration,
+		PollJitter:           conf.PollJitter,
+		AdvisoryPollInterval: conf.AdvisoryPollInterval.Duration,
+		UnreachableThreshold: conf.UnreachableThreshold,
+		ShutdownBudget:       conf.ShutdownBudget.Duration,
+		ClockSkewAllowance:   conf.ClockSkewAllowance.Duration,
+		Retry:                retryPolicy(conf.Metadata.Retry(conf.CloudProvider)),
+	}
+}
+
+// retryPolicy returns the policy retrying failed polls of the metadata service
+func retryPolicy(retry config.RetryConfig) agent.RetryPolicy {
+	return agent.RetryPolicy{
+		InitialInterval:   retry.InitialInterval.Duration,
+		Multiplier:        retry.Multiplier,
+		MaxAttempts:       retry.MaxAttempts,
+		RetryableStatuses: retry.RetryableStatuses,
+	}
+}
+
+// kuredOptions returns the options of the coordination of drains with kured, nil if disabled
+func kuredOptions(conf *config.Config) *agent.KuredOptions {
+	kured := conf.Drain.Kured
+	if !kured.Enabled {
+		return nil
+	}
+	return &agent.KuredOptions{
+		Namespace: kured.Namespace,
+		Name:      kured.DaemonSet,
+		LockTTL:   kured.LockTTL.Duration,
+		MaxWait:   kured.MaxWait.Duration,
+	}
+}
+
+// conditionOptions returns the options of the node condition added for termination notices
+func conditionOptions(conf *config.Config) actions.ConditionOptions {
+	return actions.ConditionOptions{
+		Type:            conf.Condition.Type,
+		ReasonTemplate:  conf.Condition.Reason,
+		MessageTemplate: conf.Condition.Message,
+		TTL:             conf.Condition.TTL.Duration,
+	}
+}
+
+// deferralOptions returns the options for deferring the drain on notices of scheduled
+// maintenance, deferral is disabled unless the MaintenanceWindowDeferral feature is enabled
+func deferralOptions(logger logr.Logger, conf *config.Config, gate *features.Gate) actions.DeferralOptions {
+	if !gate.Enabled(features.MaintenanceWindowDeferral) {
+		if conf.Deferral.MaintenanceWindow != "" || conf.Deferral.LeadTime.Duration > 0 {
+			logger.Info("Ignoring the deferral configuration, the feature gate is disabled", "featureGate", features.MaintenanceWindowDeferral)
+		}
+		return actions.DeferralOptions{}
+	}
+	return actions.DeferralOptions{
+		Window:   conf.Deferral.MaintenanceWindow,
+		LeadTime: conf.Deferral.LeadTime.Duration,
+	}
+}
+
+// buildNotifiers constructs the notifiers enabled in the configuration
+func buildNotifiers(conf *config.Config) ([]notify.Notifier, error) {
+	timeout := conf.Notifications.Timeout.Duration
+
+	var notifiers []notify.Notifier
+	if sinkURL := conf.Notifications.CloudEvents.SinkURL; sinkURL != "" {
+		cloudEventsNotifier, err := notify.NewCloudEventsNotifier(sinkURL, timeout, tlsOptions(conf.Notifications.CloudEvents.TLS))
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, cloudEventsNotifier)
+	}
+
+	if nats := conf.Notifications.NATS; nats.URL != "" {
+		natsNotifier, err := notify.NewNATSNotifier(nats.URL, nats.Subject, timeout)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, natsNotifier)
+	}
+
+	if hook := conf.Notifications.Hook; hook.Command != "" {
+		notifiers = append(notifiers, notify.NewExecNotifier(hook.Command, hook.Args, hook.Timeout.Duration))
+	}
+
+	if path := conf.Notifications.File.Path; path != "" {
+		notifiers = append(notifiers, notify.NewFileNotifier(path))
+	}
+
+	if mqtt := conf.Notifications.MQTT; mqtt.BrokerURL != "" {
+		clientID := mqtt.ClientID
+		if clientID == "" {
+			clientID = "termination-handler-" + conf.NodeName
+		}
+		mqttNotifier, err := notify.NewMQTTNotifier(notify.MQTTOptions{
+			BrokerURL: mqtt.BrokerURL,
+			Topic:     mqtt.Topic,
+			QoS:       byte(mqtt.QoS),
+			ClientID:  clientID,
+			Username:  mqtt.Username,
+			Password:  os.Getenv("MQTT_PASSWORD"),
+			TLS: notify.TLSOptions{
+				CAFile:     mqtt.CAFile,
+				CertFile:   mqtt.CertFile,
+				KeyFile:    mqtt.KeyFile,
+				MinVersion: mqtt.MinTLSVersion,
+			},
+			Timeout: timeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, mqttNotifier)
+	}
+
+	return notifiers, nil
+}
+
+// serveMetrics serves the Prometheus metrics and any additional handlers on address,
+// unless address is 0
+func serveMetrics(logger logr.Logger, address string, handlers map[string]http.Handler) {
+	if address == "0" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	for path, handler := range handlers {
+		mux.Handle(path, handler)
+	}
+	go func() {
+		if err := http.ListenAndServe(address, mux); err != nil {
+			logger.Error(err, "Error serving metrics")
+		}
+	}()
+}
+
+// serveSimulation serves the endpoint injecting simulated termination notices on address
+func serveSimulation(logger logr.Logger, address string, handler agent.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle(simulatePath, agent.SimulationHandler(handler))
+	go func() {
+		if err := http.ListenAndServe(address, mux); err != nil {
+			logger.Error(err, "Error serving simulation endpoint")
+		}
+	}()
+}
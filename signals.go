@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// setupSignalHandler returns a channel closed on SIGTERM or SIGINT. A second
+// signal exits immediately with exitRuntimeError.
+func setupSignalHandler() <-chan struct{} {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		<-signals
+		close(stop)
+		<-signals
+		os.Exit(exitRuntimeError)
+	}()
+	return stop
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/agent"
+	"github.com/spf13/cobra"
+)
+
+// simulatePath is the path of the endpoint injecting simulated termination notices
+const simulatePath = "/simulate"
+
+// newSimulateCommand constructs the command injecting a simulated termination notice
+// into the handler running on the node
+func newSimulateCommand(opts *rootOptions) *cobra.Command {
+	address := "127.0.0.1:8081"
+	eventType := ""
+	deadline := time.Duration(0)
+
+	cmd := &cobra.Command{
+		Use:   "simulate",
+		Short: "Inject a simulated termination notice into the handler running on this node",
+		Long: `Inject a simulated termination notice into the handler running on this node.
+
+The handler acts on the notice exactly like on a notice observed from the cloud provider,
+so MachineHealthChecks and drain automation can be rehearsed end to end. The handler must
+be started with --simulation-bind-address. The node annotation, notifications and audit
+records of the notice are marked as simulated.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSimulate(address, agent.SimulationRequest{
+				EventType:       eventType,
+				DeadlineSeconds: int64(deadline / time.Second),
+			})
+		},
+	}
+	cmd.Flags().StringVar(&address, "address", address, "address of the handler's simulation endpoint, as set with --simulation-bind-address")
+	cmd.Flags().StringVar(&eventType, "event-type", eventType, "event type of the simulated notice. If unspecified, the event type of the cloud provider is used.")
+	cmd.Flags().DurationVar(&deadline, "deadline", deadline, "time after which the instance is assumed to be terminated. If unspecified, the deadline is unknown.")
+	return cmd
+}
+
+// runSimulate posts the simulation request to the handler
+func runSimulate(address string, request agent.SimulationRequest) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("error marshalling simulation request: %v", err)
+	}
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	resp, err := httpClient.Post("http://"+address+simulatePath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error contacting handler: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("handler rejected the simulated notice: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	fmt.Println("Simulated termination notice injected, it is acted on at the next poll")
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/agent"
+	"github.com/alexander-demichev/termination-handler/pkg/notify"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// newStatusCommand constructs the command printing the status of the handler running on the node
+func newStatusCommand(opts *rootOptions) *cobra.Command {
+	address := "127.0.0.1:8080"
+	direct := false
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Print the status of the handler running on this node",
+		Long: `Print the status of the handler running on this node.
+
+The state of the handler, its last poll, the termination notice it is acting on and the
+actions still pending are read from the /statusz endpoint of the handler. With --direct,
+the termination notice endpoint of the cloud provider is polled instead, for nodes on
+which the handler is not running or can not be reached.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if direct {
+				return runDirectStatus(opts)
+			}
+			return runStatus(address)
+		},
+	}
+	cmd.Flags().StringVar(&address, "address", address, "address of the handler's status endpoint, as set with --metrics-bind-address")
+	cmd.Flags().BoolVar(&direct, "direct", direct, "poll the termination notice endpoint instead of querying the handler")
+	return cmd
+}
+
+// maxStatusSize bounds the status response read from the handler
+const maxStatusSize = 1 << 20
+
+// runStatus queries the status of the handler and prints it
+func runStatus(address string) error {
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	resp, err := httpClient.Get("http://" + address + "/statusz")
+	if err != nil {
+		return fmt.Errorf("error contacting handler, use --direct to poll the termination notice endpoint instead: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error querying handler status: %s", resp.Status)
+	}
+
+	status := agent.Status{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxStatusSize)).Decode(&status); err != nil {
+		return fmt.Errorf("error decoding handler status: %v", err)
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Node:\t%s\n", status.Config.NodeName)
+	fmt.Fprintf(w, "Cloud provider:\t%s\n", status.Config.CloudProvider)
+	fmt.Fprintf(w, "State:\t%s\n", status.State)
+	if status.LastPoll != nil {
+		fmt.Fprintf(w, "Last poll:\t%s (%s ago), every %s\n", status.LastPoll.UTC().Format(time.RFC3339), duration.HumanDuration(now.Sub(*status.LastPoll)), status.Config.PollInterval)
+	} else {
+		fmt.Fprintf(w, "Last poll:\tnever\n")
+	}
+	if status.MetadataUnreachable {
+		fmt.Fprintf(w, "Metadata endpoint:\tunreachable\n")
+	}
+	if status.LastError != "" {
+		fmt.Fprintf(w, "Last error:\t%s\n", status.LastError)
+	}
+	if notice := status.Notice; notice != nil {
+		fmt.Fprintf(w, "Notice:\t%s\n", describeNotice(notice.EventType, notice.Simulated, notice.Deadline, now))
+		fmt.Fprintf(w, "Detected:\t%s (%s ago)\n", notice.DetectedAt.UTC().Format(time.RFC3339), duration.HumanDuration(now.Sub(notice.DetectedAt)))
+		if len(status.PendingActions) > 0 {
+			fmt.Fprintf(w, "Pending actions:\t%s\n", strings.Join(status.PendingActions, ", "))
+		} else {
+			fmt.Fprintf(w, "Pending actions:\tnone\n")
+		}
+	} else {
+		fmt.Fprintf(w, "Notice:\tnone\n")
+	}
+	return w.Flush()
+}
+
+// runDirectStatus polls the termination notice endpoint once and prints the notice
+func runDirectStatus(opts *rootOptions) error {
+	// The configuration is only read from a file, the API server may not be reachable
+	if opts.configMap != "" {
+		return configError("--config-map can not be used with --direct")
+	}
+	if opts.handlerConfig != "" {
+		return configError("--handler-config can not be used with --direct")
+	}
+	if _, err := opts.loadConfig(nil); err != nil {
+		return configError("error loading configuration: %w", err)
+	}
+	conf := opts.conf
+	registerExecProvider(conf)
+
+	httpClient, err := pollClient(conf)
+	if err != nil {
+		return configError("error constructing metadata client: %w", err)
+	}
+	notice, err := agent.CheckTermination(context.Background(), opts.logger, httpClient, conf.CloudProvider, conf.Metadata.URL(conf.CloudProvider), conf.NodeName)
+	if err != nil {
+		return fmt.Errorf("error checking termination notice endpoint: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Cloud provider:\t%s\n", conf.CloudProvider)
+	fmt.Fprintf(w, "Metadata endpoint:\treachable\n")
+	if notice == nil {
+		fmt.Fprintf(w, "Notice:\tnone\n")
+	} else {
+		fmt.Fprintf(w, "Notice:\t%s\n", describeNotice(notice.EventType, notice.Simulated, deadlineOf(*notice), time.Now()))
+	}
+	return w.Flush()
+}
+
+// describeNotice formats the event type and deadline of a notice
+func describeNotice(eventType string, simulated bool, deadline *time.Time, now time.Time) string {
+	description := eventType
+	if simulated {
+		description += " (simulated)"
+	}
+	switch {
+	case deadline == nil:
+		return description + ", deadline unknown"
+	case deadline.Before(now):
+		return fmt.Sprintf("%s, deadline %s (%s ago)", description, deadline.UTC().Format(time.RFC3339), duration.HumanDuration(now.Sub(*deadline)))
+	default:
+		return fmt.Sprintf("%s, deadline %s (in %s)", description, deadline.UTC().Format(time.RFC3339), duration.HumanDuration(deadline.Sub(now)))
+	}
+}
+
+// deadlineOf returns the deadline of the notice, nil if it is unknown
+func deadlineOf(notice notify.Notice) *time.Time {
+	if notice.Deadline.IsZero() {
+		return nil
+	}
+	return &notice.Deadline
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/agent"
+	"github.com/alexander-demichev/termination-handler/pkg/systemd"
+	"github.com/go-logr/logr"
+)
+
+// readinessCheckInterval is the interval at which the handler is checked for having started
+const readinessCheckInterval = 100 * time.Millisecond
+
+// notifySystemd reports the handler as ready to systemd once it started, and pings the systemd
+// watchdog while the handler responds, at half the watchdog interval as recommended by
+// sd_watchdog_enabled(3). Stopping is reported once stop is closed.
+func notifySystemd(logger logr.Logger, notifier *systemd.Notifier, handler agent.Handler, stop <-chan struct{}) {
+	interval, err := systemd.WatchdogInterval()
+	if err != nil {
+		logger.Error(err, "Ignoring the systemd watchdog")
+	}
+
+	readiness := time.NewTicker(readinessCheckInterval)
+	defer readiness.Stop()
+	for handler.Status().State == agent.StateInitializing {
+		select {
+		case <-stop:
+			return
+		case <-readiness.C:
+		}
+	}
+	if err := notifier.Notify(systemd.Ready); err != nil {
+		logger.Error(err, "Error notifying systemd of readiness")
+	}
+
+	var watchdog <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		watchdog = ticker.C
+	}
+	for {
+		select {
+		case <-stop:
+			if err := notifier.Notify(systemd.Stopping); err != nil {
+				logger.Error(err, "Error notifying systemd of stopping")
+			}
+			return
+		case <-watchdog:
+			// Fetching the status fails to return if the handler is deadlocked
+			handler.Status()
+			if err := notifier.Notify(systemd.Watchdog); err != nil {
+				logger.Error(err, "Error pinging the systemd watchdog")
+			}
+		}
+	}
+}
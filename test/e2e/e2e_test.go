@@ -0,0 +1,355 @@
+//go:build e2e
+// +build e2e
+
+// Package e2e runs the termination handler against a kind cluster. The handler binary is built
+// from the module and run outside the cluster for a node of the cluster, polling the fake
+// metadata service of pkg/testutil/fakeimds served by the test, which triggers interruptions
+// by switching its phase. Run with
+//
+//	go test -tags e2e ./test/e2e/
+//
+// A cluster named termination-handler-e2e is created with kind and deleted afterwards, unless
+// an existing cluster is given with -kubeconfig.
+package e2e
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alexander-demichev/termination-handler/pkg/testutil/fakeimds"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	clusterName = "termination-handler-e2e"
+	// conditionType and conditionReason are those of the default condition of the handler
+	conditionType   corev1.NodeConditionType = "Terminating"
+	conditionReason                          = "TerminationRequested"
+	// testNamespace holds the pods drained and the Machine of the node
+	testNamespace = "termination-handler-e2e"
+	timeout       = 2 * time.Minute
+)
+
+var (
+	kubeconfig = flag.String("kubeconfig", "", "kubeconfig of an existing cluster, a kind cluster is created if empty")
+	pauseImage = flag.String("pause-image", "k8s.gcr.io/pause:3.2", "image of the pods drained")
+)
+
+var (
+	machineResource = schema.GroupVersionResource{Group: "machine.openshift.io", Version: "v1beta1", Resource: "machines"}
+	crdResource     = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+)
+
+// handlerBinary is the handler built for the suite
+var handlerBinary string
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	dir, err := ioutil.TempDir("", "termination-handler-e2e")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	handlerBinary = filepath.Join(dir, "termination-handler")
+	if err := command("go", "build", "-o", handlerBinary, "../..").Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error building the handler: %v\n", err)
+		return 1
+	}
+
+	if *kubeconfig == "" {
+		*kubeconfig = filepath.Join(dir, "kubeconfig")
+		if err := command("kind", "create", "cluster", "--name", clusterName, "--kubeconfig", *kubeconfig, "--wait", "2m").Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "error creating the kind cluster: %v\n", err)
+			return 1
+		}
+		defer func() {
+			if err := command("kind", "delete", "cluster", "--name", clusterName).Run(); err != nil {
+				fmt.Fprintf(os.Stderr, "error deleting the kind cluster: %v\n", err)
+			}
+		}()
+	}
+	return m.Run()
+}
+
+// command returns a command writing its output to that of the test
+func command(name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// cluster holds the clients of the cluster and the node the handler runs for
+type cluster struct {
+	clientset kubernetes.Interface
+	dynamic   dynamic.Interface
+	node      string
+}
+
+func newCluster(t *testing.T) *cluster {
+	cfg, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		t.Fatalf("error loading kubeconfig: %v", err)
+	}
+	c := &cluster{}
+	if c.clientset, err = kubernetes.NewForConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if c.dynamic, err = dynamic.NewForConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	nodes, err := c.clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil || len(nodes.Items) == 0 {
+		t.Fatalf("error listing nodes: %v", err)
+	}
+	c.node = nodes.Items[len(nodes.Items)-1].Name
+
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}}
+	if _, err := c.clientset.CoreV1().Namespaces().Create(context.TODO(), namespace, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.resetNode(t))
+	return c
+}
+
+// resetNode returns a function restoring the node once interrupted, so the tests can run in
+// any order
+func (c *cluster) resetNode(t *testing.T) func() {
+	return func() {
+		ctx := context.TODO()
+		node, err := c.clientset.CoreV1().Nodes().Get(ctx, c.node, metav1.GetOptions{})
+		if err != nil {
+			t.Errorf("error fetching node: %v", err)
+			return
+		}
+		var kept []corev1.NodeCondition
+		for _, condition := range node.Status.Conditions {
+			if condition.Type != conditionType {
+				kept = append(kept, condition)
+			}
+		}
+		node.Status.Conditions = kept
+		if node, err = c.clientset.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{}); err != nil {
+			t.Errorf("error removing the terminating condition: %v", err)
+			return
+		}
+		patch := []byte(`{"spec":{"unschedulable":false},"metadata":{"annotations":{"termination-handler/notice":null,"termination-handler/handled-event":null}}}`)
+		if _, err := c.clientset.CoreV1().Nodes().Patch(ctx, c.node, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			t.Errorf("error uncordoning node: %v", err)
+		}
+	}
+}
+
+// startHandler runs the handler for the node with args until the test ends, polling a fake
+// metadata service that reports no notice until its phase is switched
+func (c *cluster) startHandler(t *testing.T, args ...string) *fakeimds.Server {
+	imds := fakeimds.New(nil, fakeimds.Options{NoticePeriod: 2 * time.Minute})
+	server := httptest.NewServer(imds)
+	t.Cleanup(server.Close)
+
+	args = append([]string{
+		"--kubeconfig", *kubeconfig,
+		"--node-name", c.node,
+		"--cloud-provider", "aws",
+		"--aws-metadata-url", server.URL,
+		"--poll-interval", "1s",
+		"--metrics-bind-address", "0",
+	}, args...)
+	cmd := command(handlerBinary, args...)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("error starting the handler: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Signal(os.Interrupt)
+		cmd.Wait()
+	})
+	return imds
+}
+
+// waitForNode waits until the node satisfies done
+func (c *cluster) waitForNode(t *testing.T, what string, done func(*corev1.Node) bool) *corev1.Node {
+	t.Helper()
+	var node *corev1.Node
+	err := wait.PollImmediate(time.Second, timeout, func() (bool, error) {
+		var err error
+		node, err = c.clientset.CoreV1().Nodes().Get(context.TODO(), c.node, metav1.GetOptions{})
+		return err == nil && done(node), nil
+	})
+	if err != nil {
+		t.Fatalf("timed out waiting for %s: %+v", what, node)
+	}
+	return node
+}
+
+// terminating returns whether the node has the terminating condition set by the handler
+func terminating(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == conditionType {
+			return condition.Status == corev1.ConditionTrue && condition.Reason == conditionReason
+		}
+	}
+	return false
+}
+
+// cordoned returns whether the node is unschedulable and tainted by the control plane
+func cordoned(node *corev1.Node) bool {
+	if !node.Spec.Unschedulable {
+		return false
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == corev1.TaintNodeUnschedulable {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMarkOnly(t *testing.T) {
+	c := newCluster(t)
+	imds := c.startHandler(t, "--mode", "mark-only")
+
+	// No action without a notice
+	time.Sleep(5 * time.Second)
+	node, err := c.clientset.CoreV1().Nodes().Get(context.TODO(), c.node, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if terminating(node) || node.Spec.Unschedulable {
+		t.Fatalf("node acted on without a notice: %+v", node)
+	}
+
+	imds.SetPhase(fakeimds.PhaseTerminating)
+	node = c.waitForNode(t, "the terminating condition", terminating)
+	if node.Annotations["termination-handler/notice"] == "" {
+		t.Error("notice annotation missing")
+	}
+	if node.Spec.Unschedulable {
+		t.Error("node cordoned in mark-only mode")
+	}
+}
+
+func TestFullDrain(t *testing.T) {
+	c := newCluster(t)
+	pod := c.createPod(t)
+	imds := c.startHandler(t, "--mode", "full", "--feature-gates", "NodeDrain=true", "--drain-timeout", "60s")
+
+	imds.SetPhase(fakeimds.PhaseTerminating)
+	c.waitForNode(t, "the terminating condition", terminating)
+	c.waitForNode(t, "the cordon", cordoned)
+
+	err := wait.PollImmediate(time.Second, timeout, func() (bool, error) {
+		_, err := c.clientset.CoreV1().Pods(testNamespace).Get(context.TODO(), pod.Name, metav1.GetOptions{})
+		return apierrors.IsNotFound(err), nil
+	})
+	if err != nil {
+		t.Errorf("pod %s not evicted", pod.Name)
+	}
+}
+
+func TestMachineEvent(t *testing.T) {
+	c := newCluster(t)
+	c.createMachine(t)
+	imds := c.startHandler(t, "--mode", "mark-only", "--namespace", testNamespace)
+
+	imds.SetPhase(fakeimds.PhaseTerminating)
+	c.waitForNode(t, "the terminating condition", terminating)
+
+	err := wait.PollImmediate(time.Second, timeout, func() (bool, error) {
+		events, err := c.clientset.CoreV1().Events(testNamespace).List(context.TODO(), metav1.ListOptions{
+			FieldSelector: "involvedObject.kind=Machine,reason=" + conditionReason,
+		})
+		return err == nil && len(events.Items) > 0, nil
+	})
+	if err != nil {
+		t.Error("no termination event recorded for the Machine of the node")
+	}
+}
+
+// createPod creates a pod bound to the node, deleted when the test ends
+func (c *cluster) createPod(t *testing.T) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "drained-", Namespace: testNamespace},
+		Spec: corev1.PodSpec{
+			NodeName:    c.node,
+			Containers:  []corev1.Container{{Name: "pause", Image: *pauseImage}},
+			Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}},
+		},
+	}
+	pod, err := c.clientset.CoreV1().Pods(testNamespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("error creating pod: %v", err)
+	}
+	t.Cleanup(func() {
+		c.clientset.CoreV1().Pods(testNamespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{})
+	})
+	return pod
+}
+
+// createMachine installs a minimal Machine CRD of the OpenShift Machine API and creates a
+// Machine whose nodeRef is the node
+func (c *cluster) createMachine(t *testing.T) {
+	ctx := context.TODO()
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": "machines.machine.openshift.io"},
+		"spec": map[string]interface{}{
+			"group": machineResource.Group,
+			"names": map[string]interface{}{"kind": "Machine", "listKind": "MachineList", "plural": "machines", "singular": "machine"},
+			"scope": "Namespaced",
+			"versions": []interface{}{map[string]interface{}{
+				"name": machineResource.Version, "served": true, "storage": true,
+				"schema": map[string]interface{}{"openAPIV3Schema": map[string]interface{}{
+					"type": "object", "x-kubernetes-preserve-unknown-fields": true,
+				}},
+			}},
+		},
+	}}
+	if _, err := c.dynamic.Resource(crdResource).Create(ctx, crd, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		t.Fatalf("error creating the Machine CRD: %v", err)
+	}
+
+	machine := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": machineResource.GroupVersion().String(),
+		"kind":       "Machine",
+		"metadata":   map[string]interface{}{"name": c.node, "namespace": testNamespace},
+		"status": map[string]interface{}{
+			"nodeRef": map[string]interface{}{"kind": "Node", "name": c.node},
+		},
+	}}
+	// The CRD is served once established
+	err := wait.PollImmediate(time.Second, timeout, func() (bool, error) {
+		_, err := c.dynamic.Resource(machineResource).Namespace(testNamespace).Create(ctx, machine, metav1.CreateOptions{})
+		return err == nil || apierrors.IsAlreadyExists(err), nil
+	})
+	if err != nil {
+		t.Fatalf("error creating the Machine of the node: %v", err)
+	}
+	t.Cleanup(func() {
+		c.dynamic.Resource(machineResource).Namespace(testNamespace).Delete(ctx, c.node, metav1.DeleteOptions{})
+	})
+}
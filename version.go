@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/alexander-demichev/termination-handler/pkg/version"
+	"github.com/spf13/cobra"
+)
+
+// newVersionCommand constructs the command printing the build information
+func newVersionCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the version and exit",
+		Args:  cobra.NoArgs,
+		// The environment overrides of the root command are not needed to print the version
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println(version.String())
+		},
+	}
+}